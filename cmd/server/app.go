@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/config"
+	"github.com/pawelpaszki/gorts-demo/internal/handler"
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+	"github.com/pawelpaszki/gorts-demo/internal/search"
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+// app holds the wired application components.
+type app struct {
+	cfg     *config.Config
+	health  *handler.HealthHandler
+	handler http.Handler
+	closers []io.Closer
+}
+
+// newApp builds the full dependency graph from the given configuration.
+func newApp(cfg *config.Config) (*app, error) {
+	// Create repositories
+	store, err := newStorage(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the suggester in step with every write, and a search index too
+	// when search is enabled
+	books, authors, lists, relations := store.books, store.authors, store.lists, store.relations
+	var index *search.Index
+	if cfg.Features.EnableSearch {
+		index = search.NewIndex()
+		books = search.IndexBooks(books, index)
+		authors = search.IndexAuthors(authors, index)
+		if cfg.Features.EnableReadingLists {
+			lists = search.IndexReadingLists(lists, index)
+		}
+		relations = search.IndexRelations(relations, index)
+	}
+	suggester := search.NewSuggester()
+	books = search.SuggestBooks(books, suggester)
+	authors = search.SuggestAuthors(authors, suggester)
+	lists = search.SuggestReadingLists(lists, suggester)
+	relations = search.SuggestRelations(relations, suggester)
+
+	// Create services
+	importMode := cfg.Features.EnableImportMode
+	bookService := service.NewBookService(books, authors, lists, relations, service.Options{
+		ImportMode: importMode,
+		OnDelete:   service.DeletePolicy(cfg.Delete.Book),
+	})
+	authorService := service.NewAuthorService(authors, bookService, service.Options{
+		ImportMode: importMode,
+		OnDelete:   service.DeletePolicy(cfg.Delete.Author),
+	})
+	listService := service.NewReadingListService(lists, books, authors, service.Options{ImportMode: importMode})
+
+	// Create handlers
+	healthHandler := handler.NewHealthHandler(version)
+	if store.db != nil {
+		healthHandler.RegisterChecker("database", store.db.Ping)
+	}
+
+	api := http.NewServeMux()
+	handler.NewBookHandler(bookService).RegisterRoutes(api)
+	handler.NewAuthorHandler(authorService).RegisterRoutes(api)
+	if cfg.Features.EnableReadingLists {
+		handler.NewReadingListHandler(listService).RegisterRoutes(api)
+	}
+	if index != nil {
+		handler.NewSearchHandler(service.NewSearchService(index, authors)).RegisterRoutes(api)
+	}
+	handler.NewSuggestHandler(service.NewSuggestService(suggester)).RegisterRoutes(api)
+
+	// Protect API routes; health and root stay public for probes
+	var apiHandler http.Handler = api
+	var authHandler *handler.AuthHandler
+	var oidc *middleware.OIDC
+	closers := store.closers()
+	if cfg.Auth.Enabled {
+		users, err := newUserStore(cfg.Auth)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		if c, ok := users.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+		tokens, err := newTokenManager(cfg.Auth)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		keys, err := middleware.NewAPIKeyStore(cfg.Auth.APIKeysFile)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		closers = append(closers, keys)
+		fallback := middleware.BasicOrBearerAuth(users, tokens, cfg.Auth.Realm)
+		if cfg.Auth.OIDC.Issuer != "" {
+			oidc = newOIDC(cfg.Auth.OIDC, tokens)
+			fallback = middleware.SessionAuth(users, tokens, cfg.Auth.Realm, fallback)
+		}
+		apiHandler = middleware.WithAPIKeys(users, keys, cfg.Auth.Realm, fallback)(apiHandler)
+		authHandler = handler.NewAuthHandler(users, tokens)
+		handler.NewAPIKeyHandler(keys).RegisterRoutes(api)
+
+		// Accounts can only be managed when they are persisted
+		if fileUsers, ok := users.(*middleware.FileUserStore); ok {
+			handler.NewUserHandler(fileUsers, tokens, keys).RegisterRoutes(api)
+		}
+	}
+
+	mux := http.NewServeMux()
+	healthHandler.RegisterRoutes(mux)
+	if authHandler != nil {
+		authHandler.RegisterRoutes(mux)
+	}
+	if oidc != nil {
+		mux.HandleFunc("/auth/login", oidc.Login)
+		mux.HandleFunc("/auth/callback", oidc.Callback)
+		mux.HandleFunc("/auth/logout", oidc.Logout)
+	}
+	mux.Handle("/api/", apiHandler)
+	mux.HandleFunc("/", handleRoot)
+
+	// Wrap with middleware
+	var h http.Handler = mux
+	h = middleware.Logging(h)
+	h = middleware.RequestID(h)
+
+	return &app{
+		cfg:     cfg,
+		health:  healthHandler,
+		handler: h,
+		closers: closers,
+	}, nil
+}
+
+// run serves HTTP on ln until ctx is cancelled, then drains and shuts down.
+//
+// On cancellation the readiness probe is flipped to 503 and the server keeps
+// serving for the configured drain period so load balancers can stop routing
+// to it. In-flight requests then get up to ShutdownTimeout to complete before
+// the repositories are closed.
+func (a *app) run(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:      a.handler,
+		ReadTimeout:  a.cfg.Server.ReadTimeout,
+		WriteTimeout: a.cfg.Server.WriteTimeout,
+		IdleTimeout:  a.cfg.Server.IdleTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		a.close()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutdown requested, draining for %s", a.cfg.Server.DrainPeriod)
+	a.health.SetReady(false)
+	time.Sleep(a.cfg.Server.DrainPeriod)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	if closeErr := a.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// close releases all resources held by the application.
+func (a *app) close() error {
+	return closeAll(a.closers)
+}
+
+// closeAll closes each of closers, the last opened first, and joins their
+// errors.
+func closeAll(closers []io.Closer) error {
+	var errs []error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newUserStore creates the user store: the users file if one is configured,
+// plus the configured admin account if it is missing from it. With OIDC
+// login, there need not be any local accounts.
+func newUserStore(cfg config.AuthConfig) (middleware.UserStore, error) {
+	if cfg.UsersFile == "" {
+		store := middleware.NewInMemoryUserStore()
+		if cfg.AdminPassword != "" {
+			store.AddUser(cfg.AdminUser, cfg.AdminPassword, "admin")
+		} else if cfg.OIDC.Issuer == "" {
+			return nil, errors.New("AUTH_ADMIN_PASSWORD, AUTH_USERS_FILE or AUTH_OIDC_ISSUER is required when auth is enabled")
+		}
+		return store, nil
+	}
+
+	store, err := middleware.NewFileUserStore(cfg.UsersFile, middleware.HashParams{
+		Algorithm:     cfg.PasswordHash,
+		BcryptCost:    cfg.BcryptCost,
+		Argon2Time:    uint32(cfg.Argon2Time),
+		Argon2Memory:  uint32(cfg.Argon2Memory),
+		Argon2Threads: uint8(cfg.Argon2Threads),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AdminPassword != "" && !store.HasUser(cfg.AdminUser) {
+		if err := store.AddUser(cfg.AdminUser, cfg.AdminPassword, "admin"); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// newTokenManager creates the bearer token manager, generating a signing
+// secret if none is configured.
+func newTokenManager(cfg config.AuthConfig) (*middleware.TokenManager, error) {
+	secret := []byte(cfg.TokenSecret)
+	if len(secret) == 0 {
+		log.Printf("AUTH_TOKEN_SECRET is not set; bearer tokens will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.TokenStateFile == "" {
+		return middleware.NewTokenManager(secret, cfg.TokenExpiry), nil
+	}
+	return middleware.LoadTokenManager(secret, cfg.TokenExpiry, cfg.TokenStateFile)
+}
+
+// newOIDC creates the OpenID Connect relying party, whose sessions are
+// bearer tokens from tokens.
+func newOIDC(cfg config.OIDCConfig, tokens *middleware.TokenManager) *middleware.OIDC {
+	return middleware.NewOIDC(middleware.OIDCConfig{
+		Issuer:        cfg.Issuer,
+		ClientID:      cfg.ClientID,
+		ClientSecret:  cfg.ClientSecret,
+		RedirectURL:   cfg.RedirectURL,
+		Scopes:        cfg.Scopes,
+		UsernameClaim: cfg.UsernameClaim,
+		RoleClaim:     cfg.RoleClaim,
+		DefaultRole:   cfg.DefaultRole,
+	}, tokens)
+}
+
+// handleRoot serves the API banner.
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte("Bookshelf API v" + version))
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/config"
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+	"github.com/pawelpaszki/gorts-demo/internal/middleware/oidctest"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: 8080},
+		Database: config.DatabaseConfig{
+			Driver:   "memory",
+			MaxConns: 1,
+		},
+		Auth: config.AuthConfig{
+			Realm:         "test",
+			TokenExpiry:   time.Hour,
+			AdminUser:     "admin",
+			AdminPassword: "secret",
+		},
+		Features: config.FeatureFlags{
+			EnableReadingLists: true,
+		},
+	}
+}
+
+func serve(t *testing.T, a *app, method, path, auth string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// createBook creates a book through the API and returns its Location.
+func createBook(t *testing.T, a *app) string {
+	t.Helper()
+	authorID := strings.TrimPrefix(create(t, a, "/api/authors", `{"name":"Frank Herbert"}`), "/api/authors/")
+	return create(t, a, "/api/books", `{"title":"Dune","isbn":"978-0441013593","author_id":"`+authorID+`"}`)
+}
+
+// create POSTs body to a collection and returns the new record's Location.
+func create(t *testing.T, a *app, path, body string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST %s = %d, want %d: %s", path, rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, path+"/") {
+		t.Fatalf("Location = %q, want %s/{id}", location, path)
+	}
+	return location
+}
+
+func TestNewApp_Routes(t *testing.T) {
+	a, err := newApp(testConfig())
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/", http.StatusOK},
+		{"/unknown", http.StatusNotFound},
+		{"/health/ready", http.StatusOK},
+		{"/api/books", http.StatusOK},
+		{"/api/authors", http.StatusOK},
+		{"/api/lists", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := serve(t, a, http.MethodGet, tt.path, ""); got != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewApp_NestedRoutes(t *testing.T) {
+	a, err := newApp(testConfig())
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	book := createBook(t, a)
+	bookID := strings.TrimPrefix(book, "/api/books/")
+	list := create(t, a, "/api/lists", `{"name":"Favourites","book_ids":["`+bookID+`"]}`)
+
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, book, nil))
+	var authorID struct {
+		ID string `json:"author_id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&authorID)
+
+	tests := []struct {
+		path string
+		want int
+		id   string
+	}{
+		{"/api/authors/" + authorID.ID + "/books", http.StatusOK, bookID},
+		{book + "/lists", http.StatusOK, strings.TrimPrefix(list, "/api/lists/")},
+		{list + "/books", http.StatusOK, bookID},
+		{"/api/authors/missing/books", http.StatusNotFound, ""},
+		{"/api/books/missing/lists", http.StatusNotFound, ""},
+		{"/api/lists/missing/books", http.StatusNotFound, ""},
+		{list + "/books?sort=title", http.StatusBadRequest, ""},
+		{book + "/authors", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+			continue
+		}
+		if tt.id == "" {
+			continue
+		}
+		var items []struct {
+			ID string `json:"id"`
+		}
+		json.NewDecoder(rec.Body).Decode(&items)
+		if len(items) != 1 || items[0].ID != tt.id || rec.Header().Get("X-Total-Count") != "1" {
+			t.Errorf("GET %s = %+v, want [%s]", tt.path, items, tt.id)
+		}
+	}
+}
+
+func TestNewApp_SQLite(t *testing.T) {
+	cfg := testConfig()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.DSN = filepath.Join(t.TempDir(), "bookshelf.db")
+	cfg.Database.AutoMigrate = true
+
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	defer a.close()
+
+	location := createBook(t, a)
+	if got := serve(t, a, http.MethodGet, location, ""); got != http.StatusOK {
+		t.Errorf("GET %s = %d, want %d", location, got, http.StatusOK)
+	}
+	if got := serve(t, a, http.MethodGet, "/health", ""); got != http.StatusOK {
+		t.Errorf("GET /health = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestNewApp_FileDriverPersists(t *testing.T) {
+	cfg := testConfig()
+	cfg.Database.Driver = "file"
+	cfg.Database.DSN = t.TempDir()
+
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	location := createBook(t, a)
+	if err := a.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	a, err = newApp(cfg)
+	if err != nil {
+		t.Fatalf("Reopening app failed: %v", err)
+	}
+	defer a.close()
+
+	if got := serve(t, a, http.MethodGet, location, ""); got != http.StatusOK {
+		t.Errorf("GET %s after restart = %d, want %d", location, got, http.StatusOK)
+	}
+}
+
+func TestNewApp_ImportMode(t *testing.T) {
+	body := `{"id":"book-1","title":"Dune","isbn":"978-0441013593","author_id":"author-1"}`
+	post := func(a *app) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/books", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		a.handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	a, err := newApp(testConfig())
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	if got := post(a); got != http.StatusBadRequest {
+		t.Errorf("POST with client ID = %d, want %d", got, http.StatusBadRequest)
+	}
+
+	cfg := testConfig()
+	cfg.Features.EnableImportMode = true
+	a, err = newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	create(t, a, "/api/authors", `{"id":"author-1","name":"Frank Herbert"}`)
+	if got := post(a); got != http.StatusCreated {
+		t.Errorf("POST with client ID in import mode = %d, want %d", got, http.StatusCreated)
+	}
+	if got := post(a); got != http.StatusConflict {
+		t.Errorf("POST with duplicate client ID = %d, want %d", got, http.StatusConflict)
+	}
+}
+
+func TestNewApp_UnsupportedDriver(t *testing.T) {
+	cfg := testConfig()
+	cfg.Database.Driver = "oracle"
+
+	if _, err := newApp(cfg); err == nil {
+		t.Error("Expected error for unsupported database driver")
+	}
+}
+
+func TestNewApp_ReadingListsDisabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.Features.EnableReadingLists = false
+
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	if got := serve(t, a, http.MethodGet, "/api/lists", ""); got != http.StatusNotFound {
+		t.Errorf("GET /api/lists = %d, want %d", got, http.StatusNotFound)
+	}
+}
+
+func TestNewApp_Search(t *testing.T) {
+	a, err := newApp(testConfig())
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	if got := serve(t, a, http.MethodGet, "/api/search?q=dune", ""); got != http.StatusNotFound {
+		t.Errorf("GET /api/search without FEATURE_SEARCH = %d, want %d", got, http.StatusNotFound)
+	}
+	location := createBook(t, a)
+	id := strings.TrimPrefix(location, "/api/books/")
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/suggest?q=dnu", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"`+id+`"`) {
+		t.Errorf("GET /api/suggest without FEATURE_SEARCH = %d %s, want the new book", rec.Code, rec.Body)
+	}
+
+	cfg := testConfig()
+	cfg.Features.EnableSearch = true
+	a, err = newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	location = createBook(t, a)
+
+	rec = httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=dun", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/search = %d, want %d", rec.Code, http.StatusOK)
+	}
+	id = strings.TrimPrefix(location, "/api/books/")
+	if !strings.Contains(rec.Body.String(), `"id":"`+id+`"`) {
+		t.Errorf("Search did not find the new book: %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/suggest?q=dnu", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"`+id+`"`) {
+		t.Errorf("GET /api/suggest = %d %s, want the new book", rec.Code, rec.Body)
+	}
+}
+
+func TestNewApp_AuthEnabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.Enabled = true
+
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	if got := serve(t, a, http.MethodGet, "/api/books", ""); got != http.StatusUnauthorized {
+		t.Errorf("GET /api/books without auth = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := serve(t, a, http.MethodGet, "/api/books", middleware.EncodeBasicAuth("admin", "secret")); got != http.StatusOK {
+		t.Errorf("GET /api/books with auth = %d, want %d", got, http.StatusOK)
+	}
+	if got := serve(t, a, http.MethodGet, "/health/live", ""); got != http.StatusOK {
+		t.Errorf("GET /health/live = %d, want %d", got, http.StatusOK)
+	}
+	// Without a users file there are no accounts to manage
+	if got := serve(t, a, http.MethodGet, "/api/users", middleware.EncodeBasicAuth("admin", "secret")); got != http.StatusNotFound {
+		t.Errorf("GET /api/users without a users file = %d, want %d", got, http.StatusNotFound)
+	}
+}
+
+func TestNewApp_BearerTokens(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.Enabled = true
+	cfg.Auth.TokenSecret = "test-secret"
+	cfg.Auth.TokenStateFile = filepath.Join(t.TempDir(), "tokens.json")
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	// post sends an authenticated POST and returns the issued token, if any
+	post := func(path, auth string, want int) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		a.handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("POST %s = %d, want %d", path, rec.Code, want)
+		}
+		var body struct {
+			AccessToken string `json:"access_token"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body)
+		return body.AccessToken
+	}
+
+	post("/api/auth/token", middleware.EncodeBasicAuth("admin", "wrong"), http.StatusUnauthorized)
+	token := post("/api/auth/token", middleware.EncodeBasicAuth("admin", "secret"), http.StatusOK)
+	if got := serve(t, a, http.MethodGet, "/api/books", "Bearer "+token); got != http.StatusOK {
+		t.Errorf("GET /api/books with token = %d, want %d", got, http.StatusOK)
+	}
+
+	refreshed := post("/api/auth/refresh", "Bearer "+token, http.StatusOK)
+	if got := serve(t, a, http.MethodGet, "/api/books", "Bearer "+token); got != http.StatusUnauthorized {
+		t.Errorf("GET /api/books with refreshed-away token = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	post("/api/auth/revoke", "Bearer "+refreshed, http.StatusNoContent)
+	if got := serve(t, a, http.MethodGet, "/api/books", "Bearer "+refreshed); got != http.StatusUnauthorized {
+		t.Errorf("GET /api/books with revoked token = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := serve(t, a, http.MethodGet, "/api/auth/token", ""); got != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/auth/token = %d, want %d", got, http.StatusMethodNotAllowed)
+	}
+
+	// Revocations survive a restart
+	restarted, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	if got := serve(t, restarted, http.MethodGet, "/api/books", "Bearer "+refreshed); got != http.StatusUnauthorized {
+		t.Errorf("GET /api/books with revoked token after restart = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestNewApp_UsersFile(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.Enabled = true
+	cfg.Auth.UsersFile = filepath.Join(t.TempDir(), "users")
+	cfg.Auth.PasswordHash = "bcrypt"
+	cfg.Auth.BcryptCost = 4
+
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	if got := serve(t, a, http.MethodGet, "/api/books", middleware.EncodeBasicAuth("admin", "secret")); got != http.StatusOK {
+		t.Errorf("GET /api/books as admin = %d, want %d", got, http.StatusOK)
+	}
+	if got := serve(t, a, http.MethodGet, "/api/users", middleware.EncodeBasicAuth("admin", "secret")); got != http.StatusOK {
+		t.Errorf("GET /api/users as admin = %d, want %d", got, http.StatusOK)
+	}
+
+	// The admin account was saved to the file, hashed
+	data, err := os.ReadFile(cfg.Auth.UsersFile)
+	if err != nil || !strings.HasPrefix(string(data), "admin:$2a$04$") || strings.Contains(string(data), "secret") {
+		t.Errorf("Users file = %q (%v)", data, err)
+	}
+
+	cfg.Auth.PasswordHash = "scrypt"
+	if _, err := newApp(cfg); err == nil {
+		t.Error("Expected error for an unknown password hash")
+	}
+}
+
+func TestNewApp_APIKeys(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.Enabled = true
+	cfg.Auth.APIKeysFile = filepath.Join(t.TempDir(), "keys.json")
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(`{"name":"ci","scopes":["books:read"]}`))
+	req.Header.Set("Authorization", middleware.EncodeBasicAuth("admin", "secret"))
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/keys = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	// Keys survive a restart, and only grant their scopes
+	if a, err = newApp(cfg); err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+	if got := serve(t, a, http.MethodGet, "/api/books", "Bearer "+created.Key); got != http.StatusOK {
+		t.Errorf("GET /api/books with key = %d, want %d", got, http.StatusOK)
+	}
+	if got := serve(t, a, http.MethodGet, "/api/authors", "Bearer "+created.Key); got != http.StatusForbidden {
+		t.Errorf("GET /api/authors with key = %d, want %d", got, http.StatusForbidden)
+	}
+
+	// Closing the app closes the key store
+	if err := a.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(`{"name":"late","scopes":["books:read"]}`))
+	req.Header.Set("Authorization", middleware.EncodeBasicAuth("admin", "secret"))
+	rec = httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	if rec.Code == http.StatusCreated {
+		t.Error("POST /api/keys after close should fail")
+	}
+}
+
+func TestNewApp_OIDC(t *testing.T) {
+	provider, err := oidctest.NewProvider("bookshelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+	provider.SetClaims(map[string]any{"sub": "1234", "preferred_username": "alice", "role": "admin"})
+
+	cfg := testConfig()
+	cfg.Auth.Enabled = true
+	cfg.Auth.AdminPassword = ""
+	cfg.Auth.OIDC = config.OIDCConfig{
+		Issuer:        provider.Issuer(),
+		ClientID:      "bookshelf",
+		RedirectURL:   "http://bookshelf.test/auth/callback",
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "role",
+		DefaultRole:   "user",
+	}
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	// get serves a GET with cookies, and returns the response
+	get := func(target string, cookies []*http.Cookie) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		a.handler.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	login := get("/auth/login?return_to=/api/books", nil)
+	if login.StatusCode != http.StatusFound {
+		t.Fatalf("GET /auth/login = %d, want %d", login.StatusCode, http.StatusFound)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	authorized, err := client.Get(login.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	authorized.Body.Close()
+
+	callback := get(authorized.Header.Get("Location"), login.Cookies())
+	if callback.StatusCode != http.StatusFound || callback.Header.Get("Location") != "/api/books" {
+		t.Fatalf("GET /auth/callback = %d, Location %q", callback.StatusCode, callback.Header.Get("Location"))
+	}
+	if got := get("/api/books", callback.Cookies()).StatusCode; got != http.StatusOK {
+		t.Errorf("GET /api/books with session = %d, want %d", got, http.StatusOK)
+	}
+	if got := get("/api/keys", callback.Cookies()).StatusCode; got != http.StatusForbidden {
+		t.Errorf("GET /api/keys with session = %d, want %d", got, http.StatusForbidden)
+	}
+	if got := get("/api/books", nil).StatusCode; got != http.StatusUnauthorized {
+		t.Errorf("GET /api/books without session = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestNewApp_AuthRequiresPassword(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.Enabled = true
+	cfg.Auth.AdminPassword = ""
+
+	if _, err := newApp(cfg); err == nil {
+		t.Error("Expected error when auth is enabled without an admin password")
+	}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func TestApp_Run_GracefulShutdown(t *testing.T) {
+	cfg := testConfig()
+	cfg.Server.DrainPeriod = 200 * time.Millisecond
+	cfg.Server.ShutdownTimeout = time.Second
+
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatalf("newApp failed: %v", err)
+	}
+
+	var closed atomic.Bool
+	a.closers = append(a.closers, closerFunc(func() error {
+		closed.Store(true)
+		return nil
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	baseURL := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- a.run(ctx, ln)
+	}()
+
+	resp, err := http.Get(baseURL + "/health/ready")
+	if err != nil {
+		t.Fatalf("GET /health/ready failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Ready before shutdown = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+
+	// During the drain period the server still answers, but reports not ready
+	deadline := time.Now().Add(cfg.Server.DrainPeriod)
+	for {
+		resp, err = http.Get(baseURL + "/health/ready")
+		if err != nil {
+			t.Fatalf("GET /health/ready during drain failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Ready during drain = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Shutdown waits for connections that have not sent a request yet,
+	// which the client may have dialled while reusing another
+	http.DefaultClient.CloseIdleConnections()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after shutdown")
+	}
+
+	if !closed.Load() {
+		t.Error("Expected repositories to be closed on shutdown")
+	}
+}
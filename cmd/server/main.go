@@ -1,26 +1,48 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
-	"net/http"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pawelpaszki/gorts-demo/internal/config"
 )
 
+// version is the API version reported by the root and health endpoints.
+const version = "0.3.0"
+
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg.Database, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	app, err := newApp(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", cfg.Address())
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", cfg.Address(), err)
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "Bookshelf API v0.2.0")
-	})
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	addr := ":" + port
-	log.Printf("Starting server on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	log.Printf("Starting server on %s", ln.Addr())
+	if err := app.run(ctx, ln); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
+	log.Printf("Server stopped")
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/pawelpaszki/gorts-demo/internal/config"
+	"github.com/pawelpaszki/gorts-demo/internal/migrate"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(cfg config.DatabaseConfig, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if cfg.Driver == "memory" || cfg.Driver == "file" {
+		return fmt.Errorf("the %s driver has no schema to migrate", cfg.Driver)
+	}
+
+	db, err := repository.OpenDB(cfg.Driver, cfg.DSN, cfg.MaxConns, cfg.MaxIdle)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db.DB, db.Driver())
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Applied %d migration(s)\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		n, err := m.Down(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Rolled back %d migration(s)\n", n)
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d  %-30s  %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
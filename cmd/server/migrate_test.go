@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/config"
+)
+
+func testDatabaseConfig(t *testing.T) config.DatabaseConfig {
+	return config.DatabaseConfig{
+		Driver:   "sqlite",
+		DSN:      filepath.Join(t.TempDir(), "bookshelf.db"),
+		MaxConns: 1,
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	cfg := testDatabaseConfig(t)
+	var out bytes.Buffer
+
+	if err := runMigrate(cfg, []string{"status"}, &out); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "pending") {
+		t.Errorf("Expected pending migrations, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runMigrate(cfg, []string{"up"}, &out); err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	if strings.Contains(out.String(), "Applied 0") {
+		t.Errorf("Expected migrations to be applied, got: %s", out.String())
+	}
+
+	out.Reset()
+	if err := runMigrate(cfg, []string{"status"}, &out); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if strings.Contains(out.String(), "pending") {
+		t.Errorf("Expected no pending migrations, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runMigrate(cfg, []string{"down", "1"}, &out); err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Rolled back 1") {
+		t.Errorf("Expected one rollback, got: %s", out.String())
+	}
+}
+
+func TestRunMigrate_InvalidArgs(t *testing.T) {
+	cfg := testDatabaseConfig(t)
+
+	for _, args := range [][]string{nil, {"sideways"}, {"down", "zero"}} {
+		if err := runMigrate(cfg, args, &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected error for args %v", args)
+		}
+	}
+}
+
+func TestNewStorage_PendingMigrationsWithoutAutoMigrate(t *testing.T) {
+	cfg := testDatabaseConfig(t)
+
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("Expected error when migrations are pending and auto-migrate is off")
+	}
+
+	cfg.AutoMigrate = true
+	store, err := newStorage(cfg)
+	if err != nil {
+		t.Fatalf("newStorage with auto-migrate failed: %v", err)
+	}
+	closeAll(store.closers())
+}
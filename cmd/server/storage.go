@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pawelpaszki/gorts-demo/internal/config"
+	"github.com/pawelpaszki/gorts-demo/internal/migrate"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+// fileSnapshotEvery is how many logged writes the file driver accepts
+// before compacting them into a snapshot.
+const fileSnapshotEvery = 1000
+
+// storage groups the repositories selected by the database configuration.
+type storage struct {
+	books     repository.BookStore
+	authors   repository.AuthorStore
+	lists     repository.ReadingListStore
+	relations repository.RelationStore
+
+	// db is nil unless a SQL driver is configured.
+	db     *repository.DB
+	closer io.Closer
+}
+
+// newStorage creates the repositories for the configured driver.
+// The "memory" driver keeps everything in maps, "file" additionally persists
+// the maps to a log and snapshot in the DSN directory, and any other driver
+// is opened as a SQL database.
+func newStorage(cfg config.DatabaseConfig) (*storage, error) {
+	switch cfg.Driver {
+	case "memory":
+		books, authors, lists := repository.NewRepositories()
+		return &storage{
+			books:     books,
+			authors:   authors,
+			lists:     lists,
+			relations: repository.NewRelationRepository(books, authors, lists),
+		}, nil
+	case "file":
+		fs, err := repository.OpenFileStore(cfg.DSN, repository.FileStoreOptions{
+			SnapshotEvery: fileSnapshotEvery,
+			Sync:          true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &storage{
+			books:     fs.Books(),
+			authors:   fs.Authors(),
+			lists:     fs.ReadingLists(),
+			relations: fs.Relations(),
+			closer:    fs,
+		}, nil
+	}
+
+	db, err := repository.OpenDB(cfg.Driver, cfg.DSN, cfg.MaxConns, cfg.MaxIdle)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareSchema(db, cfg.AutoMigrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &storage{
+		books:     repository.NewSQLBookRepository(db),
+		authors:   repository.NewSQLAuthorRepository(db),
+		lists:     repository.NewSQLReadingListRepository(db),
+		relations: repository.NewSQLRelationRepository(db),
+		db:        db,
+		closer:    db,
+	}, nil
+}
+
+// prepareSchema applies pending migrations, or refuses to start with an
+// outdated schema when automatic migration is disabled.
+func prepareSchema(db *repository.DB, autoMigrate bool) error {
+	m, err := migrate.New(db.DB, db.Driver())
+	if err != nil {
+		return err
+	}
+
+	if autoMigrate {
+		n, err := m.Up()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Applied %d database migration(s)", n)
+		}
+		return nil
+	}
+
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("database has %d pending migration(s); run \"migrate up\"", pending)
+	}
+	return nil
+}
+
+// closers returns the resources that must be released on shutdown.
+func (s *storage) closers() []io.Closer {
+	if s.closer == nil {
+		return nil
+	}
+	return []io.Closer{s.closer}
+}
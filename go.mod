@@ -1,3 +1,13 @@
 module github.com/pawelpaszki/gorts-demo
 
 go 1.22
+
+require (
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
+)
+
+require (
+	golang.org/x/crypto v0.33.0
+	golang.org/x/sys v0.30.0 // indirect
+)
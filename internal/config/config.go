@@ -14,23 +14,27 @@ type Config struct {
 	Database DatabaseConfig
 	Auth     AuthConfig
 	Features FeatureFlags
+	Delete   DeletePolicies
 }
 
 // ServerConfig holds server-related configuration.
 type ServerConfig struct {
-	Host         string
-	Port         int
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
+	Host            string
+	Port            int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	DrainPeriod     time.Duration
+	ShutdownTimeout time.Duration
 }
 
 // DatabaseConfig holds database-related configuration.
 type DatabaseConfig struct {
-	Driver   string
-	DSN      string
-	MaxConns int
-	MaxIdle  int
+	Driver      string
+	DSN         string
+	MaxConns    int
+	MaxIdle     int
+	AutoMigrate bool
 }
 
 // AuthConfig holds authentication configuration.
@@ -38,6 +42,46 @@ type AuthConfig struct {
 	Enabled     bool
 	Realm       string
 	TokenExpiry time.Duration
+	// TokenSecret signs bearer tokens. If empty, a random secret is
+	// generated at startup, so tokens do not survive a restart.
+	TokenSecret string
+	// TokenStateFile keeps token revocations. Without it they are kept in
+	// memory, and revoked tokens become valid again after a restart.
+	TokenStateFile string
+	AdminUser      string
+	AdminPassword  string
+	// UsersFile holds hashed user accounts; see middleware.FileUserStore.
+	// Without it only the admin account exists.
+	UsersFile string
+	// APIKeysFile holds API keys, hashed. Without it keys are kept in
+	// memory and lost on restart.
+	APIKeysFile string
+	// PasswordHash is the algorithm of new password hashes, "bcrypt" or
+	// "argon2id", with its cost parameters below. Hashes made with other
+	// parameters are replaced on login.
+	PasswordHash  string
+	BcryptCost    int
+	Argon2Time    int
+	Argon2Memory  int // KiB
+	Argon2Threads int
+	// OIDC enables login with an OpenID Connect provider when its issuer
+	// is set.
+	OIDC OIDCConfig
+}
+
+// OIDCConfig holds OpenID Connect login configuration.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the public URL of /auth/callback.
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+	// RoleClaim names the ID token claim mapped to the user's role, with
+	// DefaultRole for users without it.
+	RoleClaim   string
+	DefaultRole string
 }
 
 // FeatureFlags holds feature toggle configuration.
@@ -45,33 +89,76 @@ type FeatureFlags struct {
 	EnableReadingLists bool
 	EnableSearch       bool
 	EnableMetrics      bool
+	// EnableImportMode lets clients choose record IDs on create, for
+	// loading existing data. Otherwise IDs are always generated.
+	EnableImportMode bool
+}
+
+// DeletePolicies holds what deleting a record does to the records that
+// reference it: "restrict", "cascade" or "nullify", or "" for the service
+// default. Clients can override them per request.
+type DeletePolicies struct {
+	// Author applies to an author's books.
+	Author string
+	// Book applies to the reading lists containing a book; cascade and
+	// nullify both remove it from them.
+	Book string
 }
 
 // Load reads configuration from environment variables.
 func Load() (*Config, error) {
 	cfg := &Config{
 		Server: ServerConfig{
-			Host:         getEnv("SERVER_HOST", "0.0.0.0"),
-			Port:         getEnvInt("SERVER_PORT", 8080),
-			ReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second),
-			WriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", 15*time.Second),
-			IdleTimeout:  getEnvDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			Host:            getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:            getEnvInt("SERVER_PORT", 8080),
+			ReadTimeout:     getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:    getEnvDuration("SERVER_WRITE_TIMEOUT", 15*time.Second),
+			IdleTimeout:     getEnvDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			DrainPeriod:     getEnvDuration("SERVER_DRAIN_PERIOD", 5*time.Second),
+			ShutdownTimeout: getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", 15*time.Second),
 		},
 		Database: DatabaseConfig{
-			Driver:   getEnv("DB_DRIVER", "sqlite"),
-			DSN:      getEnv("DB_DSN", "bookshelf.db"),
-			MaxConns: getEnvInt("DB_MAX_CONNS", 10),
-			MaxIdle:  getEnvInt("DB_MAX_IDLE", 5),
+			Driver:      getEnv("DB_DRIVER", "sqlite"),
+			DSN:         getEnv("DB_DSN", "bookshelf.db"),
+			MaxConns:    getEnvInt("DB_MAX_CONNS", 10),
+			MaxIdle:     getEnvInt("DB_MAX_IDLE", 5),
+			AutoMigrate: getEnvBool("DB_AUTO_MIGRATE", true),
 		},
 		Auth: AuthConfig{
-			Enabled:     getEnvBool("AUTH_ENABLED", false),
-			Realm:       getEnv("AUTH_REALM", "Bookshelf API"),
-			TokenExpiry: getEnvDuration("AUTH_TOKEN_EXPIRY", 24*time.Hour),
+			Enabled:        getEnvBool("AUTH_ENABLED", false),
+			Realm:          getEnv("AUTH_REALM", "Bookshelf API"),
+			TokenExpiry:    getEnvDuration("AUTH_TOKEN_EXPIRY", 24*time.Hour),
+			TokenSecret:    getEnv("AUTH_TOKEN_SECRET", ""),
+			TokenStateFile: getEnv("AUTH_TOKEN_STATE_FILE", ""),
+			AdminUser:      getEnv("AUTH_ADMIN_USER", "admin"),
+			AdminPassword:  getEnv("AUTH_ADMIN_PASSWORD", ""),
+			UsersFile:      getEnv("AUTH_USERS_FILE", ""),
+			APIKeysFile:    getEnv("AUTH_API_KEYS_FILE", ""),
+			PasswordHash:   getEnv("AUTH_PASSWORD_HASH", "argon2id"),
+			BcryptCost:     getEnvInt("AUTH_BCRYPT_COST", 10),
+			Argon2Time:     getEnvInt("AUTH_ARGON2_TIME", 3),
+			Argon2Memory:   getEnvInt("AUTH_ARGON2_MEMORY", 64*1024),
+			Argon2Threads:  getEnvInt("AUTH_ARGON2_THREADS", 4),
+			OIDC: OIDCConfig{
+				Issuer:        getEnv("AUTH_OIDC_ISSUER", ""),
+				ClientID:      getEnv("AUTH_OIDC_CLIENT_ID", ""),
+				ClientSecret:  getEnv("AUTH_OIDC_CLIENT_SECRET", ""),
+				RedirectURL:   getEnv("AUTH_OIDC_REDIRECT_URL", ""),
+				Scopes:        strings.Fields(getEnv("AUTH_OIDC_SCOPES", "openid profile email")),
+				UsernameClaim: getEnv("AUTH_OIDC_USERNAME_CLAIM", "sub"),
+				RoleClaim:     getEnv("AUTH_OIDC_ROLE_CLAIM", "role"),
+				DefaultRole:   getEnv("AUTH_OIDC_DEFAULT_ROLE", "user"),
+			},
 		},
 		Features: FeatureFlags{
 			EnableReadingLists: getEnvBool("FEATURE_READING_LISTS", true),
 			EnableSearch:       getEnvBool("FEATURE_SEARCH", false),
 			EnableMetrics:      getEnvBool("FEATURE_METRICS", false),
+			EnableImportMode:   getEnvBool("FEATURE_IMPORT_MODE", false),
+		},
+		Delete: DeletePolicies{
+			Author: getEnv("AUTHOR_DELETE_POLICY", "restrict"),
+			Book:   getEnv("BOOK_DELETE_POLICY", "cascade"),
 		},
 	}
 
@@ -87,6 +174,12 @@ func (c *Config) Validate() error {
 	if c.Server.Port < 1 || c.Server.Port > 65535 {
 		return errors.New("invalid server port")
 	}
+	if c.Server.DrainPeriod < 0 {
+		return errors.New("server drain period cannot be negative")
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		return errors.New("server shutdown timeout cannot be negative")
+	}
 	if c.Database.MaxConns < 1 {
 		return errors.New("database max connections must be at least 1")
 	}
@@ -96,9 +189,33 @@ func (c *Config) Validate() error {
 	if c.Database.MaxIdle > c.Database.MaxConns {
 		return errors.New("database max idle cannot exceed max connections")
 	}
+	if c.Auth.Enabled && c.Auth.TokenExpiry <= 0 {
+		return errors.New("auth token expiry must be positive")
+	}
+	if c.Auth.Enabled && c.Auth.PasswordHash != "bcrypt" && c.Auth.PasswordHash != "argon2id" {
+		return errors.New("auth password hash must be bcrypt or argon2id")
+	}
+	if c.Auth.Enabled && c.Auth.OIDC.Issuer != "" && (c.Auth.OIDC.ClientID == "" || c.Auth.OIDC.RedirectURL == "") {
+		return errors.New("OIDC login needs a client ID and redirect URL")
+	}
+	if !isDeletePolicy(c.Delete.Author) {
+		return errors.New("invalid author delete policy")
+	}
+	if !isDeletePolicy(c.Delete.Book) {
+		return errors.New("invalid book delete policy")
+	}
 	return nil
 }
 
+// isDeletePolicy reports whether name is a known delete policy or empty.
+func isDeletePolicy(name string) bool {
+	switch name {
+	case "", "restrict", "cascade", "nullify":
+		return true
+	}
+	return false
+}
+
 // Address returns the server address in host:port format.
 func (c *Config) Address() string {
 	return c.Server.Host + ":" + strconv.Itoa(c.Server.Port)
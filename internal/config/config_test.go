@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -10,9 +11,20 @@ func clearEnv() {
 	envVars := []string{
 		"SERVER_HOST", "SERVER_PORT", "SERVER_READ_TIMEOUT",
 		"SERVER_WRITE_TIMEOUT", "SERVER_IDLE_TIMEOUT",
+		"SERVER_DRAIN_PERIOD", "SERVER_SHUTDOWN_TIMEOUT",
 		"DB_DRIVER", "DB_DSN", "DB_MAX_CONNS", "DB_MAX_IDLE",
-		"AUTH_ENABLED", "AUTH_REALM", "AUTH_TOKEN_EXPIRY",
+		"DB_AUTO_MIGRATE",
+		"AUTH_ENABLED", "AUTH_REALM", "AUTH_TOKEN_EXPIRY", "AUTH_TOKEN_SECRET",
+		"AUTH_TOKEN_STATE_FILE",
+		"AUTH_ADMIN_USER", "AUTH_ADMIN_PASSWORD", "AUTH_USERS_FILE",
+		"AUTH_PASSWORD_HASH", "AUTH_BCRYPT_COST", "AUTH_ARGON2_TIME",
+		"AUTH_ARGON2_MEMORY", "AUTH_ARGON2_THREADS", "AUTH_API_KEYS_FILE",
+		"AUTH_OIDC_ISSUER", "AUTH_OIDC_CLIENT_ID", "AUTH_OIDC_CLIENT_SECRET",
+		"AUTH_OIDC_REDIRECT_URL", "AUTH_OIDC_SCOPES", "AUTH_OIDC_USERNAME_CLAIM",
+		"AUTH_OIDC_ROLE_CLAIM", "AUTH_OIDC_DEFAULT_ROLE",
 		"FEATURE_READING_LISTS", "FEATURE_SEARCH", "FEATURE_METRICS",
+		"FEATURE_IMPORT_MODE",
+		"AUTHOR_DELETE_POLICY", "BOOK_DELETE_POLICY",
 	}
 	for _, v := range envVars {
 		os.Unsetenv(v)
@@ -34,6 +46,12 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.Server.Port != 8080 {
 		t.Errorf("Server.Port = %d, want 8080", cfg.Server.Port)
 	}
+	if cfg.Server.DrainPeriod != 5*time.Second {
+		t.Errorf("Server.DrainPeriod = %v, want 5s", cfg.Server.DrainPeriod)
+	}
+	if cfg.Server.ShutdownTimeout != 15*time.Second {
+		t.Errorf("Server.ShutdownTimeout = %v, want 15s", cfg.Server.ShutdownTimeout)
+	}
 
 	// Database defaults
 	if cfg.Database.Driver != "sqlite" {
@@ -42,16 +60,25 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.Database.MaxConns != 10 {
 		t.Errorf("Database.MaxConns = %d, want 10", cfg.Database.MaxConns)
 	}
+	if !cfg.Database.AutoMigrate {
+		t.Error("Database.AutoMigrate should be true by default")
+	}
 
 	// Auth defaults
 	if cfg.Auth.Enabled != false {
 		t.Error("Auth.Enabled should be false by default")
 	}
+	if cfg.Auth.AdminUser != "admin" {
+		t.Errorf("Auth.AdminUser = %s, want admin", cfg.Auth.AdminUser)
+	}
 
 	// Feature defaults
 	if cfg.Features.EnableReadingLists != true {
 		t.Error("Features.EnableReadingLists should be true by default")
 	}
+	if cfg.Delete.Author != "restrict" || cfg.Delete.Book != "cascade" {
+		t.Errorf("Delete = %+v, want restrict for authors and cascade for books", cfg.Delete)
+	}
 }
 
 func TestLoad_FromEnv(t *testing.T) {
@@ -63,6 +90,7 @@ func TestLoad_FromEnv(t *testing.T) {
 	os.Setenv("DB_DSN", "postgres://localhost/test")
 	os.Setenv("AUTH_ENABLED", "true")
 	os.Setenv("FEATURE_SEARCH", "true")
+	os.Setenv("FEATURE_IMPORT_MODE", "true")
 
 	defer clearEnv()
 
@@ -86,6 +114,9 @@ func TestLoad_FromEnv(t *testing.T) {
 	if cfg.Features.EnableSearch != true {
 		t.Error("Features.EnableSearch should be true")
 	}
+	if cfg.Features.EnableImportMode != true {
+		t.Error("Features.EnableImportMode should be true")
+	}
 }
 
 func TestLoad_Duration(t *testing.T) {
@@ -124,6 +155,21 @@ func TestConfig_Validate_InvalidPort(t *testing.T) {
 	}
 }
 
+func TestConfig_Validate_NegativeDrainPeriod(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080, DrainPeriod: -time.Second},
+		Database: DatabaseConfig{
+			MaxConns: 10,
+			MaxIdle:  5,
+		},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Error("Expected validation error for negative drain period")
+	}
+}
+
 func TestConfig_Validate_InvalidMaxConns(t *testing.T) {
 	cfg := &Config{
 		Server: ServerConfig{Port: 8080},
@@ -154,6 +200,63 @@ func TestConfig_Validate_MaxIdleExceedsMaxConns(t *testing.T) {
 	}
 }
 
+func TestLoad_InvalidDeletePolicy(t *testing.T) {
+	clearEnv()
+	os.Setenv("AUTHOR_DELETE_POLICY", "orphan")
+	defer clearEnv()
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for invalid author delete policy")
+	}
+}
+
+func TestLoad_InvalidTokenExpiry(t *testing.T) {
+	clearEnv()
+	os.Setenv("AUTH_ENABLED", "true")
+	os.Setenv("AUTH_TOKEN_EXPIRY", "-1h")
+	defer clearEnv()
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for non-positive token expiry")
+	}
+}
+
+func TestLoad_InvalidPasswordHash(t *testing.T) {
+	clearEnv()
+	os.Setenv("AUTH_ENABLED", "true")
+	os.Setenv("AUTH_PASSWORD_HASH", "md5")
+	defer clearEnv()
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for unknown password hash algorithm")
+	}
+}
+
+func TestLoad_OIDC(t *testing.T) {
+	clearEnv()
+	os.Setenv("AUTH_ENABLED", "true")
+	os.Setenv("AUTH_OIDC_ISSUER", "https://idp.example.com")
+	defer clearEnv()
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for OIDC without a client ID and redirect URL")
+	}
+
+	os.Setenv("AUTH_OIDC_CLIENT_ID", "bookshelf")
+	os.Setenv("AUTH_OIDC_REDIRECT_URL", "https://bookshelf.example.com/auth/callback")
+	os.Setenv("AUTH_OIDC_SCOPES", "openid  groups")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Auth.OIDC.Scopes, []string{"openid", "groups"}) {
+		t.Errorf("Auth.OIDC.Scopes = %q, want [openid groups]", cfg.Auth.OIDC.Scopes)
+	}
+	if cfg.Auth.OIDC.RoleClaim != "role" || cfg.Auth.OIDC.DefaultRole != "user" {
+		t.Errorf("Auth.OIDC role claim = %q, default %q", cfg.Auth.OIDC.RoleClaim, cfg.Auth.OIDC.DefaultRole)
+	}
+}
+
 func TestConfig_Address(t *testing.T) {
 	cfg := &Config{
 		Server: ServerConfig{
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+)
+
+// APIKeyHandler handles HTTP requests for API keys at /api/keys. Users
+// manage their own keys; admins see and revoke everyone's.
+type APIKeyHandler struct {
+	keys *middleware.APIKeyStore
+}
+
+// NewAPIKeyHandler creates a new API key handler.
+func NewAPIKeyHandler(keys *middleware.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// RegisterRoutes registers API key routes on the given mux. It expects the
+// mux to sit behind an auth middleware.
+func (h *APIKeyHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/keys", h.handleKeys)
+	mux.HandleFunc("/api/keys/", h.handleKey)
+}
+
+// createAPIKeyRequest is the body of POST /api/keys. ExpiresAt is an
+// RFC 3339 time; without it the key does not expire.
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// createAPIKeyResponse is the body of a created key: the only response that
+// includes the key itself.
+type createAPIKeyResponse struct {
+	middleware.APIKey
+	Key string `json:"key"`
+}
+
+// handleKeys handles GET (list) and POST (create) for /api/keys
+func (h *APIKeyHandler) handleKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		owner := user.Username
+		if user.Role == "admin" {
+			owner = ""
+		}
+		respondJSON(w, http.StatusOK, h.keys.List(owner))
+	case http.MethodPost:
+		h.createKey(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleKey handles GET and DELETE (revoke) for /api/keys/{id}
+func (h *APIKeyHandler) handleKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	if id == "" {
+		http.Error(w, "API key ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Other users' keys are not found, rather than forbidden
+	key, err := h.keys.Get(id)
+	if err == nil && key.Owner != user.Username && user.Role != "admin" {
+		err = middleware.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		h.respondKeyError(w, err, "Failed to get API key")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, key)
+	case http.MethodDelete:
+		if err := h.keys.Revoke(id); err != nil {
+			h.respondKeyError(w, err, "Failed to revoke API key")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *APIKeyHandler) createKey(w http.ResponseWriter, r *http.Request, user *middleware.User) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	key, desc, err := h.keys.Create(user.Username, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		h.respondKeyError(w, err, "Failed to create API key")
+		return
+	}
+
+	w.Header().Set("Location", "/api/keys/"+desc.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusCreated, createAPIKeyResponse{APIKey: *desc, Key: key})
+}
+
+// user returns the request's user. Keys can only be managed with a
+// password or bearer token, so that a leaked key cannot mint others, and
+// only by local accounts, which keys are checked against.
+func (h *APIKeyHandler) user(w http.ResponseWriter, r *http.Request) (*middleware.User, bool) {
+	user := middleware.GetUser(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if user.APIKey != "" {
+		respondError(w, http.StatusForbidden, "API keys cannot manage API keys")
+		return nil, false
+	}
+	if user.External {
+		respondError(w, http.StatusForbidden, "Users without a local account cannot manage API keys")
+		return nil, false
+	}
+	return user, true
+}
+
+// respondKeyError maps API key store errors to responses.
+func (h *APIKeyHandler) respondKeyError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, middleware.ErrAPIKeyNotFound) {
+		respondError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if errors.Is(err, middleware.ErrInvalidAPIKey) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondError(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+)
+
+func newTestAPIKeyHandler(t *testing.T) http.Handler {
+	t.Helper()
+	users := middleware.NewInMemoryUserStore()
+	users.AddUser("admin", "admin-password", "admin")
+	users.AddUser("alice", "alice-password", "user")
+	keys, _ := middleware.NewAPIKeyStore("")
+
+	_, mux := newTestHandler()
+	NewAPIKeyHandler(keys).RegisterRoutes(mux)
+	return middleware.WithAPIKeys(users, keys, "test", middleware.BasicAuth(users, "test"))(mux)
+}
+
+func createTestAPIKey(t *testing.T, h http.Handler, auth, body string) createAPIKeyResponse {
+	t.Helper()
+	rec := doUserRequest(h, http.MethodPost, "/api/keys", auth, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Create key: status %d: %s", rec.Code, rec.Body)
+	}
+	var created createAPIKeyResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	return created
+}
+
+func TestAPIKeyHandler_Manage(t *testing.T) {
+	h := newTestAPIKeyHandler(t)
+	admin := middleware.EncodeBasicAuth("admin", "admin-password")
+	alice := middleware.EncodeBasicAuth("alice", "alice-password")
+
+	created := createTestAPIKey(t, h, alice, `{"name":"ci","scopes":["books:read"],"expires_at":"2999-01-01T00:00:00Z"}`)
+	if created.Key == "" || created.Owner != "alice" || created.ExpiresAt == nil {
+		t.Errorf("Created key = %+v", created)
+	}
+
+	for _, tt := range []struct {
+		body string
+		want int
+	}{
+		{`{"name":"ci","scopes":["books:admin"]}`, http.StatusBadRequest},
+		{`{"name":"ci","scopes":[]}`, http.StatusBadRequest},
+		{`{"name":"ci","scopes":["books:read"],"expires_at":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{`{"name":"ci","scopes":["books:read"],"expires_at":"tomorrow"}`, http.StatusBadRequest},
+	} {
+		if rec := doUserRequest(h, http.MethodPost, "/api/keys", alice, tt.body); rec.Code != tt.want {
+			t.Errorf("Create %s: expected status %d, got %d", tt.body, tt.want, rec.Code)
+		}
+	}
+
+	// The key is only shown once
+	rec := doUserRequest(h, http.MethodGet, "/api/keys", alice, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Key) {
+		t.Fatalf("List: status %d: %s", rec.Code, rec.Body)
+	}
+	var listed []middleware.APIKey
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].ID != created.ID {
+		t.Errorf("Listed keys = %+v", listed)
+	}
+
+	// Keys can only be managed by their owner, an admin, and not with a key
+	createTestAPIKey(t, h, admin, `{"name":"admin","scopes":["books:write"]}`)
+	if rec := doUserRequest(h, http.MethodGet, "/api/keys/"+created.ID, admin, ""); rec.Code != http.StatusOK {
+		t.Errorf("Admin get: expected status 200, got %d", rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodGet, "/api/keys", alice, ""); strings.Count(rec.Body.String(), `"id"`) != 1 {
+		t.Errorf("Users should only list their own keys: %s", rec.Body)
+	}
+	key := "Bearer " + created.Key
+	if rec := doUserRequest(h, http.MethodPost, "/api/keys", key, `{"name":"more","scopes":["books:write"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Create with a key: expected status 403, got %d", rec.Code)
+	}
+
+	if rec := doUserRequest(h, http.MethodDelete, "/api/keys/"+created.ID, alice, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Revoke: expected status 204, got %d", rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodGet, "/api/books", key, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Revoked key: expected status 401, got %d", rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodDelete, "/api/keys/"+created.ID, alice, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Second revoke: expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeyHandler_Scopes(t *testing.T) {
+	h := newTestAPIKeyHandler(t)
+	alice := middleware.EncodeBasicAuth("alice", "alice-password")
+	read := createTestAPIKey(t, h, alice, `{"name":"read","scopes":["books:read"]}`)
+	write := createTestAPIKey(t, h, alice, `{"name":"write","scopes":["books:read","books:write"]}`)
+
+	book := `{"id":"book-1","title":"Test Book","isbn":"978-1234567890","author_id":"author-1"}`
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"write without scope", read.Key, http.MethodPost, "/api/books", book, http.StatusForbidden},
+		{"write", write.Key, http.MethodPost, "/api/books", book, http.StatusCreated},
+		{"read", read.Key, http.MethodGet, "/api/books/book-1", "", http.StatusOK},
+		{"include without scope", read.Key, http.MethodGet, "/api/books/book-1?include=author", "", http.StatusForbidden},
+		{"nested without scope", read.Key, http.MethodGet, "/api/books/book-1/lists", "", http.StatusForbidden},
+		{"delete without scope", read.Key, http.MethodDelete, "/api/books/book-1", "", http.StatusForbidden},
+		{"password", "", http.MethodDelete, "/api/books/book-1", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set(middleware.APIKeyHeader, tt.key)
+			} else {
+				req.Header.Set("Authorization", alice)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+}
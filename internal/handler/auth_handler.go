@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+)
+
+// AuthHandler issues, refreshes and revokes bearer tokens.
+type AuthHandler struct {
+	users  middleware.UserStore
+	tokens *middleware.TokenManager
+}
+
+// NewAuthHandler creates a new auth handler.
+func NewAuthHandler(users middleware.UserStore, tokens *middleware.TokenManager) *AuthHandler {
+	return &AuthHandler{users: users, tokens: tokens}
+}
+
+// RegisterRoutes registers auth routes on the given mux. They authenticate
+// requests themselves, so mount them outside the API's auth middleware.
+func (h *AuthHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/auth/token", h.post(h.issueToken))
+	mux.HandleFunc("/api/auth/refresh", h.post(h.refreshToken))
+	mux.HandleFunc("/api/auth/revoke", h.post(h.revokeToken))
+}
+
+// tokenResponse is the body of a successful token or refresh request.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// post rejects requests other than POST.
+func (h *AuthHandler) post(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// issueToken exchanges Basic credentials for a bearer token.
+func (h *AuthHandler) issueToken(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Basic credentials required")
+		return
+	}
+	user, ok := h.users.Authenticate(username, password)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	token, claims, err := h.tokens.Issue(user)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to issue token")
+		return
+	}
+	h.respondToken(w, token, claims)
+}
+
+// refreshToken exchanges a valid bearer token for a new one and revokes
+// the old one.
+func (h *AuthHandler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	old, ok := middleware.BearerToken(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Bearer token required")
+		return
+	}
+
+	// Disabled accounts and changed roles cannot refresh their way back in
+	if _, err := middleware.AuthenticateToken(h.users, h.tokens, old); err != nil {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	token, claims, err := h.tokens.Refresh(old)
+	if err != nil {
+		h.respondTokenError(w, err, "Failed to refresh token")
+		return
+	}
+	h.respondToken(w, token, claims)
+}
+
+// revokeToken revokes the bearer token the request carries.
+func (h *AuthHandler) revokeToken(w http.ResponseWriter, r *http.Request) {
+	token, ok := middleware.BearerToken(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Bearer token required")
+		return
+	}
+
+	claims, err := h.tokens.Verify(token)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err := h.tokens.Revoke(claims); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to revoke token")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondTokenError maps token errors to responses.
+func (h *AuthHandler) respondTokenError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, middleware.ErrInvalidToken) || errors.Is(err, middleware.ErrTokenExpired) || errors.Is(err, middleware.ErrTokenRevoked) {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	respondError(w, http.StatusInternalServerError, message)
+}
+
+func (h *AuthHandler) respondToken(w http.ResponseWriter, token string, claims *middleware.Claims) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   claims.ExpiresAt - claims.IssuedAt,
+	})
+}
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
 	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
 	"github.com/pawelpaszki/gorts-demo/internal/service"
 )
 
@@ -28,6 +31,10 @@ func (h *AuthorHandler) RegisterRoutes(mux *http.ServeMux) {
 
 // handleAuthors handles GET (list) and POST (create) for /api/authors
 func (h *AuthorHandler) handleAuthors(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, methodScope(r, "authors")) {
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.listAuthors(w, r)
@@ -38,13 +45,33 @@ func (h *AuthorHandler) handleAuthors(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleAuthor handles GET, PUT, DELETE for /api/authors/{id}
+// handleAuthor handles GET, PUT, DELETE for /api/authors/{id} and GET for
+// /api/authors/{id}/books
 func (h *AuthorHandler) handleAuthor(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/api/authors/")
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/authors/"), "/")
 	if id == "" {
 		http.Error(w, "Author ID required", http.StatusBadRequest)
 		return
 	}
+	if !requireScope(w, r, methodScope(r, "authors")) {
+		return
+	}
+
+	if sub != "" {
+		if sub != "books" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireScope(w, r, middleware.ScopeBooksRead) {
+			return
+		}
+		h.listAuthorBooks(w, r, id)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -59,15 +86,68 @@ func (h *AuthorHandler) handleAuthor(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthorHandler) listAuthors(w http.ResponseWriter, r *http.Request) {
-	// Check for country filter
-	country := r.URL.Query().Get("country")
-	var authors []*model.Author
-	if country != "" {
-		authors = h.service.GetAuthorsByCountry(country)
-	} else {
-		authors = h.service.ListAuthors()
-	}
-	respondJSON(w, http.StatusOK, authors)
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), authorFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authors, total, err := h.service.QueryAuthors(repository.AuthorQuery{
+		Filter: repository.AuthorFilter{Country: r.URL.Query().Get("country")},
+		Sort:   p.sort,
+		Offset: p.offset,
+		Limit:  p.limit,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to list authors")
+		return
+	}
+
+	writePageHeaders(w, r, p, total)
+	respondFields(w, http.StatusOK, authors, fields)
+}
+
+func (h *AuthorHandler) listAuthorBooks(w http.ResponseWriter, r *http.Request, id string) {
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), bookFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	books, total, err := h.service.QueryAuthorBooks(id, repository.BookQuery{
+		Sort:   p.sort,
+		Offset: p.offset,
+		Limit:  p.limit,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrAuthorNotFound) {
+			respondError(w, http.StatusNotFound, "Author not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to list books")
+		return
+	}
+
+	writePageHeaders(w, r, p, total)
+	respondFields(w, http.StatusOK, books, fields)
 }
 
 func (h *AuthorHandler) createAuthor(w http.ResponseWriter, r *http.Request) {
@@ -78,6 +158,10 @@ func (h *AuthorHandler) createAuthor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.service.CreateAuthor(&author); err != nil {
+		if errors.Is(err, service.ErrDuplicateID) {
+			respondError(w, http.StatusConflict, "Author with this ID already exists")
+			return
+		}
 		if errors.Is(err, service.ErrInvalidAuthor) {
 			respondError(w, http.StatusBadRequest, err.Error())
 			return
@@ -86,10 +170,18 @@ func (h *AuthorHandler) createAuthor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Location", "/api/authors/"+url.PathEscape(author.ID))
+	w.Header().Set("ETag", etag(author.Version))
 	respondJSON(w, http.StatusCreated, author)
 }
 
 func (h *AuthorHandler) getAuthor(w http.ResponseWriter, r *http.Request, id string) {
+	fields, err := parseFields(r.URL.Query(), authorFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	author, err := h.service.GetAuthor(id)
 	if err != nil {
 		if errors.Is(err, service.ErrAuthorNotFound) {
@@ -100,7 +192,10 @@ func (h *AuthorHandler) getAuthor(w http.ResponseWriter, r *http.Request, id str
 		return
 	}
 
-	respondJSON(w, http.StatusOK, author)
+	if notModified(w, r, author.Version) {
+		return
+	}
+	respondFields(w, http.StatusOK, author, fields)
 }
 
 func (h *AuthorHandler) updateAuthor(w http.ResponseWriter, r *http.Request, id string) {
@@ -112,7 +207,16 @@ func (h *AuthorHandler) updateAuthor(w http.ResponseWriter, r *http.Request, id
 
 	author.ID = id
 
-	if err := h.service.UpdateAuthor(&author); err != nil {
+	version, err := ifMatchVersion(r, id, h.currentVersion)
+	if err == nil {
+		author.Version = version
+		err = h.service.UpdateAuthor(&author)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			respondError(w, http.StatusPreconditionFailed, "Author was modified by another request")
+			return
+		}
 		if errors.Is(err, service.ErrAuthorNotFound) {
 			respondError(w, http.StatusNotFound, "Author not found")
 			return
@@ -125,18 +229,46 @@ func (h *AuthorHandler) updateAuthor(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 
+	w.Header().Set("ETag", etag(author.Version))
 	respondJSON(w, http.StatusOK, author)
 }
 
 func (h *AuthorHandler) deleteAuthor(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.service.DeleteAuthor(id); err != nil {
+	policy, err := service.ParseDeletePolicy(r.URL.Query().Get("on_delete"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	version, err := ifMatchVersion(r, id, h.currentVersion)
+	if err == nil {
+		err = h.service.DeleteAuthorIfVersion(id, version, policy)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			respondError(w, http.StatusPreconditionFailed, "Author was modified by another request")
+			return
+		}
 		if errors.Is(err, service.ErrAuthorNotFound) {
 			respondError(w, http.StatusNotFound, "Author not found")
 			return
 		}
+		if errors.Is(err, service.ErrAuthorHasBooks) {
+			respondError(w, http.StatusConflict, "Author still has books")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to delete author")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// currentVersion returns the stored version of an author for If-Match checks.
+func (h *AuthorHandler) currentVersion(id string) (int64, error) {
+	author, err := h.service.GetAuthor(id)
+	if err != nil {
+		return 0, err
+	}
+	return author.Version, nil
+}
@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
 	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/querylang"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
 	"github.com/pawelpaszki/gorts-demo/internal/service"
 )
 
@@ -28,6 +32,10 @@ func (h *BookHandler) RegisterRoutes(mux *http.ServeMux) {
 
 // handleBooks handles GET (list) and POST (create) for /api/books
 func (h *BookHandler) handleBooks(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, methodScope(r, "books")) {
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.listBooks(w, r)
@@ -38,14 +46,34 @@ func (h *BookHandler) handleBooks(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleBook handles GET, PUT, DELETE for /api/books/{id}
+// handleBook handles GET, PUT, DELETE for /api/books/{id} and GET for
+// /api/books/{id}/lists
 func (h *BookHandler) handleBook(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from path: /api/books/{id}
-	id := strings.TrimPrefix(r.URL.Path, "/api/books/")
+	// Extract ID from path: /api/books/{id}[/lists]
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/books/"), "/")
 	if id == "" {
 		http.Error(w, "Book ID required", http.StatusBadRequest)
 		return
 	}
+	if !requireScope(w, r, methodScope(r, "books")) {
+		return
+	}
+
+	if sub != "" {
+		if sub != "lists" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireScope(w, r, middleware.ScopeListsRead) {
+			return
+		}
+		h.listBookLists(w, r, id)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -60,8 +88,148 @@ func (h *BookHandler) handleBook(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *BookHandler) listBooks(w http.ResponseWriter, r *http.Request) {
-	books := h.service.ListBooks()
-	respondJSON(w, http.StatusOK, books)
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	inc, err := service.ParseBookInclude(r.URL.Query().Get("include"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !requireIncludeScopes(w, r, inc) {
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), bookFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := parseBookFilter(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var where querylang.Node
+	if q := r.URL.Query().Get("q"); q != "" {
+		if where, err = querylang.Parse(q); err != nil {
+			respondQueryError(w, err)
+			return
+		}
+	}
+
+	q := repository.BookQuery{
+		Filter: filter,
+		Where:  where,
+		Sort:   p.sort,
+		Offset: p.offset,
+		Limit:  p.limit,
+	}
+	books, total, err := h.service.QueryBooks(q)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to list books")
+		return
+	}
+	items, err := h.includeBooks(books, inc)
+	if err == nil {
+		items, err = selectFields(items, fields)
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list books")
+		return
+	}
+
+	facets := parseFacets(r.URL.Query())
+	if facets == nil {
+		writePageHeaders(w, r, p, total)
+		respondJSON(w, http.StatusOK, items)
+		return
+	}
+
+	counts, err := h.service.BookFacets(q, facets)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to count facets")
+		return
+	}
+	writePageHeaders(w, r, p, total)
+	respondJSON(w, http.StatusOK, facetedPage{Items: items, Facets: counts})
+}
+
+// includeBooks embeds the relations named by inc in books, or returns books
+// unchanged if there are none.
+func (h *BookHandler) includeBooks(books []*model.Book, inc service.Include) (interface{}, error) {
+	if len(inc) == 0 {
+		return books, nil
+	}
+	return h.service.BookViews(books, inc)
+}
+
+func (h *BookHandler) listBookLists(w http.ResponseWriter, r *http.Request, id string) {
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), readingListFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lists, total, err := h.service.QueryBookLists(id, repository.ReadingListQuery{
+		Sort:   p.sort,
+		Offset: p.offset,
+		Limit:  p.limit,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrBookNotFound) {
+			respondError(w, http.StatusNotFound, "Book not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to list reading lists")
+		return
+	}
+
+	writePageHeaders(w, r, p, total)
+	respondFields(w, http.StatusOK, lists, fields)
+}
+
+// parseBookFilter reads the genre, author_id, min_pages, max_pages,
+// published_after and published_before query parameters.
+func parseBookFilter(query url.Values) (repository.BookFilter, error) {
+	filter := repository.BookFilter{
+		Genre:    query.Get("genre"),
+		AuthorID: query.Get("author_id"),
+	}
+
+	var err error
+	if filter.MinPages, err = parseIntParam(query, "min_pages"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPages, err = parseIntParam(query, "max_pages"); err != nil {
+		return filter, err
+	}
+	if filter.PublishedAfter, err = parseTimeParam(query, "published_after"); err != nil {
+		return filter, err
+	}
+	if filter.PublishedBefore, err = parseTimeParam(query, "published_before"); err != nil {
+		return filter, err
+	}
+	return filter, nil
 }
 
 func (h *BookHandler) createBook(w http.ResponseWriter, r *http.Request) {
@@ -72,6 +240,10 @@ func (h *BookHandler) createBook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.service.CreateBook(&book); err != nil {
+		if errors.Is(err, service.ErrDuplicateID) {
+			respondError(w, http.StatusConflict, "Book with this ID already exists")
+			return
+		}
 		if errors.Is(err, service.ErrInvalidBook) {
 			respondError(w, http.StatusBadRequest, err.Error())
 			return
@@ -84,10 +256,26 @@ func (h *BookHandler) createBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Location", "/api/books/"+url.PathEscape(book.ID))
+	w.Header().Set("ETag", etag(book.Version))
 	respondJSON(w, http.StatusCreated, book)
 }
 
 func (h *BookHandler) getBook(w http.ResponseWriter, r *http.Request, id string) {
+	inc, err := service.ParseBookInclude(r.URL.Query().Get("include"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !requireIncludeScopes(w, r, inc) {
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), bookFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	book, err := h.service.GetBook(id)
 	if err != nil {
 		if errors.Is(err, service.ErrBookNotFound) {
@@ -98,7 +286,22 @@ func (h *BookHandler) getBook(w http.ResponseWriter, r *http.Request, id string)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, book)
+	if len(inc) == 0 {
+		if notModified(w, r, book.Version) {
+			return
+		}
+		respondFields(w, http.StatusOK, book, fields)
+		return
+	}
+
+	// Embedded records change without the book's version changing, so the
+	// response carries no ETag.
+	views, err := h.service.BookViews([]*model.Book{book}, inc)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get book")
+		return
+	}
+	respondFields(w, http.StatusOK, views[0], fields)
 }
 
 func (h *BookHandler) updateBook(w http.ResponseWriter, r *http.Request, id string) {
@@ -110,7 +313,16 @@ func (h *BookHandler) updateBook(w http.ResponseWriter, r *http.Request, id stri
 
 	book.ID = id // Ensure ID matches path
 
-	if err := h.service.UpdateBook(&book); err != nil {
+	version, err := ifMatchVersion(r, id, h.currentVersion)
+	if err == nil {
+		book.Version = version
+		err = h.service.UpdateBook(&book)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			respondError(w, http.StatusPreconditionFailed, "Book was modified by another request")
+			return
+		}
 		if errors.Is(err, service.ErrBookNotFound) {
 			respondError(w, http.StatusNotFound, "Book not found")
 			return
@@ -127,15 +339,34 @@ func (h *BookHandler) updateBook(w http.ResponseWriter, r *http.Request, id stri
 		return
 	}
 
+	w.Header().Set("ETag", etag(book.Version))
 	respondJSON(w, http.StatusOK, book)
 }
 
 func (h *BookHandler) deleteBook(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.service.DeleteBook(id); err != nil {
+	policy, err := service.ParseDeletePolicy(r.URL.Query().Get("on_delete"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	version, err := ifMatchVersion(r, id, h.currentVersion)
+	if err == nil {
+		err = h.service.DeleteBookIfVersion(id, version, policy)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			respondError(w, http.StatusPreconditionFailed, "Book was modified by another request")
+			return
+		}
 		if errors.Is(err, service.ErrBookNotFound) {
 			respondError(w, http.StatusNotFound, "Book not found")
 			return
 		}
+		if errors.Is(err, service.ErrBookInLists) {
+			respondError(w, http.StatusConflict, "Book is still in reading lists")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to delete book")
 		return
 	}
@@ -143,6 +374,30 @@ func (h *BookHandler) deleteBook(w http.ResponseWriter, r *http.Request, id stri
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// respondQueryError writes a 400 response for a query language error,
+// including the column and token it points at.
+func respondQueryError(w http.ResponseWriter, err error) {
+	var syntaxErr *querylang.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":  "Invalid query: " + syntaxErr.Error(),
+		"column": syntaxErr.Column,
+		"token":  syntaxErr.Token,
+	})
+}
+
+// currentVersion returns the stored version of a book for If-Match checks.
+func (h *BookHandler) currentVersion(id string) (int64, error) {
+	book, err := h.service.GetBook(id)
+	if err != nil {
+		return 0, err
+	}
+	return book.Version, nil
+}
+
 // respondJSON writes a JSON response.
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -3,8 +3,14 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
@@ -14,7 +20,7 @@ import (
 
 func newTestHandler() (*BookHandler, *http.ServeMux) {
 	repo := repository.NewBookRepository()
-	svc := service.NewBookService(repo)
+	svc := service.NewBookService(repo, nil, nil, nil, service.Options{ImportMode: true}) // tests use fixed IDs
 	handler := NewBookHandler(svc)
 
 	mux := http.NewServeMux()
@@ -45,6 +51,35 @@ func TestBookHandler_CreateBook(t *testing.T) {
 	}
 }
 
+func TestBookHandler_CreateBook_Location(t *testing.T) {
+	mux := http.NewServeMux()
+	NewBookHandler(service.NewBookService(repository.NewBookRepository(), nil, nil, nil, service.Options{})).RegisterRoutes(mux)
+
+	body := `{"title":"Test Book","isbn":"978-1234567890","author_id":"author-1"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/books", bytes.NewReader([]byte(body)))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	var created model.Book
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.ID == "" {
+		t.Fatal("Expected a generated ID")
+	}
+	if want := "/api/books/" + created.ID; rec.Header().Get("Location") != want {
+		t.Errorf("Location = %q, want %q", rec.Header().Get("Location"), want)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, rec.Header().Get("Location"), nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET Location: expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
 func TestBookHandler_CreateBook_InvalidJSON(t *testing.T) {
 	_, mux := newTestHandler()
 
@@ -215,6 +250,185 @@ func TestBookHandler_ListBooks(t *testing.T) {
 	}
 }
 
+func TestBookHandler_ListBooks_Pagination(t *testing.T) {
+	_, mux := newTestHandler()
+
+	for i := 1; i <= 5; i++ {
+		genre := "SF"
+		if i%2 == 0 {
+			genre = "Classic"
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"id":        fmt.Sprintf("book-%d", i),
+			"title":     "Book",
+			"isbn":      fmt.Sprintf("isbn-%d", i),
+			"author_id": "author-1",
+			"pages":     i * 100,
+			"genre":     genre,
+		})
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/books", bytes.NewReader(body)))
+	}
+
+	list := func(target string) ([]model.Book, *httptest.ResponseRecorder) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status %d, got %d: %s", target, http.StatusOK, rec.Code, rec.Body)
+		}
+		var books []model.Book
+		json.NewDecoder(rec.Body).Decode(&books)
+		return books, rec
+	}
+	ids := func(books []model.Book) []string {
+		var ids []string
+		for _, b := range books {
+			ids = append(ids, b.ID)
+		}
+		return ids
+	}
+	nextLink := regexp.MustCompile(`<([^>]+)>; rel="next"`)
+
+	books, rec := list("/api/books?limit=2&sort=-pages")
+	if got := ids(books); !reflect.DeepEqual(got, []string{"book-5", "book-4"}) {
+		t.Errorf("First page = %v", got)
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %q, want 5", got)
+	}
+	if strings.Contains(rec.Header().Get("Link"), `rel="prev"`) {
+		t.Errorf("First page should not link to a previous page: %s", rec.Header().Get("Link"))
+	}
+
+	m := nextLink.FindStringSubmatch(rec.Header().Get("Link"))
+	if m == nil {
+		t.Fatalf("Missing next link: %q", rec.Header().Get("Link"))
+	}
+	books, rec = list(m[1])
+	if got := ids(books); !reflect.DeepEqual(got, []string{"book-3", "book-2"}) {
+		t.Errorf("Second page = %v", got)
+	}
+	if link := rec.Header().Get("Link"); !strings.Contains(link, `</api/books?limit=2&sort=-pages>; rel="prev"`) {
+		t.Errorf("Second page prev link = %q", link)
+	}
+
+	books, rec = list("/api/books?limit=500&cursor=" + encodeCursor(maxCursorOffset))
+	if len(books) != 0 || rec.Header().Get("Link") != `</api/books?cursor=`+encodeCursor(maxCursorOffset-500)+`&limit=500>; rel="prev"` {
+		t.Errorf("Last possible page = %v with Link %q", ids(books), rec.Header().Get("Link"))
+	}
+
+	books, rec = list("/api/books?genre=SF&min_pages=200&sort=pages")
+	if got := ids(books); !reflect.DeepEqual(got, []string{"book-3", "book-5"}) {
+		t.Errorf("Filtered = %v", got)
+	}
+	if rec.Header().Get("Link") != "" || rec.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("Filtered headers = %v", rec.Header())
+	}
+}
+
+func TestBookHandler_ListBooks_BadQuery(t *testing.T) {
+	_, mux := newTestHandler()
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=1000",
+		"cursor=bogus",
+		"cursor=" + encodeCursor(math.MaxInt),
+		"sort=isbn_key",
+		"sort=title,,pages",
+		"min_pages=-1",
+		"max_pages=ten",
+		"published_after=yesterday",
+		"min_pages=500&max_pages=100",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestBookHandler_ListBooks_QueryLanguage(t *testing.T) {
+	_, mux := newTestHandler()
+	for i, genre := range []string{"Fantasy", "Horror", "Fantasy"} {
+		body, _ := json.Marshal(map[string]interface{}{
+			"id":        fmt.Sprintf("book-%d", i+1),
+			"title":     "Book",
+			"isbn":      fmt.Sprintf("isbn-%d", i+1),
+			"author_id": "author-1",
+			"pages":     (i + 1) * 200,
+			"genre":     genre,
+		})
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/books", bytes.NewReader(body)))
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books?q="+url.QueryEscape("pages>300 -genre:horror"), nil))
+	var books []model.Book
+	json.NewDecoder(rec.Body).Decode(&books)
+	if rec.Code != http.StatusOK || len(books) != 1 || books[0].ID != "book-3" {
+		t.Errorf("Expected book-3, got %d %+v", rec.Code, books)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books?q="+url.QueryEscape("genre:fantasy pages>lots"), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	var body struct {
+		Error  string `json:"error"`
+		Column int    `json:"column"`
+		Token  string `json:"token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body.Column != 21 || body.Token != "lots" || !strings.Contains(body.Error, "pages must be a whole number") {
+		t.Errorf("Unexpected error body: %+v", body)
+	}
+}
+
+func TestBookHandler_ListBooks_Facets(t *testing.T) {
+	_, mux := newTestHandler()
+	for i, genre := range []string{"Fantasy", "Horror", "Fantasy"} {
+		body, _ := json.Marshal(map[string]interface{}{
+			"id":        fmt.Sprintf("book-%d", i+1),
+			"title":     "Book",
+			"isbn":      fmt.Sprintf("isbn-%d", i+1),
+			"author_id": "author-1",
+			"pages":     (i + 1) * 200,
+			"genre":     genre,
+		})
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/books", bytes.NewReader(body)))
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books?limit=1&facets=genre,pages", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var body struct {
+		Items  []model.Book                  `json:"items"`
+		Facets map[string][]model.FacetCount `json:"facets"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if len(body.Items) != 1 || rec.Header().Get("X-Total-Count") != "3" {
+		t.Errorf("Expected one of 3 books, got %d (total %s)", len(body.Items), rec.Header().Get("X-Total-Count"))
+	}
+	if genres := body.Facets["genre"]; len(genres) != 2 || genres[0] != (model.FacetCount{Value: "Fantasy", Count: 2}) {
+		t.Errorf("Genre facet = %+v", genres)
+	}
+	if pages := body.Facets["pages"]; len(pages) != 3 || pages[0].Value != "200-299" {
+		t.Errorf("Pages facet = %+v", pages)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books?facets=colour", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Unknown facet: expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
 func TestBookHandler_MethodNotAllowed(t *testing.T) {
 	_, mux := newTestHandler()
 
@@ -226,3 +440,216 @@ func TestBookHandler_MethodNotAllowed(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
 	}
 }
+
+// createTestBook creates book-1 through the handler and returns its ETag.
+func createTestBook(t *testing.T, mux *http.ServeMux) string {
+	t.Helper()
+	body := `{"id":"book-1","title":"Test Book","isbn":"978-1234567890","author_id":"author-1"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/books", bytes.NewReader([]byte(body)))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Create status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	return rec.Header().Get("ETag")
+}
+
+func TestBookHandler_ETag(t *testing.T) {
+	_, mux := newTestHandler()
+	created := createTestBook(t, mux)
+	if created != `"1"` {
+		t.Errorf("ETag after create = %s, want \"1\"", created)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/books/book-1", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Header().Get("ETag") != created {
+		t.Errorf("GET ETag = %s, want %s", rec.Header().Get("ETag"), created)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/books/book-1", nil)
+	req.Header.Set("If-None-Match", `W/"1"`)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("304 response should have no body, got %q", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/books/book-1", nil)
+	req.Header.Set("If-None-Match", `"7"`)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d for stale If-None-Match, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestBookHandler_UpdateBook_IfMatch(t *testing.T) {
+	_, mux := newTestHandler()
+	stale := createTestBook(t, mux)
+
+	update := func(ifMatch, title string) *httptest.ResponseRecorder {
+		body := `{"title":"` + title + `","isbn":"978-1234567890","author_id":"author-1"}`
+		req := httptest.NewRequest(http.MethodPut, "/api/books/book-1", bytes.NewReader([]byte(body)))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// First editor wins.
+	rec := update(stale, "Editor A")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Header().Get("ETag") != `"2"` {
+		t.Errorf("ETag after update = %s, want \"2\"", rec.Header().Get("ETag"))
+	}
+
+	// Second editor still holds the old ETag.
+	if rec := update(stale, "Editor B"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+
+	// Any of several tags may match.
+	if rec := update(`"1", "2"`, "Editor C"); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d with matching tag list, got %d", http.StatusOK, rec.Code)
+	}
+	// Weak tags never satisfy If-Match.
+	if rec := update(`W/"3"`, "Editor D"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d for weak tag, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	// Without If-Match the write is unconditional.
+	if rec := update("", "Editor E"); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d without If-Match, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestBookHandler_DeleteBook_IfMatch(t *testing.T) {
+	_, mux := newTestHandler()
+	createTestBook(t, mux)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/books/book-1", nil)
+	req.Header.Set("If-Match", `"5"`)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/books/book-1", nil)
+	req.Header.Set("If-Match", `"1"`)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+}
+
+func TestBookHandler_DeleteBook_OnDelete(t *testing.T) {
+	books, lists := repository.NewBookRepository(), repository.NewReadingListRepository()
+	relations := repository.NewRelationRepository(books, repository.NewAuthorRepository(), lists)
+	svc := service.NewBookService(books, nil, lists, relations, service.Options{ImportMode: true})
+	mux := http.NewServeMux()
+	NewBookHandler(svc).RegisterRoutes(mux)
+	createTestBook(t, mux)
+	_ = lists.Create(&model.ReadingList{ID: "list-1", Name: "Favourites", BookIDs: []string{"book-1"}})
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?on_delete=orphan", http.StatusBadRequest},
+		{"?on_delete=restrict", http.StatusConflict},
+		{"", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/books/book-1"+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("DELETE %q: expected status %d, got %d", tt.query, tt.want, rec.Code)
+		}
+	}
+
+	if list, _ := lists.Get("list-1"); len(list.BookIDs) != 0 {
+		t.Errorf("Expected deleted book to leave list-1, got %v", list.BookIDs)
+	}
+}
+
+func TestBookHandler_GetBook_Include(t *testing.T) {
+	authors := repository.NewAuthorRepository()
+	_ = authors.Create(&model.Author{ID: "author-1", Name: "Frank Herbert"})
+	svc := service.NewBookService(repository.NewBookRepository(), authors, nil, nil, service.Options{ImportMode: true})
+	mux := http.NewServeMux()
+	NewBookHandler(svc).RegisterRoutes(mux)
+	createTestBook(t, mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books/book-1?include=author", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var body struct {
+		Title  string        `json:"title"`
+		Author *model.Author `json:"author"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body.Title != "Test Book" || body.Author == nil || body.Author.Name != "Frank Herbert" {
+		t.Errorf("Unexpected body: %+v", body)
+	}
+	if rec.Header().Get("ETag") != "" {
+		t.Errorf("Responses with includes should not carry an ETag, got %q", rec.Header().Get("ETag"))
+	}
+
+	for _, path := range []string{"/api/books/book-1?include=books", "/api/books?include=author,shelves"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status %d, got %d", path, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestBookHandler_Fields(t *testing.T) {
+	_, mux := newTestHandler()
+	createTestBook(t, mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books/book-1?fields=id,title", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var book map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&book)
+	if want := map[string]interface{}{"id": "book-1", "title": "Test Book"}; !reflect.DeepEqual(book, want) {
+		t.Errorf("Book = %v, want %v", book, want)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/books?fields=isbn&facets=genre", nil))
+	var page struct {
+		Items  []map[string]interface{}      `json:"items"`
+		Facets map[string][]model.FacetCount `json:"facets"`
+	}
+	json.NewDecoder(rec.Body).Decode(&page)
+	if len(page.Items) != 1 || len(page.Items[0]) != 1 || page.Items[0]["isbn"] != "978-1234567890" {
+		t.Errorf("Items = %v, want only isbn", page.Items)
+	}
+	if _, ok := page.Facets["genre"]; !ok {
+		t.Errorf("Facets should not be affected by fields, got %v", page.Facets)
+	}
+
+	for _, path := range []string{"/api/books?fields=id,colour", "/api/books/book-1?fields=id,", "/api/books/book-1/lists?fields=title"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status %d, got %d", path, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+// etag formats a record version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETags splits an If-Match or If-None-Match header into its entity
+// tags. Weak tags keep their W/ prefix.
+func parseETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ifMatchVersion resolves the If-Match header of a write to the version the
+// stored record must still have.
+//
+// It returns 0 when the write is unconditional: no If-Match header, or "*",
+// which the update and delete already satisfy by requiring the record to
+// exist. A single tag is returned without a lookup so the check stays atomic
+// in the store; with several tags, current is called to pick the one that
+// matches. If no tag can match, service.ErrVersionConflict is returned.
+func ifMatchVersion(r *http.Request, id string, current func(id string) (int64, error)) (int64, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, nil
+	}
+
+	var versions []int64
+	for _, tag := range parseETags(header) {
+		if tag == "*" {
+			return 0, nil
+		}
+		// If-Match uses strong comparison, so weak tags never match.
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		v, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+		if err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		return 0, service.ErrVersionConflict
+	case 1:
+		return versions[0], nil
+	}
+
+	version, err := current(id)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range versions {
+		if v == version {
+			return v, nil
+		}
+	}
+	return 0, service.ErrVersionConflict
+}
+
+// notModified sets the ETag header for a record and, if the request's
+// If-None-Match header matches it, answers 304 Not Modified and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	tag := etag(version)
+	w.Header().Set("ETag", tag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range parseETags(header) {
+		// If-None-Match uses weak comparison.
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+// facetedPage is the response body of a list or search request that asks
+// for facets: the page of results and the facet counts over all of them.
+type facetedPage struct {
+	Items  any                           `json:"items"`
+	Facets map[string][]model.FacetCount `json:"facets"`
+}
+
+// parseFacets reads the comma-separated facets query parameter, e.g.
+// facets=genre,decade. It returns nil when no facets were requested.
+func parseFacets(query url.Values) []string {
+	v := query.Get("facets")
+	if v == "" {
+		return nil
+	}
+	var facets []string
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			facets = append(facets, f)
+		}
+	}
+	return facets
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+// Field names accepted by ?fields=: the JSON fields of each model, plus the
+// relations that ?include= can embed.
+var (
+	bookFields        = append(jsonFields(model.Book{}), service.IncludeAuthor, service.IncludeLists)
+	authorFields      = jsonFields(model.Author{})
+	readingListFields = append(jsonFields(model.ReadingList{}), service.IncludeBooks)
+)
+
+// jsonFields returns the JSON names of the fields of struct v.
+func jsonFields(v any) []string {
+	t := reflect.TypeOf(v)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fieldSet is the set of JSON fields a client asked for.
+type fieldSet map[string]bool
+
+// parseFields reads the comma-separated fields query parameter, e.g.
+// fields=id,title. It returns nil when no fields were requested, so whole
+// records are written.
+func parseFields(query url.Values, allowed []string) (fieldSet, error) {
+	v := query.Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+	fields := fieldSet{}
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if !contains(allowed, name) {
+			return nil, fmt.Errorf("unknown field %q: want one of %s", name, strings.Join(allowed, ", "))
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFields returns data, a record or a slice of records, with only the
+// requested fields of each record kept. It returns data unchanged if fields
+// is nil.
+func selectFields(data any, fields fieldSet) (any, error) {
+	if fields == nil {
+		return data, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(raw, []byte("[")) {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &record); err != nil || record == nil {
+			return data, err
+		}
+		return fields.pick(record), nil
+	}
+
+	var records []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		records[i] = fields.pick(record)
+	}
+	return records, nil
+}
+
+func (fields fieldSet) pick(record map[string]json.RawMessage) map[string]json.RawMessage {
+	for name := range record {
+		if !fields[name] {
+			delete(record, name)
+		}
+	}
+	return record
+}
+
+// respondFields writes data as respondJSON does, keeping only the requested
+// fields.
+func respondFields(w http.ResponseWriter, status int, data any, fields fieldSet) {
+	data, err := selectFields(data, fields)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	respondJSON(w, status, data)
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+// Page sizes for list endpoints.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// page holds the paging and ordering parameters shared by list endpoints.
+type page struct {
+	offset int
+	limit  int
+	sort   []repository.SortKey
+}
+
+// parsePage reads the limit, cursor and sort query parameters.
+//
+// sort is a comma-separated list of fields, each optionally prefixed with
+// "-" for descending order, e.g. sort=title,-published_at.
+func parsePage(query url.Values) (page, error) {
+	p := page{limit: defaultPageLimit}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		p.limit = limit
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		offset, err := decodeCursor(v)
+		if err != nil {
+			return page{}, err
+		}
+		p.offset = offset
+	}
+
+	if v := query.Get("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			key := repository.SortKey{Field: strings.TrimSpace(field)}
+			if strings.HasPrefix(key.Field, "-") {
+				key.Field, key.Desc = key.Field[1:], true
+			}
+			if key.Field == "" {
+				return page{}, errors.New("sort fields must not be empty")
+			}
+			p.sort = append(p.sort, key)
+		}
+	}
+	return p, nil
+}
+
+// Cursors are opaque to clients; they currently encode an offset into the
+// sorted, filtered results, of at most maxCursorOffset so that offset
+// arithmetic cannot overflow.
+const (
+	cursorPrefix    = "o:"
+	maxCursorOffset = math.MaxInt32
+)
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && strings.HasPrefix(string(raw), cursorPrefix) {
+		offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), cursorPrefix))
+		if err == nil && offset >= 0 && offset <= maxCursorOffset {
+			return offset, nil
+		}
+	}
+	return 0, errors.New("invalid cursor")
+}
+
+// writePageHeaders reports the total number of matching records in
+// X-Total-Count and links to the neighbouring pages in a Link header.
+func writePageHeaders(w http.ResponseWriter, r *http.Request, p page, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	var links []string
+	if total-p.offset > p.limit {
+		links = append(links, pageLink(r, p.offset+p.limit, "next"))
+	}
+	if p.offset > 0 {
+		links = append(links, pageLink(r, max(p.offset-p.limit, 0), "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageLink formats a Link header entry for the request URL at another offset.
+func pageLink(r *http.Request, offset int, rel string) string {
+	query := r.URL.Query()
+	if offset == 0 {
+		query.Del("cursor")
+	} else {
+		query.Set("cursor", encodeCursor(offset))
+	}
+
+	target := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel)
+}
+
+// parseIntParam reads an optional non-negative integer query parameter.
+func parseIntParam(query url.Values, name string) (int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+// parseTimeParam reads an optional date (2006-01-02) or RFC 3339 timestamp
+// query parameter.
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	v := query.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC 3339 timestamp", name)
+	}
+	return t, nil
+}
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
 	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
 	"github.com/pawelpaszki/gorts-demo/internal/service"
 )
 
@@ -28,6 +31,10 @@ func (h *ReadingListHandler) RegisterRoutes(mux *http.ServeMux) {
 
 // handleLists handles GET (list) and POST (create) for /api/lists
 func (h *ReadingListHandler) handleLists(w http.ResponseWriter, r *http.Request) {
+	if !requireScope(w, r, methodScope(r, "lists")) {
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.listReadingLists(w, r)
@@ -38,7 +45,8 @@ func (h *ReadingListHandler) handleLists(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// handleList handles individual list operations: /api/lists/{id} and /api/lists/{id}/books/{bookId}
+// handleList handles individual list operations: /api/lists/{id}, /api/lists/{id}/books
+// and /api/lists/{id}/books/{bookId}
 func (h *ReadingListHandler) handleList(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/lists/")
 	parts := strings.Split(path, "/")
@@ -47,6 +55,9 @@ func (h *ReadingListHandler) handleList(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "List ID required", http.StatusBadRequest)
 		return
 	}
+	if !requireScope(w, r, methodScope(r, "lists")) {
+		return
+	}
 
 	listID := parts[0]
 
@@ -57,6 +68,23 @@ func (h *ReadingListHandler) handleList(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Handle /api/lists/{id}/books
+	if len(parts) == 2 && parts[1] == "books" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireScope(w, r, middleware.ScopeBooksRead) {
+			return
+		}
+		h.listBooks(w, r, listID)
+		return
+	}
+	if len(parts) > 1 {
+		http.NotFound(w, r)
+		return
+	}
+
 	// Handle /api/lists/{id}
 	switch r.Method {
 	case http.MethodGet:
@@ -83,8 +111,83 @@ func (h *ReadingListHandler) handleListBook(w http.ResponseWriter, r *http.Reque
 }
 
 func (h *ReadingListHandler) listReadingLists(w http.ResponseWriter, r *http.Request) {
-	lists := h.service.ListReadingLists()
-	respondJSON(w, http.StatusOK, lists)
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	inc, err := service.ParseReadingListInclude(r.URL.Query().Get("include"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !requireIncludeScopes(w, r, inc) {
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), readingListFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lists, total, err := h.service.QueryReadingLists(repository.ReadingListQuery{
+		Filter: repository.ReadingListFilter{BookID: r.URL.Query().Get("book_id")},
+		Sort:   p.sort,
+		Offset: p.offset,
+		Limit:  p.limit,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to list reading lists")
+		return
+	}
+	if len(inc) == 0 {
+		writePageHeaders(w, r, p, total)
+		respondFields(w, http.StatusOK, lists, fields)
+		return
+	}
+
+	views, err := h.service.ReadingListViews(lists, inc)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list reading lists")
+		return
+	}
+	writePageHeaders(w, r, p, total)
+	respondFields(w, http.StatusOK, views, fields)
+}
+
+// listBooks returns a page of a list's books in list order, so it does not
+// accept sort.
+func (h *ReadingListHandler) listBooks(w http.ResponseWriter, r *http.Request, id string) {
+	p, err := parsePage(r.URL.Query())
+	if err == nil && p.sort != nil {
+		err = errors.New("sort is not supported; books are returned in list order")
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), bookFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	books, total, err := h.service.ListBooks(id, p.offset, p.limit)
+	if err != nil {
+		if errors.Is(err, service.ErrReadingListNotFound) {
+			respondError(w, http.StatusNotFound, "Reading list not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to list books")
+		return
+	}
+
+	writePageHeaders(w, r, p, total)
+	respondFields(w, http.StatusOK, books, fields)
 }
 
 func (h *ReadingListHandler) createReadingList(w http.ResponseWriter, r *http.Request) {
@@ -95,6 +198,10 @@ func (h *ReadingListHandler) createReadingList(w http.ResponseWriter, r *http.Re
 	}
 
 	if err := h.service.CreateReadingList(&list); err != nil {
+		if errors.Is(err, service.ErrDuplicateID) {
+			respondError(w, http.StatusConflict, "Reading list with this ID already exists")
+			return
+		}
 		if errors.Is(err, service.ErrInvalidReadingList) {
 			respondError(w, http.StatusBadRequest, err.Error())
 			return
@@ -103,10 +210,26 @@ func (h *ReadingListHandler) createReadingList(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	w.Header().Set("Location", "/api/lists/"+url.PathEscape(list.ID))
+	w.Header().Set("ETag", etag(list.Version))
 	respondJSON(w, http.StatusCreated, list)
 }
 
 func (h *ReadingListHandler) getReadingList(w http.ResponseWriter, r *http.Request, id string) {
+	inc, err := service.ParseReadingListInclude(r.URL.Query().Get("include"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !requireIncludeScopes(w, r, inc) {
+		return
+	}
+	fields, err := parseFields(r.URL.Query(), readingListFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	list, err := h.service.GetReadingList(id)
 	if err != nil {
 		if errors.Is(err, service.ErrReadingListNotFound) {
@@ -117,7 +240,22 @@ func (h *ReadingListHandler) getReadingList(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	respondJSON(w, http.StatusOK, list)
+	if len(inc) == 0 {
+		if notModified(w, r, list.Version) {
+			return
+		}
+		respondFields(w, http.StatusOK, list, fields)
+		return
+	}
+
+	// Embedded records change without the list's version changing, so the
+	// response carries no ETag.
+	views, err := h.service.ReadingListViews([]*model.ReadingList{list}, inc)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get reading list")
+		return
+	}
+	respondFields(w, http.StatusOK, views[0], fields)
 }
 
 func (h *ReadingListHandler) updateReadingList(w http.ResponseWriter, r *http.Request, id string) {
@@ -129,7 +267,16 @@ func (h *ReadingListHandler) updateReadingList(w http.ResponseWriter, r *http.Re
 
 	list.ID = id
 
-	if err := h.service.UpdateReadingList(&list); err != nil {
+	version, err := ifMatchVersion(r, id, h.currentVersion)
+	if err == nil {
+		list.Version = version
+		err = h.service.UpdateReadingList(&list)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			respondError(w, http.StatusPreconditionFailed, "Reading list was modified by another request")
+			return
+		}
 		if errors.Is(err, service.ErrReadingListNotFound) {
 			respondError(w, http.StatusNotFound, "Reading list not found")
 			return
@@ -142,11 +289,20 @@ func (h *ReadingListHandler) updateReadingList(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	w.Header().Set("ETag", etag(list.Version))
 	respondJSON(w, http.StatusOK, list)
 }
 
 func (h *ReadingListHandler) deleteReadingList(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.service.DeleteReadingList(id); err != nil {
+	version, err := ifMatchVersion(r, id, h.currentVersion)
+	if err == nil {
+		err = h.service.DeleteReadingListIfVersion(id, version)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			respondError(w, http.StatusPreconditionFailed, "Reading list was modified by another request")
+			return
+		}
 		if errors.Is(err, service.ErrReadingListNotFound) {
 			respondError(w, http.StatusNotFound, "Reading list not found")
 			return
@@ -158,6 +314,15 @@ func (h *ReadingListHandler) deleteReadingList(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// currentVersion returns the stored version of a reading list for If-Match checks.
+func (h *ReadingListHandler) currentVersion(id string) (int64, error) {
+	list, err := h.service.GetReadingList(id)
+	if err != nil {
+		return 0, err
+	}
+	return list.Version, nil
+}
+
 func (h *ReadingListHandler) addBookToList(w http.ResponseWriter, r *http.Request, listID, bookID string) {
 	if err := h.service.AddBookToList(listID, bookID); err != nil {
 		if errors.Is(err, service.ErrReadingListNotFound) {
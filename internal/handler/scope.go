@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+// requireScope responds with 403 and returns false unless the request's
+// user holds every scope. Requests without an API key pass: they are only
+// limited by role.
+func requireScope(w http.ResponseWriter, r *http.Request, scopes ...string) bool {
+	user := middleware.GetUser(r.Context())
+	if user == nil {
+		return true
+	}
+	for _, scope := range scopes {
+		if !user.HasScope(scope) {
+			respondError(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
+			return false
+		}
+	}
+	return true
+}
+
+// methodScope returns the read scope of resource for GET and HEAD requests,
+// and its write scope otherwise.
+func methodScope(r *http.Request, resource string) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return resource + ":read"
+	}
+	return resource + ":write"
+}
+
+// includeScopes are the scopes needed to embed each ?include= relation.
+var includeScopes = map[string]string{
+	service.IncludeAuthor:      middleware.ScopeAuthorsRead,
+	service.IncludeLists:       middleware.ScopeListsRead,
+	service.IncludeBooks:       middleware.ScopeBooksRead,
+	service.IncludeBooksAuthor: middleware.ScopeAuthorsRead,
+}
+
+// requireIncludeScopes is requireScope for the relations in inc.
+func requireIncludeScopes(w http.ResponseWriter, r *http.Request, inc service.Include) bool {
+	var scopes []string
+	for name := range inc {
+		scopes = append(scopes, includeScopes[name])
+	}
+	sort.Strings(scopes)
+	return requireScope(w, r, scopes...)
+}
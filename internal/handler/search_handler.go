@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+	"github.com/pawelpaszki/gorts-demo/internal/search"
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+// SearchHandler handles full-text search requests.
+type SearchHandler struct {
+	service *service.SearchService
+}
+
+// NewSearchHandler creates a new search handler.
+func NewSearchHandler(svc *service.SearchService) *SearchHandler {
+	return &SearchHandler{service: svc}
+}
+
+// RegisterRoutes registers search routes on the given mux.
+func (h *SearchHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/search", h.handleSearch)
+}
+
+// handleSearch handles GET /api/search?q=...&type=...&facets=...
+// Results are paged like the list endpoints but always ranked by relevance.
+func (h *SearchHandler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireScope(w, r, middleware.ScopeSearchRead) {
+		return
+	}
+
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(p.sort) > 0 {
+		respondError(w, http.StatusBadRequest, "search results are ordered by relevance and cannot be sorted")
+		return
+	}
+
+	q := search.Query{
+		Text:   r.URL.Query().Get("q"),
+		Kind:   r.URL.Query().Get("type"),
+		Offset: p.offset,
+		Limit:  p.limit,
+	}
+	hits, total, err := h.service.Search(q)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to search")
+		return
+	}
+
+	facets := parseFacets(r.URL.Query())
+	if facets == nil {
+		writePageHeaders(w, r, p, total)
+		respondJSON(w, http.StatusOK, hits)
+		return
+	}
+
+	counts, err := h.service.Facets(q, facets)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to count facets")
+		return
+	}
+	writePageHeaders(w, r, p, total)
+	respondJSON(w, http.StatusOK, facetedPage{Items: hits, Facets: counts})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/search"
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+func TestSearchHandler(t *testing.T) {
+	idx := search.NewIndex()
+	for _, title := range []string{"Dune", "Dune Messiah", "Children of Dune"} {
+		idx.Put(search.Document{Kind: search.KindBook, ID: title, Title: title, Fields: []search.Field{{Name: "title", Text: title}}})
+	}
+	mux := http.NewServeMux()
+	NewSearchHandler(service.NewSearchService(idx, nil)).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=dune&limit=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var hits []search.Hit
+	json.NewDecoder(rec.Body).Decode(&hits)
+	if len(hits) != 2 || hits[0].ID != "Dune" {
+		t.Errorf("Unexpected hits: %+v", hits)
+	}
+	if hits[0].Highlights["title"] != "<mark>Dune</mark>" {
+		t.Errorf("Highlight = %q", hits[0].Highlights["title"])
+	}
+	if rec.Header().Get("X-Total-Count") != "3" || rec.Header().Get("Link") == "" {
+		t.Errorf("Missing paging headers: %v", rec.Header())
+	}
+}
+
+func TestSearchHandler_Facets(t *testing.T) {
+	idx := search.NewIndex()
+	for _, book := range []*model.Book{
+		{ID: "b1", Title: "Dune", Genre: "Science Fiction"},
+		{ID: "b2", Title: "Dune Messiah", Genre: "Science Fiction"},
+		{ID: "b3", Title: "The Dune Encyclopedia", Genre: "Reference"},
+	} {
+		idx.Put(search.BookDocument(book))
+	}
+	mux := http.NewServeMux()
+	NewSearchHandler(service.NewSearchService(idx, nil)).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=dune&limit=1&facets=genre", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var body struct {
+		Items  []search.Hit                  `json:"items"`
+		Facets map[string][]model.FacetCount `json:"facets"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if len(body.Items) != 1 {
+		t.Errorf("Expected 1 hit, got %d", len(body.Items))
+	}
+	want := []model.FacetCount{{Value: "Science Fiction", Count: 2}, {Value: "Reference", Count: 1}}
+	if got := body.Facets["genre"]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Genre facet = %+v, want %+v", got, want)
+	}
+}
+
+func TestSearchHandler_BadRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	NewSearchHandler(service.NewSearchService(search.NewIndex(), nil)).RegisterRoutes(mux)
+
+	for _, query := range []string{"", "q=+-+", "q=dune&type=movie", "q=dune&sort=title", "q=dune&limit=0", "q=dune&facets=colour"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d, got %d", query, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+	"github.com/pawelpaszki/gorts-demo/internal/search"
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+// Number of suggestions returned by /api/suggest.
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+// SuggestHandler handles autocomplete requests.
+type SuggestHandler struct {
+	service *service.SuggestService
+}
+
+// NewSuggestHandler creates a new suggest handler.
+func NewSuggestHandler(svc *service.SuggestService) *SuggestHandler {
+	return &SuggestHandler{service: svc}
+}
+
+// RegisterRoutes registers suggest routes on the given mux.
+func (h *SuggestHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/suggest", h.handleSuggest)
+}
+
+// handleSuggest handles GET /api/suggest?q=...&type=...&limit=...
+func (h *SuggestHandler) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireScope(w, r, middleware.ScopeSearchRead) {
+		return
+	}
+
+	limit := defaultSuggestLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSuggestLimit {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSuggestLimit))
+			return
+		}
+		limit = n
+	}
+
+	suggestions, err := h.service.Suggest(search.SuggestQuery{
+		Text:  r.URL.Query().Get("q"),
+		Kind:  r.URL.Query().Get("type"),
+		Limit: limit,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to suggest")
+		return
+	}
+	respondJSON(w, http.StatusOK, suggestions)
+}
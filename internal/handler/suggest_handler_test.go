@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/search"
+	"github.com/pawelpaszki/gorts-demo/internal/service"
+)
+
+func TestSuggestHandler(t *testing.T) {
+	s := search.NewSuggester()
+	s.PutBook(&model.Book{ID: "b1", Title: "Dune", AuthorID: "a1"})
+	s.PutBook(&model.Book{ID: "b2", Title: "Dune Messiah", AuthorID: "a1"})
+	s.PutAuthor(&model.Author{ID: "a1", Name: "Frank Herbert"})
+	s.SetListCount("b2", 3)
+	mux := http.NewServeMux()
+	NewSuggestHandler(service.NewSuggestService(s)).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/suggest?q=dnue&type=book", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var suggestions []search.Suggestion
+	json.NewDecoder(rec.Body).Decode(&suggestions)
+	want := []search.Suggestion{
+		{Kind: "book", ID: "b2", Text: "Dune Messiah", Popularity: 3},
+		{Kind: "book", ID: "b1", Text: "Dune", Popularity: 0},
+	}
+	if len(suggestions) != 2 || suggestions[0] != want[0] || suggestions[1] != want[1] {
+		t.Errorf("Suggestions = %+v, want %+v", suggestions, want)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/suggest?q=herb&limit=1", nil))
+	suggestions = nil
+	json.NewDecoder(rec.Body).Decode(&suggestions)
+	if len(suggestions) != 1 || suggestions[0].ID != "a1" || suggestions[0].Popularity != 3 {
+		t.Errorf("Author suggestions = %+v", suggestions)
+	}
+}
+
+func TestSuggestHandler_BadRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	NewSuggestHandler(service.NewSuggestService(search.NewSuggester())).RegisterRoutes(mux)
+
+	for _, query := range []string{"", "q=+-+", "q=dune&type=list", "q=dune&limit=0", "q=dune&limit=51"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/suggest?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d, got %d", query, http.StatusBadRequest, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/suggest?q=dune", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+)
+
+// UserHandler handles HTTP requests for user accounts: admin management at
+// /api/users and self-service at /api/me.
+type UserHandler struct {
+	users  *middleware.FileUserStore
+	tokens *middleware.TokenManager
+	keys   *middleware.APIKeyStore
+}
+
+// NewUserHandler creates a new user handler. Changing a user's password,
+// role or access revokes their bearer tokens, and disabling a user also
+// revokes their API keys in keys, which may be nil.
+func NewUserHandler(users *middleware.FileUserStore, tokens *middleware.TokenManager, keys *middleware.APIKeyStore) *UserHandler {
+	return &UserHandler{users: users, tokens: tokens, keys: keys}
+}
+
+// RegisterRoutes registers user routes on the given mux. It expects the mux
+// to sit behind an auth middleware; /api/users also requires the admin role.
+func (h *UserHandler) RegisterRoutes(mux *http.ServeMux) {
+	admin := middleware.RequireRole("admin")
+	mux.Handle("/api/users", admin(http.HandlerFunc(h.handleUsers)))
+	mux.Handle("/api/users/", admin(http.HandlerFunc(h.handleUser)))
+	mux.HandleFunc("/api/me", h.handleMe)
+	mux.HandleFunc("/api/me/password", h.handleMePassword)
+}
+
+// createUserRequest is the body of POST /api/users.
+type createUserRequest struct {
+	middleware.Account
+	Password string `json:"password"`
+}
+
+// updateUserRequest is the body of PATCH /api/users/{username}; fields left
+// out are unchanged.
+type updateUserRequest struct {
+	Email    *string `json:"email"`
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// passwordRequest is the body of a password reset or change.
+type passwordRequest struct {
+	CurrentPassword string `json:"current_password,omitempty"`
+	Password        string `json:"password"`
+}
+
+// handleUsers handles GET (list) and POST (create) for /api/users
+func (h *UserHandler) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, h.users.Accounts())
+	case http.MethodPost:
+		h.createUser(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUser handles GET and PATCH for /api/users/{username} and PUT for
+// /api/users/{username}/password
+func (h *UserHandler) handleUser(w http.ResponseWriter, r *http.Request) {
+	username, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+	if username == "" {
+		http.Error(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	if sub != "" {
+		if sub != "password" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.resetPassword(w, r, username)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getUser(w, username)
+	case http.MethodPatch:
+		h.updateUser(w, r, username)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *UserHandler) createUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if req.Role == "" {
+		req.Role = "user"
+	}
+
+	if err := h.users.CreateAccount(req.Account, req.Password); err != nil {
+		h.respondUserError(w, err, "Failed to create user")
+		return
+	}
+
+	w.Header().Set("Location", "/api/users/"+url.PathEscape(req.Username))
+	respondJSON(w, http.StatusCreated, req.Account)
+}
+
+func (h *UserHandler) getUser(w http.ResponseWriter, username string) {
+	account, err := h.users.Account(username)
+	if err != nil {
+		h.respondUserError(w, err, "Failed to get user")
+		return
+	}
+	respondJSON(w, http.StatusOK, account)
+}
+
+func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, username string) {
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	// Admins cannot lock themselves out
+	if self := middleware.GetUser(r.Context()); self != nil && self.Username == username {
+		if (req.Disabled != nil && *req.Disabled) || (req.Role != nil && *req.Role != self.Role) {
+			respondError(w, http.StatusConflict, "Cannot disable or change the role of your own account")
+			return
+		}
+	}
+
+	var revoke, disable bool
+	account, err := h.users.UpdateAccount(username, func(a *middleware.Account) error {
+		if req.Email != nil {
+			a.Email = *req.Email
+		}
+		if req.Role != nil && *req.Role != a.Role {
+			a.Role, revoke = *req.Role, true
+		}
+		if req.Disabled != nil && *req.Disabled != a.Disabled {
+			a.Disabled, revoke = *req.Disabled, true
+			disable = a.Disabled
+		}
+		return nil
+	})
+	if err != nil {
+		h.respondUserError(w, err, "Failed to update user")
+		return
+	}
+
+	// Tokens carry the role, and must stop working when access is removed
+	if revoke {
+		if err := h.tokens.RevokeUser(username); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to revoke tokens")
+			return
+		}
+	}
+	if disable && h.keys != nil {
+		if err := h.keys.RevokeOwner(username); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to revoke API keys")
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, account)
+}
+
+func (h *UserHandler) resetPassword(w http.ResponseWriter, r *http.Request, username string) {
+	var req passwordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := h.users.SetPassword(username, req.Password); err != nil {
+		h.respondUserError(w, err, "Failed to reset password")
+		return
+	}
+	if err := h.tokens.RevokeUser(username); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to revoke tokens")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMe handles GET for /api/me
+func (h *UserHandler) handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := h.localUser(w, r)
+	if !ok {
+		return
+	}
+	h.getUser(w, user.Username)
+}
+
+// handleMePassword handles PUT for /api/me/password, which needs the
+// current password as well as the new one.
+func (h *UserHandler) handleMePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := h.localUser(w, r)
+	if !ok {
+		return
+	}
+	if user.APIKey != "" {
+		respondError(w, http.StatusForbidden, "API keys cannot change passwords")
+		return
+	}
+
+	var req passwordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if _, ok := h.users.Authenticate(user.Username, req.CurrentPassword); !ok {
+		respondError(w, http.StatusForbidden, "Current password is incorrect")
+		return
+	}
+
+	if err := h.users.SetPassword(user.Username, req.Password); err != nil {
+		h.respondUserError(w, err, "Failed to change password")
+		return
+	}
+	if err := h.tokens.RevokeUser(user.Username); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to revoke tokens")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// localUser returns the request's user, who must have a local account.
+// Users of an identity provider are refused, even if a local account has
+// the same name.
+func (h *UserHandler) localUser(w http.ResponseWriter, r *http.Request) (*middleware.User, bool) {
+	user := middleware.GetUser(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if user.External {
+		respondError(w, http.StatusForbidden, "No local account")
+		return nil, false
+	}
+	return user, true
+}
+
+// respondUserError maps user store errors to responses.
+func (h *UserHandler) respondUserError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, middleware.ErrUserNotFound) {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if errors.Is(err, middleware.ErrUserExists) {
+		respondError(w, http.StatusConflict, "User already exists")
+		return
+	}
+	if errors.Is(err, middleware.ErrInvalidUser) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondError(w, http.StatusInternalServerError, message)
+}
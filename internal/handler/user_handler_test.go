@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware"
+)
+
+func newTestUserHandler(t *testing.T) (http.Handler, *middleware.TokenManager, *middleware.APIKeyStore) {
+	t.Helper()
+	users, err := middleware.NewFileUserStore(filepath.Join(t.TempDir(), "users.json"), middleware.HashParams{
+		Algorithm:  middleware.HashBcrypt,
+		BcryptCost: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.AddUser("admin", "admin-password", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	tokens := middleware.NewTokenManager([]byte("test"), time.Hour)
+	keys, _ := middleware.NewAPIKeyStore("")
+
+	mux := http.NewServeMux()
+	NewUserHandler(users, tokens, keys).RegisterRoutes(mux)
+	return middleware.WithAPIKeys(users, keys, "test", middleware.BasicOrBearerAuth(users, tokens, "test"))(mux), tokens, keys
+}
+
+func doUserRequest(h http.Handler, method, path, auth, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", auth)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUserHandler_Manage(t *testing.T) {
+	h, tokens, _ := newTestUserHandler(t)
+	admin := middleware.EncodeBasicAuth("admin", "admin-password")
+
+	rec := doUserRequest(h, http.MethodPost, "/api/users", admin, `{"username":"alice","email":"alice@example.com","password":"alice-password"}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/api/users/alice" {
+		t.Fatalf("Create: status %d, Location %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	var account middleware.Account
+	json.NewDecoder(rec.Body).Decode(&account)
+	if account != (middleware.Account{Username: "alice", Email: "alice@example.com", Role: "user"}) {
+		t.Errorf("Created account = %+v", account)
+	}
+	if strings.Contains(rec.Body.String(), "password") {
+		t.Errorf("Response should not include the password: %s", rec.Body)
+	}
+
+	for _, tt := range []struct {
+		body string
+		want int
+	}{
+		{`{"username":"alice","password":"alice-password"}`, http.StatusConflict},
+		{`{"username":"bob","email":"bob@","password":"bob-password"}`, http.StatusBadRequest},
+		{`{"username":"bob","password":"short"}`, http.StatusBadRequest},
+		{`{`, http.StatusBadRequest},
+	} {
+		if rec := doUserRequest(h, http.MethodPost, "/api/users", admin, tt.body); rec.Code != tt.want {
+			t.Errorf("Create %s: expected status %d, got %d", tt.body, tt.want, rec.Code)
+		}
+	}
+
+	alice := middleware.EncodeBasicAuth("alice", "alice-password")
+	if rec := doUserRequest(h, http.MethodGet, "/api/users", alice, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("List as non-admin: expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	token, _, _ := tokens.Issue(&middleware.User{Username: "alice", Role: "user"})
+
+	rec = doUserRequest(h, http.MethodPatch, "/api/users/alice", admin, `{"role":"editor"}`)
+	json.NewDecoder(rec.Body).Decode(&account)
+	if rec.Code != http.StatusOK || account.Role != "editor" || account.Email != "alice@example.com" {
+		t.Errorf("Update: status %d, account %+v", rec.Code, account)
+	}
+	if _, err := tokens.Verify(token); err == nil {
+		t.Error("Changing the role should revoke the user's tokens")
+	}
+
+	doUserRequest(h, http.MethodPatch, "/api/users/alice", admin, `{"disabled":true}`)
+	if rec := doUserRequest(h, http.MethodGet, "/api/me", alice, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Disabled user: expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	doUserRequest(h, http.MethodPatch, "/api/users/alice", admin, `{"disabled":false}`)
+
+	if rec := doUserRequest(h, http.MethodPut, "/api/users/alice/password", admin, `{"password":"reset-password"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("Reset password: expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodGet, "/api/me", middleware.EncodeBasicAuth("alice", "reset-password"), ""); rec.Code != http.StatusOK {
+		t.Errorf("Login with reset password: expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	rec = doUserRequest(h, http.MethodGet, "/api/users", admin, "")
+	var accounts []middleware.Account
+	json.NewDecoder(rec.Body).Decode(&accounts)
+	if len(accounts) != 2 || accounts[1].Username != "alice" {
+		t.Errorf("List = %+v", accounts)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/api/users/nobody", "", http.StatusNotFound},
+		{http.MethodPatch, "/api/users/nobody", `{}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/users/admin", `{"disabled":true}`, http.StatusConflict},
+		{http.MethodPatch, "/api/users/admin", `{"role":"user"}`, http.StatusConflict},
+		{http.MethodDelete, "/api/users/alice", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/users/alice/roles", "", http.StatusNotFound},
+	} {
+		if rec := doUserRequest(h, tt.method, tt.path, admin, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestUserHandler_Me(t *testing.T) {
+	h, tokens, _ := newTestUserHandler(t)
+	token, _, _ := tokens.Issue(&middleware.User{Username: "admin", Role: "admin"})
+	bearer := "Bearer " + token
+
+	rec := doUserRequest(h, http.MethodGet, "/api/me", bearer, "")
+	var account middleware.Account
+	json.NewDecoder(rec.Body).Decode(&account)
+	if rec.Code != http.StatusOK || account.Username != "admin" || account.Role != "admin" {
+		t.Errorf("GET /api/me: status %d, account %+v", rec.Code, account)
+	}
+
+	if rec := doUserRequest(h, http.MethodPut, "/api/me/password", bearer, `{"current_password":"wrong","password":"new-password"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Wrong current password: expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodPut, "/api/me/password", bearer, `{"current_password":"admin-password","password":"short"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Short password: expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodPut, "/api/me/password", bearer, `{"current_password":"admin-password","password":"new-password"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("Change password: expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	// The change revokes the token it was made with
+	if rec := doUserRequest(h, http.MethodGet, "/api/me", bearer, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Old token: expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodGet, "/api/me", middleware.EncodeBasicAuth("admin", "new-password"), ""); rec.Code != http.StatusOK {
+		t.Errorf("New password: expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	// Users of an identity provider have no local account, whatever their name
+	external, _, _ := tokens.IssueExternal(&middleware.User{Username: "admin", Role: "admin"})
+	if rec := doUserRequest(h, http.MethodGet, "/api/me", "Bearer "+external, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("External token: expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestUserHandler_APIKeys(t *testing.T) {
+	h, _, keys := newTestUserHandler(t)
+	admin := middleware.EncodeBasicAuth("admin", "admin-password")
+	if rec := doUserRequest(h, http.MethodPost, "/api/users", admin, `{"username":"alice","password":"alice-password"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Create: status %d: %s", rec.Code, rec.Body)
+	}
+	adminKey, _, _ := keys.Create("admin", "admin", []string{middleware.ScopeBooksRead}, nil)
+	aliceKey, _, _ := keys.Create("alice", "alice", []string{middleware.ScopeBooksRead}, nil)
+
+	// Keys carry no role or password
+	if rec := doUserRequest(h, http.MethodGet, "/api/users", "Bearer "+adminKey, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("List users with a key: expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodPut, "/api/me/password", "Bearer "+adminKey, `{"current_password":"admin-password","password":"new-password"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Change password with a key: expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	if rec := doUserRequest(h, http.MethodPatch, "/api/users/alice", admin, `{"disabled":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("Disable: status %d", rec.Code)
+	}
+	if rec := doUserRequest(h, http.MethodGet, "/api/me", "Bearer "+aliceKey, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Disabled user's key: expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
@@ -0,0 +1,377 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API key scopes. Read scopes allow GET requests on a resource, write
+// scopes every other method.
+const (
+	ScopeBooksRead    = "books:read"
+	ScopeBooksWrite   = "books:write"
+	ScopeAuthorsRead  = "authors:read"
+	ScopeAuthorsWrite = "authors:write"
+	ScopeListsRead    = "lists:read"
+	ScopeListsWrite   = "lists:write"
+	ScopeSearchRead   = "search:read"
+)
+
+// Scopes lists every API key scope.
+var Scopes = []string{
+	ScopeBooksRead, ScopeBooksWrite,
+	ScopeAuthorsRead, ScopeAuthorsWrite,
+	ScopeListsRead, ScopeListsWrite,
+	ScopeSearchRead,
+}
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to spot.
+const APIKeyPrefix = "bsk_"
+
+// API key errors.
+var (
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrAPIKeyExpired  = errors.New("API key expired")
+)
+
+// APIKeyHeader is the request header that carries an API key. Keys are also
+// accepted as bearer tokens.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey describes an API key. The key itself is only returned once, when
+// it is created; the store keeps a hash of it.
+type APIKey struct {
+	ID string `json:"id"`
+	// Prefix is the start of the key, bsk_<id>, to tell keys apart.
+	Prefix    string     `json:"prefix"`
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the key has expired at now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// storedAPIKey is an API key as stored: its description and the SHA-256
+// hash of the key. Keys are random, so a fast hash is enough.
+type storedAPIKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// APIKeyStore keeps API keys, in memory or in a JSON file. It is safe for
+// concurrent use.
+type APIKeyStore struct {
+	path string
+	now  func() time.Time
+
+	mu     sync.RWMutex
+	keys   map[string]*storedAPIKey
+	closed bool
+}
+
+// NewAPIKeyStore loads the API keys in path. With an empty path keys are
+// only kept in memory; a missing file is created on the first write.
+func NewAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{path: path, now: time.Now, keys: make(map[string]*storedAPIKey)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []*storedAPIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+// Create makes a new key for owner and returns it with its description.
+// expiresAt may be nil for a key that does not expire.
+func (s *APIKeyStore) Create(owner, name string, scopes []string, expiresAt *time.Time) (string, *APIKey, error) {
+	if err := s.validate(name, scopes, expiresAt); err != nil {
+		return "", nil, err
+	}
+
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	k := &storedAPIKey{APIKey: APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Owner:     owner,
+		Scopes:    append([]string(nil), scopes...),
+		CreatedAt: s.now().UTC(),
+		ExpiresAt: expiresAt,
+	}}
+	k.Prefix = APIKeyPrefix + k.ID
+	key := k.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hashAPIKey(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	if err := s.save(); err != nil {
+		delete(s.keys, k.ID)
+		return "", nil, err
+	}
+	desc := k.APIKey
+	return key, &desc, nil
+}
+
+func (s *APIKeyStore) validate(name string, scopes []string, expiresAt *time.Time) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	for _, scope := range scopes {
+		if !containsString(Scopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q: want one of %s", ErrInvalidAPIKey, scope, strings.Join(Scopes, ", "))
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(s.now()) {
+		return fmt.Errorf("%w: expiry must be in the future", ErrInvalidAPIKey)
+	}
+	return nil
+}
+
+// List returns the keys of owner, or every key if owner is empty, oldest
+// first.
+func (s *APIKeyStore) List(owner string) []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		if owner == "" || k.Owner == owner {
+			keys = append(keys, k.APIKey)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Get returns the key with the given ID.
+func (s *APIKeyStore) Get(id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	desc := k.APIKey
+	return &desc, nil
+}
+
+// Revoke deletes the key with the given ID.
+func (s *APIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.keys, id)
+	if err := s.save(); err != nil {
+		s.keys[id] = k
+		return err
+	}
+	return nil
+}
+
+// RevokeOwner deletes every key of owner.
+func (s *APIKeyStore) RevokeOwner(owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := make(map[string]*storedAPIKey)
+	for id, k := range s.keys {
+		if k.Owner == owner {
+			removed[id] = k
+			delete(s.keys, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		for id, k := range removed {
+			s.keys[id] = k
+		}
+		return err
+	}
+	return nil
+}
+
+// Authenticate returns the key matching key, unless it is unknown or has
+// expired.
+func (s *APIKeyStore) Authenticate(key string) (*APIKey, error) {
+	id, ok := apiKeyID(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	s.mu.RLock()
+	k, exists := s.keys[id]
+	s.mu.RUnlock()
+	if !exists || subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(k.Hash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if k.Expired(s.now()) {
+		return nil, ErrAPIKeyExpired
+	}
+	desc := k.APIKey
+	return &desc, nil
+}
+
+// Close waits for writes in progress and makes later writes fail with
+// ErrStoreClosed, so that the file is not written after shutdown.
+func (s *APIKeyStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// save writes the keys to the file, if there is one. The caller holds mu.
+func (s *APIKeyStore) save() error {
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if s.path == "" {
+		return nil
+	}
+	keys := make([]*storedAPIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, append(data, '\n'))
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyID returns the ID in a key of the form bsk_<id>_<secret>.
+func apiKeyID(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	return id, ok && id != "" && secret != ""
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// requestAPIKey returns the API key a request carries in the X-API-Key
+// header, or as a bearer token.
+func requestAPIKey(r *http.Request) (string, bool) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key, true
+	}
+	if token, ok := BearerToken(r); ok && strings.HasPrefix(token, APIKeyPrefix) {
+		return token, true
+	}
+	return "", false
+}
+
+// APIKeyAuth returns a middleware that requires a valid API key. The user
+// it adds to the context is the key's owner, with no role and the key's
+// scopes. If store can look accounts up, the owner must also still have an
+// enabled account, as for bearer tokens; store may be nil.
+func APIKeyAuth(store UserStore, keys *APIKeyStore, realm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := requestAPIKey(r)
+			if !ok {
+				requireBearer(w, realm)
+				return
+			}
+
+			k, err := keys.Authenticate(key)
+			if err != nil {
+				requireBearer(w, realm)
+				return
+			}
+			if lookup, ok := store.(UserLookup); ok {
+				if _, ok := lookup.LookupUser(k.Owner); !ok {
+					requireBearer(w, realm)
+					return
+				}
+			}
+
+			// Add user to context
+			user := &User{Username: k.Owner, APIKey: k.ID, Scopes: k.Scopes}
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WithAPIKeys returns a middleware that authenticates requests carrying an
+// API key with APIKeyAuth, and all others with fallback.
+func WithAPIKeys(store UserStore, keys *APIKeyStore, realm string, fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		keyNext, fallbackNext := APIKeyAuth(store, keys, realm)(next), fallback(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := requestAPIKey(r); ok {
+				keyNext.ServeHTTP(w, r)
+				return
+			}
+			fallbackNext.ServeHTTP(w, r)
+		})
+	}
+}
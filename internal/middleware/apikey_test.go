@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyStore_CreateAuthenticate(t *testing.T) {
+	keys, _ := NewAPIKeyStore("")
+
+	key, desc, err := keys.Create("alice", "ci", []string{ScopeBooksRead}, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(key, desc.Prefix+"_") || desc.Prefix != APIKeyPrefix+desc.ID {
+		t.Errorf("Key %q should start with its prefix %q", key, desc.Prefix)
+	}
+
+	got, err := keys.Authenticate(key)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, desc) {
+		t.Errorf("Authenticate() = %+v, want %+v", got, desc)
+	}
+
+	for _, bad := range []string{"", "bsk_", desc.Prefix + "_", desc.Prefix + "_wrong", key + "x", strings.TrimPrefix(key, APIKeyPrefix)} {
+		if _, err := keys.Authenticate(bad); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrInvalidAPIKey", bad, err)
+		}
+	}
+}
+
+func TestAPIKeyStore_CreateInvalid(t *testing.T) {
+	keys, _ := NewAPIKeyStore("")
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		keyName   string
+		scopes    []string
+		expiresAt *time.Time
+	}{
+		{"no name", " ", []string{ScopeBooksRead}, nil},
+		{"no scopes", "ci", nil, nil},
+		{"unknown scope", "ci", []string{"books:delete"}, nil},
+		{"expired", "ci", []string{ScopeBooksRead}, &past},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := keys.Create("alice", tt.keyName, tt.scopes, tt.expiresAt); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("Create() error = %v, want ErrInvalidAPIKey", err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyStore_Expiry(t *testing.T) {
+	keys, _ := NewAPIKeyStore("")
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	expiresAt := now.Add(time.Hour)
+	key, _, err := keys.Create("alice", "ci", []string{ScopeBooksRead}, &expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(key); err != nil {
+		t.Fatalf("Authenticate before expiry failed: %v", err)
+	}
+
+	keys.now = func() time.Time { return expiresAt }
+	if _, err := keys.Authenticate(key); !errors.Is(err, ErrAPIKeyExpired) {
+		t.Errorf("Authenticate after expiry error = %v, want ErrAPIKeyExpired", err)
+	}
+}
+
+func TestAPIKeyStore_Revoke(t *testing.T) {
+	keys, _ := NewAPIKeyStore("")
+	key1, desc1, _ := keys.Create("alice", "one", []string{ScopeBooksRead}, nil)
+	key2, _, _ := keys.Create("alice", "two", []string{ScopeBooksRead}, nil)
+	key3, _, _ := keys.Create("bob", "three", []string{ScopeBooksRead}, nil)
+
+	if got := len(keys.List("alice")); got != 2 {
+		t.Errorf("List(alice) returned %d keys, want 2", got)
+	}
+	if got := len(keys.List("")); got != 3 {
+		t.Errorf("List() returned %d keys, want 3", got)
+	}
+
+	if err := keys.Revoke(desc1.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if err := keys.Revoke(desc1.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Second Revoke error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if _, err := keys.Authenticate(key1); err == nil {
+		t.Error("Revoked key should not authenticate")
+	}
+
+	if err := keys.RevokeOwner("alice"); err != nil {
+		t.Fatalf("RevokeOwner failed: %v", err)
+	}
+	if _, err := keys.Authenticate(key2); err == nil {
+		t.Error("Keys of a revoked owner should not authenticate")
+	}
+	if _, err := keys.Authenticate(key3); err != nil {
+		t.Errorf("Other owners' keys should still authenticate: %v", err)
+	}
+}
+
+func TestAPIKeyStore_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStore failed: %v", err)
+	}
+	key, _, err := keys.Create("alice", "ci", []string{ScopeBooksRead, ScopeListsWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), key) {
+		t.Error("Keys file should not contain the key itself")
+	}
+
+	reloaded, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	got, err := reloaded.Authenticate(key)
+	if err != nil {
+		t.Fatalf("Authenticate after reload failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Scopes, []string{ScopeBooksRead, ScopeListsWrite}) {
+		t.Errorf("Scopes = %v", got.Scopes)
+	}
+
+	// A closed store still authenticates but no longer writes the file
+	reloaded.Close()
+	if _, _, err := reloaded.Create("alice", "late", []string{ScopeBooksRead}, nil); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("Create after Close error = %v, want ErrStoreClosed", err)
+	}
+	if _, err := reloaded.Authenticate(key); err != nil {
+		t.Errorf("Authenticate after Close failed: %v", err)
+	}
+
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := NewAPIKeyStore(path); err == nil {
+		t.Error("Expected an error for an invalid keys file")
+	}
+}
+
+func TestWithAPIKeys(t *testing.T) {
+	keys, _ := NewAPIKeyStore("")
+	key, desc, _ := keys.Create("alice", "ci", []string{ScopeBooksRead}, nil)
+	orphan, _, _ := keys.Create("bob", "ci", []string{ScopeBooksRead}, nil)
+	users := NewInMemoryUserStore()
+	users.AddUser("admin", "secret", "admin")
+	users.AddUser("alice", "secret", "user")
+
+	var got *User
+	h := WithAPIKeys(users, keys, "test", BasicAuth(users, "test"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUser(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		wantCode int
+		wantUser *User
+	}{
+		{"header", APIKeyHeader, key, http.StatusOK, &User{Username: "alice", APIKey: desc.ID, Scopes: []string{ScopeBooksRead}}},
+		{"bearer", "Authorization", "Bearer " + key, http.StatusOK, &User{Username: "alice", APIKey: desc.ID, Scopes: []string{ScopeBooksRead}}},
+		{"basic", "Authorization", EncodeBasicAuth("admin", "secret"), http.StatusOK, &User{Username: "admin", Role: "admin"}},
+		{"bad key", APIKeyHeader, key + "x", http.StatusUnauthorized, nil},
+		{"owner without account", APIKeyHeader, orphan, http.StatusUnauthorized, nil},
+		{"none", "", "", http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+			if !reflect.DeepEqual(got, tt.wantUser) {
+				t.Errorf("User = %+v, want %+v", got, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestUser_HasScope(t *testing.T) {
+	if !(&User{Username: "admin", Role: "admin"}).HasScope(ScopeBooksWrite) {
+		t.Error("Users without an API key should have every scope")
+	}
+	key := &User{Username: "alice", APIKey: "id", Scopes: []string{ScopeBooksRead}}
+	if !key.HasScope(ScopeBooksRead) || key.HasScope(ScopeBooksWrite) {
+		t.Error("API key users should only have their key's scopes")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 // contextKey is a custom type for context keys to avoid collisions.
@@ -26,6 +27,19 @@ type Credentials struct {
 type User struct {
 	Username string
 	Role     string
+	// APIKey is the ID of the API key the user authenticated with, if any.
+	APIKey string
+	// Scopes limits what an API key may do. Users who authenticated
+	// otherwise are only limited by their role.
+	Scopes []string
+	// External marks users authenticated by an identity provider, who
+	// have no local account.
+	External bool
+}
+
+// HasScope reports whether the user may act within scope.
+func (u *User) HasScope(scope string) bool {
+	return u.APIKey == "" || containsString(u.Scopes, scope)
 }
 
 // UserStore defines the interface for user authentication.
@@ -33,8 +47,18 @@ type UserStore interface {
 	Authenticate(username, password string) (*User, bool)
 }
 
-// InMemoryUserStore is a simple in-memory user store.
+// UserLookup is implemented by user stores that can look up an account
+// without its password, so that bearer tokens stop working when their
+// account is removed, disabled or changes role.
+type UserLookup interface {
+	// LookupUser returns the user of an enabled account.
+	LookupUser(username string) (*User, bool)
+}
+
+// InMemoryUserStore is a simple in-memory user store. It keeps plaintext
+// passwords, so use FileUserStore outside tests and single-admin setups.
 type InMemoryUserStore struct {
+	mu    sync.RWMutex
 	users map[string]Credentials
 	roles map[string]string
 }
@@ -49,13 +73,18 @@ func NewInMemoryUserStore() *InMemoryUserStore {
 
 // AddUser adds a user to the store.
 func (s *InMemoryUserStore) AddUser(username, password, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.users[username] = Credentials{Username: username, Password: password}
 	s.roles[username] = role
 }
 
 // Authenticate checks if the credentials are valid.
 func (s *InMemoryUserStore) Authenticate(username, password string) (*User, bool) {
+	s.mu.RLock()
 	creds, exists := s.users[username]
+	role := s.roles[username]
+	s.mu.RUnlock()
 	if !exists {
 		return nil, false
 	}
@@ -67,10 +96,20 @@ func (s *InMemoryUserStore) Authenticate(username, password string) (*User, bool
 
 	return &User{
 		Username: username,
-		Role:     s.roles[username],
+		Role:     role,
 	}, true
 }
 
+// LookupUser returns the user with the given username.
+func (s *InMemoryUserStore) LookupUser(username string) (*User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, exists := s.users[username]; !exists {
+		return nil, false
+	}
+	return &User{Username: username, Role: s.roles[username]}, true
+}
+
 // BasicAuth returns a middleware that requires HTTP Basic Authentication.
 func BasicAuth(store UserStore, realm string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
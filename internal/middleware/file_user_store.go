@@ -0,0 +1,545 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/pkg/validator"
+)
+
+// User store errors.
+var (
+	ErrInvalidUser  = errors.New("invalid user")
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+	// ErrStoreClosed is returned by writes to a closed user or API key store.
+	ErrStoreClosed = errors.New("store is closed")
+)
+
+// MinPasswordLength is the shortest password CreateAccount and SetPassword
+// accept.
+const MinPasswordLength = 8
+
+// Account is a user account, without its password.
+type Account struct {
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	Role     string `json:"role"`
+	// Disabled accounts cannot log in.
+	Disabled bool `json:"disabled"`
+}
+
+// Validate checks that the account can be stored.
+func (a *Account) Validate() error {
+	if a.Username == "" || strings.TrimSpace(a.Username) != a.Username || strings.ContainsAny(a.Username, ":\n") {
+		return fmt.Errorf("%w: username must be non-empty without colons or surrounding spaces", ErrInvalidUser)
+	}
+	if validator.MaxLength(a.Username, 64) != nil {
+		return fmt.Errorf("%w: username must be 64 characters or less", ErrInvalidUser)
+	}
+	if strings.ContainsAny(a.Role, ":\n") {
+		return fmt.Errorf("%w: role must not contain colons", ErrInvalidUser)
+	}
+	if a.Email != "" && validator.Email(a.Email) != nil {
+		return fmt.Errorf("%w: invalid email %q", ErrInvalidUser, a.Email)
+	}
+	return nil
+}
+
+// fileUser is one account in a users file.
+type fileUser struct {
+	Account
+	PasswordHash string `json:"password_hash"`
+}
+
+// FileUserStore is a UserStore backed by a file of password hashes. The file
+// is either JSON, an array of {"username", "password_hash", "role", "email",
+// "disabled"} objects, or htpasswd-style lines of
+// username:hash[:role[:email]] with # comments, where a hash prefixed with
+// "!" marks a disabled account. Files named *.json are read as JSON.
+//
+// The store reloads the file when it changes, and rewrites a user's hash in
+// it on login when the hash was made with other parameters than the store's.
+// It is safe for concurrent use.
+type FileUserStore struct {
+	path   string
+	json   bool
+	params HashParams
+	// dummyHash is verified for unknown users so they take as long to
+	// reject as wrong passwords.
+	dummyHash string
+
+	// reloadInterval is how often the file is checked for changes.
+	reloadInterval time.Duration
+
+	// checked is when the file was last checked, in Unix nanoseconds. It is
+	// atomic so that requests between checks do not take the lock.
+	checked atomic.Int64
+
+	mu     sync.RWMutex
+	users  map[string]*fileUser
+	order  []string // usernames in file order
+	lines  []string // raw htpasswd lines, to keep comments when rewriting
+	stamp  fileStamp
+	closed bool
+}
+
+// fileStamp identifies a version of the users file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewFileUserStore loads the users in path, hashing new passwords with
+// params. A missing file is treated as empty and created on the first write.
+func NewFileUserStore(path string, params HashParams) (*FileUserStore, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	dummy, err := params.Hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileUserStore{
+		path:           path,
+		json:           strings.EqualFold(filepath.Ext(path), ".json"),
+		params:         params,
+		dummyHash:      dummy,
+		reloadInterval: time.Second,
+		users:          make(map[string]*fileUser),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Authenticate checks if the credentials are valid and the account is
+// enabled.
+func (s *FileUserStore) Authenticate(username, password string) (*User, bool) {
+	s.reloadIfChanged()
+
+	s.mu.RLock()
+	u, exists := s.users[username]
+	var stored fileUser
+	if exists {
+		stored = *u
+	}
+	s.mu.RUnlock()
+
+	if !exists {
+		s.params.Verify(s.dummyHash, password)
+		return nil, false
+	}
+	ok, rehash, err := s.params.Verify(stored.PasswordHash, password)
+	if err != nil || !ok || stored.Disabled {
+		return nil, false
+	}
+	if rehash {
+		s.rehash(stored, password)
+	}
+	return &User{Username: stored.Username, Role: stored.Role}, true
+}
+
+// LookupUser returns the user of username's account, unless it is
+// disabled.
+func (s *FileUserStore) LookupUser(username string) (*User, bool) {
+	a, err := s.Account(username)
+	if err != nil || a.Disabled {
+		return nil, false
+	}
+	return &User{Username: a.Username, Role: a.Role}, true
+}
+
+// AddUser adds an enabled user, or replaces their password and role, and
+// saves the file. Unlike CreateAccount it does not check password length,
+// so configured passwords can be loaded as they are.
+func (s *FileUserStore) AddUser(username, password, role string) error {
+	a := Account{Username: username, Role: role}
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	hash, err := s.hashPassword(password, 1)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, exists := s.users[username]
+	if exists {
+		a.Email = previous.Email
+	} else {
+		s.order = append(s.order, username)
+	}
+	s.users[username] = &fileUser{Account: a, PasswordHash: hash}
+	if err := s.save(); err != nil {
+		if exists {
+			s.users[username] = previous
+		} else {
+			delete(s.users, username)
+			s.order = s.order[:len(s.order)-1]
+		}
+		return err
+	}
+	return nil
+}
+
+// HasUser reports whether the store has an account for username.
+func (s *FileUserStore) HasUser(username string) bool {
+	_, err := s.Account(username)
+	return err == nil
+}
+
+// Accounts returns all accounts in file order.
+func (s *FileUserStore) Accounts() []Account {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accounts := make([]Account, 0, len(s.order))
+	for _, name := range s.order {
+		accounts = append(accounts, s.users[name].Account)
+	}
+	return accounts
+}
+
+// Account returns the account of username.
+func (s *FileUserStore) Account(username string) (Account, error) {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return Account{}, ErrUserNotFound
+	}
+	return u.Account, nil
+}
+
+// CreateAccount adds a new account with password and saves the file.
+func (s *FileUserStore) CreateAccount(a Account, password string) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	hash, err := s.hashPassword(password, MinPasswordLength)
+	if err != nil {
+		return err
+	}
+
+	s.reloadIfChanged()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[a.Username]; exists {
+		return ErrUserExists
+	}
+	s.users[a.Username] = &fileUser{Account: a, PasswordHash: hash}
+	s.order = append(s.order, a.Username)
+	if err := s.save(); err != nil {
+		delete(s.users, a.Username)
+		s.order = s.order[:len(s.order)-1]
+		return err
+	}
+	return nil
+}
+
+// UpdateAccount applies update to the account of username and saves the
+// file. The username cannot be changed.
+func (s *FileUserStore) UpdateAccount(username string, update func(*Account) error) (Account, error) {
+	s.reloadIfChanged()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return Account{}, ErrUserNotFound
+	}
+	a := u.Account
+	if err := update(&a); err != nil {
+		return Account{}, err
+	}
+	a.Username = username
+	if err := a.Validate(); err != nil {
+		return Account{}, err
+	}
+
+	old := u.Account
+	u.Account = a
+	if err := s.save(); err != nil {
+		u.Account = old
+		return Account{}, err
+	}
+	return a, nil
+}
+
+// SetPassword replaces the password of username and saves the file.
+func (s *FileUserStore) SetPassword(username, password string) error {
+	hash, err := s.hashPassword(password, MinPasswordLength)
+	if err != nil {
+		return err
+	}
+
+	s.reloadIfChanged()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	old := u.PasswordHash
+	u.PasswordHash = hash
+	if err := s.save(); err != nil {
+		u.PasswordHash = old
+		return err
+	}
+	return nil
+}
+
+// hashPassword hashes password after checking it has at least minLength
+// characters.
+func (s *FileUserStore) hashPassword(password string, minLength int) (string, error) {
+	if validator.MinLength(password, minLength) != nil {
+		return "", fmt.Errorf("%w: password must be at least %d characters", ErrInvalidUser, minLength)
+	}
+	return s.params.Hash(password)
+}
+
+// Reload reads the users file again.
+func (s *FileUserStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// reloadIfChanged reloads the file if it changed since it was last read,
+// checking at most once per reloadInterval. A file that fails to load is
+// logged and the current users are kept.
+func (s *FileUserStore) reloadIfChanged() {
+	now := time.Now().UnixNano()
+	last := s.checked.Load()
+	if now-last < int64(s.reloadInterval) || !s.checked.CompareAndSwap(last, now) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp, err := s.statFile()
+	if err != nil || stamp == s.stamp {
+		return
+	}
+	if err := s.load(); err != nil {
+		log.Printf("Keeping previous users; failed to reload %s: %v", s.path, err)
+	}
+}
+
+// rehash replaces the hash of u, verified with password, with one made with
+// the store's parameters, unless it changed in the meantime.
+func (s *FileUserStore) rehash(u fileUser, password string) {
+	hash, err := s.params.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password of %s: %v", u.Username, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.users[u.Username]
+	if !ok || current.PasswordHash != u.PasswordHash {
+		return
+	}
+	current.PasswordHash = hash
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save rehashed password of %s: %v", u.Username, err)
+	}
+}
+
+func (s *FileUserStore) statFile() (fileStamp, error) {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileStamp{}, nil
+	}
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// load replaces the users with the file's. The caller holds mu.
+func (s *FileUserStore) load() error {
+	stamp, err := s.statFile()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var users []fileUser
+	var lines []string
+	if s.json {
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := json.Unmarshal(data, &users); err != nil {
+				return fmt.Errorf("parse %s: %w", s.path, err)
+			}
+		}
+	} else {
+		if users, lines, err = parseHtpasswd(data); err != nil {
+			return fmt.Errorf("parse %s: %w", s.path, err)
+		}
+	}
+
+	byName := make(map[string]*fileUser, len(users))
+	order := make([]string, 0, len(users))
+	for i := range users {
+		u := &users[i]
+		if err := u.Validate(); err != nil {
+			return fmt.Errorf("parse %s: user %d: %w", s.path, i+1, err)
+		}
+		if _, dup := byName[u.Username]; dup {
+			return fmt.Errorf("parse %s: duplicate user %q", s.path, u.Username)
+		}
+		if err := CheckHash(u.PasswordHash); err != nil {
+			return fmt.Errorf("parse %s: user %q: %w", s.path, u.Username, err)
+		}
+		byName[u.Username] = u
+		order = append(order, u.Username)
+	}
+
+	s.users, s.order, s.lines, s.stamp = byName, order, lines, stamp
+	return nil
+}
+
+// parseHtpasswd parses username:hash[:role[:email]] lines, skipping blank
+// lines and # comments. It also returns the raw lines.
+func parseHtpasswd(data []byte) ([]fileUser, []string, error) {
+	var users []fileUser
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		lines = append(lines, line)
+		u, ok, err := parseHtpasswdLine(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if ok {
+			users = append(users, u)
+		}
+	}
+	return users, lines, scanner.Err()
+}
+
+// parseHtpasswdLine parses one line, returning false for blank lines and
+// comments.
+func parseHtpasswdLine(line string) (fileUser, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return fileUser{}, false, nil
+	}
+	parts := strings.Split(line, ":")
+	if len(parts) < 2 || len(parts) > 4 {
+		return fileUser{}, false, errors.New("want username:hash[:role[:email]]")
+	}
+	u := fileUser{Account: Account{Username: parts[0]}, PasswordHash: parts[1]}
+	if hash, ok := strings.CutPrefix(u.PasswordHash, "!"); ok {
+		u.PasswordHash, u.Disabled = hash, true
+	}
+	if len(parts) > 2 {
+		u.Role = parts[2]
+	}
+	if len(parts) > 3 {
+		u.Email = parts[3]
+	}
+	return u, true, nil
+}
+
+// Close waits for writes in progress and makes later writes fail with
+// ErrStoreClosed, so that the file is not written after shutdown.
+func (s *FileUserStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// save writes the users to the file, replacing it atomically. Rewritten
+// htpasswd files keep their comments and order; new users are appended.
+// The caller holds mu.
+func (s *FileUserStore) save() error {
+	if s.closed {
+		return ErrStoreClosed
+	}
+	var buf bytes.Buffer
+	if s.json {
+		users := make([]fileUser, 0, len(s.order))
+		for _, name := range s.order {
+			users = append(users, *s.users[name])
+		}
+		data, err := json.MarshalIndent(users, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	} else {
+		written := make(map[string]bool, len(s.users))
+		var lines []string
+		for _, line := range s.lines {
+			if u, ok, _ := parseHtpasswdLine(line); ok {
+				current, exists := s.users[u.Username]
+				if !exists {
+					continue
+				}
+				line = htpasswdLine(current)
+				written[u.Username] = true
+			}
+			lines = append(lines, line)
+		}
+		for _, name := range s.order {
+			if !written[name] {
+				lines = append(lines, htpasswdLine(s.users[name]))
+			}
+		}
+		for _, line := range lines {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+		s.lines = lines
+	}
+
+	if err := writeFileAtomic(s.path, buf.Bytes()); err != nil {
+		return err
+	}
+	stamp, err := s.statFile()
+	if err != nil {
+		return err
+	}
+	s.stamp = stamp
+	return nil
+}
+
+func htpasswdLine(u *fileUser) string {
+	hash := u.PasswordHash
+	if u.Disabled {
+		hash = "!" + hash
+	}
+	fields := []string{u.Username, hash, u.Role, u.Email}
+	for len(fields) > 2 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return strings.Join(fields, ":")
+}
@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeUsersFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Give each write a distinct modification time
+	later := time.Now().Add(time.Duration(len(content)) * time.Second)
+	os.Chtimes(path, later, later)
+}
+
+func TestFileUserStore_Htpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	adminHash, _ := testArgon2.Hash("secret123")
+	readerHash, _ := testBcrypt.Hash("readonly")
+	writeUsersFile(t, path, "# accounts\nadmin:"+adminHash+":admin\n\nreader:"+readerHash+"\n")
+
+	store, err := NewFileUserStore(path, testArgon2)
+	if err != nil {
+		t.Fatalf("NewFileUserStore failed: %v", err)
+	}
+
+	user, ok := store.Authenticate("admin", "secret123")
+	if !ok || user.Username != "admin" || user.Role != "admin" {
+		t.Errorf("Authenticate(admin) = %+v, %v", user, ok)
+	}
+	if _, ok := store.Authenticate("admin", "wrong"); ok {
+		t.Error("Wrong password should fail")
+	}
+	if _, ok := store.Authenticate("nobody", "secret123"); ok {
+		t.Error("Unknown user should fail")
+	}
+
+	// reader's bcrypt hash is replaced by an argon2id one on login, keeping
+	// the rest of the file as it was
+	if user, ok := store.Authenticate("reader", "readonly"); !ok || user.Role != "" {
+		t.Fatalf("Authenticate(reader) = %+v, %v", user, ok)
+	}
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 4 || lines[0] != "# accounts" || lines[1] != "admin:"+adminHash+":admin" || lines[2] != "" {
+		t.Errorf("Rewritten file = %q", data)
+	}
+	if !strings.HasPrefix(lines[3], "reader:$argon2id$") {
+		t.Errorf("reader was not rehashed: %q", lines[3])
+	}
+	if _, ok := store.Authenticate("reader", "readonly"); !ok {
+		t.Error("Rehashed password should still work")
+	}
+}
+
+func TestFileUserStore_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	store, err := NewFileUserStore(path, testBcrypt)
+	if err != nil {
+		t.Fatalf("NewFileUserStore on a missing file failed: %v", err)
+	}
+	if err := store.AddUser("admin", "secret123", "admin"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if err := store.AddUser("bad:name", "pw", ""); !errors.Is(err, ErrInvalidUser) {
+		t.Errorf("AddUser(bad:name) error = %v, want ErrInvalidUser", err)
+	}
+
+	var users []fileUser
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &users); err != nil || len(users) != 1 {
+		t.Fatalf("File = %s (%v)", data, err)
+	}
+	if users[0].Username != "admin" || users[0].Role != "admin" || !strings.HasPrefix(users[0].PasswordHash, "$2a$04$") {
+		t.Errorf("Stored user = %+v", users[0])
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("File mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	reopened, err := NewFileUserStore(path, testBcrypt)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if _, ok := reopened.Authenticate("admin", "secret123"); !ok {
+		t.Error("Saved user should authenticate after reopening")
+	}
+}
+
+func TestFileUserStore_ReloadOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	hash, _ := testArgon2.Hash("pw")
+	writeUsersFile(t, path, "alice:"+hash+"\n")
+
+	store, err := NewFileUserStore(path, testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.reloadInterval = 0
+
+	writeUsersFile(t, path, "alice:"+hash+"\nbob:"+hash+":editor\n")
+	if user, ok := store.Authenticate("bob", "pw"); !ok || user.Role != "editor" {
+		t.Errorf("Added user after reload = %+v, %v", user, ok)
+	}
+
+	// A broken file keeps the previous users
+	writeUsersFile(t, path, "alice:plaintext\n")
+	if _, ok := store.Authenticate("bob", "pw"); !ok {
+		t.Error("Users should be kept when the file fails to load")
+	}
+
+	writeUsersFile(t, path, "bob:"+hash+"\n")
+	if _, ok := store.Authenticate("alice", "pw"); ok {
+		t.Error("Removed user should no longer authenticate")
+	}
+}
+
+func TestFileUserStore_ReloadInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	hash, _ := testArgon2.Hash("pw")
+	writeUsersFile(t, path, "alice:"+hash+"\n")
+
+	store, err := NewFileUserStore(path, testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.reloadInterval = time.Hour
+	store.Authenticate("alice", "pw")
+
+	writeUsersFile(t, path, "alice:"+hash+"\nbob:"+hash+"\n")
+	if _, ok := store.Authenticate("bob", "pw"); ok {
+		t.Error("File should not be checked again within the interval")
+	}
+	store.checked.Store(time.Now().Add(-time.Hour).UnixNano())
+	if _, ok := store.Authenticate("bob", "pw"); !ok {
+		t.Error("File should be checked again after the interval")
+	}
+}
+
+func TestFileUserStore_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	store, err := NewFileUserStore(path, testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.AddUser("alice", "pw", "user")
+
+	store.Close()
+	if err := store.AddUser("bob", "pw", "user"); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("AddUser after Close error = %v, want ErrStoreClosed", err)
+	}
+	if err := store.AddUser("alice", "other", "admin"); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("AddUser after Close error = %v, want ErrStoreClosed", err)
+	}
+	if store.HasUser("bob") || len(store.Accounts()) != 1 {
+		t.Errorf("Failed AddUser should leave the accounts unchanged, got %v", store.Accounts())
+	}
+	if user, ok := store.Authenticate("alice", "pw"); !ok || user.Role != "user" {
+		t.Errorf("Users should still authenticate unchanged after Close, got %+v", user)
+	}
+	if reloaded, _ := NewFileUserStore(path, testArgon2); reloaded.HasUser("bob") {
+		t.Error("Users file should not be written after Close")
+	}
+}
+
+func TestNewFileUserStore_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	hash, _ := testArgon2.Hash("pw")
+	for name, content := range map[string]string{
+		"plaintext": "alice:secret\n",
+		"fields":    "alice:" + hash + ":admin:alice@example.com:extra\n",
+		"email":     "alice:" + hash + ":admin:not-an-email\n",
+		"duplicate": "alice:" + hash + "\nalice:" + hash + "\n",
+		"bad.json":  `{"username":"alice"}`,
+	} {
+		path := filepath.Join(dir, name)
+		writeUsersFile(t, path, content)
+		if _, err := NewFileUserStore(path, testArgon2); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := NewFileUserStore(filepath.Join(dir, "users"), HashParams{Algorithm: "md5"}); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
+
+func TestFileUserStore_Concurrent(t *testing.T) {
+	store, err := NewFileUserStore(filepath.Join(t.TempDir(), "users"), testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.reloadInterval = 0
+	store.AddUser("admin", "secret123", "admin")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.Authenticate("admin", "secret123")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			store.AddUser("user"+string(rune('a'+i)), "pw", "user")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		if !store.HasUser("user" + string(rune('a'+i))) {
+			t.Errorf("user%c missing", 'a'+i)
+		}
+	}
+}
+
+func TestFileUserStore_Accounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	store, err := NewFileUserStore(path, testArgon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := Account{Username: "alice", Email: "alice@example.com", Role: "user"}
+	if err := store.CreateAccount(alice, "password1"); err != nil {
+		t.Fatalf("CreateAccount failed: %v", err)
+	}
+	if err := store.CreateAccount(alice, "password1"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Duplicate CreateAccount error = %v, want ErrUserExists", err)
+	}
+	for _, tt := range []struct {
+		account  Account
+		password string
+	}{
+		{Account{Username: "bob", Email: "not-an-email", Role: "user"}, "password1"},
+		{Account{Username: "bob", Role: "user"}, "short"},
+		{Account{Username: " bob", Role: "user"}, "password1"},
+	} {
+		if err := store.CreateAccount(tt.account, tt.password); !errors.Is(err, ErrInvalidUser) {
+			t.Errorf("CreateAccount(%+v, %q) error = %v, want ErrInvalidUser", tt.account, tt.password, err)
+		}
+	}
+
+	updated, err := store.UpdateAccount("alice", func(a *Account) error {
+		a.Role, a.Disabled = "editor", true
+		return nil
+	})
+	if err != nil || updated.Role != "editor" || !updated.Disabled {
+		t.Fatalf("UpdateAccount = %+v, %v", updated, err)
+	}
+	if _, ok := store.Authenticate("alice", "password1"); ok {
+		t.Error("Disabled account should not authenticate")
+	}
+	if _, err := store.UpdateAccount("nobody", func(*Account) error { return nil }); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateAccount(nobody) error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := store.UpdateAccount("alice", func(a *Account) error { a.Email = "bad"; return nil }); !errors.Is(err, ErrInvalidUser) {
+		t.Errorf("UpdateAccount with bad email error = %v, want ErrInvalidUser", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "alice:!$argon2id$") || !strings.HasSuffix(string(data), ":editor:alice@example.com\n") {
+		t.Errorf("File = %q, want a disabled alice line", data)
+	}
+
+	store.UpdateAccount("alice", func(a *Account) error { a.Disabled = false; return nil })
+	if err := store.SetPassword("alice", "password2"); err != nil {
+		t.Fatalf("SetPassword failed: %v", err)
+	}
+	if _, ok := store.Authenticate("alice", "password1"); ok {
+		t.Error("Old password should no longer work")
+	}
+
+	reopened, _ := NewFileUserStore(path, testArgon2)
+	if got := reopened.Accounts(); len(got) != 1 || got[0] != (Account{Username: "alice", Email: "alice@example.com", Role: "editor"}) {
+		t.Errorf("Accounts after reopening = %+v", got)
+	}
+	if user, ok := reopened.Authenticate("alice", "password2"); !ok || user.Role != "editor" {
+		t.Errorf("Authenticate after reopening = %+v, %v", user, ok)
+	}
+}
@@ -0,0 +1,611 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDC errors.
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrOIDCProvider   = errors.New("identity provider error")
+)
+
+// Cookies set by the OpenID Connect login flow.
+const (
+	// SessionCookie holds the bearer token of a logged-in browser.
+	SessionCookie = "bookshelf_session"
+	// oidcStateCookie holds a login in progress, signed so that the
+	// server keeps no state for logins that are never completed.
+	oidcStateCookie = "bookshelf_oidc_state"
+)
+
+const (
+	// oidcFlowExpiry is how long a user has to log in at the provider.
+	oidcFlowExpiry = 10 * time.Minute
+	// oidcClockSkew is the leeway when checking ID token times.
+	oidcClockSkew = time.Minute
+)
+
+// OIDCConfig configures an OpenID Connect relying party.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the Callback handler, as
+	// registered with the provider.
+	RedirectURL string
+	// Scopes are requested at login; "openid" is always included.
+	Scopes []string
+	// UsernameClaim names the ID token claim that identifies the user,
+	// "sub" by default and when it is missing. Usernames are prefixed with
+	// "oidc:" and a hash of the issuer, so that they cannot be taken for
+	// local accounts, which have no colons.
+	UsernameClaim string
+	// RoleClaim names the ID token claim used as the role: a string, or
+	// the first string of an array. DefaultRole is used without it.
+	RoleClaim   string
+	DefaultRole string
+}
+
+// OIDC is an OpenID Connect relying party. It logs users in with the
+// authorization code flow and PKCE, verifies their ID token against the
+// issuer's JWKS, and keeps them logged in with a session cookie holding a
+// bearer token from tokens.
+type OIDC struct {
+	cfg    OIDCConfig
+	tokens *TokenManager
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	provider *oidcProvider
+	keys     map[string]*rsa.PublicKey // key ID -> key
+}
+
+// oidcProvider is the part of the provider's discovery document we use.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcFlow is a login in progress, kept in the state cookie.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"return_to"`
+	Expires  int64  `json:"exp"`
+}
+
+// NewOIDC creates a relying party. The provider is discovered on the first
+// login, so the server starts while the provider is down.
+func NewOIDC(cfg OIDCConfig, tokens *TokenManager) *OIDC {
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "sub"
+	}
+	if !containsString(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	return &OIDC{
+		cfg:    cfg,
+		tokens: tokens,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+// SetHTTPClient sets the client used to reach the provider.
+func (o *OIDC) SetHTTPClient(client *http.Client) {
+	o.client = client
+}
+
+// Login handles GET requests by redirecting to the provider's login page.
+// After logging in, the user is sent to the local path in ?return_to=, or /.
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, err := o.discover(r.Context())
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state, err1 := randomString()
+	nonce, err2 := randomString()
+	verifier, err3 := randomString()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	flow, err := o.encodeFlow(&oidcFlow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		ReturnTo: returnPath(r.URL.Query().Get("return_to")),
+		Expires:  o.now().Add(oidcFlowExpiry).Unix(),
+	})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.cfg.ClientID},
+		"redirect_uri":          {o.cfg.RedirectURL},
+		"scope":                 {strings.Join(o.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	o.setCookie(w, oidcStateCookie, flow, oidcFlowExpiry)
+	http.Redirect(w, r, withQuery(provider.AuthorizationEndpoint, params), http.StatusFound)
+}
+
+// Callback handles the provider's redirect back after login: it exchanges
+// the code for an ID token, verifies it and starts a session.
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+
+	// The state must match the browser's, so logins cannot be injected
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	flow, ok := o.decodeFlow(cookie.Value)
+	if !ok || flow.State != state {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	o.setCookie(w, oidcStateCookie, "", -1)
+	if !o.now().Before(time.Unix(flow.Expires, 0)) {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	if e := query.Get("error"); e != "" {
+		http.Error(w, "Login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, "Authorization code required", http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := o.exchange(r.Context(), code, flow.Verifier)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	claims, err := o.Verify(r.Context(), idToken, flow.Nonce)
+	if err != nil {
+		log.Printf("OIDC ID token rejected: %v", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	token, _, err := o.tokens.IssueExternal(o.user(claims))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	o.setCookie(w, SessionCookie, token, o.tokens.Expiry())
+	http.Redirect(w, r, flow.ReturnTo, http.StatusFound)
+}
+
+// Logout handles POST requests by revoking the session and clearing its
+// cookie. It only ends the session here, not at the provider.
+func (o *OIDC) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		if claims, err := o.tokens.Verify(cookie.Value); err == nil {
+			if err := o.tokens.Revoke(claims); err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	o.setCookie(w, SessionCookie, "", -1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Verify checks an ID token's signature against the provider's keys, its
+// issuer, audience, expiry and nonce, and returns its claims.
+func (o *OIDC) Verify(ctx context.Context, idToken, nonce string) (map[string]any, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+	key, err := o.key(ctx, provider, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	var std struct {
+		Issuer          string   `json:"iss"`
+		Subject         string   `json:"sub"`
+		Audience        audience `json:"aud"`
+		AuthorizedParty string   `json:"azp"`
+		ExpiresAt       int64    `json:"exp"`
+		IssuedAt        int64    `json:"iat"`
+		Nonce           string   `json:"nonce"`
+	}
+	var claims map[string]any
+	if decodeSegment(parts[1], &std) != nil || decodeSegment(parts[1], &claims) != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	now := o.now()
+	switch {
+	case std.Issuer != provider.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, std.Issuer)
+	case std.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	case !containsString(std.Audience, o.cfg.ClientID):
+		return nil, fmt.Errorf("%w: not issued to this client", ErrInvalidIDToken)
+	case len(std.Audience) > 1 && std.AuthorizedParty != o.cfg.ClientID:
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidIDToken, std.AuthorizedParty)
+	case !now.Add(-oidcClockSkew).Before(time.Unix(std.ExpiresAt, 0)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case now.Add(oidcClockSkew).Before(time.Unix(std.IssuedAt, 0)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case std.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// user maps ID token claims to a user.
+func (o *OIDC) user(claims map[string]any) *User {
+	username, _ := claims[o.cfg.UsernameClaim].(string)
+	if username == "" {
+		username, _ = claims["sub"].(string)
+	}
+
+	role := o.cfg.DefaultRole
+	switch v := claims[o.cfg.RoleClaim].(type) {
+	case string:
+		role = v
+	case []any:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				role = s
+			}
+		}
+	}
+	return &User{Username: externalUsername(o.cfg.Issuer, username), Role: role, External: true}
+}
+
+// externalUsername is the username of the user id of issuer: "oidc:", a
+// hash of the issuer, ":" and id.
+func externalUsername(issuer, id string) string {
+	sum := sha256.Sum256([]byte(issuer))
+	return "oidc:" + hex.EncodeToString(sum[:4]) + ":" + id
+}
+
+// discover fetches and caches the provider's discovery document.
+func (o *OIDC) discover(ctx context.Context) (*oidcProvider, error) {
+	o.mu.Lock()
+	provider := o.provider
+	o.mu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	provider = &oidcProvider{}
+	wellKnown := strings.TrimSuffix(o.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := o.getJSON(ctx, wellKnown, provider); err != nil {
+		return nil, err
+	}
+	if provider.Issuer != o.cfg.Issuer {
+		return nil, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrOIDCProvider, provider.Issuer, o.cfg.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrOIDCProvider)
+	}
+
+	o.mu.Lock()
+	o.provider = provider
+	o.mu.Unlock()
+	return provider, nil
+}
+
+// key returns the provider's signing key with the given ID, refetching the
+// JWKS when it is unknown, as happens after key rotation.
+func (o *OIDC) key(ctx context.Context, provider *oidcProvider, kid string) (*rsa.PublicKey, error) {
+	o.mu.Lock()
+	key, ok := o.keys[kid]
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(ctx, provider.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	o.mu.Lock()
+	o.keys = keys
+	o.mu.Unlock()
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+	return key, nil
+}
+
+// exchange redeems an authorization code at the token endpoint and returns
+// the ID token.
+func (o *OIDC) exchange(ctx context.Context, code, verifier string) (string, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if o.cfg.ClientSecret == "" {
+		form.Set("client_id", o.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: token response: %v", ErrOIDCProvider, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint returned %d %s", ErrOIDCProvider, resp.StatusCode, body.Error)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: no ID token in token response", ErrOIDCProvider)
+	}
+	return body.IDToken, nil
+}
+
+func (o *OIDC) getJSON(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: GET %s returned %d", ErrOIDCProvider, rawURL, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: GET %s: %v", ErrOIDCProvider, rawURL, err)
+	}
+	return nil
+}
+
+// oidcFlowPrefix separates the signatures of state cookies from those of
+// bearer tokens, which share the token manager's secret.
+const oidcFlowPrefix = "oidc-flow."
+
+// encodeFlow returns flow as a state cookie value signed by the token
+// manager.
+func (o *OIDC) encodeFlow(flow *oidcFlow) (string, error) {
+	data, err := json.Marshal(flow)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + o.tokens.sign(oidcFlowPrefix+payload), nil
+}
+
+// decodeFlow returns the flow in a state cookie value if its signature is
+// valid.
+func (o *OIDC) decodeFlow(value string) (*oidcFlow, bool) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(o.tokens.sign(oidcFlowPrefix+payload))) {
+		return nil, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(data, &flow); err != nil {
+		return nil, false
+	}
+	return &flow, true
+}
+
+// setCookie sets an HTTP-only cookie; a negative maxAge deletes it. Cookies
+// are Secure when the redirect URL is HTTPS, and SameSite=Lax so that other
+// sites cannot make authenticated writes with them.
+func (o *OIDC) setCookie(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(o.cfg.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// audience is an ID token's aud claim: a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// randomString returns 32 random bytes, base64url-encoded.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// returnPath returns path if it is local to this server, and / otherwise,
+// so the login cannot redirect to other sites.
+func returnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
+
+// withQuery adds params to the query of endpoint.
+func withQuery(endpoint string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + params.Encode()
+}
+
+// SessionAuth returns a middleware that authenticates requests with a
+// session cookie from an OIDC login, checking non-external tokens in store
+// like BearerAuth. Requests with an Authorization header or without the
+// cookie are authenticated with fallback.
+func SessionAuth(store UserStore, tokens *TokenManager, realm string, fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fallbackNext := fallback(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(SessionCookie)
+			if err != nil || r.Header.Get("Authorization") != "" {
+				fallbackNext.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := AuthenticateToken(store, tokens, cookie.Value)
+			if err != nil {
+				requireBearer(w, realm)
+				return
+			}
+
+			// Add user to context
+			ctx := context.WithValue(r.Context(), UserContextKey, claims.User())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/middleware/oidctest"
+)
+
+const testRedirectURL = "http://bookshelf.test/auth/callback"
+
+func newTestOIDC(t *testing.T) (*OIDC, *oidctest.Provider) {
+	t.Helper()
+	provider, err := oidctest.NewProvider("bookshelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	rp := NewOIDC(OIDCConfig{
+		Issuer:      provider.Issuer(),
+		ClientID:    "bookshelf",
+		RedirectURL: testRedirectURL,
+		RoleClaim:   "groups",
+		DefaultRole: "user",
+	}, newTestTokenManager())
+	return rp, provider
+}
+
+// oidcLogin runs the login flow as a browser would, and returns the
+// callback's response.
+func oidcLogin(t *testing.T, rp *OIDC, returnTo string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	rp.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/login?return_to="+url.QueryEscape(returnTo), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Login: status %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+
+	// The provider logs the user in and redirects back with a code
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	resp.Body.Close()
+	callback := resp.Header.Get("Location")
+	if !strings.HasPrefix(callback, testRedirectURL+"?") {
+		t.Fatalf("Authorize redirected to %q", callback)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	rp.Callback(rec, req)
+	return rec
+}
+
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == SessionCookie && c.MaxAge > 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOIDC_Login(t *testing.T) {
+	rp, provider := newTestOIDC(t)
+	provider.SetClaims(map[string]any{
+		"sub":                "1234",
+		"preferred_username": "alice",
+		"groups":             []string{"admin", "staff"},
+	})
+
+	rec := oidcLogin(t, rp, "/api/books?limit=5")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/api/books?limit=5" {
+		t.Fatalf("Callback: status %d, Location %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	cookie := sessionCookie(rec)
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Session cookie = %+v", cookie)
+	}
+
+	var got *User
+	h := SessionAuth(newTestUserStore(), rp.tokens, "test", BearerAuth(nil, rp.tokens, "test"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUser(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+	req.AddCookie(cookie)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	want := &User{Username: externalUsername(rp.cfg.Issuer, "1234"), Role: "admin", External: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Session user = %+v, want %+v", got, want)
+	}
+
+	// Logging out revokes the session
+	logout := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	logout.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	rp.Logout(rec, logout)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Logout: expected status 204, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("After logout: expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_UserNamespace(t *testing.T) {
+	rp, _ := newTestOIDC(t)
+	rp.cfg.UsernameClaim = "preferred_username"
+
+	// A provider user named like a local account does not become it
+	user := rp.user(map[string]any{"sub": "1234", "preferred_username": "admin"})
+	if user.Username == "admin" || !strings.HasPrefix(user.Username, "oidc:") || !user.External {
+		t.Errorf("User = %+v, want an external oidc: username", user)
+	}
+	if other := externalUsername("https://other.example", "admin"); other == user.Username {
+		t.Errorf("Users of different issuers share the username %q", other)
+	}
+}
+
+func TestOIDC_LoginDefaults(t *testing.T) {
+	rp, provider := newTestOIDC(t)
+	provider.SetClaims(map[string]any{"sub": "1234"})
+
+	// Off-site return paths are ignored
+	rec := oidcLogin(t, rp, "//evil.example")
+	if rec.Header().Get("Location") != "/" {
+		t.Errorf("Callback redirected to %q, want /", rec.Header().Get("Location"))
+	}
+	user, err := rp.tokens.Verify(sessionCookie(rec).Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Subject != externalUsername(rp.cfg.Issuer, "1234") || user.Role != "user" || !user.External {
+		t.Errorf("Session claims = %+v, want sub 1234 and the default role", user)
+	}
+}
+
+func TestOIDC_CallbackState(t *testing.T) {
+	rp, _ := newTestOIDC(t)
+	flow := func(state string, expires time.Time) string {
+		value, err := rp.encodeFlow(&oidcFlow{State: state, Nonce: "n", Verifier: "v", ReturnTo: "/", Expires: expires.Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	valid := flow("abc", time.Now().Add(time.Minute))
+	payload, _, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+	}{
+		{"no cookie", "?state=abc&code=x", ""},
+		{"no state", "?code=x", valid},
+		{"mismatch", "?state=abc&code=x", flow("def", time.Now().Add(time.Minute))},
+		{"unsigned", "?state=abc&code=x", "abc"},
+		{"forged", "?state=abc&code=x", payload + ".x"},
+		{"expired", "?state=abc&code=x", flow("abc", time.Now().Add(-time.Second))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/callback"+tt.query, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			rp.Callback(rec, req)
+			if rec.Code != http.StatusBadRequest || sessionCookie(rec) != nil {
+				t.Errorf("Expected status 400 and no session, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestOIDC_Verify(t *testing.T) {
+	rp, provider := newTestOIDC(t)
+	ctx := context.Background()
+	valid := map[string]any{"sub": "1234", "nonce": "n"}
+
+	token, _ := provider.IDToken(valid, false)
+	if _, err := rp.Verify(ctx, token, "n"); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// New keys are fetched when the provider rotates its key
+	if err := provider.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	token, _ = provider.IDToken(valid, false)
+	if _, err := rp.Verify(ctx, token, "n"); err != nil {
+		t.Fatalf("Verify after key rotation failed: %v", err)
+	}
+
+	with := func(name string, v any) map[string]any {
+		claims := map[string]any{"sub": "1234", "nonce": "n"}
+		claims[name] = v
+		return claims
+	}
+	forged, _ := provider.IDToken(valid, true)
+	parts := strings.Split(token, ".")
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"garbage", "not-a-token"},
+		{"forged", forged},
+		{"alg none", "eyJhbGciOiJub25lIn0." + parts[1] + "."},
+		{"no subject", tokenWith(t, provider, with("sub", ""))},
+		{"wrong issuer", tokenWith(t, provider, with("iss", "https://evil.example"))},
+		{"wrong audience", tokenWith(t, provider, with("aud", "other"))},
+		{"no authorized party", tokenWith(t, provider, with("aud", []string{"bookshelf", "other"}))},
+		{"expired", tokenWith(t, provider, with("exp", time.Now().Add(-time.Hour).Unix()))},
+		{"future", tokenWith(t, provider, with("iat", time.Now().Add(time.Hour).Unix()))},
+		{"wrong nonce", tokenWith(t, provider, with("nonce", "other"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rp.Verify(ctx, tt.token, "n"); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Verify() error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	multi := with("aud", []string{"bookshelf", "other"})
+	multi["azp"] = "bookshelf"
+	if _, err := rp.Verify(ctx, tokenWith(t, provider, multi), "n"); err != nil {
+		t.Errorf("Verify with several audiences failed: %v", err)
+	}
+}
+
+func tokenWith(t *testing.T, provider *oidctest.Provider, claims map[string]any) string {
+	t.Helper()
+	token, err := provider.IDToken(claims, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestOIDC_ProviderUnavailable(t *testing.T) {
+	rp, provider := newTestOIDC(t)
+	provider.Close()
+
+	rec := httptest.NewRecorder()
+	rp.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", rec.Code)
+	}
+}
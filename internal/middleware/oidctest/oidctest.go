@@ -0,0 +1,268 @@
+// Package oidctest provides a minimal OpenID Connect provider for tests.
+//
+// The provider serves discovery, JWKS, authorization and token endpoints on
+// a loopback server. Its authorization endpoint logs in a fixed user
+// without showing a login page, so tests can run the whole authorization
+// code flow without network access.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Provider is an OpenID Connect provider for tests.
+type Provider struct {
+	// ClientID is the only client the provider accepts.
+	ClientID string
+	// ClientSecret, if set, must be sent with token requests using HTTP
+	// Basic authentication.
+	ClientSecret string
+
+	server *httptest.Server
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	keyID  string
+	claims map[string]any
+	codes  map[string]*authCode
+}
+
+// authCode is an issued authorization code and what it was issued for.
+type authCode struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      map[string]any
+}
+
+// NewProvider starts a provider for clientID. Logins return the claims
+// {"sub": "test-user"} until SetClaims is called. Call Close when done.
+func NewProvider(clientID string) (*Provider, error) {
+	p := &Provider{
+		ClientID: clientID,
+		claims:   map[string]any{"sub": "test-user"},
+		codes:    make(map[string]*authCode),
+	}
+	if err := p.RotateKey(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// Issuer returns the provider's issuer URL.
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// Close shuts the provider down.
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// SetClaims sets the claims, including "sub", of the user logged in by the
+// next authorizations. The provider adds iss, aud, iat, exp and nonce.
+func (p *Provider) SetClaims(claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+// RotateKey replaces the provider's signing key.
+func (p *Provider) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key, p.keyID = key, hex.EncodeToString(id)
+	return nil
+}
+
+// IDToken returns an ID token for the client with the given claims, which
+// override the standard iss, aud, iat and exp claims. It is signed with the
+// provider's key, or with a throwaway key if forged is true.
+func (p *Provider) IDToken(claims map[string]any, forged bool) (string, error) {
+	p.mu.Lock()
+	key, keyID := p.key, p.keyID
+	p.mu.Unlock()
+	if forged {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return "", err
+		}
+	}
+
+	now := time.Now()
+	all := map[string]any{
+		"iss": p.Issuer(),
+		"aud": p.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for name, v := range claims {
+		all[name] = v
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(all)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := p.Issuer()
+	respondJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	pub, keyID := p.key.PublicKey, p.keyID
+	p.mu.Unlock()
+	respondJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// handleAuthorize logs the user in at once and redirects back to the client
+// with a code.
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("client_id") != p.ClientID || redirectURI == "" {
+		http.Error(w, "unknown client or redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	back := url.Values{"state": {q.Get("state")}}
+	switch {
+	case q.Get("response_type") != "code":
+		back.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		back.Set("error", "invalid_request")
+	default:
+		code := make([]byte, 16)
+		rand.Read(code)
+		back.Set("code", hex.EncodeToString(code))
+
+		p.mu.Lock()
+		p.codes[back.Get("code")] = &authCode{
+			redirectURI: redirectURI,
+			challenge:   q.Get("code_challenge"),
+			nonce:       q.Get("nonce"),
+			claims:      p.claims,
+		}
+		p.mu.Unlock()
+	}
+	http.Redirect(w, r, redirectURI+"?"+back.Encode(), http.StatusFound)
+}
+
+// handleToken redeems a code, once, for an ID token.
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+
+	clientID := r.PostForm.Get("client_id")
+	if id, secret, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if secret != p.ClientSecret {
+			id = ""
+		}
+		clientID = id
+	} else if p.ClientSecret != "" {
+		clientID = ""
+	}
+	if clientID != p.ClientID {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if r.PostForm.Get("grant_type") != "authorization_code" || !ok ||
+		code.redirectURI != r.PostForm.Get("redirect_uri") ||
+		code.challenge != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]any{"nonce": code.nonce}
+	for name, v := range code.claims {
+		claims[name] = v
+	}
+	idToken, err := p.IDToken(claims, false)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"access_token": "test-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func respondJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
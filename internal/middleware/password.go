@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// ErrUnknownHash is returned for a password hash in an unsupported format.
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// HashParams selects the algorithm and cost of new password hashes.
+type HashParams struct {
+	Algorithm string
+	// BcryptCost is the bcrypt work factor.
+	BcryptCost int
+	// Argon2Time, Argon2Memory (KiB) and Argon2Threads are the argon2id
+	// iterations, memory and parallelism.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// DefaultHashParams are argon2id with the parameters recommended by
+// RFC 9106 for memory-constrained environments.
+var DefaultHashParams = HashParams{
+	Algorithm:     HashArgon2id,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Time:    3,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 4,
+}
+
+// argon2id salt and key lengths in bytes.
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Validate checks that p describes a usable hash configuration.
+func (p HashParams) Validate() error {
+	switch p.Algorithm {
+	case HashBcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		if p.Argon2Time < 1 || p.Argon2Memory < 8*uint32(p.Argon2Threads) || p.Argon2Threads < 1 {
+			return errors.New("argon2id needs time >= 1, threads >= 1 and memory >= 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q: want bcrypt or argon2id", p.Algorithm)
+	}
+	return nil
+}
+
+// Hash returns an encoded hash of password: a bcrypt hash, or an argon2id
+// hash in the PHC string format.
+func (p HashParams) Hash(password string) (string, error) {
+	if p.Algorithm == HashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches hash, and whether hash should be
+// replaced because it was made with other parameters than p.
+func (p HashParams) Verify(hash, password string) (ok, rehash bool, err error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, _ := bcrypt.Cost([]byte(hash))
+		return true, p.Algorithm != HashBcrypt || cost != p.BcryptCost, nil
+	}
+
+	h, err := parseArgon2id(hash)
+	if err != nil {
+		return false, false, err
+	}
+	key := argon2.IDKey([]byte(password), h.salt, h.params.Argon2Time, h.params.Argon2Memory, h.params.Argon2Threads, uint32(len(h.key)))
+	if subtle.ConstantTimeCompare(key, h.key) != 1 {
+		return false, false, nil
+	}
+	current := p.Algorithm == HashArgon2id &&
+		h.params.Argon2Time == p.Argon2Time &&
+		h.params.Argon2Memory == p.Argon2Memory &&
+		h.params.Argon2Threads == p.Argon2Threads
+	return true, !current, nil
+}
+
+// CheckHash returns an error unless hash is in a supported format.
+func CheckHash(hash string) error {
+	if isBcrypt(hash) {
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	}
+	_, err := parseArgon2id(hash)
+	return err
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// argon2idHash is a decoded argon2id PHC string.
+type argon2idHash struct {
+	params    HashParams
+	salt, key []byte
+}
+
+// parseArgon2id decodes $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>.
+func parseArgon2id(hash string) (*argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != HashArgon2id {
+		return nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnknownHash, parts[2])
+	}
+	h := &argon2idHash{params: HashParams{Algorithm: HashArgon2id}}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Argon2Memory, &h.params.Argon2Time, &h.params.Argon2Threads); err != nil {
+		return nil, fmt.Errorf("%w: bad argon2id parameters %q", ErrUnknownHash, parts[3])
+	}
+	if h.params.Argon2Time < 1 || h.params.Argon2Threads < 1 {
+		return nil, fmt.Errorf("%w: bad argon2id parameters %q", ErrUnknownHash, parts[3])
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("%w: bad argon2id salt", ErrUnknownHash)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, fmt.Errorf("%w: bad argon2id key", ErrUnknownHash)
+	}
+	return h, nil
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters keep tests fast.
+var (
+	testArgon2 = HashParams{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+	testBcrypt = HashParams{Algorithm: HashBcrypt, BcryptCost: 4}
+)
+
+func TestHashParams_HashVerify(t *testing.T) {
+	for _, params := range []HashParams{testArgon2, testBcrypt} {
+		t.Run(params.Algorithm, func(t *testing.T) {
+			hash, err := params.Hash("hunter2")
+			if err != nil {
+				t.Fatalf("Hash failed: %v", err)
+			}
+			if strings.Contains(hash, "hunter2") || CheckHash(hash) != nil {
+				t.Errorf("Unexpected hash %q", hash)
+			}
+
+			if ok, rehash, err := params.Verify(hash, "hunter2"); !ok || rehash || err != nil {
+				t.Errorf("Verify(right) = %v, %v, %v; want true, false, nil", ok, rehash, err)
+			}
+			if ok, _, err := params.Verify(hash, "hunter3"); ok || err != nil {
+				t.Errorf("Verify(wrong) = %v, %v; want false, nil", ok, err)
+			}
+		})
+	}
+}
+
+func TestHashParams_Rehash(t *testing.T) {
+	stronger := testArgon2
+	stronger.Argon2Time = 2
+	costlier := testBcrypt
+	costlier.BcryptCost = 5
+
+	argonHash, _ := testArgon2.Hash("pw")
+	bcryptHash, _ := testBcrypt.Hash("pw")
+	tests := []struct {
+		name   string
+		params HashParams
+		hash   string
+		want   bool
+	}{
+		{"same argon2id", testArgon2, argonHash, false},
+		{"argon2id time changed", stronger, argonHash, true},
+		{"argon2id to bcrypt", testBcrypt, argonHash, true},
+		{"same bcrypt", testBcrypt, bcryptHash, false},
+		{"bcrypt cost changed", costlier, bcryptHash, true},
+		{"bcrypt to argon2id", testArgon2, bcryptHash, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := tt.params.Verify(tt.hash, "pw")
+			if !ok || err != nil || rehash != tt.want {
+				t.Errorf("Verify() = %v, %v, %v; want true, %v, nil", ok, rehash, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHash_Invalid(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$apr1$salt$hash",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+		"$2b$04$short",
+	} {
+		if err := CheckHash(hash); err == nil {
+			t.Errorf("CheckHash(%q) = nil, want error", hash)
+		}
+	}
+	if _, _, err := testArgon2.Verify("plaintext", "plaintext"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("Verify(plaintext) error = %v, want ErrUnknownHash", err)
+	}
+}
+
+func TestHashParams_Validate(t *testing.T) {
+	if err := DefaultHashParams.Validate(); err != nil {
+		t.Errorf("DefaultHashParams invalid: %v", err)
+	}
+	for _, p := range []HashParams{
+		{Algorithm: "md5"},
+		{Algorithm: HashBcrypt, BcryptCost: 2},
+		{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 4, Argon2Threads: 1},
+		{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 64},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", p)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token errors.
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// Claims is the payload of a bearer token.
+type Claims struct {
+	ID        string `json:"jti"`
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// Generation is the subject's token generation when the token was
+	// issued; RevokeUser moves it on.
+	Generation int64 `json:"gen,omitempty"`
+	// External marks tokens of users authenticated by an identity
+	// provider, who have no local account.
+	External bool `json:"ext,omitempty"`
+}
+
+// User returns the user the token was issued to.
+func (c *Claims) User() *User {
+	return &User{Username: c.Subject, Role: c.Role, External: c.External}
+}
+
+// tokenHeader is the JOSE header of every token we issue.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// TokenManager issues and verifies HMAC-SHA256 signed JWTs. It keeps the
+// IDs of revoked tokens until they expire, and a generation per user that
+// RevokeUser moves on to reject all of the user's earlier tokens.
+type TokenManager struct {
+	secret []byte
+	expiry time.Duration
+	now    func() time.Time
+	// path is the state file; revocations are only kept in memory
+	// without it.
+	path string
+
+	mu          sync.Mutex
+	revoked     map[string]time.Time // token ID -> expiry
+	generations map[string]int64     // username -> generation
+}
+
+// tokenState is the content of a token state file.
+type tokenState struct {
+	Revoked     map[string]int64 `json:"revoked"` // token ID -> expiry
+	Generations map[string]int64 `json:"generations"`
+}
+
+// NewTokenManager creates a token manager that signs with secret and issues
+// tokens valid for expiry. Revocations are kept in memory.
+func NewTokenManager(secret []byte, expiry time.Duration) *TokenManager {
+	return &TokenManager{
+		secret:      secret,
+		expiry:      expiry,
+		now:         time.Now,
+		revoked:     make(map[string]time.Time),
+		generations: make(map[string]int64),
+	}
+}
+
+// LoadTokenManager is NewTokenManager with revocations saved to the state
+// file at path, so they survive a restart with the same secret. A missing
+// file is created on the first revocation.
+func LoadTokenManager(secret []byte, expiry time.Duration, path string) (*TokenManager, error) {
+	m := NewTokenManager(secret, expiry)
+	m.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state tokenState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for id, exp := range state.Revoked {
+		m.revoked[id] = time.Unix(exp, 0)
+	}
+	for user, gen := range state.Generations {
+		m.generations[user] = gen
+	}
+	return m, nil
+}
+
+// Expiry returns how long issued tokens are valid.
+func (m *TokenManager) Expiry() time.Duration {
+	return m.expiry
+}
+
+// Issue returns a signed token for user and its claims.
+func (m *TokenManager) Issue(user *User) (string, *Claims, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.issue(user.Username, user.Role, false)
+}
+
+// IssueExternal is Issue for a user authenticated by an identity provider.
+// Their tokens are not checked against the local user store.
+func (m *TokenManager) IssueExternal(user *User) (string, *Claims, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.issue(user.Username, user.Role, true)
+}
+
+// issue signs a new token. The caller holds mu.
+func (m *TokenManager) issue(username, role string, external bool) (string, *Claims, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	now := m.now()
+	claims := &Claims{
+		ID:         hex.EncodeToString(id),
+		Subject:    username,
+		Role:       role,
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  now.Add(m.expiry).Unix(),
+		Generation: m.generations[username],
+		External:   external,
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + m.sign(unsigned), claims, nil
+}
+
+// Verify checks a token's signature, expiry and revocation, and returns
+// its claims.
+func (m *TokenManager) Verify(token string) (*Claims, error) {
+	claims, err := m.parse(token)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkRevoked(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// parse checks a token's signature and expiry, and returns its claims.
+func (m *TokenManager) parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(m.sign(parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if m.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// checkRevoked returns ErrTokenRevoked if the token was revoked, on its own
+// or with all of its user's. The caller holds mu.
+func (m *TokenManager) checkRevoked(claims *Claims) error {
+	if _, revoked := m.revoked[claims.ID]; revoked {
+		return ErrTokenRevoked
+	}
+	if claims.Generation < m.generations[claims.Subject] {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// Revoke rejects the token with the given claims from now on.
+func (m *TokenManager) Revoke(claims *Claims) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[claims.ID] = time.Unix(claims.ExpiresAt, 0)
+	if err := m.save(); err != nil {
+		delete(m.revoked, claims.ID)
+		return err
+	}
+	return nil
+}
+
+// RevokeUser rejects every token issued to username so far, for when their
+// password, role or access changes.
+func (m *TokenManager) RevokeUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generations[username]++
+	if err := m.save(); err != nil {
+		m.generations[username]--
+		return err
+	}
+	return nil
+}
+
+// Refresh verifies token, revokes it and issues a new one to the same user.
+// A token can only be refreshed once, even by concurrent requests.
+func (m *TokenManager) Refresh(token string) (string, *Claims, error) {
+	old, err := m.parse(token)
+	if err != nil {
+		return "", nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkRevoked(old); err != nil {
+		return "", nil, err
+	}
+	m.revoked[old.ID] = time.Unix(old.ExpiresAt, 0)
+	if err := m.save(); err != nil {
+		delete(m.revoked, old.ID)
+		return "", nil, err
+	}
+	return m.issue(old.Subject, old.Role, old.External)
+}
+
+// save prunes expired revocations, which fail verification anyway, and
+// writes the state file, if there is one. The caller holds mu.
+func (m *TokenManager) save() error {
+	now := m.now()
+	for id, exp := range m.revoked {
+		if !now.Before(exp) {
+			delete(m.revoked, id)
+		}
+	}
+	if m.path == "" {
+		return nil
+	}
+
+	state := tokenState{Revoked: make(map[string]int64, len(m.revoked)), Generations: m.generations}
+	for id, exp := range m.revoked {
+		state.Revoked[id] = exp.Unix()
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, append(data, '\n'))
+}
+
+func (m *TokenManager) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// AuthenticateToken verifies token and returns its claims. Unless the token
+// is external, its user must also still have an enabled account with the
+// same role, if store can look accounts up.
+func AuthenticateToken(store UserStore, tokens *TokenManager, token string) (*Claims, error) {
+	claims, err := tokens.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if lookup, ok := store.(UserLookup); ok && !claims.External {
+		user, ok := lookup.LookupUser(claims.Subject)
+		if !ok || user.Role != claims.Role {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// BearerAuth returns a middleware that requires a valid bearer token. The
+// token's account is checked in store, which may be nil.
+func BearerAuth(store UserStore, tokens *TokenManager, realm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := BearerToken(r)
+			if !ok {
+				requireBearer(w, realm)
+				return
+			}
+
+			claims, err := AuthenticateToken(store, tokens, token)
+			if err != nil {
+				requireBearer(w, realm)
+				return
+			}
+
+			// Add user to context
+			ctx := context.WithValue(r.Context(), UserContextKey, claims.User())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// BasicOrBearerAuth returns a middleware that accepts either HTTP Basic
+// credentials or a bearer token.
+func BasicOrBearerAuth(store UserStore, tokens *TokenManager, realm string) func(http.Handler) http.Handler {
+	basic, bearer := BasicAuth(store, realm), BearerAuth(store, tokens, realm)
+	return func(next http.Handler) http.Handler {
+		basicNext, bearerNext := basic(next), bearer(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := BearerToken(r); ok {
+				bearerNext.ServeHTTP(w, r)
+				return
+			}
+			basicNext.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BearerToken returns the token of a Bearer Authorization header.
+func BearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+// requireBearer sends a 401 response requesting a bearer token.
+func requireBearer(w http.ResponseWriter, realm string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file,
+// so readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestTokenManager() *TokenManager {
+	return NewTokenManager([]byte("test-secret"), time.Hour)
+}
+
+func TestTokenManager_IssueVerify(t *testing.T) {
+	tokens := newTestTokenManager()
+
+	token, issued, err := tokens.Issue(&User{Username: "admin", Role: "admin"})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	claims, err := tokens.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if *claims != *issued || claims.Subject != "admin" || claims.Role != "admin" {
+		t.Errorf("Claims = %+v, want %+v", claims, issued)
+	}
+	if claims.ExpiresAt-claims.IssuedAt != 3600 {
+		t.Errorf("Token lifetime = %ds, want 3600s", claims.ExpiresAt-claims.IssuedAt)
+	}
+}
+
+func TestTokenManager_VerifyInvalid(t *testing.T) {
+	tokens := newTestTokenManager()
+	token, _, _ := tokens.Issue(&User{Username: "user", Role: "user"})
+	parts := strings.Split(token, ".")
+
+	other := NewTokenManager([]byte("other-secret"), time.Hour)
+	forged, _, _ := other.Issue(&User{Username: "user", Role: "admin"})
+	forgedParts := strings.Split(forged, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"garbage", "not.a.token"},
+		{"wrong secret", forged},
+		{"swapped payload", parts[0] + "." + forgedParts[1] + "." + parts[2]},
+		{"no signature", parts[0] + "." + parts[1] + "."},
+		{"alg none", "eyJhbGciOiJub25lIn0." + parts[1] + "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.Verify(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestTokenManager_Expiry(t *testing.T) {
+	tokens := newTestTokenManager()
+	now := time.Now()
+	tokens.now = func() time.Time { return now }
+	token, _, _ := tokens.Issue(&User{Username: "user"})
+
+	now = now.Add(59 * time.Minute)
+	if _, err := tokens.Verify(token); err != nil {
+		t.Errorf("Verify before expiry: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := tokens.Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Verify after expiry error = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestTokenManager_RefreshRevoke(t *testing.T) {
+	tokens := newTestTokenManager()
+	old, _, _ := tokens.Issue(&User{Username: "user", Role: "reader"})
+
+	token, claims, err := tokens.Refresh(old)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if claims.Subject != "user" || claims.Role != "reader" {
+		t.Errorf("Refreshed claims = %+v", claims)
+	}
+	if _, err := tokens.Verify(old); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Old token error = %v, want ErrTokenRevoked", err)
+	}
+	if _, _, err := tokens.Refresh(old); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Refreshing old token error = %v, want ErrTokenRevoked", err)
+	}
+
+	tokens.Revoke(claims)
+	if _, err := tokens.Verify(token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Revoked token error = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestTokenManager_RevokeUser(t *testing.T) {
+	tokens := newTestTokenManager()
+	first, _, _ := tokens.Issue(&User{Username: "alice"})
+	second, _, _ := tokens.Issue(&User{Username: "alice"})
+	other, _, _ := tokens.Issue(&User{Username: "bob"})
+
+	tokens.RevokeUser("alice")
+	for _, token := range []string{first, second} {
+		if _, err := tokens.Verify(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("alice's token error = %v, want ErrTokenRevoked", err)
+		}
+	}
+	if _, err := tokens.Verify(other); err != nil {
+		t.Errorf("bob's token should stay valid: %v", err)
+	}
+
+	fresh, _, _ := tokens.Issue(&User{Username: "alice"})
+	if _, err := tokens.Verify(fresh); err != nil {
+		t.Errorf("Tokens issued after RevokeUser should be valid: %v", err)
+	}
+}
+
+func TestTokenManager_RefreshConcurrent(t *testing.T) {
+	tokens := newTestTokenManager()
+	old, _, _ := tokens.Issue(&User{Username: "user", Role: "reader"})
+
+	var wg sync.WaitGroup
+	results := make([]error, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, results[i] = tokens.Refresh(old)
+		}(i)
+	}
+	wg.Wait()
+
+	refreshed := 0
+	for _, err := range results {
+		if err == nil {
+			refreshed++
+		} else if !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("Refresh error = %v, want ErrTokenRevoked", err)
+		}
+	}
+	if refreshed != 1 {
+		t.Errorf("Token was refreshed %d times, want once", refreshed)
+	}
+}
+
+func TestLoadTokenManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	secret := []byte("test-secret")
+	tokens, err := LoadTokenManager(secret, time.Hour, path)
+	if err != nil {
+		t.Fatalf("LoadTokenManager failed: %v", err)
+	}
+	revoked, claims, _ := tokens.Issue(&User{Username: "bob"})
+	alice, _, _ := tokens.Issue(&User{Username: "alice"})
+	kept, _, _ := tokens.Issue(&User{Username: "carol"})
+	if err := tokens.Revoke(claims); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if err := tokens.RevokeUser("alice"); err != nil {
+		t.Fatalf("RevokeUser failed: %v", err)
+	}
+
+	// Revocations survive a restart with the same secret
+	reloaded, err := LoadTokenManager(secret, time.Hour, path)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	for _, token := range []string{revoked, alice} {
+		if _, err := reloaded.Verify(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("Verify after reload error = %v, want ErrTokenRevoked", err)
+		}
+	}
+	if _, err := reloaded.Verify(kept); err != nil {
+		t.Errorf("Unrevoked token should stay valid: %v", err)
+	}
+	fresh, _, _ := reloaded.Issue(&User{Username: "alice"})
+	if _, err := reloaded.Verify(fresh); err != nil {
+		t.Errorf("Tokens issued after reload should be valid: %v", err)
+	}
+
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := LoadTokenManager(secret, time.Hour, path); err == nil {
+		t.Error("Expected an error for an invalid state file")
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	tokens := newTestTokenManager()
+	store := newTestUserStore()
+	issue := func(user *User, external bool) string {
+		issue := tokens.Issue
+		if external {
+			issue = tokens.IssueExternal
+		}
+		token, _, err := issue(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"account", issue(&User{Username: "user", Role: "user"}, false), nil},
+		{"role changed", issue(&User{Username: "user", Role: "admin"}, false), ErrTokenRevoked},
+		{"no account", issue(&User{Username: "ghost", Role: "user"}, false), ErrTokenRevoked},
+		{"external", issue(&User{Username: "ghost", Role: "user"}, true), nil},
+		{"invalid", "nope", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AuthenticateToken(store, tokens, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthenticateToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Accounts are checked in the users file as it is now
+	users, err := NewFileUserStore(filepath.Join(t.TempDir(), "users.json"), testBcrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.AddUser("alice", "alice-password", "user")
+	token := issue(&User{Username: "alice", Role: "user"}, false)
+	if _, err := AuthenticateToken(users, tokens, token); err != nil {
+		t.Fatalf("AuthenticateToken failed: %v", err)
+	}
+	users.AddUser("alice", "alice-password", "admin")
+	if _, err := AuthenticateToken(users, tokens, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Changed role error = %v, want ErrTokenRevoked", err)
+	}
+	token = issue(&User{Username: "alice", Role: "admin"}, false)
+	users.UpdateAccount("alice", func(a *Account) error {
+		a.Disabled = true
+		return nil
+	})
+	if _, err := AuthenticateToken(users, tokens, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Disabled account error = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	tokens := newTestTokenManager()
+	token, _, _ := tokens.Issue(&User{Username: "user", Role: "reader"})
+
+	var got *User
+	protected := BearerAuth(nil, tokens, "test")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUser(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	protected.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || got == nil || !reflect.DeepEqual(*got, User{Username: "user", Role: "reader"}) {
+		t.Errorf("Status %d, user %+v", rec.Code, got)
+	}
+
+	for _, auth := range []string{"", "Bearer ", "Bearer " + token + "x", EncodeBasicAuth("admin", "secret123")} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected status %d, got %d", auth, http.StatusUnauthorized, rec.Code)
+		}
+		if !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer ") {
+			t.Errorf("WWW-Authenticate = %q", rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestBasicOrBearerAuth(t *testing.T) {
+	tokens := newTestTokenManager()
+	token, _, _ := tokens.Issue(&User{Username: "reader", Role: "reader"})
+	protected := BasicOrBearerAuth(newTestUserStore(), tokens, "test")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r.Context()).Username))
+	}))
+
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{EncodeBasicAuth("admin", "secret123"), http.StatusOK},
+		{"Bearer " + token, http.StatusOK},
+		{EncodeBasicAuth("admin", "wrong"), http.StatusUnauthorized},
+		{"Bearer nope", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", tt.auth)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("Authorization %q: expected status %d, got %d", tt.auth, tt.want, rec.Code)
+		}
+	}
+}
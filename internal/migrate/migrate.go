@@ -0,0 +1,393 @@
+// Package migrate applies versioned, embedded schema migrations to the
+// bookshelf database.
+//
+// Migrations live in migrations/<driver>/ as pairs of files named
+// NNNN_description.up.sql and NNNN_description.down.sql. Applied versions are
+// recorded in the schema_migrations table; each migration runs in its own
+// transaction together with its bookkeeping row. The transactions hold a
+// database-wide lock, so that servers starting together against the same
+// database apply every migration once.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+var (
+	ErrUnsupportedDriver = errors.New("no migrations for database driver")
+	ErrInvalidMigration  = errors.New("invalid migration")
+	// ErrUnknownVersion is returned by Up and Pending when the database has
+	// a migration applied that this build does not know, such as after a
+	// downgrade.
+	ErrUnknownVersion = errors.New("database has an unknown migration applied")
+)
+
+// lockKey is the Postgres advisory lock migrations hold.
+const lockKey = 0x626f6f6b // "book"
+
+// Migration is a single schema change with its rollback.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+// New creates a migrator for the given database and driver ("sqlite" or "postgres").
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	migrations, err := load(migrationsFS, path.Join("migrations", driver))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: migrations}, nil
+}
+
+// Migrations returns the known migrations in version order.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies all pending migrations in order and returns how many were applied.
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.checkKnown(applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		done, err := m.apply(mig, mig.Up, true)
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if done {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// checkKnown returns ErrUnknownVersion if any applied version is not one of
+// the embedded migrations.
+func (m *Migrator) checkKnown(applied map[int]time.Time) error {
+	known := make(map[int]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: %04d", ErrUnknownVersion, version)
+		}
+	}
+	return nil
+}
+
+// Down rolls back up to steps of the most recently applied migrations and
+// returns how many were rolled back.
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		done, err := m.apply(mig, mig.Down, false)
+		if err != nil {
+			return count, fmt.Errorf("rollback %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if done {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		appliedAt, ok := applied[mig.Version]
+		statuses = append(statuses, Status{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return statuses, nil
+}
+
+// Pending returns the number of migrations that have not been applied, or
+// ErrUnknownVersion like Up.
+func (m *Migrator) Pending() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if err := m.checkKnown(applied); err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// apply runs a migration script and records (or removes) its version. It
+// reports false, without running the script, if a concurrent migrator got
+// there first.
+func (m *Migrator) apply(mig Migration, script string, up bool) (bool, error) {
+	ctx := context.Background()
+	conn, err := m.begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer m.end(ctx, conn)
+
+	var count int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = `+m.bind(1), mig.Version).Scan(&count); err != nil {
+		return false, err
+	}
+	if (count == 1) == up {
+		return false, nil
+	}
+
+	if _, err := conn.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+
+	if up {
+		_, err = conn.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (`+m.bind(1)+`, `+m.bind(2)+`, `+m.bind(3)+`)`,
+			mig.Version, mig.Name, time.Now().UTC(),
+		)
+	} else {
+		_, err = conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = `+m.bind(1), mig.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// applied returns the applied versions and when they were applied,
+// creating the tracking table if needed.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	ctx := context.Background()
+	conn, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.end(ctx, conn)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// begin starts a transaction that holds the migration lock until it ends,
+// on a connection of its own: SQLite takes its write lock with BEGIN
+// IMMEDIATE, and Postgres a transaction-level advisory lock. Concurrent
+// migrators wait for the lock, SQLite ones for up to the busy timeout.
+func (m *Migrator) begin(ctx context.Context) (*sql.Conn, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.driver == "postgres" {
+		_, err = conn.ExecContext(ctx, "BEGIN")
+		if err == nil {
+			if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_xact_lock(`+strconv.Itoa(lockKey)+`)`); err != nil {
+				conn.ExecContext(ctx, "ROLLBACK")
+			}
+		}
+	} else {
+		_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// end rolls back the transaction begin started unless it was committed, and
+// releases its connection.
+func (m *Migrator) end(ctx context.Context, conn *sql.Conn) {
+	// Rolling back after COMMIT only fails with "no transaction"
+	conn.ExecContext(ctx, "ROLLBACK")
+	conn.Close()
+}
+
+// bind returns the n-th bind placeholder for the driver.
+func (m *Migrator) bind(n int) string {
+	if m.driver == "postgres" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// load reads and pairs the migration files in dir.
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedDriver, path.Base(dir))
+		}
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		version, name, direction, err := parseFilename(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: name}
+			byVersion[version] = mig
+		} else if mig.Name != name {
+			return nil, fmt.Errorf("%w: version %04d used by %q and %q", ErrInvalidMigration, version, mig.Name, name)
+		}
+
+		if direction == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("%w: %04d_%s needs both up and down files", ErrInvalidMigration, mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// parseFilename splits "0002_add_isbn_index.up.sql" into its parts.
+func parseFilename(filename string) (version int, name, direction string, err error) {
+	base, ok := strings.CutSuffix(filename, ".sql")
+	if !ok {
+		return 0, "", "", fmt.Errorf("%w: %q is not a .sql file", ErrInvalidMigration, filename)
+	}
+
+	dot := strings.LastIndexByte(base, '.')
+	if dot < 0 {
+		return 0, "", "", fmt.Errorf("%w: %q has no up/down suffix", ErrInvalidMigration, filename)
+	}
+	direction = base[dot+1:]
+	if direction != "up" && direction != "down" {
+		return 0, "", "", fmt.Errorf("%w: %q has no up/down suffix", ErrInvalidMigration, filename)
+	}
+
+	versionStr, name, ok := strings.Cut(base[:dot], "_")
+	if !ok || name == "" {
+		return 0, "", "", fmt.Errorf("%w: %q must be named NNNN_description", ErrInvalidMigration, filename)
+	}
+	version, err = strconv.Atoi(versionStr)
+	if err != nil || version < 1 {
+		return 0, "", "", fmt.Errorf("%w: %q has an invalid version", ErrInvalidMigration, filename)
+	}
+
+	return version, name, direction, nil
+}
@@ -0,0 +1,366 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestMigrator(t *testing.T) (*Migrator, *sql.DB) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return m, db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count)
+	if err != nil {
+		t.Fatalf("Checking table %s failed: %v", name, err)
+	}
+	return count == 1
+}
+
+func TestMigrator_Up(t *testing.T) {
+	m, db := newTestMigrator(t)
+
+	n, err := m.Up()
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if n != len(m.Migrations()) {
+		t.Errorf("Up applied %d migrations, want %d", n, len(m.Migrations()))
+	}
+
+	for _, table := range []string{"authors", "books", "reading_lists", "reading_list_books"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("Expected table %s to exist", table)
+		}
+	}
+
+	// Running again is a no-op
+	n, err = m.Up()
+	if err != nil {
+		t.Fatalf("Second Up failed: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Second Up applied %d migrations, want 0", n)
+	}
+}
+
+func TestMigrator_ConcurrentUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migrate.db")
+
+	// Two servers starting together, each with its own connection pool
+	counts := make([]int, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range counts {
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := New(db, "sqlite")
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i], errs[i] = m.Up()
+		}(i)
+	}
+	wg.Wait()
+
+	m, _ := New(nil, "sqlite")
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Up failed: %v", err)
+		}
+	}
+	if counts[0]+counts[1] != len(m.Migrations()) {
+		t.Errorf("Up applied %v migrations, want %d in total", counts, len(m.Migrations()))
+	}
+}
+
+func TestMigrator_UnknownVersion(t *testing.T) {
+	m, db := newTestMigrator(t)
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	// A newer build has applied a migration this one does not have
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	if _, err := m.Up(); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Expected ErrUnknownVersion, got %v", err)
+	}
+	if _, err := m.Pending(); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Expected ErrUnknownVersion from Pending, got %v", err)
+	}
+}
+
+func TestMigrator_Status(t *testing.T) {
+	m, _ := newTestMigrator(t)
+
+	pending, err := m.Pending()
+	if err != nil {
+		t.Fatalf("Pending failed: %v", err)
+	}
+	if pending != len(m.Migrations()) {
+		t.Errorf("Pending = %d, want %d", pending, len(m.Migrations()))
+	}
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("Migration %04d_%s should be applied", s.Version, s.Name)
+		}
+		if s.AppliedAt.IsZero() {
+			t.Errorf("Migration %04d_%s should have AppliedAt set", s.Version, s.Name)
+		}
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	m, db := newTestMigrator(t)
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	n, err := m.Down(len(m.Migrations()))
+	if err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if n != len(m.Migrations()) {
+		t.Errorf("Down rolled back %d migrations, want %d", n, len(m.Migrations()))
+	}
+	if tableExists(t, db, "books") {
+		t.Error("Expected books table to be dropped")
+	}
+
+	pending, _ := m.Pending()
+	if pending != len(m.Migrations()) {
+		t.Errorf("Pending after Down = %d, want %d", pending, len(m.Migrations()))
+	}
+}
+
+func TestMigrator_Down_OneStep(t *testing.T) {
+	m, _ := newTestMigrator(t)
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	n, err := m.Down(1)
+	if err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Down rolled back %d migrations, want 1", n)
+	}
+
+	statuses, _ := m.Status()
+	last := statuses[len(statuses)-1]
+	if last.Applied {
+		t.Errorf("Latest migration %04d_%s should be rolled back", last.Version, last.Name)
+	}
+}
+
+func TestMigrator_SQLiteForeignKeys(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "fk.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	m, _ := New(db, "sqlite")
+
+	// Leave dangling references from before the foreign keys of 0006 existed
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if _, err := m.Down(len(m.Migrations()) - 5); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO authors (id, name, birth_date, created_at, updated_at) VALUES ('a', 'A', '', '', '')`,
+		`INSERT INTO books (id, title, isbn, isbn_key, author_id, published_at, created_at, updated_at) VALUES ('kept', 'Kept', '1', '1', 'a', '', '', '')`,
+		`INSERT INTO books (id, title, isbn, isbn_key, author_id, published_at, created_at, updated_at) VALUES ('orphan', 'Orphan', '2', '2', 'gone', '', '', '')`,
+		`INSERT INTO reading_lists (id, name, created_at, updated_at) VALUES ('list', 'List', '', '')`,
+		`INSERT INTO reading_list_books (list_id, book_id, position) VALUES ('list', 'kept', 0), ('list', 'gone', 1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Seeding failed: %v", err)
+		}
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	var orphanAuthor sql.NullString
+	db.QueryRow(`SELECT author_id FROM books WHERE id = 'orphan'`).Scan(&orphanAuthor)
+	if orphanAuthor.Valid {
+		t.Errorf("Book of a missing author kept author_id %q", orphanAuthor.String)
+	}
+	var members int
+	db.QueryRow(`SELECT COUNT(*) FROM reading_list_books`).Scan(&members)
+	if members != 1 {
+		t.Errorf("Reading list has %d members, want only the existing book", members)
+	}
+
+	if _, err := db.Exec(`UPDATE books SET author_id = 'gone' WHERE id = 'kept'`); err == nil {
+		t.Error("Expected a foreign key error for an unknown author")
+	}
+	if _, err := db.Exec(`INSERT INTO reading_list_books (list_id, book_id, position) VALUES ('list', 'gone', 2)`); err == nil {
+		t.Error("Expected a foreign key error for an unknown book")
+	}
+}
+
+func TestMigrator_SQLiteUTCTimestamps(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "utc.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	m, _ := New(db, "sqlite")
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	// Roll back to before the timestamps of 0004 were converted
+	if _, err := m.Down(len(m.Migrations()) - 3); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO books (id, title, isbn, isbn_key, author_id, published_at, created_at, updated_at)
+		VALUES ('b', 'B', '1', '1', '', '2000-01-01 01:00:00+02:00', '2020-05-05 10:00:00.5+00:00', '')`); err != nil {
+		t.Fatalf("Seeding failed: %v", err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	var published, created, updated string
+	db.QueryRow(`SELECT CAST(published_at AS TEXT), CAST(created_at AS TEXT), CAST(updated_at AS TEXT) FROM books`).
+		Scan(&published, &created, &updated)
+	if want := "1999-12-31 23:00:00.000+00:00"; published != want {
+		t.Errorf("published_at = %q, want %q", published, want)
+	}
+	if created != "2020-05-05 10:00:00.5+00:00" || updated != "" {
+		t.Errorf("UTC and unparseable values changed: %q, %q", created, updated)
+	}
+}
+
+func TestNew_UnsupportedDriver(t *testing.T) {
+	_, err := New(nil, "oracle")
+	if !errors.Is(err, ErrUnsupportedDriver) {
+		t.Errorf("Expected ErrUnsupportedDriver, got %v", err)
+	}
+}
+
+func TestNew_DriversHaveSameVersions(t *testing.T) {
+	lite, err := New(nil, "sqlite")
+	if err != nil {
+		t.Fatalf("New(sqlite) failed: %v", err)
+	}
+	pg, err := New(nil, "postgres")
+	if err != nil {
+		t.Fatalf("New(postgres) failed: %v", err)
+	}
+
+	if len(lite.Migrations()) != len(pg.Migrations()) {
+		t.Fatalf("sqlite has %d migrations, postgres has %d", len(lite.Migrations()), len(pg.Migrations()))
+	}
+	for i := range lite.Migrations() {
+		l, p := lite.Migrations()[i], pg.Migrations()[i]
+		if l.Version != p.Version || l.Name != p.Name {
+			t.Errorf("Migration %d differs: sqlite %04d_%s, postgres %04d_%s", i, l.Version, l.Name, p.Version, p.Name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"m/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"m/0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"m/0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := load(fsys, "m")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(migrations))
+	}
+	if migrations[0].Version != 1 || migrations[0].Name != "first" {
+		t.Errorf("First migration = %04d_%s, want 0001_first", migrations[0].Version, migrations[0].Name)
+	}
+	if migrations[1].Down != "DROP TABLE b;" {
+		t.Errorf("Second migration down = %q", migrations[1].Down)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{"m/0001_first.up.sql": {Data: []byte("SELECT 1;")}},
+		},
+		{
+			name: "conflicting names",
+			fsys: fstest.MapFS{
+				"m/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+				"m/0001_other.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "bad filename",
+			fsys: fstest.MapFS{"m/first.up.sql": {Data: []byte("SELECT 1;")}},
+		},
+		{
+			name: "bad direction",
+			fsys: fstest.MapFS{"m/0001_first.sideways.sql": {Data: []byte("SELECT 1;")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.fsys, "m")
+			if !errors.Is(err, ErrInvalidMigration) {
+				t.Errorf("Expected ErrInvalidMigration, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS authors (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	bio        TEXT NOT NULL DEFAULT '',
+	birth_date TIMESTAMPTZ NOT NULL,
+	country    TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS books (
+	id           TEXT PRIMARY KEY,
+	title        TEXT NOT NULL,
+	isbn         TEXT NOT NULL,
+	author_id    TEXT NOT NULL REFERENCES authors (id),
+	published_at TIMESTAMPTZ NOT NULL,
+	pages        INTEGER NOT NULL DEFAULT 0,
+	genre        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMPTZ NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn);
+CREATE INDEX IF NOT EXISTS idx_books_author_id ON books (author_id);
+
+CREATE TABLE IF NOT EXISTS reading_lists (
+	id          TEXT PRIMARY KEY,
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS reading_list_books (
+	list_id  TEXT NOT NULL REFERENCES reading_lists (id) ON DELETE CASCADE,
+	book_id  TEXT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (list_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_list_books_book_id ON reading_list_books (book_id);
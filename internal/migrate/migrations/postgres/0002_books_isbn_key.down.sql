@@ -0,0 +1,4 @@
+DROP INDEX idx_books_isbn_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn);
+
+ALTER TABLE books DROP COLUMN isbn_key;
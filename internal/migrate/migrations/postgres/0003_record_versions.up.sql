@@ -0,0 +1,5 @@
+-- version is incremented on every write and backs optimistic concurrency
+-- (ETag / If-Match). Existing rows start at version 1.
+ALTER TABLE authors ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE books ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE reading_lists ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
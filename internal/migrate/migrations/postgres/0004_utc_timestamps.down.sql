@@ -0,0 +1 @@
+-- Nothing to undo; see 0004_utc_timestamps.up.sql.
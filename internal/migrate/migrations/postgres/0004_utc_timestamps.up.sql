@@ -0,0 +1,2 @@
+-- TIMESTAMPTZ columns compare by instant whatever the offset; this version
+-- keeps the drivers' migrations in step with SQLite's.
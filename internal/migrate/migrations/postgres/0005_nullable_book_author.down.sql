@@ -0,0 +1,2 @@
+-- Fails while books without an author remain; reassign or delete them first.
+ALTER TABLE books ALTER COLUMN author_id SET NOT NULL;
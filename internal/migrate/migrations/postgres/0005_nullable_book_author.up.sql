@@ -0,0 +1,3 @@
+-- A NULL author_id marks a book whose author was deleted under the nullify
+-- delete policy; the foreign key still checks every other value.
+ALTER TABLE books ALTER COLUMN author_id DROP NOT NULL;
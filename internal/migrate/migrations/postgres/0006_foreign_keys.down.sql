@@ -0,0 +1 @@
+-- Nothing to undo; see 0006_foreign_keys.up.sql.
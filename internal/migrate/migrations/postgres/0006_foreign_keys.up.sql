@@ -0,0 +1,2 @@
+-- PostgreSQL has had these foreign keys since 0001; this version keeps the
+-- drivers' migrations in step with SQLite's.
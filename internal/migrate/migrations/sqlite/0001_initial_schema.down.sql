@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS reading_list_books;
+DROP TABLE IF EXISTS reading_lists;
+DROP TABLE IF EXISTS books;
+DROP TABLE IF EXISTS authors;
@@ -0,0 +1,3 @@
+DROP INDEX idx_books_isbn_key;
+
+ALTER TABLE books DROP COLUMN isbn_key;
@@ -0,0 +1,7 @@
+-- isbn_key holds the normalized ISBN (no hyphens or spaces, upper-case X) so
+-- that differently formatted copies of the same ISBN collide on the index.
+ALTER TABLE books ADD COLUMN isbn_key TEXT NOT NULL DEFAULT '';
+
+UPDATE books SET isbn_key = UPPER(REPLACE(REPLACE(isbn, '-', ''), ' ', ''));
+
+CREATE UNIQUE INDEX idx_books_isbn_key ON books (isbn_key);
@@ -0,0 +1,3 @@
+ALTER TABLE reading_lists DROP COLUMN version;
+ALTER TABLE books DROP COLUMN version;
+ALTER TABLE authors DROP COLUMN version;
@@ -0,0 +1 @@
+-- The original offsets are not kept, so there is nothing to undo.
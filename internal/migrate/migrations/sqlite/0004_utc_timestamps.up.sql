@@ -0,0 +1,20 @@
+-- Timestamps are stored as text, so comparisons and the year facet only
+-- work when every value is in UTC. Rewrite values written with another
+-- offset; this keeps millisecond precision. Values SQLite cannot parse are
+-- left alone.
+UPDATE authors SET birth_date = strftime('%Y-%m-%d %H:%M:%f+00:00', birth_date)
+	WHERE birth_date NOT LIKE '%+00:00' AND strftime('%s', birth_date) IS NOT NULL;
+UPDATE authors SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+	WHERE created_at NOT LIKE '%+00:00' AND strftime('%s', created_at) IS NOT NULL;
+UPDATE authors SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', updated_at)
+	WHERE updated_at NOT LIKE '%+00:00' AND strftime('%s', updated_at) IS NOT NULL;
+UPDATE books SET published_at = strftime('%Y-%m-%d %H:%M:%f+00:00', published_at)
+	WHERE published_at NOT LIKE '%+00:00' AND strftime('%s', published_at) IS NOT NULL;
+UPDATE books SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+	WHERE created_at NOT LIKE '%+00:00' AND strftime('%s', created_at) IS NOT NULL;
+UPDATE books SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', updated_at)
+	WHERE updated_at NOT LIKE '%+00:00' AND strftime('%s', updated_at) IS NOT NULL;
+UPDATE reading_lists SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+	WHERE created_at NOT LIKE '%+00:00' AND strftime('%s', created_at) IS NOT NULL;
+UPDATE reading_lists SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', updated_at)
+	WHERE updated_at NOT LIKE '%+00:00' AND strftime('%s', updated_at) IS NOT NULL;
@@ -0,0 +1,23 @@
+CREATE TABLE books_old (
+	id           TEXT PRIMARY KEY,
+	title        TEXT NOT NULL,
+	isbn         TEXT NOT NULL,
+	author_id    TEXT NOT NULL,
+	published_at TIMESTAMP NOT NULL,
+	pages        INTEGER NOT NULL DEFAULT 0,
+	genre        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	updated_at   TIMESTAMP NOT NULL,
+	isbn_key     TEXT NOT NULL DEFAULT '',
+	version      INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO books_old (id, title, isbn, author_id, published_at, pages, genre, created_at, updated_at, isbn_key, version)
+SELECT id, title, isbn, COALESCE(author_id, ''), published_at, pages, genre, created_at, updated_at, isbn_key, version
+FROM books;
+
+DROP TABLE books;
+ALTER TABLE books_old RENAME TO books;
+
+CREATE INDEX idx_books_author_id ON books (author_id);
+CREATE UNIQUE INDEX idx_books_isbn_key ON books (isbn_key);
@@ -0,0 +1,26 @@
+-- A NULL author_id marks a book whose author was deleted under the nullify
+-- delete policy. SQLite cannot drop NOT NULL in place, so the table is
+-- rebuilt; nothing references books by foreign key.
+CREATE TABLE books_new (
+	id           TEXT PRIMARY KEY,
+	title        TEXT NOT NULL,
+	isbn         TEXT NOT NULL,
+	author_id    TEXT,
+	published_at TIMESTAMP NOT NULL,
+	pages        INTEGER NOT NULL DEFAULT 0,
+	genre        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	updated_at   TIMESTAMP NOT NULL,
+	isbn_key     TEXT NOT NULL DEFAULT '',
+	version      INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO books_new (id, title, isbn, author_id, published_at, pages, genre, created_at, updated_at, isbn_key, version)
+SELECT id, title, isbn, NULLIF(author_id, ''), published_at, pages, genre, created_at, updated_at, isbn_key, version
+FROM books;
+
+DROP TABLE books;
+ALTER TABLE books_new RENAME TO books;
+
+CREATE INDEX idx_books_author_id ON books (author_id);
+CREATE UNIQUE INDEX idx_books_isbn_key ON books (isbn_key);
@@ -0,0 +1,38 @@
+CREATE TABLE reading_list_books_old (
+	list_id  TEXT NOT NULL REFERENCES reading_lists (id) ON DELETE CASCADE,
+	book_id  TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (list_id, book_id)
+);
+
+INSERT INTO reading_list_books_old (list_id, book_id, position)
+SELECT list_id, book_id, position FROM reading_list_books;
+
+DROP TABLE reading_list_books;
+ALTER TABLE reading_list_books_old RENAME TO reading_list_books;
+
+CREATE INDEX idx_reading_list_books_book_id ON reading_list_books (book_id);
+
+CREATE TABLE books_old (
+	id           TEXT PRIMARY KEY,
+	title        TEXT NOT NULL,
+	isbn         TEXT NOT NULL,
+	author_id    TEXT,
+	published_at TIMESTAMP NOT NULL,
+	pages        INTEGER NOT NULL DEFAULT 0,
+	genre        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	updated_at   TIMESTAMP NOT NULL,
+	isbn_key     TEXT NOT NULL DEFAULT '',
+	version      INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO books_old (id, title, isbn, author_id, published_at, pages, genre, created_at, updated_at, isbn_key, version)
+SELECT id, title, isbn, author_id, published_at, pages, genre, created_at, updated_at, isbn_key, version
+FROM books;
+
+DROP TABLE books;
+ALTER TABLE books_old RENAME TO books;
+
+CREATE INDEX idx_books_author_id ON books (author_id);
+CREATE UNIQUE INDEX idx_books_isbn_key ON books (isbn_key);
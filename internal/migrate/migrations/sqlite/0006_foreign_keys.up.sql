@@ -0,0 +1,47 @@
+-- Adds the foreign keys PostgreSQL has had since 0001: books.author_id
+-- references authors and reading_list_books.book_id references books, so
+-- the database rejects dangling references like the other backends.
+-- SQLite cannot add a foreign key in place, so both tables are rebuilt.
+-- Books of authors that no longer exist lose their author, as under the
+-- nullify delete policy, and memberships of books that no longer exist are
+-- dropped, as under cascade.
+CREATE TABLE books_new (
+	id           TEXT PRIMARY KEY,
+	title        TEXT NOT NULL,
+	isbn         TEXT NOT NULL,
+	author_id    TEXT REFERENCES authors (id),
+	published_at TIMESTAMP NOT NULL,
+	pages        INTEGER NOT NULL DEFAULT 0,
+	genre        TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	updated_at   TIMESTAMP NOT NULL,
+	isbn_key     TEXT NOT NULL DEFAULT '',
+	version      INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO books_new (id, title, isbn, author_id, published_at, pages, genre, created_at, updated_at, isbn_key, version)
+SELECT id, title, isbn, (SELECT a.id FROM authors a WHERE a.id = books.author_id), published_at, pages, genre, created_at, updated_at, isbn_key, version
+FROM books;
+
+DROP TABLE books;
+ALTER TABLE books_new RENAME TO books;
+
+CREATE INDEX idx_books_author_id ON books (author_id);
+CREATE UNIQUE INDEX idx_books_isbn_key ON books (isbn_key);
+
+CREATE TABLE reading_list_books_new (
+	list_id  TEXT NOT NULL REFERENCES reading_lists (id) ON DELETE CASCADE,
+	book_id  TEXT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (list_id, book_id)
+);
+
+INSERT INTO reading_list_books_new (list_id, book_id, position)
+SELECT list_id, book_id, position
+FROM reading_list_books
+WHERE book_id IN (SELECT id FROM books);
+
+DROP TABLE reading_list_books;
+ALTER TABLE reading_list_books_new RENAME TO reading_list_books;
+
+CREATE INDEX idx_reading_list_books_book_id ON reading_list_books (book_id);
@@ -14,6 +14,7 @@ type Author struct {
 	Country   string    `json:"country"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
 }
 
 // Validate checks if the author has valid data.
@@ -16,6 +16,7 @@ type Book struct {
 	Genre       string    `json:"genre"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int64     `json:"version"`
 }
 
 // Validate checks if the book has valid data.
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Book facet names.
+const (
+	FacetGenre  = "genre"
+	FacetAuthor = "author"
+	FacetDecade = "decade"
+	FacetPages  = "pages"
+)
+
+// BookFacets lists every book facet.
+var BookFacets = []string{FacetGenre, FacetAuthor, FacetDecade, FacetPages}
+
+// FacetCount is the number of results sharing one facet value. Label is a
+// display name for values that are IDs, such as author facets.
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// PageBucket is a range of page counts, Min <= pages <= Max.
+type PageBucket struct {
+	Min   int
+	Max   int
+	Label string
+}
+
+// PageBuckets are the buckets of the pages facet, in order.
+var PageBuckets = []PageBucket{
+	{1, 99, "1-99"},
+	{100, 199, "100-199"},
+	{200, 299, "200-299"},
+	{300, 499, "300-499"},
+	{500, 999, "500-999"},
+	{1000, math.MaxInt, "1000+"},
+}
+
+// FacetValue returns the value of a book facet, or "" if the book has none,
+// e.g. no genre or an unknown page count.
+func (b *Book) FacetValue(facet string) string {
+	switch facet {
+	case FacetGenre:
+		return b.Genre
+	case FacetAuthor:
+		return b.AuthorID
+	case FacetDecade:
+		if b.PublishedAt.IsZero() {
+			return ""
+		}
+		return Decade(b.PublishedAt.Year())
+	case FacetPages:
+		for _, bucket := range PageBuckets {
+			if b.Pages >= bucket.Min && b.Pages <= bucket.Max {
+				return bucket.Label
+			}
+		}
+	}
+	return ""
+}
+
+// Decade returns the decade facet value for a year, e.g. "1960s".
+func Decade(year int) string {
+	return strconv.Itoa(year/10*10) + "s"
+}
+
+// SortFacet orders facet counts for display: decades and page buckets in
+// their natural order, other facets by descending count, then value.
+func SortFacet(facet string, counts []FacetCount) {
+	switch facet {
+	case FacetDecade:
+		sort.Slice(counts, func(i, j int) bool {
+			return decadeYear(counts[i].Value) < decadeYear(counts[j].Value)
+		})
+	case FacetPages:
+		order := make(map[string]int, len(PageBuckets))
+		for i, bucket := range PageBuckets {
+			order[bucket.Label] = i
+		}
+		sort.Slice(counts, func(i, j int) bool {
+			return order[counts[i].Value] < order[counts[j].Value]
+		})
+	default:
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Value < counts[j].Value
+		})
+	}
+}
+
+func decadeYear(decade string) int {
+	year, _ := strconv.Atoi(decade[:len(decade)-1])
+	return year
+}
+
+// IsBookFacet reports whether name is a book facet.
+func IsBookFacet(name string) bool {
+	for _, f := range BookFacets {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CountFacets counts facet values over books.
+func CountFacets(books []*Book, facets []string) map[string][]FacetCount {
+	result := make(map[string][]FacetCount, len(facets))
+	for _, facet := range facets {
+		counts := make(map[string]int)
+		for _, b := range books {
+			if v := b.FacetValue(facet); v != "" {
+				counts[v]++
+			}
+		}
+		result[facet] = FacetCounts(facet, counts)
+	}
+	return result
+}
+
+// FacetCounts converts value counts into sorted FacetCounts.
+func FacetCounts(facet string, counts map[string]int) []FacetCount {
+	out := make([]FacetCount, 0, len(counts))
+	for v, n := range counts {
+		out = append(out, FacetCount{Value: v, Count: n})
+	}
+	SortFacet(facet, out)
+	return out
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBook_FacetValue(t *testing.T) {
+	book := &Book{
+		Genre:       "Fantasy",
+		AuthorID:    "author-1",
+		Pages:       300,
+		PublishedAt: time.Date(1969, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	want := map[string]string{
+		FacetGenre:  "Fantasy",
+		FacetAuthor: "author-1",
+		FacetDecade: "1960s",
+		FacetPages:  "300-499",
+		"colour":    "",
+	}
+	for facet, value := range want {
+		if got := book.FacetValue(facet); got != value {
+			t.Errorf("FacetValue(%q) = %q, want %q", facet, got, value)
+		}
+	}
+
+	empty := &Book{}
+	for _, facet := range BookFacets {
+		if got := empty.FacetValue(facet); got != "" {
+			t.Errorf("Empty book: FacetValue(%q) = %q, want none", facet, got)
+		}
+	}
+}
+
+func TestCountFacets(t *testing.T) {
+	books := []*Book{
+		{Genre: "Horror", Pages: 1200},
+		{Genre: "Fantasy", Pages: 99},
+		{Genre: "Fantasy", Pages: 100},
+		{Pages: 2000},
+	}
+	counts := CountFacets(books, []string{FacetGenre, FacetPages})
+
+	genres := counts[FacetGenre]
+	if len(genres) != 2 || genres[0] != (FacetCount{Value: "Fantasy", Count: 2}) || genres[1] != (FacetCount{Value: "Horror", Count: 1}) {
+		t.Errorf("Genre counts = %+v", genres)
+	}
+
+	pages := counts[FacetPages]
+	want := []FacetCount{{Value: "1-99", Count: 1}, {Value: "100-199", Count: 1}, {Value: "1000+", Count: 2}}
+	if len(pages) != len(want) {
+		t.Fatalf("Pages counts = %+v", pages)
+	}
+	for i := range want {
+		if pages[i] != want[i] {
+			t.Errorf("Pages counts = %+v, want %+v", pages, want)
+			break
+		}
+	}
+}
+
+func TestSortFacet_Decades(t *testing.T) {
+	counts := []FacetCount{{Value: "2000s", Count: 5}, {Value: "990s", Count: 1}, {Value: "1960s", Count: 9}}
+	SortFacet(FacetDecade, counts)
+	if counts[0].Value != "990s" || counts[1].Value != "1960s" || counts[2].Value != "2000s" {
+		t.Errorf("Decades not in order: %+v", counts)
+	}
+}
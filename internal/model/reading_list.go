@@ -15,6 +15,7 @@ type ReadingList struct {
 	BookIDs     []string  `json:"book_ids"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int64     `json:"version"`
 }
 
 // Validate checks if the reading list has valid data.
@@ -28,6 +29,13 @@ func (r *ReadingList) Validate() error {
 	if len(r.Description) > 500 {
 		return errors.New("description must be 500 characters or less")
 	}
+	seen := make(map[string]bool, len(r.BookIDs))
+	for _, id := range r.BookIDs {
+		if seen[id] {
+			return errors.New("book_ids must not contain duplicates")
+		}
+		seen[id] = true
+	}
 	return nil
 }
 
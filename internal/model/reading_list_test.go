@@ -94,6 +94,16 @@ func TestReadingList_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "duplicate book",
+			list: ReadingList{
+				ID:      "list-1",
+				Name:    "Twice",
+				BookIDs: []string{"book-1", "book-2", "book-1"},
+			},
+			wantErr: true,
+			errMsg:  "book_ids must not contain duplicates",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,148 @@
+// Package querylang parses the fielded book query language, e.g.
+//
+//	author:"le guin" genre:fantasy pages>300 published:1960..1980 -genre:horror
+//
+// Terms separated by spaces must all match; OR, parentheses and a leading
+// "-" or NOT build other combinations. A bare word matches book titles.
+package querylang
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Queryable fields.
+const (
+	FieldTitle     = "title"
+	FieldAuthor    = "author"
+	FieldAuthorID  = "author_id"
+	FieldGenre     = "genre"
+	FieldISBN      = "isbn"
+	FieldPages     = "pages"
+	FieldPublished = "published"
+)
+
+// Node is a node of a parsed query. String renders it back in the query
+// language with explicit grouping.
+type Node interface {
+	String() string
+}
+
+// And matches books that match every node.
+type And []Node
+
+// Or matches books that match any node.
+type Or []Node
+
+// Not matches books that do not match Node.
+type Not struct {
+	Node Node
+}
+
+// Match compares a text field. Title and author match when the field
+// contains Value, genre when it equals Value, both ignoring case; author_id
+// and isbn must match exactly, the latter after ISBN normalization.
+type Match struct {
+	Field string
+	Value string
+}
+
+// PagesRange matches books with Min <= pages <= Max.
+type PagesRange struct {
+	Min int
+	Max int
+}
+
+// DateRange matches books published at or after From and before To.
+// A zero bound is open.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// AuthorIDs matches books by any of the listed authors. ResolveAuthors
+// replaces author Match nodes with it.
+type AuthorIDs []string
+
+func (n And) String() string { return join(n, " ") }
+func (n Or) String() string  { return join(n, " OR ") }
+func (n Not) String() string { return "-" + n.Node.String() }
+
+func (n Match) String() string {
+	return n.Field + ":" + strconv.Quote(n.Value)
+}
+
+func (n PagesRange) String() string {
+	lo, hi := "", ""
+	if n.Min > 0 {
+		lo = strconv.Itoa(n.Min)
+	}
+	if n.Max != math.MaxInt {
+		hi = strconv.Itoa(n.Max)
+	}
+	return FieldPages + ":" + lo + ".." + hi
+}
+
+func (n DateRange) String() string {
+	lo, hi := "", ""
+	if !n.From.IsZero() {
+		lo = n.From.Format(time.DateOnly)
+	}
+	if !n.To.IsZero() {
+		hi = "<" + n.To.Format(time.DateOnly)
+	}
+	return FieldPublished + ":" + lo + ".." + hi
+}
+
+func (n AuthorIDs) String() string {
+	return FieldAuthorID + ":(" + strings.Join(n, " ") + ")"
+}
+
+func join(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// ResolveAuthors returns a copy of n with every author Match replaced by
+// the AuthorIDs that lookup finds for its value.
+func ResolveAuthors(n Node, lookup func(name string) ([]string, error)) (Node, error) {
+	switch n := n.(type) {
+	case And:
+		return resolveAll(n, lookup, func(nodes []Node) Node { return And(nodes) })
+	case Or:
+		return resolveAll(n, lookup, func(nodes []Node) Node { return Or(nodes) })
+	case Not:
+		inner, err := ResolveAuthors(n.Node, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: inner}, nil
+	case Match:
+		if n.Field != FieldAuthor {
+			return n, nil
+		}
+		ids, err := lookup(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		return AuthorIDs(ids), nil
+	}
+	return n, nil
+}
+
+func resolveAll(nodes []Node, lookup func(string) ([]string, error), build func([]Node) Node) (Node, error) {
+	out := make([]Node, len(nodes))
+	for i, n := range nodes {
+		r, err := ResolveAuthors(n, lookup)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = r
+	}
+	return build(out), nil
+}
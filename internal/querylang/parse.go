@@ -0,0 +1,404 @@
+package querylang
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxDepth limits nesting of parentheses and negations.
+const maxDepth = 32
+
+// SyntaxError describes an invalid query. Column is the 1-based character
+// position of Token in the query.
+type SyntaxError struct {
+	Column int
+	Token  string
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at column %d", e.Msg, e.Column)
+	}
+	return fmt.Sprintf("%s at column %d (%q)", e.Msg, e.Column, e.Token)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokQuoted
+	tokLParen
+	tokRParen
+	tokMinus
+	tokOp // one of : > >= < <=
+)
+
+type token struct {
+	kind tokenKind
+	text string // for tokQuoted, the unquoted value
+	raw  string // the token as written
+	pos  int    // byte offset
+}
+
+// lex splits a query into tokens.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(' || r == ')':
+			kind := tokLParen
+			if r == ')' {
+				kind = tokRParen
+			}
+			tokens = append(tokens, token{kind: kind, raw: string(r), pos: i})
+			i++
+		case r == '-' && (len(tokens) == 0 || precedesTerm(s, i)):
+			tokens = append(tokens, token{kind: tokMinus, raw: "-", pos: i})
+			i++
+		case r == ':' || r == '<' || r == '>':
+			op := string(r)
+			if r != ':' && i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, raw: op, pos: i})
+			i += len(op)
+		case r == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, syntaxError(s, i, s[i:], "unterminated quote")
+			}
+			raw := s[i : i+end+2]
+			tokens = append(tokens, token{kind: tokQuoted, text: raw[1 : len(raw)-1], raw: raw, pos: i})
+			i += len(raw)
+		default:
+			start := i
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if unicode.IsSpace(r) || strings.ContainsRune(`()":<>`, r) {
+					break
+				}
+				i += size
+			}
+			word := s[start:i]
+			tokens = append(tokens, token{kind: tokWord, text: word, raw: word, pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(s)}), nil
+}
+
+// precedesTerm reports whether the "-" at s[i] starts a negated term rather
+// than being part of a word: it must follow a space or "(".
+func precedesTerm(s string, i int) bool {
+	prev, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsSpace(prev) || prev == '('
+}
+
+// Parse parses a query. Errors are *SyntaxError values.
+func Parse(s string) (Node, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{src: s, tokens: tokens}
+	n, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorAt(t, "unexpected "+describe(t))
+	}
+	return n, nil
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorAt(t token, msg string) error {
+	return syntaxError(p.src, t.pos, t.raw, msg)
+}
+
+func isOr(t token) bool { return t.kind == tokWord && t.text == "OR" }
+
+// or parses: and { "OR" and }
+func (p *parser) or(depth int) (Node, error) {
+	first, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for isOr(p.peek()) {
+		p.next()
+		n, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return Or(nodes), nil
+}
+
+// and parses: unary { unary }
+func (p *parser) and(depth int) (Node, error) {
+	var nodes []Node
+	for {
+		t := p.peek()
+		if t.kind == tokEOF || t.kind == tokRParen || isOr(t) {
+			break
+		}
+		n, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	switch len(nodes) {
+	case 0:
+		t := p.peek()
+		return nil, p.errorAt(t, "expected a search term before "+describe(t))
+	case 1:
+		return nodes[0], nil
+	}
+	return And(nodes), nil
+}
+
+// unary parses: ("-" | "NOT") unary | "(" or ")" | term
+func (p *parser) unary(depth int) (Node, error) {
+	t := p.peek()
+	if depth >= maxDepth {
+		return nil, p.errorAt(t, "query is nested too deeply")
+	}
+
+	switch {
+	case t.kind == tokMinus || (t.kind == tokWord && t.text == "NOT"):
+		p.next()
+		if next := p.peek(); next.kind == tokEOF || next.kind == tokRParen || isOr(next) {
+			return nil, p.errorAt(t, "expected a search term after "+describe(t))
+		}
+		n, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+
+	case t.kind == tokLParen:
+		p.next()
+		n, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, p.errorAt(t, "unclosed parenthesis")
+		}
+		return n, nil
+	}
+	return p.term()
+}
+
+// term parses: word [op value] | quoted
+func (p *parser) term() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokQuoted:
+		return Match{Field: FieldTitle, Value: t.text}, nil
+	case tokWord:
+	default:
+		return nil, p.errorAt(t, "unexpected "+describe(t))
+	}
+
+	op := p.peek()
+	if op.kind != tokOp {
+		return Match{Field: FieldTitle, Value: t.text}, nil
+	}
+	p.next()
+
+	field := strings.ToLower(t.text)
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokQuoted {
+		return nil, p.errorAt(op, fmt.Sprintf("expected a value after %s%s", t.text, op.text))
+	}
+
+	switch field {
+	case FieldTitle, FieldAuthor, FieldAuthorID, FieldGenre, FieldISBN:
+		if op.text != ":" {
+			return nil, p.errorAt(op, fmt.Sprintf("%s only supports %s:value", field, field))
+		}
+		if value.text == "" {
+			return nil, p.errorAt(value, fmt.Sprintf("%s needs a value", field))
+		}
+		return Match{Field: field, Value: value.text}, nil
+	case FieldPages:
+		return p.pages(op, value)
+	case FieldPublished:
+		return p.published(op, value)
+	}
+	return nil, p.errorAt(t, fmt.Sprintf("unknown field (expected one of %s)", strings.Join(fields, ", ")))
+}
+
+var fields = []string{FieldTitle, FieldAuthor, FieldAuthorID, FieldGenre, FieldISBN, FieldPages, FieldPublished}
+
+// pages parses pages:N, pages:N..M and pages with a comparison operator.
+func (p *parser) pages(op, value token) (Node, error) {
+	atoi := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, p.errorAt(value, "pages must be a whole number")
+		}
+		return n, nil
+	}
+
+	r := PagesRange{Max: math.MaxInt}
+	if lo, hi, ok := strings.Cut(value.text, ".."); ok && op.text == ":" {
+		if lo == "" && hi == "" {
+			return nil, p.errorAt(value, "range needs at least one bound")
+		}
+		var err error
+		if lo != "" {
+			if r.Min, err = atoi(lo); err != nil {
+				return nil, err
+			}
+		}
+		if hi != "" {
+			if r.Max, err = atoi(hi); err != nil {
+				return nil, err
+			}
+		}
+		if r.Min > r.Max {
+			return nil, p.errorAt(value, "range is empty")
+		}
+		return r, nil
+	}
+
+	n, err := atoi(value.text)
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case ":":
+		r.Min, r.Max = n, n
+	case ">":
+		if n == math.MaxInt {
+			return nil, p.errorAt(value, "range is empty")
+		}
+		r.Min = n + 1
+	case ">=":
+		r.Min = n
+	case "<":
+		if n == 0 {
+			return nil, p.errorAt(value, "range is empty")
+		}
+		r.Max = n - 1
+	case "<=":
+		r.Max = n
+	}
+	return r, nil
+}
+
+// published parses dates as YYYY, YYYY-MM or YYYY-MM-DD, each covering the
+// whole year, month or day, with ranges and comparison operators.
+func (p *parser) published(op, value token) (Node, error) {
+	period := func(s string) (from, to time.Time, err error) {
+		for _, layout := range []struct {
+			format string
+			years  int
+			months int
+			days   int
+		}{
+			{"2006", 1, 0, 0},
+			{"2006-01", 0, 1, 0},
+			{time.DateOnly, 0, 0, 1},
+		} {
+			if t, err := time.Parse(layout.format, s); err == nil {
+				return t, t.AddDate(layout.years, layout.months, layout.days), nil
+			}
+		}
+		return time.Time{}, time.Time{}, p.errorAt(value, "published must be a date like 1970, 1970-05 or 1970-05-31")
+	}
+
+	var r DateRange
+	if lo, hi, ok := strings.Cut(value.text, ".."); ok && op.text == ":" {
+		if lo == "" && hi == "" {
+			return nil, p.errorAt(value, "range needs at least one bound")
+		}
+		if lo != "" {
+			from, _, err := period(lo)
+			if err != nil {
+				return nil, err
+			}
+			r.From = from
+		}
+		if hi != "" {
+			_, to, err := period(hi)
+			if err != nil {
+				return nil, err
+			}
+			r.To = to
+		}
+		if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+			return nil, p.errorAt(value, "range is empty")
+		}
+		return r, nil
+	}
+
+	from, to, err := period(value.text)
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case ":":
+		r.From, r.To = from, to
+	case ">":
+		r.From = to
+	case ">=":
+		r.From = from
+	case "<":
+		r.To = from
+	case "<=":
+		r.To = to
+	}
+	return r, nil
+}
+
+// describe names a token for error messages.
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokRParen:
+		return `")"`
+	}
+	return strconv.Quote(t.raw)
+}
+
+// syntaxError builds a SyntaxError for the token at byte offset pos.
+func syntaxError(src string, pos int, raw, msg string) error {
+	return &SyntaxError{Column: utf8.RuneCountInString(src[:pos]) + 1, Token: raw, Msg: msg}
+}
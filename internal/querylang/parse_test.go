@@ -0,0 +1,97 @@
+package querylang
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`dune`, `title:"dune"`},
+		{`"left hand"`, `title:"left hand"`},
+		{
+			`author:"le guin" genre:fantasy pages>300 published:1960..1980 -genre:horror`,
+			`(author:"le guin" genre:"fantasy" pages:301.. published:1960-01-01..<1981-01-01 -genre:"horror")`,
+		},
+		{`Genre:SF OR genre:fantasy`, `(genre:"SF" OR genre:"fantasy")`},
+		{`a b OR c`, `((title:"a" title:"b") OR title:"c")`},
+		{`NOT (isbn:978-0441013593 OR author_id:01H)`, `-(isbn:"978-0441013593" OR author_id:"01H")`},
+		{`pages:100..`, `pages:100..`},
+		{`pages<=250`, `pages:..250`},
+		{`pages<250`, `pages:..249`},
+		{`pages:42`, `pages:42..42`},
+		{`published:1970-05`, `published:1970-05-01..<1970-06-01`},
+		{`published>1970`, `published:1971-01-01..`},
+		{`published<1970-05-31`, `published:..<1970-05-31`},
+		{`published:..1999-12-31`, `published:..<2000-01-01`},
+		{`sci-fi -horror`, `(title:"sci-fi" -title:"horror")`},
+	}
+
+	for _, tt := range tests {
+		n, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.query, err)
+			continue
+		}
+		if got := n.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		query  string
+		column int
+		token  string
+	}{
+		{`genre:fantasy autor:"le guin"`, 15, "autor"},
+		{`pages>many`, 7, "many"},
+		{`pages:300..100`, 7, "300..100"},
+		{`pages>9223372036854775807`, 7, "9223372036854775807"},
+		{`pages>99999999999999999999`, 7, "99999999999999999999"},
+		{`pages<0`, 7, "0"},
+		{`published:1970-13`, 11, "1970-13"},
+		{`title>dune`, 6, ">"},
+		{`genre:`, 6, ":"},
+		{`(dune OR emma`, 1, "("},
+		{`dune)`, 5, ")"},
+		{`OR dune`, 1, "OR"},
+		{`dune -`, 6, "-"},
+		{`author:"le guin`, 8, `"le guin`},
+		{`Łódź autor:x`, 6, "autor"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, want *SyntaxError", tt.query, err)
+			continue
+		}
+		if syntaxErr.Column != tt.column || syntaxErr.Token != tt.token {
+			t.Errorf("Parse(%q) error at column %d (%q), want column %d (%q): %v",
+				tt.query, syntaxErr.Column, syntaxErr.Token, tt.column, tt.token, err)
+		}
+	}
+}
+
+func TestResolveAuthors(t *testing.T) {
+	n, _ := Parse(`author:lem OR -author:"le guin"`)
+
+	resolved, err := ResolveAuthors(n, func(name string) ([]string, error) {
+		if name == "lem" {
+			return []string{"a1", "a2"}, nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("ResolveAuthors failed: %v", err)
+	}
+	if want := `(author_id:(a1 a2) OR -author_id:())`; resolved.String() != want {
+		t.Errorf("ResolveAuthors = %s, want %s", resolved, want)
+	}
+}
@@ -38,6 +38,7 @@ func (r *AuthorRepository) Create(author *model.Author) error {
 	now := time.Now()
 	author.CreatedAt = now
 	author.UpdatedAt = now
+	author.Version = 1
 
 	stored := *author
 	r.authors[author.ID] = &stored
@@ -67,9 +68,13 @@ func (r *AuthorRepository) Update(author *model.Author) error {
 	if !exists {
 		return ErrAuthorNotFound
 	}
+	if author.Version != 0 && author.Version != existing.Version {
+		return ErrVersionConflict
+	}
 
 	author.CreatedAt = existing.CreatedAt
 	author.UpdatedAt = time.Now()
+	author.Version = existing.Version + 1
 
 	stored := *author
 	r.authors[author.ID] = &stored
@@ -78,17 +83,41 @@ func (r *AuthorRepository) Update(author *model.Author) error {
 
 // Delete removes an author by ID.
 func (r *AuthorRepository) Delete(id string) error {
+	return r.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes an author by ID if it is still at the given version.
+func (r *AuthorRepository) DeleteIfVersion(id string, version int64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.authors[id]; !exists {
+	existing, exists := r.authors[id]
+	if !exists {
 		return ErrAuthorNotFound
 	}
+	if version != 0 && version != existing.Version {
+		return ErrVersionConflict
+	}
 
 	delete(r.authors, id)
 	return nil
 }
 
+// GetMany retrieves the authors with the given IDs that exist.
+func (r *AuthorRepository) GetMany(ids []string) ([]*model.Author, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*model.Author, 0, len(ids))
+	for _, id := range ids {
+		if author, exists := r.authors[id]; exists {
+			copy := *author
+			result = append(result, &copy)
+		}
+	}
+	return result, nil
+}
+
 // List returns all authors.
 func (r *AuthorRepository) List() []*model.Author {
 	r.mu.RLock()
@@ -117,9 +146,45 @@ func (r *AuthorRepository) FindByCountry(country string) []*model.Author {
 	return result
 }
 
+// Query returns a sorted page of the authors matching q.Filter and the
+// number of matching authors.
+func (r *AuthorRepository) Query(q AuthorQuery) ([]*model.Author, int, error) {
+	if err := checkQuery(q.Sort, authorSortColumns, q.Offset, q.Limit); err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*model.Author
+	for _, author := range r.authors {
+		if q.Filter.Country == "" || author.Country == q.Filter.Country {
+			matches = append(matches, author)
+		}
+	}
+
+	page := sortAndPage(matches, q.Sort, q.Offset, q.Limit, compareAuthors)
+	result := make([]*model.Author, len(page))
+	for i, author := range page {
+		copy := *author
+		result[i] = &copy
+	}
+	return result, len(matches), nil
+}
+
 // Count returns the total number of authors.
 func (r *AuthorRepository) Count() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return len(r.authors)
 }
+
+// restore stores an author exactly as given, keeping its timestamps.
+// It is used when replaying persisted state.
+func (r *AuthorRepository) restore(author *model.Author) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *author
+	r.authors[author.ID] = &stored
+}
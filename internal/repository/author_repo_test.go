@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
@@ -142,3 +143,47 @@ func TestAuthorRepository_FindByCountry(t *testing.T) {
 		t.Errorf("Expected 2 authors from USA, got %d", len(authors))
 	}
 }
+
+func TestAuthorRepository_Query(t *testing.T) {
+	repo := NewAuthorRepository()
+	_ = repo.Create(&model.Author{ID: "1", Name: "Lem", Country: "PL"})
+	_ = repo.Create(&model.Author{ID: "2", Name: "Austen", Country: "UK"})
+	_ = repo.Create(&model.Author{ID: "3", Name: "Conrad", Country: "PL"})
+
+	authors, total, err := repo.Query(AuthorQuery{
+		Filter: AuthorFilter{Country: "PL"},
+		Sort:   []SortKey{{Field: "name"}},
+		Limit:  1,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if total != 2 || len(authors) != 1 || authors[0].ID != "3" {
+		t.Errorf("Query = %v (total %d), want author 3 of 2", authors, total)
+	}
+
+	if _, _, err := repo.Query(AuthorQuery{Sort: []SortKey{{Field: "bio"}}}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+}
+
+func TestAuthorRepository_GetMany(t *testing.T) {
+	testAuthorGetMany(t, NewAuthorRepository())
+}
+
+// testAuthorGetMany checks that GetMany skips missing IDs against any
+// AuthorStore.
+func testAuthorGetMany(t *testing.T, store AuthorStore) {
+	t.Helper()
+
+	_ = store.Create(&model.Author{ID: "a1", Name: "Jane Doe"})
+	_ = store.Create(&model.Author{ID: "a2", Name: "John Doe"})
+
+	authors, err := store.GetMany([]string{"a2", "missing"})
+	if err != nil {
+		t.Fatalf("GetMany failed: %v", err)
+	}
+	if len(authors) != 1 || authors[0].Name != "John Doe" {
+		t.Errorf("GetMany = %+v, want John Doe", authors)
+	}
+}
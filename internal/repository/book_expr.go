@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/querylang"
+	"github.com/pawelpaszki/gorts-demo/pkg/validator"
+)
+
+// checkExpr rejects query language nodes the repositories cannot evaluate,
+// i.e. author name matches that were not resolved to author IDs.
+func checkExpr(n querylang.Node) error {
+	switch n := n.(type) {
+	case nil, querylang.PagesRange, querylang.DateRange, querylang.AuthorIDs:
+		return nil
+	case querylang.And:
+		return checkExprs(n)
+	case querylang.Or:
+		return checkExprs(n)
+	case querylang.Not:
+		return checkExpr(n.Node)
+	case querylang.Match:
+		if n.Field == querylang.FieldAuthor {
+			return fmt.Errorf("%w: author names must be resolved to IDs", ErrInvalidQuery)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported expression %T", ErrInvalidQuery, n)
+}
+
+func checkExprs(nodes []querylang.Node) error {
+	for _, n := range nodes {
+		if err := checkExpr(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchExpr reports whether a book satisfies a checked expression.
+func matchExpr(n querylang.Node, b *model.Book) bool {
+	switch n := n.(type) {
+	case nil:
+		return true
+	case querylang.And:
+		for _, c := range n {
+			if !matchExpr(c, b) {
+				return false
+			}
+		}
+		return true
+	case querylang.Or:
+		for _, c := range n {
+			if matchExpr(c, b) {
+				return true
+			}
+		}
+		return false
+	case querylang.Not:
+		return !matchExpr(n.Node, b)
+	case querylang.Match:
+		switch n.Field {
+		case querylang.FieldTitle:
+			return strings.Contains(strings.ToLower(b.Title), strings.ToLower(n.Value))
+		case querylang.FieldGenre:
+			return strings.EqualFold(b.Genre, n.Value)
+		case querylang.FieldAuthorID:
+			return b.AuthorID == n.Value
+		case querylang.FieldISBN:
+			return validator.NormalizeISBN(b.ISBN) == validator.NormalizeISBN(n.Value)
+		}
+	case querylang.AuthorIDs:
+		for _, id := range n {
+			if b.AuthorID == id {
+				return true
+			}
+		}
+		return false
+	case querylang.PagesRange:
+		return b.Pages >= n.Min && b.Pages <= n.Max
+	case querylang.DateRange:
+		return (n.From.IsZero() || !b.PublishedAt.Before(n.From)) &&
+			(n.To.IsZero() || b.PublishedAt.Before(n.To))
+	}
+	return false
+}
+
+// exprSQL translates a checked expression into a condition over the books
+// table. Text comparisons use LOWER, so only ASCII letters ignore case in
+// SQLite.
+func exprSQL(n querylang.Node) (string, []interface{}) {
+	switch n := n.(type) {
+	case querylang.And:
+		return joinExprSQL(n, " AND ")
+	case querylang.Or:
+		return joinExprSQL(n, " OR ")
+	case querylang.Not:
+		cond, args := exprSQL(n.Node)
+		return "NOT " + cond, args
+	case querylang.Match:
+		switch n.Field {
+		case querylang.FieldTitle:
+			return `LOWER(title) LIKE ? ESCAPE '\'`, []interface{}{"%" + escapeLike(strings.ToLower(n.Value)) + "%"}
+		case querylang.FieldGenre:
+			return "LOWER(genre) = ?", []interface{}{strings.ToLower(n.Value)}
+		case querylang.FieldAuthorID:
+			// A book without an author has a NULL author_id; compare it as
+			// "" so that NOT matches it, as it does in memory
+			return "COALESCE(author_id, '') = ?", []interface{}{n.Value}
+		case querylang.FieldISBN:
+			return "isbn_key = ?", []interface{}{validator.NormalizeISBN(n.Value)}
+		}
+	case querylang.AuthorIDs:
+		return inList("COALESCE(author_id, '')", len(n)), stringArgs(n)
+	case querylang.PagesRange:
+		if n.Max == math.MaxInt {
+			return "pages >= ?", []interface{}{n.Min}
+		}
+		return "pages BETWEEN ? AND ?", []interface{}{n.Min, n.Max}
+	case querylang.DateRange:
+		var conds []string
+		var args []interface{}
+		if !n.From.IsZero() {
+			conds, args = append(conds, "published_at >= ?"), append(args, n.From.UTC())
+		}
+		if !n.To.IsZero() {
+			conds, args = append(conds, "published_at < ?"), append(args, n.To.UTC())
+		}
+		if len(conds) == 0 {
+			// published>=0001 has neither bound and matches every book
+			return "1 = 1", nil
+		}
+		return "(" + strings.Join(conds, " AND ") + ")", args
+	}
+	return "1 = 0", nil
+}
+
+func joinExprSQL(nodes []querylang.Node, sep string) (string, []interface{}) {
+	conds := make([]string, len(nodes))
+	var args []interface{}
+	for i, n := range nodes {
+		var a []interface{}
+		conds[i], a = exprSQL(n)
+		args = append(args, a...)
+	}
+	return "(" + strings.Join(conds, sep) + ")", args
+}
+
+// escapeLike escapes the LIKE wildcards in s, using \ as the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
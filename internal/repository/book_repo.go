@@ -6,42 +6,62 @@ import (
 	"time"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/pkg/validator"
 )
 
 var (
 	ErrBookNotFound = errors.New("book not found")
 	ErrBookExists   = errors.New("book already exists")
+
+	// ErrDuplicateISBN is returned when another book already has the same
+	// ISBN, compared after validator.NormalizeISBN.
+	ErrDuplicateISBN = errors.New("book with this ISBN already exists")
 )
 
 // BookRepository provides CRUD operations for books.
 type BookRepository struct {
 	mu    sync.RWMutex
 	books map[string]*model.Book
+	// byISBN maps normalized ISBNs to book IDs.
+	byISBN map[string]string
+	// authors, when set, is what Create and Update check author_id
+	// against; see NewRepositories.
+	authors *AuthorRepository
 }
 
 // NewBookRepository creates a new in-memory book repository.
 func NewBookRepository() *BookRepository {
 	return &BookRepository{
-		books: make(map[string]*model.Book),
+		books:  make(map[string]*model.Book),
+		byISBN: make(map[string]string),
 	}
 }
 
 // Create adds a new book to the repository.
 func (r *BookRepository) Create(book *model.Book) error {
+	r.lockAuthors()
+	defer r.unlockAuthors()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if _, exists := r.books[book.ID]; exists {
 		return ErrBookExists
 	}
+	if _, taken := r.byISBN[validator.NormalizeISBN(book.ISBN)]; taken {
+		return ErrDuplicateISBN
+	}
+	if !r.authorExists(book.AuthorID) {
+		return ErrInvalidReference
+	}
 
 	now := time.Now()
 	book.CreatedAt = now
 	book.UpdatedAt = now
+	book.Version = 1
 
 	// Store a copy to prevent external mutations
 	stored := *book
-	r.books[book.ID] = &stored
+	r.put(&stored)
 	return nil
 }
 
@@ -60,8 +80,25 @@ func (r *BookRepository) Get(id string) (*model.Book, error) {
 	return &result, nil
 }
 
+// GetMany retrieves the books with the given IDs that exist.
+func (r *BookRepository) GetMany(ids []string) ([]*model.Book, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*model.Book, 0, len(ids))
+	for _, id := range ids {
+		if book, exists := r.books[id]; exists {
+			copy := *book
+			result = append(result, &copy)
+		}
+	}
+	return result, nil
+}
+
 // Update modifies an existing book.
 func (r *BookRepository) Update(book *model.Book) error {
+	r.lockAuthors()
+	defer r.unlockAuthors()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -69,24 +106,70 @@ func (r *BookRepository) Update(book *model.Book) error {
 	if !exists {
 		return ErrBookNotFound
 	}
+	if book.Version != 0 && book.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	if owner, taken := r.byISBN[validator.NormalizeISBN(book.ISBN)]; taken && owner != book.ID {
+		return ErrDuplicateISBN
+	}
+	if !r.authorExists(book.AuthorID) {
+		return ErrInvalidReference
+	}
 
 	book.CreatedAt = existing.CreatedAt
 	book.UpdatedAt = time.Now()
+	book.Version = existing.Version + 1
 
 	stored := *book
-	r.books[book.ID] = &stored
+	r.put(&stored)
 	return nil
 }
 
+// lockAuthors read-locks the linked author repository, if any, so that
+// authors cannot be deleted between the reference check and the write. It
+// is taken before the book lock, the order RelationRepository uses.
+func (r *BookRepository) lockAuthors() {
+	if r.authors != nil {
+		r.authors.mu.RLock()
+	}
+}
+
+func (r *BookRepository) unlockAuthors() {
+	if r.authors != nil {
+		r.authors.mu.RUnlock()
+	}
+}
+
+// authorExists reports whether a book may refer to the author: an empty
+// author ID refers to nobody, and without a linked author repository every
+// author is taken to exist. The caller holds lockAuthors.
+func (r *BookRepository) authorExists(id string) bool {
+	if r.authors == nil || id == "" {
+		return true
+	}
+	_, exists := r.authors.authors[id]
+	return exists
+}
+
 // Delete removes a book by ID.
 func (r *BookRepository) Delete(id string) error {
+	return r.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes a book by ID if it is still at the given version.
+func (r *BookRepository) DeleteIfVersion(id string, version int64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.books[id]; !exists {
+	existing, exists := r.books[id]
+	if !exists {
 		return ErrBookNotFound
 	}
+	if version != 0 && version != existing.Version {
+		return ErrVersionConflict
+	}
 
+	delete(r.byISBN, validator.NormalizeISBN(existing.ISBN))
 	delete(r.books, id)
 	return nil
 }
@@ -119,6 +202,63 @@ func (r *BookRepository) FindByAuthor(authorID string) []*model.Book {
 	return result
 }
 
+// Query returns a sorted page of the books matching q.Filter and the
+// number of matching books.
+func (r *BookRepository) Query(q BookQuery) ([]*model.Book, int, error) {
+	if err := checkQuery(q.Sort, bookSortColumns, q.Offset, q.Limit); err != nil {
+		return nil, 0, err
+	}
+	if err := checkBookFilter(q.Filter); err != nil {
+		return nil, 0, err
+	}
+	if err := checkExpr(q.Where); err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*model.Book
+	for _, book := range r.books {
+		if matchBook(book, q.Filter) && matchExpr(q.Where, book) {
+			matches = append(matches, book)
+		}
+	}
+
+	page := sortAndPage(matches, q.Sort, q.Offset, q.Limit, compareBooks)
+	result := make([]*model.Book, len(page))
+	for i, book := range page {
+		copy := *book
+		result[i] = &copy
+	}
+	return result, len(matches), nil
+}
+
+// Facets counts the values of each named facet over the books matching
+// q.Filter and q.Where, ignoring its sort and paging.
+func (r *BookRepository) Facets(q BookQuery, facets []string) (map[string][]model.FacetCount, error) {
+	if err := checkFacets(facets); err != nil {
+		return nil, err
+	}
+	if err := checkBookFilter(q.Filter); err != nil {
+		return nil, err
+	}
+	if err := checkExpr(q.Where); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*model.Book
+	for _, book := range r.books {
+		if matchBook(book, q.Filter) && matchExpr(q.Where, book) {
+			matches = append(matches, book)
+		}
+	}
+	return model.CountFacets(matches, facets), nil
+}
+
 // Count returns the total number of books.
 func (r *BookRepository) Count() int {
 	r.mu.RLock()
@@ -126,3 +266,23 @@ func (r *BookRepository) Count() int {
 	r.mu.RUnlock()
 	return count
 }
+
+// restore stores a book exactly as given, keeping its timestamps.
+// It is used when replaying persisted state.
+func (r *BookRepository) restore(book *model.Book) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *book
+	r.put(&stored)
+}
+
+// put stores a book and points its ISBN index entry at it, dropping the
+// entry for the ISBN it replaces. The caller must hold the write lock.
+func (r *BookRepository) put(book *model.Book) {
+	if existing, exists := r.books[book.ID]; exists {
+		delete(r.byISBN, validator.NormalizeISBN(existing.ISBN))
+	}
+	r.books[book.ID] = book
+	r.byISBN[validator.NormalizeISBN(book.ISBN)] = book.ID
+}
@@ -1,10 +1,15 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/querylang"
 )
 
 func TestBookRepository_Create(t *testing.T) {
@@ -167,7 +172,7 @@ func TestBookRepository_List(t *testing.T) {
 		book := &model.Book{
 			ID:       string(rune('a' + i)),
 			Title:    "Book",
-			ISBN:     "123",
+			ISBN:     string(rune('1' + i)),
 			AuthorID: "author-1",
 		}
 		_ = repo.Create(book)
@@ -192,3 +197,285 @@ func TestBookRepository_FindByAuthor(t *testing.T) {
 		t.Errorf("Expected 2 books by author-1, got %d", len(books))
 	}
 }
+
+func TestBookRepository_Create_DuplicateISBN(t *testing.T) {
+	repo := NewBookRepository()
+
+	_ = repo.Create(&model.Book{ID: "book-1", Title: "First", ISBN: "978-0-306-40615-7", AuthorID: "a"})
+
+	err := repo.Create(&model.Book{ID: "book-2", Title: "Second", ISBN: "9780306406157", AuthorID: "a"})
+	if err != ErrDuplicateISBN {
+		t.Errorf("Expected ErrDuplicateISBN, got %v", err)
+	}
+	if repo.Count() != 1 {
+		t.Errorf("Expected count 1, got %d", repo.Count())
+	}
+}
+
+func TestBookRepository_Update_DuplicateISBN(t *testing.T) {
+	repo := NewBookRepository()
+
+	_ = repo.Create(&model.Book{ID: "book-1", Title: "First", ISBN: "080442957X", AuthorID: "a"})
+	_ = repo.Create(&model.Book{ID: "book-2", Title: "Second", ISBN: "0306406152", AuthorID: "a"})
+
+	err := repo.Update(&model.Book{ID: "book-2", Title: "Second", ISBN: "0-8044-2957-x", AuthorID: "a"})
+	if err != ErrDuplicateISBN {
+		t.Errorf("Expected ErrDuplicateISBN, got %v", err)
+	}
+
+	// Keeping its own ISBN in a different format is not a conflict.
+	if err := repo.Update(&model.Book{ID: "book-1", Title: "First", ISBN: "0-8044-2957-X", AuthorID: "a"}); err != nil {
+		t.Errorf("Update with own ISBN failed: %v", err)
+	}
+}
+
+func TestBookRepository_ISBNReleased(t *testing.T) {
+	repo := NewBookRepository()
+
+	_ = repo.Create(&model.Book{ID: "book-1", Title: "First", ISBN: "111", AuthorID: "a"})
+	_ = repo.Update(&model.Book{ID: "book-1", Title: "First", ISBN: "222", AuthorID: "a"})
+
+	if err := repo.Create(&model.Book{ID: "book-2", Title: "Second", ISBN: "111", AuthorID: "a"}); err != nil {
+		t.Errorf("ISBN should be free after update: %v", err)
+	}
+
+	_ = repo.Delete("book-1")
+	if err := repo.Create(&model.Book{ID: "book-3", Title: "Third", ISBN: "222", AuthorID: "a"}); err != nil {
+		t.Errorf("ISBN should be free after delete: %v", err)
+	}
+}
+
+func TestBookRepository_Create_ConcurrentSameISBN(t *testing.T) {
+	repo := NewBookRepository()
+
+	const writers = 50
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			book := &model.Book{ID: fmt.Sprintf("book-%d", i), Title: "Race", ISBN: "978-0306406157", AuthorID: "a"}
+			if err := repo.Create(book); err == nil {
+				created.Add(1)
+			} else if err != ErrDuplicateISBN {
+				t.Errorf("Create failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created.Load() != 1 {
+		t.Errorf("Expected exactly 1 create to succeed, got %d", created.Load())
+	}
+}
+
+func TestBookRepository_Versions(t *testing.T) {
+	repo := NewBookRepository()
+
+	book := &model.Book{ID: "book-1", Title: "First", ISBN: "1", AuthorID: "a", Version: 9}
+	_ = repo.Create(book)
+	if book.Version != 1 {
+		t.Errorf("Version after create = %d, want 1", book.Version)
+	}
+
+	if err := repo.Update(&model.Book{ID: "book-1", Title: "Second", ISBN: "1", AuthorID: "a", Version: 1}); err != nil {
+		t.Fatalf("Update at current version failed: %v", err)
+	}
+	if err := repo.Update(&model.Book{ID: "book-1", Title: "Stale", ISBN: "1", AuthorID: "a", Version: 1}); err != ErrVersionConflict {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if err := repo.DeleteIfVersion("book-1", 1); err != ErrVersionConflict {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	stored, _ := repo.Get("book-1")
+	if stored.Title != "Second" || stored.Version != 2 {
+		t.Errorf("Stored book = %q at version %d, want \"Second\" at 2", stored.Title, stored.Version)
+	}
+	if err := repo.DeleteIfVersion("book-1", 2); err != nil {
+		t.Errorf("DeleteIfVersion at current version failed: %v", err)
+	}
+}
+
+func TestBookRepository_Query(t *testing.T) {
+	testBookQuery(t, NewBookRepository())
+}
+
+func mustParse(t *testing.T, query string) querylang.Node {
+	t.Helper()
+	n, err := querylang.Parse(query)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", query, err)
+	}
+	return n
+}
+
+// testBookQuery checks filtering, multi-key sorting and paging against any BookStore.
+func testBookQuery(t *testing.T, store BookStore) {
+	t.Helper()
+
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	books := []*model.Book{
+		{ID: "1", Title: "Dune", ISBN: "1", AuthorID: "a1", Genre: "SF", Pages: 600, PublishedAt: day(1965, 8, 1)},
+		{ID: "2", Title: "Emma", ISBN: "2", AuthorID: "a2", Genre: "Classic", Pages: 400, PublishedAt: day(1815, 12, 23)},
+		{ID: "3", Title: "Solaris", ISBN: "3", AuthorID: "a3", Genre: "SF", Pages: 200, PublishedAt: day(1961, 1, 1)},
+		{ID: "4", Title: "Dune", ISBN: "4", AuthorID: "a1", Genre: "SF", Pages: 700, PublishedAt: day(1984, 1, 1)},
+		{ID: "5", Title: "Neuromancer", ISBN: "5", AuthorID: "a4", Genre: "SF", Pages: 270, PublishedAt: day(1984, 7, 1)},
+	}
+	for _, b := range books {
+		if err := store.Create(b); err != nil {
+			t.Fatalf("Create %s failed: %v", b.ID, err)
+		}
+	}
+
+	ids := func(books []*model.Book) string {
+		var s []string
+		for _, b := range books {
+			s = append(s, b.ID)
+		}
+		return fmt.Sprint(s)
+	}
+
+	tests := []struct {
+		name  string
+		query BookQuery
+		want  string
+		total int
+	}{
+		{"default order is ID", BookQuery{}, "[1 2 3 4 5]", 5},
+		{"multi-key sort", BookQuery{Sort: []SortKey{{Field: "title"}, {Field: "published_at", Desc: true}}}, "[4 1 2 5 3]", 5},
+		{"genre", BookQuery{Filter: BookFilter{Genre: "SF"}, Sort: []SortKey{{Field: "pages"}}}, "[3 5 1 4]", 4},
+		{"author", BookQuery{Filter: BookFilter{AuthorID: "a1"}}, "[1 4]", 2},
+		{"pages range", BookQuery{Filter: BookFilter{MinPages: 270, MaxPages: 600}}, "[1 2 5]", 3},
+		{"published range", BookQuery{Filter: BookFilter{PublishedAfter: day(1961, 1, 1), PublishedBefore: day(1984, 7, 1)}}, "[1 3 4]", 3},
+		{"page", BookQuery{Sort: []SortKey{{Field: "pages", Desc: true}}, Offset: 1, Limit: 2}, "[1 2]", 5},
+		{"offset past end", BookQuery{Offset: 10, Limit: 2}, "[]", 5},
+		{"offset without limit", BookQuery{Offset: 3}, "[4 5]", 5},
+		{"where", BookQuery{Where: mustParse(t, `genre:sf pages>=270 -title:dune`)}, "[5]", 1},
+		{"where or", BookQuery{Where: mustParse(t, `published:1984 OR (isbn:2 pages:..400)`)}, "[2 4 5]", 3},
+		{"where title", BookQuery{Where: mustParse(t, `"UNE" published:..1970`)}, "[1]", 1},
+		{"where unbounded date", BookQuery{Where: mustParse(t, `published>=0001`)}, "[1 2 3 4 5]", 5},
+		{"where authors", BookQuery{Where: querylang.And{querylang.AuthorIDs{"a1", "a3"}, mustParse(t, "pages<650")}}, "[1 3]", 2},
+		{"where no authors", BookQuery{Where: querylang.AuthorIDs{}}, "[]", 0},
+		{"where like wildcards", BookQuery{Where: mustParse(t, `title:%`)}, "[]", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := store.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if ids(got) != tt.want || total != tt.total {
+				t.Errorf("Query = %s (total %d), want %s (total %d)", ids(got), total, tt.want, tt.total)
+			}
+		})
+	}
+
+	// Negations match books without an author
+	book, _ := store.Get("5")
+	book.AuthorID = ""
+	if err := store.Update(book); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	for _, where := range []querylang.Node{mustParse(t, `-author_id:a1`), querylang.Not{Node: querylang.AuthorIDs{"a1"}}} {
+		got, total, err := store.Query(BookQuery{Where: where})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if ids(got) != "[2 3 5]" || total != 3 {
+			t.Errorf("Query(%s) = %s (total %d), want [2 3 5] (total 3)", where, ids(got), total)
+		}
+	}
+
+	invalid := []BookQuery{
+		{Sort: []SortKey{{Field: "isbn_key"}}},
+		{Limit: -1},
+		{Filter: BookFilter{MinPages: 500, MaxPages: 100}},
+		{Filter: BookFilter{PublishedAfter: day(2000, 1, 1), PublishedBefore: day(1990, 1, 1)}},
+		{Where: mustParse(t, `author:lem`)},
+	}
+	for _, q := range invalid {
+		if _, _, err := store.Query(q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Query(%+v) error = %v, want ErrInvalidQuery", q, err)
+		}
+	}
+}
+
+func TestBookRepository_Facets(t *testing.T) {
+	testBookFacets(t, NewBookRepository())
+}
+
+// testBookFacets checks facet counts over a filtered set against any BookStore.
+func testBookFacets(t *testing.T, store BookStore) {
+	t.Helper()
+
+	day := func(y int) time.Time { return time.Date(y, 6, 1, 0, 0, 0, 0, time.UTC) }
+	books := []*model.Book{
+		{ID: "1", Title: "A", ISBN: "1", AuthorID: "a1", Genre: "SF", Pages: 150, PublishedAt: day(1965)},
+		{ID: "2", Title: "B", ISBN: "2", AuthorID: "a1", Genre: "SF", Pages: 1200, PublishedAt: day(1969)},
+		{ID: "3", Title: "C", ISBN: "3", AuthorID: "a2", Genre: "Fantasy", Pages: 320, PublishedAt: day(1954)},
+		{ID: "4", Title: "D", ISBN: "4", AuthorID: "a3", Genre: "Fantasy", Pages: 0},
+		{ID: "5", Title: "E", ISBN: "5", AuthorID: "a3", Genre: "Horror", Pages: 90, PublishedAt: day(2001)},
+	}
+	for _, b := range books {
+		if err := store.Create(b); err != nil {
+			t.Fatalf("Create %s failed: %v", b.ID, err)
+		}
+	}
+
+	facets, err := store.Facets(BookQuery{Where: mustParse(t, "-genre:horror"), Limit: 1}, model.BookFacets)
+	if err != nil {
+		t.Fatalf("Facets failed: %v", err)
+	}
+	want := map[string][]model.FacetCount{
+		model.FacetGenre:  {{Value: "Fantasy", Count: 2}, {Value: "SF", Count: 2}},
+		model.FacetAuthor: {{Value: "a1", Count: 2}, {Value: "a2", Count: 1}, {Value: "a3", Count: 1}},
+		model.FacetDecade: {{Value: "1950s", Count: 1}, {Value: "1960s", Count: 2}},
+		model.FacetPages:  {{Value: "100-199", Count: 1}, {Value: "300-499", Count: 1}, {Value: "1000+", Count: 1}},
+	}
+	for name, counts := range want {
+		if fmt.Sprint(facets[name]) != fmt.Sprint(counts) {
+			t.Errorf("%s facet = %v, want %v", name, facets[name], counts)
+		}
+	}
+
+	facets, err = store.Facets(BookQuery{Filter: BookFilter{Genre: "Horror"}}, []string{model.FacetGenre})
+	if err != nil || len(facets) != 1 || fmt.Sprint(facets[model.FacetGenre]) != fmt.Sprint([]model.FacetCount{{Value: "Horror", Count: 1}}) {
+		t.Errorf("Filtered facets = %v, %v", facets, err)
+	}
+
+	if _, err := store.Facets(BookQuery{}, []string{"colour"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Unknown facet: expected ErrInvalidQuery, got %v", err)
+	}
+}
+
+func TestBookRepository_GetMany(t *testing.T) {
+	testBookGetMany(t, NewBookRepository())
+}
+
+// testBookGetMany checks that GetMany skips missing IDs against any BookStore.
+func testBookGetMany(t *testing.T, store BookStore) {
+	t.Helper()
+
+	_ = store.Create(&model.Book{ID: "1", Title: "Book 1", ISBN: "1", AuthorID: "a1"})
+	_ = store.Create(&model.Book{ID: "2", Title: "Book 2", ISBN: "2", AuthorID: "a1"})
+	_ = store.Create(&model.Book{ID: "3", Title: "Book 3", ISBN: "3", AuthorID: "a1"})
+
+	books, err := store.GetMany([]string{"3", "missing", "1"})
+	if err != nil {
+		t.Fatalf("GetMany failed: %v", err)
+	}
+	got := make(map[string]string)
+	for _, book := range books {
+		got[book.ID] = book.Title
+	}
+	if len(books) != 2 || got["1"] != "Book 1" || got["3"] != "Book 3" {
+		t.Errorf("GetMany = %v, want books 1 and 3", got)
+	}
+
+	if books, err := store.GetMany(nil); err != nil || len(books) != 0 {
+		t.Errorf("GetMany(nil) = %d books, %v", len(books), err)
+	}
+}
@@ -0,0 +1,644 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+const (
+	walFileName      = "bookshelf.wal"
+	snapshotFileName = "bookshelf.snapshot"
+)
+
+var ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+// ErrLogFailed is returned by writes to a file store whose log could not be
+// restored after a failed write. Reads keep working.
+var ErrLogFailed = errors.New("log is inconsistent after a failed write")
+
+// Log record operations and kinds.
+const (
+	opPut    = "put"
+	opDelete = "delete"
+	opBatch  = "batch"
+
+	kindBook   = "book"
+	kindAuthor = "author"
+	kindList   = "list"
+)
+
+// walRecord is a single logged write. Puts carry the full stored record so
+// replaying a record more than once is harmless. A batch carries the
+// records of a write that changes several records, which are replayed
+// all or not at all.
+type walRecord struct {
+	Op      string             `json:"op"`
+	Kind    string             `json:"kind,omitempty"`
+	ID      string             `json:"id,omitempty"`
+	Book    *model.Book        `json:"book,omitempty"`
+	Author  *model.Author      `json:"author,omitempty"`
+	List    *model.ReadingList `json:"list,omitempty"`
+	Records []walRecord        `json:"records,omitempty"`
+}
+
+// snapshotData is the compacted state written to the snapshot file.
+type snapshotData struct {
+	Books   []*model.Book        `json:"books"`
+	Authors []*model.Author      `json:"authors"`
+	Lists   []*model.ReadingList `json:"lists"`
+}
+
+// FileStoreOptions tunes FileStore durability.
+type FileStoreOptions struct {
+	// SnapshotEvery compacts the log into a snapshot after this many
+	// records. Zero disables automatic snapshots.
+	SnapshotEvery int
+	// Sync flushes the log to stable storage after every record.
+	Sync bool
+}
+
+// FileStore makes the in-memory repositories durable. Every write is
+// appended to a checksummed log in dir, the log is periodically compacted
+// into a snapshot, and both are replayed when the store is opened.
+type FileStore struct {
+	mu      sync.Mutex
+	dir     string
+	opts    FileStoreOptions
+	wal     logFile
+	pending int
+	// failed is set when a failed write could not be removed from the log.
+	failed bool
+
+	books   *BookRepository
+	authors *AuthorRepository
+	lists   *ReadingListRepository
+}
+
+// OpenFileStore opens (or creates) a file store in dir and restores its state.
+// A torn record at the end of the log is truncated.
+func OpenFileStore(dir string, opts FileStoreOptions) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{dir: dir, opts: opts}
+	s.books, s.authors, s.lists = NewRepositories()
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.wal = wal
+
+	if err := s.replay(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Books returns the durable book store.
+func (s *FileStore) Books() BookStore {
+	return &fileBookStore{BookRepository: s.books, fs: s}
+}
+
+// Authors returns the durable author store.
+func (s *FileStore) Authors() AuthorStore {
+	return &fileAuthorStore{AuthorRepository: s.authors, fs: s}
+}
+
+// ReadingLists returns the durable reading list store.
+func (s *FileStore) ReadingLists() ReadingListStore {
+	return &fileReadingListStore{ReadingListRepository: s.lists, fs: s}
+}
+
+// Relations returns the durable relation store.
+func (s *FileStore) Relations() RelationStore {
+	return &fileRelationStore{RelationRepository: NewRelationRepository(s.books, s.authors, s.lists), fs: s}
+}
+
+// Snapshot compacts the current state into the snapshot file and empties the log.
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked()
+}
+
+// Close writes a final snapshot and closes the log.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.snapshotLocked()
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// append logs a record. It must be called with s.mu held.
+//
+// A record that fails to write or sync is cut from the log again, so that
+// it neither corrupts the records after it nor reappears after a restart.
+// If that fails too, the store refuses further writes with ErrLogFailed.
+func (s *FileStore) append(rec walRecord) error {
+	if s.failed {
+		return ErrLogFailed
+	}
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	info, err := s.wal.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.writeLog(payload); err != nil {
+		if truncErr := s.wal.Truncate(info.Size()); truncErr != nil {
+			log.Printf("repository: failed to remove a failed write from %s: %v", s.wal.Name(), truncErr)
+			s.failed = true
+		}
+		return err
+	}
+
+	s.pending++
+	if s.opts.SnapshotEvery > 0 && s.pending >= s.opts.SnapshotEvery {
+		// The record is already durable in the log, so a failed
+		// compaction is retried on the next write rather than reported.
+		if err := s.snapshotLocked(); err != nil {
+			log.Printf("repository: snapshot failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeLog writes a record to the log, and syncs it if the store syncs.
+func (s *FileStore) writeLog(payload []byte) error {
+	if err := writeRecord(s.wal, payload); err != nil {
+		return err
+	}
+	if s.opts.Sync {
+		return s.wal.Sync()
+	}
+	return nil
+}
+
+// snapshotLocked writes the snapshot atomically, then truncates the log.
+// It must be called with s.mu held.
+func (s *FileStore) snapshotLocked() error {
+	payload, err := json.Marshal(snapshotData{
+		Books:   s.books.List(),
+		Authors: s.authors.List(),
+		Lists:   s.lists.List(),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, snapshotFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeRecord(tmp, payload); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return err
+	}
+	syncDir(s.dir)
+
+	// Replaying log records over the new snapshot is idempotent, so a
+	// crash before this truncation only costs replay time.
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	s.pending = 0
+	return nil
+}
+
+// loadSnapshot restores state from the snapshot file, if there is one.
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Snapshots are renamed into place only once complete, so anything
+	// other than exactly one valid record means the file was damaged.
+	payloads, valid, err := readRecords(data)
+	if err != nil || valid != len(data) || len(payloads) != 1 {
+		return ErrCorruptSnapshot
+	}
+
+	var snap snapshotData
+	if err := json.Unmarshal(payloads[0], &snap); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+
+	for _, book := range snap.Books {
+		s.books.restore(book)
+	}
+	for _, author := range snap.Authors {
+		s.authors.restore(author)
+	}
+	for _, list := range snap.Lists {
+		s.lists.restore(list)
+	}
+	return nil
+}
+
+// replay applies the log on top of the snapshot, truncating a torn tail.
+func (s *FileStore) replay() error {
+	data, err := os.ReadFile(s.wal.Name())
+	if err != nil {
+		return err
+	}
+
+	payloads, valid, err := readRecords(data)
+	if err != nil {
+		return err
+	}
+	if valid < len(data) {
+		log.Printf("repository: truncating torn record at offset %d of %s", valid, s.wal.Name())
+		if err := s.wal.Truncate(int64(valid)); err != nil {
+			return err
+		}
+	}
+
+	for _, payload := range payloads {
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptLog, err)
+		}
+		if err := s.apply(rec); err != nil {
+			return err
+		}
+	}
+	s.pending = len(payloads)
+	return nil
+}
+
+// apply replays a single log record.
+func (s *FileStore) apply(rec walRecord) error {
+	switch {
+	case rec.Op == opPut && rec.Kind == kindBook && rec.Book != nil:
+		s.books.restore(rec.Book)
+	case rec.Op == opPut && rec.Kind == kindAuthor && rec.Author != nil:
+		s.authors.restore(rec.Author)
+	case rec.Op == opPut && rec.Kind == kindList && rec.List != nil:
+		s.lists.restore(rec.List)
+	case rec.Op == opDelete && rec.Kind == kindBook:
+		s.books.Delete(rec.ID)
+	case rec.Op == opDelete && rec.Kind == kindAuthor:
+		s.authors.Delete(rec.ID)
+	case rec.Op == opDelete && rec.Kind == kindList:
+		s.lists.Delete(rec.ID)
+	case rec.Op == opBatch:
+		for _, r := range rec.Records {
+			if err := s.apply(r); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown operation %q on %q", ErrCorruptLog, rec.Op, rec.Kind)
+	}
+	return nil
+}
+
+// syncDir flushes directory metadata so a rename survives a crash.
+// Not every platform supports it, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// fileBookStore logs every book write to its FileStore.
+type fileBookStore struct {
+	*BookRepository
+	fs *FileStore
+}
+
+// Create adds a new book and logs it.
+func (s *fileBookStore) Create(book *model.Book) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	if err := s.BookRepository.Create(book); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opPut, Kind: kindBook, ID: book.ID, Book: book}); err != nil {
+		s.BookRepository.Delete(book.ID)
+		return err
+	}
+	return nil
+}
+
+// Update modifies an existing book and logs it.
+func (s *fileBookStore) Update(book *model.Book) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	previous, err := s.BookRepository.Get(book.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.BookRepository.Update(book); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opPut, Kind: kindBook, ID: book.ID, Book: book}); err != nil {
+		s.BookRepository.restore(previous)
+		return err
+	}
+	return nil
+}
+
+// Delete removes a book and logs it.
+func (s *fileBookStore) Delete(id string) error {
+	return s.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes a book if it is still at the given version and logs it.
+func (s *fileBookStore) DeleteIfVersion(id string, version int64) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	previous, err := s.BookRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.BookRepository.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opDelete, Kind: kindBook, ID: id}); err != nil {
+		s.BookRepository.restore(previous)
+		return err
+	}
+	return nil
+}
+
+// fileAuthorStore logs every author write to its FileStore.
+type fileAuthorStore struct {
+	*AuthorRepository
+	fs *FileStore
+}
+
+// Create adds a new author and logs it.
+func (s *fileAuthorStore) Create(author *model.Author) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	if err := s.AuthorRepository.Create(author); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opPut, Kind: kindAuthor, ID: author.ID, Author: author}); err != nil {
+		s.AuthorRepository.Delete(author.ID)
+		return err
+	}
+	return nil
+}
+
+// Update modifies an existing author and logs it.
+func (s *fileAuthorStore) Update(author *model.Author) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	previous, err := s.AuthorRepository.Get(author.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.AuthorRepository.Update(author); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opPut, Kind: kindAuthor, ID: author.ID, Author: author}); err != nil {
+		s.AuthorRepository.restore(previous)
+		return err
+	}
+	return nil
+}
+
+// Delete removes an author and logs it.
+func (s *fileAuthorStore) Delete(id string) error {
+	return s.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes an author if it is still at the given version and logs it.
+func (s *fileAuthorStore) DeleteIfVersion(id string, version int64) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	previous, err := s.AuthorRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.AuthorRepository.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opDelete, Kind: kindAuthor, ID: id}); err != nil {
+		s.AuthorRepository.restore(previous)
+		return err
+	}
+	return nil
+}
+
+// fileReadingListStore logs every reading list write to its FileStore.
+type fileReadingListStore struct {
+	*ReadingListRepository
+	fs *FileStore
+}
+
+// Create adds a new reading list and logs it.
+func (s *fileReadingListStore) Create(list *model.ReadingList) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	if err := s.ReadingListRepository.Create(list); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opPut, Kind: kindList, ID: list.ID, List: list}); err != nil {
+		s.ReadingListRepository.Delete(list.ID)
+		return err
+	}
+	return nil
+}
+
+// Update modifies an existing reading list and logs it.
+func (s *fileReadingListStore) Update(list *model.ReadingList) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	previous, err := s.ReadingListRepository.Get(list.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.ReadingListRepository.Update(list); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opPut, Kind: kindList, ID: list.ID, List: list}); err != nil {
+		s.ReadingListRepository.restore(previous)
+		return err
+	}
+	return nil
+}
+
+// Delete removes a reading list and logs it.
+func (s *fileReadingListStore) Delete(id string) error {
+	return s.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes a reading list if it is still at the given version and logs it.
+func (s *fileReadingListStore) DeleteIfVersion(id string, version int64) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	previous, err := s.ReadingListRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.ReadingListRepository.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opDelete, Kind: kindList, ID: id}); err != nil {
+		s.ReadingListRepository.restore(previous)
+		return err
+	}
+	return nil
+}
+
+// AddMember adds a book to a reading list and logs the resulting list.
+func (s *fileReadingListStore) AddMember(listID, bookID string) error {
+	return s.changeMembers(listID, func() error {
+		return s.ReadingListRepository.AddMember(listID, bookID)
+	})
+}
+
+// RemoveMember removes a book from a reading list and logs the resulting list.
+func (s *fileReadingListStore) RemoveMember(listID, bookID string) error {
+	return s.changeMembers(listID, func() error {
+		return s.ReadingListRepository.RemoveMember(listID, bookID)
+	})
+}
+
+// changeMembers applies a membership change and logs the whole list,
+// reverting the change if it cannot be logged.
+func (s *fileReadingListStore) changeMembers(listID string, change func() error) error {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	previous, err := s.ReadingListRepository.Get(listID)
+	if err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	list, err := s.ReadingListRepository.Get(listID)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.append(walRecord{Op: opPut, Kind: kindList, ID: listID, List: list}); err != nil {
+		s.ReadingListRepository.restore(previous)
+		return err
+	}
+	return nil
+}
+
+// fileRelationStore logs every relational delete to its FileStore as one
+// batch record.
+type fileRelationStore struct {
+	*RelationRepository
+	fs *FileStore
+}
+
+// DeleteAuthor deletes an author, applies action to their books and logs it.
+func (s *fileRelationStore) DeleteAuthor(id string, version int64, action DeleteAction) (*RelatedChanges, error) {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	w, err := s.deleteAuthor(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.log(w, walRecord{Op: opDelete, Kind: kindAuthor, ID: id}); err != nil {
+		return nil, err
+	}
+	return w.changes, nil
+}
+
+// DeleteBook deletes a book, applies action to its reading lists and logs it.
+func (s *fileRelationStore) DeleteBook(id string, version int64, action DeleteAction) (*RelatedChanges, error) {
+	s.fs.mu.Lock()
+	defer s.fs.mu.Unlock()
+
+	w, err := s.deleteBook(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.log(w, walRecord{Op: opDelete, Kind: kindBook, ID: id}); err != nil {
+		return nil, err
+	}
+	return w.changes, nil
+}
+
+// log appends a relational delete as one batch: the changed reading lists
+// and books, then the delete itself. It undoes the delete if it cannot be
+// logged. It must be called with s.fs.mu held.
+func (s *fileRelationStore) log(w *relationWrite, deleted walRecord) error {
+	batch := walRecord{Op: opBatch}
+	for _, previous := range w.lists {
+		list, err := s.lists.Get(previous.ID)
+		if err != nil {
+			return err
+		}
+		batch.Records = append(batch.Records, walRecord{Op: opPut, Kind: kindList, ID: list.ID, List: list})
+	}
+	for _, id := range w.changes.DeletedBooks {
+		batch.Records = append(batch.Records, walRecord{Op: opDelete, Kind: kindBook, ID: id})
+	}
+	for _, book := range w.changes.UpdatedBooks {
+		batch.Records = append(batch.Records, walRecord{Op: opPut, Kind: kindBook, ID: book.ID, Book: book})
+	}
+	batch.Records = append(batch.Records, deleted)
+
+	if err := s.fs.append(batch); err != nil {
+		if w.author != nil {
+			s.authors.restore(w.author)
+		}
+		if w.book != nil {
+			s.books.restore(w.book)
+		}
+		for _, book := range w.books {
+			s.books.restore(book)
+		}
+		for _, list := range w.lists {
+			s.lists.restore(list)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+func openTestFileStore(t *testing.T, dir string, opts FileStoreOptions) *FileStore {
+	t.Helper()
+	s, err := OpenFileStore(dir, opts)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	return s
+}
+
+// crash closes the log without the final snapshot Close would write.
+func crash(s *FileStore) {
+	s.wal.Close()
+}
+
+func TestFileStore_ReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{})
+
+	books, authors, lists := s.Books(), s.Authors(), s.ReadingLists()
+	_ = authors.Create(&model.Author{ID: "author-1", Name: "Jane Doe"})
+	_ = books.Create(&model.Book{ID: "book-1", Title: "First", ISBN: "1", AuthorID: "author-1"})
+	_ = books.Create(&model.Book{ID: "book-2", Title: "Second", ISBN: "2", AuthorID: "author-1"})
+	_ = books.Update(&model.Book{ID: "book-1", Title: "First (revised)", ISBN: "1", AuthorID: "author-1"})
+	_ = books.Delete("book-2")
+	_ = lists.Create(&model.ReadingList{ID: "list-1", Name: "List", BookIDs: []string{"book-1"}})
+	created, _ := books.Get("book-1")
+	crash(s)
+
+	s = openTestFileStore(t, dir, FileStoreOptions{})
+	defer s.Close()
+
+	book, err := s.Books().Get("book-1")
+	if err != nil {
+		t.Fatalf("Get after replay failed: %v", err)
+	}
+	if book.Title != "First (revised)" {
+		t.Errorf("Title = %q, want revised title", book.Title)
+	}
+	if !book.CreatedAt.Equal(created.CreatedAt) || !book.UpdatedAt.Equal(created.UpdatedAt) {
+		t.Error("Timestamps should survive replay unchanged")
+	}
+	if _, err := s.Books().Get("book-2"); err != ErrBookNotFound {
+		t.Errorf("Deleted book should stay deleted, got %v", err)
+	}
+	if s.Authors().Count() != 1 {
+		t.Errorf("Expected 1 author, got %d", s.Authors().Count())
+	}
+	list, err := s.ReadingLists().Get("list-1")
+	if err != nil || !reflect.DeepEqual(list.BookIDs, []string{"book-1"}) {
+		t.Errorf("Reading list not restored: %+v, %v", list, err)
+	}
+}
+
+func TestFileStore_MembersReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{})
+	for i := 0; i < 40; i++ {
+		id := fmt.Sprintf("book-%02d", i)
+		_ = s.Books().Create(&model.Book{ID: id, Title: id, ISBN: id})
+	}
+
+	testConcurrentMembers(t, s.ReadingLists())
+	before, _ := s.ReadingLists().Get("list-1")
+	crash(s)
+
+	s = openTestFileStore(t, dir, FileStoreOptions{})
+	defer s.Close()
+
+	after, err := s.ReadingLists().Get("list-1")
+	if err != nil {
+		t.Fatalf("Get after replay failed: %v", err)
+	}
+	if !reflect.DeepEqual(after.BookIDs, before.BookIDs) {
+		t.Errorf("BookIDs after replay = %v, want %v", after.BookIDs, before.BookIDs)
+	}
+}
+
+func TestFileStore_RelationsReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{})
+	_ = s.Authors().Create(&model.Author{ID: "author-1", Name: "Jane Doe"})
+	_ = s.Books().Create(&model.Book{ID: "book-1", Title: "First", ISBN: "1", AuthorID: "author-1"})
+	_ = s.Books().Create(&model.Book{ID: "book-2", Title: "Second", ISBN: "2"})
+	_ = s.ReadingLists().Create(&model.ReadingList{ID: "list-1", Name: "List", BookIDs: []string{"book-1", "book-2"}})
+	if _, err := s.Relations().DeleteAuthor("author-1", 0, DeleteCascade); err != nil {
+		t.Fatalf("DeleteAuthor failed: %v", err)
+	}
+	crash(s)
+
+	s = openTestFileStore(t, dir, FileStoreOptions{})
+	defer s.Close()
+	if s.Authors().Count() != 0 || s.Books().Count() != 1 {
+		t.Errorf("After replay: %d authors and %d books, want 0 and 1", s.Authors().Count(), s.Books().Count())
+	}
+	list, _ := s.ReadingLists().Get("list-1")
+	if list == nil || !reflect.DeepEqual(list.BookIDs, []string{"book-2"}) || list.Version != 2 {
+		t.Errorf("list-1 after replay = %+v, want [book-2] at version 2", list)
+	}
+}
+
+func TestFileStore_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{SnapshotEvery: 3})
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		_ = s.Books().Create(&model.Book{ID: id, Title: "Book " + id, ISBN: id})
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("Expected snapshot after 3 records: %v", err)
+	}
+	if s.pending != 1 {
+		t.Errorf("Expected 1 record in the log after compaction, got %d", s.pending)
+	}
+	crash(s)
+
+	s = openTestFileStore(t, dir, FileStoreOptions{})
+	if s.Books().Count() != 4 {
+		t.Errorf("Expected 4 books from snapshot + log, got %d", s.Books().Count())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatalf("Stat log failed: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Expected empty log after Close snapshot, got %d bytes", info.Size())
+	}
+}
+
+func TestFileStore_TruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{})
+	_ = s.Books().Create(&model.Book{ID: "book-1", Title: "Intact", ISBN: "1"})
+	crash(s)
+
+	walPath := filepath.Join(dir, walFileName)
+	intact, _ := os.ReadFile(walPath)
+
+	// Simulate a write interrupted halfway through the next record
+	f, _ := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.Write([]byte{0, 0, 0, 42, 1, 2, 3})
+	f.Close()
+
+	s = openTestFileStore(t, dir, FileStoreOptions{})
+	defer s.Close()
+
+	if s.Books().Count() != 1 {
+		t.Errorf("Expected intact record to be replayed, got %d books", s.Books().Count())
+	}
+	after, _ := os.ReadFile(walPath)
+	if len(after) != len(intact) {
+		t.Errorf("Log length = %d after truncation, want %d", len(after), len(intact))
+	}
+
+	// The store keeps working after truncation
+	if err := s.Books().Create(&model.Book{ID: "book-2", Title: "After", ISBN: "2"}); err != nil {
+		t.Errorf("Create after truncation failed: %v", err)
+	}
+}
+
+// failingLog is a log whose writes, syncs and truncations can be made to
+// fail. A failing write writes half of its data first.
+type failingLog struct {
+	logFile
+	failWrite, failSync, failTruncate bool
+}
+
+var errInjected = errors.New("injected failure")
+
+func (f *failingLog) Write(p []byte) (int, error) {
+	if f.failWrite {
+		n, _ := f.logFile.Write(p[:len(p)/2])
+		return n, errInjected
+	}
+	return f.logFile.Write(p)
+}
+
+func (f *failingLog) Sync() error {
+	if f.failSync {
+		return errInjected
+	}
+	return f.logFile.Sync()
+}
+
+func (f *failingLog) Truncate(size int64) error {
+	if f.failTruncate {
+		return errInjected
+	}
+	return f.logFile.Truncate(size)
+}
+
+func TestFileStore_FailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{Sync: true})
+	wal := &failingLog{logFile: s.wal}
+	s.wal = wal
+	books := s.Books()
+	create := func(id string) error {
+		return books.Create(&model.Book{ID: id, Title: id, ISBN: id})
+	}
+
+	_ = create("book-1")
+	wal.failWrite = true
+	if err := create("book-2"); !errors.Is(err, errInjected) {
+		t.Errorf("Create with a failing write error = %v, want the write error", err)
+	}
+	wal.failWrite, wal.failSync = false, true
+	if err := create("book-3"); !errors.Is(err, errInjected) {
+		t.Errorf("Create with a failing sync error = %v, want the sync error", err)
+	}
+	wal.failSync = false
+	if err := create("book-4"); err != nil {
+		t.Fatalf("Create after failed writes failed: %v", err)
+	}
+	crash(s)
+
+	// Neither failed write is left in the log to corrupt or reappear
+	s = openTestFileStore(t, dir, FileStoreOptions{})
+	var ids []string
+	for _, book := range s.Books().List() {
+		ids = append(ids, book.ID)
+	}
+	sort.Strings(ids)
+	if want := []string{"book-1", "book-4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Books after reopen = %v, want %v", ids, want)
+	}
+
+	// A log that cannot be restored stops further writes
+	wal = &failingLog{logFile: s.wal, failWrite: true, failTruncate: true}
+	s.wal = wal
+	_ = s.Books().Create(&model.Book{ID: "book-5", Title: "5", ISBN: "5"})
+	wal.failWrite, wal.failTruncate = false, false
+	if err := s.Books().Create(&model.Book{ID: "book-6", Title: "6", ISBN: "6"}); !errors.Is(err, ErrLogFailed) {
+		t.Errorf("Create after an unrestored log error = %v, want ErrLogFailed", err)
+	}
+	if _, err := s.Books().Get("book-1"); err != nil {
+		t.Errorf("Reads should keep working: %v", err)
+	}
+	crash(s)
+}
+
+func TestFileStore_CorruptLogIsKept(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{})
+	for _, id := range []string{"book-1", "book-2"} {
+		_ = s.Books().Create(&model.Book{ID: id, Title: id, ISBN: id})
+	}
+	crash(s)
+
+	walPath := filepath.Join(dir, walFileName)
+	data, _ := os.ReadFile(walPath)
+	data[0] = 0x7f // damage the length of the first record
+	os.WriteFile(walPath, data, 0o644)
+
+	if _, err := OpenFileStore(dir, FileStoreOptions{}); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("Expected ErrCorruptLog, got %v", err)
+	}
+	if after, _ := os.ReadFile(walPath); len(after) != len(data) {
+		t.Errorf("Log length = %d, want it left at %d", len(after), len(data))
+	}
+}
+
+func TestFileStore_CorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir, FileStoreOptions{})
+	_ = s.Books().Create(&model.Book{ID: "book-1", Title: "Test", ISBN: "1"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	path := filepath.Join(dir, snapshotFileName)
+	data, _ := os.ReadFile(path)
+	data[len(data)-2] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+
+	if _, err := OpenFileStore(dir, FileStoreOptions{}); err != ErrCorruptSnapshot {
+		t.Errorf("Expected ErrCorruptSnapshot, got %v", err)
+	}
+}
+
+func TestFileStore_ErrorsAreNotLogged(t *testing.T) {
+	s := openTestFileStore(t, t.TempDir(), FileStoreOptions{})
+	defer s.Close()
+
+	book := &model.Book{ID: "book-1", Title: "Test", ISBN: "1"}
+	_ = s.Books().Create(book)
+
+	if err := s.Books().Create(book); err != ErrBookExists {
+		t.Errorf("Expected ErrBookExists, got %v", err)
+	}
+	if err := s.Books().Create(&model.Book{ID: "book-2", Title: "Test", ISBN: "2", AuthorID: "missing"}); err != ErrInvalidReference {
+		t.Errorf("Expected ErrInvalidReference, got %v", err)
+	}
+	if err := s.Books().Delete("missing"); err != ErrBookNotFound {
+		t.Errorf("Expected ErrBookNotFound, got %v", err)
+	}
+	if s.pending != 1 {
+		t.Errorf("Failed writes should not be logged, got %d records", s.pending)
+	}
+}
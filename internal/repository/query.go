@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/querylang"
+)
+
+// ErrInvalidQuery is returned for unknown sort fields and invalid filters.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// SortKey orders query results by one field.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// BookFilter restricts a book query. Zero values do not filter.
+// PublishedAfter is inclusive and PublishedBefore exclusive.
+type BookFilter struct {
+	Genre           string
+	AuthorID        string
+	MinPages        int
+	MaxPages        int
+	PublishedAfter  time.Time
+	PublishedBefore time.Time
+}
+
+// BookQuery selects a sorted page of books. Results are always ordered by ID
+// after the given sort keys, so pages are stable. A zero Limit returns every
+// book from Offset on.
+//
+// Where, if set, is a query language expression the books must also match.
+// Author name matches must be resolved with querylang.ResolveAuthors first.
+type BookQuery struct {
+	Filter BookFilter
+	Where  querylang.Node
+	Sort   []SortKey
+	Offset int
+	Limit  int
+}
+
+// AuthorFilter restricts an author query. Zero values do not filter.
+type AuthorFilter struct {
+	Country string
+}
+
+// AuthorQuery selects a sorted page of authors; see BookQuery.
+type AuthorQuery struct {
+	Filter AuthorFilter
+	Sort   []SortKey
+	Offset int
+	Limit  int
+}
+
+// ReadingListFilter restricts a reading list query. Zero values do not filter.
+type ReadingListFilter struct {
+	// BookID selects lists that contain the book.
+	BookID string
+}
+
+// ReadingListQuery selects a sorted page of reading lists; see BookQuery.
+type ReadingListQuery struct {
+	Filter ReadingListFilter
+	Sort   []SortKey
+	Offset int
+	Limit  int
+}
+
+// Sortable fields and the columns that store them.
+var (
+	bookSortColumns = map[string]string{
+		"id": "id", "title": "title", "isbn": "isbn", "author_id": "COALESCE(author_id, '')",
+		"published_at": "published_at", "pages": "pages", "genre": "genre",
+		"created_at": "created_at", "updated_at": "updated_at",
+	}
+	authorSortColumns = map[string]string{
+		"id": "id", "name": "name", "country": "country", "birth_date": "birth_date",
+		"created_at": "created_at", "updated_at": "updated_at",
+	}
+	readingListSortColumns = map[string]string{
+		"id": "id", "name": "name", "created_at": "created_at", "updated_at": "updated_at",
+	}
+)
+
+// checkQuery validates the sort keys and paging of a query.
+func checkQuery(keys []SortKey, columns map[string]string, offset, limit int) error {
+	for _, key := range keys {
+		if _, ok := columns[key.Field]; !ok {
+			return fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, key.Field)
+		}
+	}
+	if offset < 0 || limit < 0 {
+		return fmt.Errorf("%w: offset and limit must not be negative", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// checkFacets rejects unknown book facet names.
+func checkFacets(facets []string) error {
+	for _, f := range facets {
+		if !model.IsBookFacet(f) {
+			return fmt.Errorf("%w: unknown facet %q", ErrInvalidQuery, f)
+		}
+	}
+	return nil
+}
+
+// checkBookFilter validates the ranges in a book filter.
+func checkBookFilter(f BookFilter) error {
+	if f.MinPages < 0 || f.MaxPages < 0 || (f.MaxPages > 0 && f.MinPages > f.MaxPages) {
+		return fmt.Errorf("%w: invalid pages range", ErrInvalidQuery)
+	}
+	if !f.PublishedAfter.IsZero() && !f.PublishedBefore.IsZero() && !f.PublishedAfter.Before(f.PublishedBefore) {
+		return fmt.Errorf("%w: invalid publication date range", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// matchBook reports whether a book passes the filter.
+func matchBook(b *model.Book, f BookFilter) bool {
+	switch {
+	case f.Genre != "" && b.Genre != f.Genre:
+		return false
+	case f.AuthorID != "" && b.AuthorID != f.AuthorID:
+		return false
+	case b.Pages < f.MinPages:
+		return false
+	case f.MaxPages > 0 && b.Pages > f.MaxPages:
+		return false
+	case !f.PublishedAfter.IsZero() && b.PublishedAt.Before(f.PublishedAfter):
+		return false
+	case !f.PublishedBefore.IsZero() && !b.PublishedAt.Before(f.PublishedBefore):
+		return false
+	}
+	return true
+}
+
+// compareBooks compares two books by a sortable field.
+func compareBooks(a, b *model.Book, field string) int {
+	switch field {
+	case "title":
+		return strings.Compare(a.Title, b.Title)
+	case "isbn":
+		return strings.Compare(a.ISBN, b.ISBN)
+	case "author_id":
+		return strings.Compare(a.AuthorID, b.AuthorID)
+	case "published_at":
+		return a.PublishedAt.Compare(b.PublishedAt)
+	case "pages":
+		return a.Pages - b.Pages
+	case "genre":
+		return strings.Compare(a.Genre, b.Genre)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// compareAuthors compares two authors by a sortable field.
+func compareAuthors(a, b *model.Author, field string) int {
+	switch field {
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "country":
+		return strings.Compare(a.Country, b.Country)
+	case "birth_date":
+		return a.BirthDate.Compare(b.BirthDate)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// compareReadingLists compares two reading lists by a sortable field.
+func compareReadingLists(a, b *model.ReadingList, field string) int {
+	switch field {
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// sortAndPage orders items by keys, then by ID (compare's fallback field),
+// and returns the requested page.
+func sortAndPage[T any](items []T, keys []SortKey, offset, limit int, compare func(a, b T, field string) int) []T {
+	slices.SortFunc(items, func(a, b T) int {
+		for _, key := range keys {
+			if c := compare(a, b, key.Field); c != 0 {
+				if key.Desc {
+					return -c
+				}
+				return c
+			}
+		}
+		return compare(a, b, "id")
+	})
+
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// orderBy renders sort keys as an ORDER BY clause with a trailing ID tie-breaker.
+// The keys must already have been checked against columns.
+func orderBy(keys []SortKey, columns map[string]string) string {
+	terms := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		term := columns[key.Field]
+		if key.Desc {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+	terms = append(terms, "id")
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// whereClause joins conditions into a WHERE clause, or returns "" if there are none.
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// inList renders "column IN (?, ?, ...)" for n values, or a condition
+// that matches nothing if n is zero.
+func inList(column string, n int) string {
+	if n == 0 {
+		return "1 = 0"
+	}
+	return column + " IN (?" + strings.Repeat(", ?", n-1) + ")"
+}
+
+// stringArgs converts values to query arguments.
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// limitOffset renders the paging clause of a query.
+func limitOffset(offset, limit int) string {
+	if limit <= 0 {
+		if offset == 0 {
+			return ""
+		}
+		// SQLite needs a LIMIT before OFFSET and the drivers disagree on
+		// how to spell "no limit".
+		limit = math.MaxInt64
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+}
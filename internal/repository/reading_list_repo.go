@@ -11,12 +11,17 @@ import (
 var (
 	ErrReadingListNotFound = errors.New("reading list not found")
 	ErrReadingListExists   = errors.New("reading list already exists")
+	ErrAlreadyMember       = errors.New("book already in reading list")
+	ErrNotMember           = errors.New("book not in reading list")
 )
 
 // ReadingListRepository provides CRUD operations for reading lists.
 type ReadingListRepository struct {
 	mu    sync.RWMutex
 	lists map[string]*model.ReadingList
+	// books, when set, is what Create, Update and AddMember check book
+	// IDs against; see NewRepositories.
+	books *BookRepository
 }
 
 // NewReadingListRepository creates a new in-memory reading list repository.
@@ -28,16 +33,22 @@ func NewReadingListRepository() *ReadingListRepository {
 
 // Create adds a new reading list to the repository.
 func (r *ReadingListRepository) Create(list *model.ReadingList) error {
+	r.lockBooks()
+	defer r.unlockBooks()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if _, exists := r.lists[list.ID]; exists {
 		return ErrReadingListExists
 	}
+	if !r.booksExist(list.BookIDs...) {
+		return ErrInvalidReference
+	}
 
 	now := time.Now()
 	list.CreatedAt = now
 	list.UpdatedAt = now
+	list.Version = 1
 
 	if list.BookIDs == nil {
 		list.BookIDs = []string{}
@@ -68,6 +79,8 @@ func (r *ReadingListRepository) Get(id string) (*model.ReadingList, error) {
 
 // Update modifies an existing reading list.
 func (r *ReadingListRepository) Update(list *model.ReadingList) error {
+	r.lockBooks()
+	defer r.unlockBooks()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -75,9 +88,16 @@ func (r *ReadingListRepository) Update(list *model.ReadingList) error {
 	if !exists {
 		return ErrReadingListNotFound
 	}
+	if list.Version != 0 && list.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	if !r.booksExist(list.BookIDs...) {
+		return ErrInvalidReference
+	}
 
 	list.CreatedAt = existing.CreatedAt
 	list.UpdatedAt = time.Now()
+	list.Version = existing.Version + 1
 
 	stored := *list
 	stored.BookIDs = make([]string, len(list.BookIDs))
@@ -86,19 +106,96 @@ func (r *ReadingListRepository) Update(list *model.ReadingList) error {
 	return nil
 }
 
+// lockBooks read-locks the linked book repository, if any, so that books
+// cannot be deleted between the reference check and the write. It is taken
+// before the reading list lock, the order RelationRepository uses.
+func (r *ReadingListRepository) lockBooks() {
+	if r.books != nil {
+		r.books.mu.RLock()
+	}
+}
+
+func (r *ReadingListRepository) unlockBooks() {
+	if r.books != nil {
+		r.books.mu.RUnlock()
+	}
+}
+
+// booksExist reports whether all the books exist; without a linked book
+// repository every book is taken to exist. The caller holds lockBooks.
+func (r *ReadingListRepository) booksExist(ids ...string) bool {
+	if r.books == nil {
+		return true
+	}
+	for _, id := range ids {
+		if _, exists := r.books.books[id]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
 // Delete removes a reading list by ID.
 func (r *ReadingListRepository) Delete(id string) error {
+	return r.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes a reading list by ID if it is still at the given version.
+func (r *ReadingListRepository) DeleteIfVersion(id string, version int64) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.lists[id]; !exists {
+	existing, exists := r.lists[id]
+	if !exists {
 		return ErrReadingListNotFound
 	}
+	if version != 0 && version != existing.Version {
+		return ErrVersionConflict
+	}
 
 	delete(r.lists, id)
 	return nil
 }
 
+// AddMember appends a book to the end of a reading list.
+func (r *ReadingListRepository) AddMember(listID, bookID string) error {
+	r.lockBooks()
+	defer r.unlockBooks()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, exists := r.lists[listID]
+	if !exists {
+		return ErrReadingListNotFound
+	}
+	if !r.booksExist(bookID) {
+		return ErrInvalidReference
+	}
+	if !list.AddBook(bookID) {
+		return ErrAlreadyMember
+	}
+	list.UpdatedAt = time.Now()
+	list.Version++
+	return nil
+}
+
+// RemoveMember removes a book from a reading list.
+func (r *ReadingListRepository) RemoveMember(listID, bookID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, exists := r.lists[listID]
+	if !exists {
+		return ErrReadingListNotFound
+	}
+	if !list.RemoveBook(bookID) {
+		return ErrNotMember
+	}
+	list.UpdatedAt = time.Now()
+	list.Version++
+	return nil
+}
+
 // List returns all reading lists.
 func (r *ReadingListRepository) List() []*model.ReadingList {
 	r.mu.RLock()
@@ -135,9 +232,72 @@ func (r *ReadingListRepository) FindByBook(bookID string) []*model.ReadingList {
 	return result
 }
 
+// FindByBooks returns all reading lists containing any of the books.
+func (r *ReadingListRepository) FindByBooks(bookIDs []string) ([]*model.ReadingList, error) {
+	wanted := make(map[string]bool, len(bookIDs))
+	for _, id := range bookIDs {
+		wanted[id] = true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []*model.ReadingList{}
+	for _, list := range r.lists {
+		for _, id := range list.BookIDs {
+			if wanted[id] {
+				copy := *list
+				copy.BookIDs = append([]string(nil), list.BookIDs...)
+				result = append(result, &copy)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// Query returns a sorted page of the reading lists matching q.Filter and
+// the number of matching lists.
+func (r *ReadingListRepository) Query(q ReadingListQuery) ([]*model.ReadingList, int, error) {
+	if err := checkQuery(q.Sort, readingListSortColumns, q.Offset, q.Limit); err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*model.ReadingList
+	for _, list := range r.lists {
+		if q.Filter.BookID == "" || list.ContainsBook(q.Filter.BookID) {
+			matches = append(matches, list)
+		}
+	}
+
+	page := sortAndPage(matches, q.Sort, q.Offset, q.Limit, compareReadingLists)
+	result := make([]*model.ReadingList, len(page))
+	for i, list := range page {
+		copy := *list
+		copy.BookIDs = append([]string(nil), list.BookIDs...)
+		result[i] = &copy
+	}
+	return result, len(matches), nil
+}
+
 // Count returns the total number of reading lists.
 func (r *ReadingListRepository) Count() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return len(r.lists)
 }
+
+// restore stores a reading list exactly as given, keeping its timestamps.
+// It is used when replaying persisted state.
+func (r *ReadingListRepository) restore(list *model.ReadingList) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *list
+	stored.BookIDs = make([]string, len(list.BookIDs))
+	copy(stored.BookIDs, list.BookIDs)
+	r.lists[list.ID] = &stored
+}
@@ -1,6 +1,10 @@
 package repository
 
 import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
@@ -148,3 +152,129 @@ func TestReadingListRepository_FindByBook(t *testing.T) {
 		t.Errorf("Expected 2 lists containing book-1, got %d", len(lists))
 	}
 }
+
+func TestReadingListRepository_Members(t *testing.T) {
+	repo := NewReadingListRepository()
+	_ = repo.Create(&model.ReadingList{ID: "list-1", Name: "List"})
+
+	if err := repo.AddMember("list-1", "book-1"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	if err := repo.AddMember("list-1", "book-1"); err != ErrAlreadyMember {
+		t.Errorf("Expected ErrAlreadyMember, got %v", err)
+	}
+	if err := repo.AddMember("missing", "book-1"); err != ErrReadingListNotFound {
+		t.Errorf("Expected ErrReadingListNotFound, got %v", err)
+	}
+	if err := repo.RemoveMember("list-1", "book-1"); err != nil {
+		t.Fatalf("RemoveMember failed: %v", err)
+	}
+	if err := repo.RemoveMember("list-1", "book-1"); err != ErrNotMember {
+		t.Errorf("Expected ErrNotMember, got %v", err)
+	}
+	if err := repo.RemoveMember("missing", "book-1"); err != ErrReadingListNotFound {
+		t.Errorf("Expected ErrReadingListNotFound, got %v", err)
+	}
+}
+
+func TestReadingListRepository_ConcurrentMembers(t *testing.T) {
+	testConcurrentMembers(t, NewReadingListRepository())
+}
+
+// testConcurrentMembers adds and removes books on one list from many
+// goroutines and checks that no membership change is lost.
+func testConcurrentMembers(t *testing.T, store ReadingListStore) {
+	t.Helper()
+
+	const books = 40
+	initial := make([]string, 0, books/2)
+	for i := 0; i < books; i += 2 {
+		initial = append(initial, fmt.Sprintf("book-%02d", i))
+	}
+	if err := store.Create(&model.ReadingList{ID: "list-1", Name: "Race", BookIDs: initial}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Even books start in the list and are removed; odd books are added.
+	var wg sync.WaitGroup
+	for i := 0; i < books; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("book-%02d", i)
+			var err error
+			if i%2 == 0 {
+				err = store.RemoveMember("list-1", id)
+			} else {
+				err = store.AddMember("list-1", id)
+			}
+			if err != nil {
+				t.Errorf("membership change for %s failed: %v", id, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	list, err := store.Get("list-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	got := append([]string(nil), list.BookIDs...)
+	sort.Strings(got)
+
+	want := make([]string, 0, books/2)
+	for i := 1; i < books; i += 2 {
+		want = append(want, fmt.Sprintf("book-%02d", i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BookIDs = %v, want %v", got, want)
+	}
+}
+
+func TestReadingListRepository_Query(t *testing.T) {
+	repo := NewReadingListRepository()
+	_ = repo.Create(&model.ReadingList{ID: "list-1", Name: "B", BookIDs: []string{"book-1"}})
+	_ = repo.Create(&model.ReadingList{ID: "list-2", Name: "A", BookIDs: []string{"book-1", "book-2"}})
+	_ = repo.Create(&model.ReadingList{ID: "list-3", Name: "C"})
+
+	lists, total, err := repo.Query(ReadingListQuery{
+		Filter: ReadingListFilter{BookID: "book-1"},
+		Sort:   []SortKey{{Field: "name", Desc: true}},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if total != 2 || len(lists) != 2 || lists[0].ID != "list-1" || lists[1].ID != "list-2" {
+		t.Errorf("Query returned %v (total %d)", lists, total)
+	}
+}
+
+func TestReadingListRepository_FindByBooks(t *testing.T) {
+	testFindByBooks(t, NewReadingListRepository())
+}
+
+// testFindByBooks checks that FindByBooks returns each list containing any
+// of the books once, with all its books, against any ReadingListStore.
+func testFindByBooks(t *testing.T, store ReadingListStore) {
+	t.Helper()
+
+	_ = store.Create(&model.ReadingList{ID: "list-1", Name: "One", BookIDs: []string{"book-1", "book-2"}})
+	_ = store.Create(&model.ReadingList{ID: "list-2", Name: "Two", BookIDs: []string{"book-3"}})
+	_ = store.Create(&model.ReadingList{ID: "list-3", Name: "Three", BookIDs: []string{"book-2"}})
+
+	lists, err := store.FindByBooks([]string{"book-1", "book-2"})
+	if err != nil {
+		t.Fatalf("FindByBooks failed: %v", err)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ID < lists[j].ID })
+	if len(lists) != 2 || lists[0].ID != "list-1" || lists[1].ID != "list-3" {
+		t.Fatalf("FindByBooks = %+v, want list-1 and list-3", lists)
+	}
+	if !reflect.DeepEqual(lists[0].BookIDs, []string{"book-1", "book-2"}) {
+		t.Errorf("list-1 books = %v, want [book-1 book-2]", lists[0].BookIDs)
+	}
+
+	if lists, err := store.FindByBooks(nil); err != nil || len(lists) != 0 {
+		t.Errorf("FindByBooks(nil) = %d lists, %v", len(lists), err)
+	}
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/pkg/validator"
+)
+
+// RelationRepository is a RelationStore over the in-memory repositories.
+// A delete holds the write locks of all three, always taken in the order
+// authors, books, reading lists.
+type RelationRepository struct {
+	books   *BookRepository
+	authors *AuthorRepository
+	lists   *ReadingListRepository
+}
+
+// NewRepositories creates in-memory book, author and reading list
+// repositories linked to each other, so that a book write fails with
+// ErrInvalidReference unless its author exists and a reading list write
+// unless its books exist, checked under the same locks as the write.
+func NewRepositories() (*BookRepository, *AuthorRepository, *ReadingListRepository) {
+	authors := NewAuthorRepository()
+	books := NewBookRepository()
+	books.authors = authors
+	lists := NewReadingListRepository()
+	lists.books = books
+	return books, authors, lists
+}
+
+// NewRelationRepository creates a relation store over the given repositories.
+func NewRelationRepository(books *BookRepository, authors *AuthorRepository, lists *ReadingListRepository) *RelationRepository {
+	return &RelationRepository{books: books, authors: authors, lists: lists}
+}
+
+// relationWrite is what a relational delete changed, with the records as
+// they were before, so that the file store can log and undo it.
+type relationWrite struct {
+	author  *model.Author
+	book    *model.Book
+	books   []*model.Book
+	lists   []*model.ReadingList
+	changes *RelatedChanges
+}
+
+// DeleteAuthor deletes an author and applies action to their books.
+func (r *RelationRepository) DeleteAuthor(id string, version int64, action DeleteAction) (*RelatedChanges, error) {
+	w, err := r.deleteAuthor(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	return w.changes, nil
+}
+
+// DeleteBook deletes a book and applies action to its reading lists.
+func (r *RelationRepository) DeleteBook(id string, version int64, action DeleteAction) (*RelatedChanges, error) {
+	w, err := r.deleteBook(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	return w.changes, nil
+}
+
+func (r *RelationRepository) deleteAuthor(id string, version int64, action DeleteAction) (*relationWrite, error) {
+	if err := checkAction(action); err != nil {
+		return nil, err
+	}
+	r.authors.mu.Lock()
+	defer r.authors.mu.Unlock()
+	r.books.mu.Lock()
+	defer r.books.mu.Unlock()
+	r.lists.mu.Lock()
+	defer r.lists.mu.Unlock()
+
+	author, exists := r.authors.authors[id]
+	if !exists {
+		return nil, ErrAuthorNotFound
+	}
+	if version != 0 && version != author.Version {
+		return nil, ErrVersionConflict
+	}
+
+	var books []*model.Book
+	for _, book := range r.books.books {
+		if book.AuthorID == id {
+			books = append(books, book)
+		}
+	}
+	if len(books) > 0 && action == DeleteRestrict {
+		return nil, ErrStillReferenced
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+
+	previous := *author
+	w := &relationWrite{author: &previous, changes: &RelatedChanges{}}
+	now := time.Now()
+	for _, book := range books {
+		before := *book
+		w.books = append(w.books, &before)
+		if action == DeleteCascade {
+			r.removeFromLists(w, book.ID, now)
+			r.deleteBookLocked(book)
+			w.changes.DeletedBooks = append(w.changes.DeletedBooks, book.ID)
+			continue
+		}
+
+		updated := *book
+		updated.AuthorID = ""
+		updated.UpdatedAt = now
+		updated.Version++
+		r.books.put(&updated)
+		result := updated
+		w.changes.UpdatedBooks = append(w.changes.UpdatedBooks, &result)
+	}
+	delete(r.authors.authors, id)
+	return w, nil
+}
+
+func (r *RelationRepository) deleteBook(id string, version int64, action DeleteAction) (*relationWrite, error) {
+	if err := checkAction(action); err != nil {
+		return nil, err
+	}
+	r.books.mu.Lock()
+	defer r.books.mu.Unlock()
+	r.lists.mu.Lock()
+	defer r.lists.mu.Unlock()
+
+	book, exists := r.books.books[id]
+	if !exists {
+		return nil, ErrBookNotFound
+	}
+	if version != 0 && version != book.Version {
+		return nil, ErrVersionConflict
+	}
+	if action == DeleteRestrict {
+		for _, list := range r.lists.lists {
+			if list.ContainsBook(id) {
+				return nil, ErrStillReferenced
+			}
+		}
+	}
+
+	previous := *book
+	w := &relationWrite{book: &previous, changes: &RelatedChanges{}}
+	r.removeFromLists(w, id, time.Now())
+	r.deleteBookLocked(book)
+	return w, nil
+}
+
+// removeFromLists removes a book from every reading list, recording each
+// list as it was before the delete changed it first. The caller holds the
+// reading list write lock.
+func (r *RelationRepository) removeFromLists(w *relationWrite, bookID string, now time.Time) {
+	for _, list := range r.lists.lists {
+		if !list.ContainsBook(bookID) {
+			continue
+		}
+		if !w.hasList(list.ID) {
+			before := *list
+			before.BookIDs = append([]string(nil), list.BookIDs...)
+			w.lists = append(w.lists, &before)
+		}
+		list.RemoveBook(bookID)
+		list.UpdatedAt = now
+		list.Version++
+	}
+}
+
+// deleteBookLocked removes a book and its ISBN index entry. The caller
+// holds the book write lock.
+func (r *RelationRepository) deleteBookLocked(book *model.Book) {
+	delete(r.books.byISBN, validator.NormalizeISBN(book.ISBN))
+	delete(r.books.books, book.ID)
+}
+
+// hasList reports whether the write already changed the reading list.
+func (w *relationWrite) hasList(id string) bool {
+	for _, list := range w.lists {
+		if list.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAction returns an error for an unknown delete action.
+func checkAction(action DeleteAction) error {
+	switch action {
+	case DeleteRestrict, DeleteCascade, DeleteNullify:
+		return nil
+	}
+	return fmt.Errorf("unknown delete action %q", action)
+}
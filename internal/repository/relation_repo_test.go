@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+// relationStores are the stores a relation store deletes across.
+type relationStores struct {
+	relations RelationStore
+	books     BookStore
+	authors   AuthorStore
+	lists     ReadingListStore
+}
+
+func newMemoryRelationStores(t *testing.T) relationStores {
+	books, authors, lists := NewRepositories()
+	return relationStores{NewRelationRepository(books, authors, lists), books, authors, lists}
+}
+
+func TestRelationRepository(t *testing.T) {
+	testRelations(t, newMemoryRelationStores)
+}
+
+// TestRelationRepository_ConcurrentReferences races a book create against
+// the restricted delete of its author: one of them has to fail.
+func TestRelationRepository_ConcurrentReferences(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		s := newMemoryRelationStores(t)
+		_ = s.authors.Create(&model.Author{ID: "author-1", Name: "Jane Doe"})
+
+		var wg sync.WaitGroup
+		var createErr, deleteErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			createErr = s.books.Create(&model.Book{ID: "book-1", Title: "First", ISBN: "1", AuthorID: "author-1"})
+		}()
+		go func() {
+			defer wg.Done()
+			_, deleteErr = s.relations.DeleteAuthor("author-1", 0, DeleteRestrict)
+		}()
+		wg.Wait()
+
+		if (createErr == nil) == (deleteErr == nil) {
+			t.Fatalf("Create returned %v and DeleteAuthor %v, want exactly one to fail", createErr, deleteErr)
+		}
+		if createErr != nil && createErr != ErrInvalidReference {
+			t.Fatalf("Expected ErrInvalidReference, got %v", createErr)
+		}
+	}
+}
+
+func TestFileStore_Relations(t *testing.T) {
+	testRelations(t, func(t *testing.T) relationStores {
+		s := openTestFileStore(t, t.TempDir(), FileStoreOptions{})
+		t.Cleanup(func() { s.Close() })
+		return relationStores{s.Relations(), s.Books(), s.Authors(), s.ReadingLists()}
+	})
+}
+
+func TestSQLRelationRepository(t *testing.T) {
+	testRelations(t, func(t *testing.T) relationStores {
+		db := newTestDB(t)
+		return relationStores{NewSQLRelationRepository(db), NewSQLBookRepository(db), NewSQLAuthorRepository(db), NewSQLReadingListRepository(db)}
+	})
+}
+
+// testRelations checks the delete actions of a relation store, and that a
+// delete that fails changes nothing.
+func testRelations(t *testing.T, newStores func(t *testing.T) relationStores) {
+	t.Helper()
+
+	// seed creates author-1 with book-1 and book-2, author-2 with book-3,
+	// list-1 with book-1 and book-3, and list-2 with book-2.
+	seed := func(t *testing.T) relationStores {
+		s := newStores(t)
+		for _, id := range []string{"author-1", "author-2"} {
+			if err := s.authors.Create(&model.Author{ID: id, Name: id}); err != nil {
+				t.Fatalf("Create author failed: %v", err)
+			}
+		}
+		for _, b := range [][2]string{{"book-1", "author-1"}, {"book-2", "author-1"}, {"book-3", "author-2"}} {
+			if err := s.books.Create(&model.Book{ID: b[0], Title: b[0], ISBN: b[0], AuthorID: b[1]}); err != nil {
+				t.Fatalf("Create book failed: %v", err)
+			}
+		}
+		_ = s.lists.Create(&model.ReadingList{ID: "list-1", Name: "One", BookIDs: []string{"book-1", "book-3"}})
+		_ = s.lists.Create(&model.ReadingList{ID: "list-2", Name: "Two", BookIDs: []string{"book-2"}})
+		return s
+	}
+	// unchanged fails the test if a failed delete changed anything.
+	unchanged := func(t *testing.T, s relationStores) {
+		t.Helper()
+		if s.authors.Count() != 2 || s.books.Count() != 3 {
+			t.Errorf("Have %d authors and %d books, want 2 and 3", s.authors.Count(), s.books.Count())
+		}
+		if book, _ := s.books.Get("book-1"); book == nil || book.AuthorID != "author-1" || book.Version != 1 {
+			t.Errorf("book-1 = %+v, want it unchanged", book)
+		}
+		if list, _ := s.lists.Get("list-1"); list == nil || len(list.BookIDs) != 2 || list.Version != 1 {
+			t.Errorf("list-1 = %+v, want it unchanged", list)
+		}
+	}
+
+	t.Run("author restrict", func(t *testing.T) {
+		s := seed(t)
+		if _, err := s.relations.DeleteAuthor("author-1", 0, DeleteRestrict); err != ErrStillReferenced {
+			t.Errorf("Expected ErrStillReferenced, got %v", err)
+		}
+		unchanged(t, s)
+
+		_ = s.books.Delete("book-3")
+		if _, err := s.relations.DeleteAuthor("author-2", 0, DeleteRestrict); err != nil {
+			t.Errorf("Delete author without books failed: %v", err)
+		}
+	})
+
+	t.Run("author version conflict", func(t *testing.T) {
+		s := seed(t)
+		for _, action := range []DeleteAction{DeleteCascade, DeleteNullify} {
+			if _, err := s.relations.DeleteAuthor("author-1", 2, action); err != ErrVersionConflict {
+				t.Errorf("%s: expected ErrVersionConflict, got %v", action, err)
+			}
+		}
+		unchanged(t, s)
+		if _, err := s.relations.DeleteAuthor("missing", 0, DeleteCascade); err != ErrAuthorNotFound {
+			t.Errorf("Expected ErrAuthorNotFound, got %v", err)
+		}
+	})
+
+	t.Run("author cascade", func(t *testing.T) {
+		s := seed(t)
+		changes, err := s.relations.DeleteAuthor("author-1", 1, DeleteCascade)
+		if err != nil {
+			t.Fatalf("DeleteAuthor failed: %v", err)
+		}
+		if want := []string{"book-1", "book-2"}; !reflect.DeepEqual(changes.DeletedBooks, want) {
+			t.Errorf("DeletedBooks = %v, want %v", changes.DeletedBooks, want)
+		}
+		if _, err := s.authors.Get("author-1"); err != ErrAuthorNotFound {
+			t.Errorf("Author should be deleted, got %v", err)
+		}
+		if s.books.Count() != 1 {
+			t.Errorf("Expected only book-3 left, got %d books", s.books.Count())
+		}
+		list, _ := s.lists.Get("list-1")
+		if !reflect.DeepEqual(list.BookIDs, []string{"book-3"}) || list.Version != 2 {
+			t.Errorf("list-1 = %v at version %d, want [book-3] at version 2", list.BookIDs, list.Version)
+		}
+		if list, _ := s.lists.Get("list-2"); len(list.BookIDs) != 0 {
+			t.Errorf("list-2 books = %v, want none", list.BookIDs)
+		}
+	})
+
+	t.Run("author nullify", func(t *testing.T) {
+		s := seed(t)
+		changes, err := s.relations.DeleteAuthor("author-1", 0, DeleteNullify)
+		if err != nil {
+			t.Fatalf("DeleteAuthor failed: %v", err)
+		}
+		var updated []string
+		for _, book := range changes.UpdatedBooks {
+			if book.AuthorID != "" || book.Version != 2 {
+				t.Errorf("Updated book = %+v, want no author at version 2", book)
+			}
+			updated = append(updated, book.ID)
+		}
+		sort.Strings(updated)
+		if want := []string{"book-1", "book-2"}; !reflect.DeepEqual(updated, want) {
+			t.Errorf("UpdatedBooks = %v, want %v", updated, want)
+		}
+		if book, _ := s.books.Get("book-1"); book == nil || book.AuthorID != "" {
+			t.Errorf("book-1 = %+v, want no author", book)
+		}
+		if list, _ := s.lists.Get("list-1"); len(list.BookIDs) != 2 {
+			t.Errorf("list-1 books = %v, want both kept", list.BookIDs)
+		}
+	})
+
+	t.Run("book restrict", func(t *testing.T) {
+		s := seed(t)
+		if _, err := s.relations.DeleteBook("book-1", 0, DeleteRestrict); err != ErrStillReferenced {
+			t.Errorf("Expected ErrStillReferenced, got %v", err)
+		}
+		if _, err := s.relations.DeleteBook("book-1", 2, DeleteCascade); err != ErrVersionConflict {
+			t.Errorf("Expected ErrVersionConflict, got %v", err)
+		}
+		if _, err := s.relations.DeleteBook("missing", 0, DeleteCascade); err != ErrBookNotFound {
+			t.Errorf("Expected ErrBookNotFound, got %v", err)
+		}
+		unchanged(t, s)
+
+		_ = s.lists.Delete("list-2")
+		if _, err := s.relations.DeleteBook("book-2", 0, DeleteRestrict); err != nil {
+			t.Errorf("Delete book in no list failed: %v", err)
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		s := seed(t)
+		if err := s.books.Create(&model.Book{ID: "book-4", Title: "book-4", ISBN: "book-4", AuthorID: "missing"}); err != ErrInvalidReference {
+			t.Errorf("Create book: expected ErrInvalidReference, got %v", err)
+		}
+		if err := s.books.Update(&model.Book{ID: "book-1", Title: "book-1", ISBN: "book-1", AuthorID: "missing"}); err != ErrInvalidReference {
+			t.Errorf("Update book: expected ErrInvalidReference, got %v", err)
+		}
+		if err := s.lists.Create(&model.ReadingList{ID: "list-3", Name: "Three", BookIDs: []string{"book-1", "missing"}}); err != ErrInvalidReference {
+			t.Errorf("Create list: expected ErrInvalidReference, got %v", err)
+		}
+		if err := s.lists.Update(&model.ReadingList{ID: "list-1", Name: "One", BookIDs: []string{"missing"}}); err != ErrInvalidReference {
+			t.Errorf("Update list: expected ErrInvalidReference, got %v", err)
+		}
+		if err := s.lists.AddMember("list-2", "missing"); err != ErrInvalidReference {
+			t.Errorf("AddMember: expected ErrInvalidReference, got %v", err)
+		}
+		unchanged(t, s)
+		if list, _ := s.lists.Get("list-2"); list == nil || len(list.BookIDs) != 1 || list.Version != 1 {
+			t.Errorf("list-2 = %+v, want it unchanged", list)
+		}
+	})
+
+	t.Run("book cascade", func(t *testing.T) {
+		s := seed(t)
+		if _, err := s.relations.DeleteBook("book-1", 1, DeleteCascade); err != nil {
+			t.Fatalf("DeleteBook failed: %v", err)
+		}
+		if _, err := s.books.Get("book-1"); err != ErrBookNotFound {
+			t.Errorf("Book should be deleted, got %v", err)
+		}
+		list, _ := s.lists.Get("list-1")
+		if !reflect.DeepEqual(list.BookIDs, []string{"book-3"}) || list.Version != 2 {
+			t.Errorf("list-1 = %v at version %d, want [book-3] at version 2", list.BookIDs, list.Version)
+		}
+	})
+}
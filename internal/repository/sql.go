@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsupportedDriver = errors.New("unsupported database driver")
+
+// DB wraps a database handle together with the driver it was opened with.
+// The SQL repositories share a single DB and write queries with ? placeholders;
+// Exec, Query, QueryRow and Begin rewrite them to the driver's bind syntax.
+type DB struct {
+	*sql.DB
+	driver string
+}
+
+// Tx wraps a transaction with the same placeholder rewriting as DB.
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+// OpenDB opens a database for the given driver and applies the pool settings.
+// Supported drivers: "sqlite" and "postgres". The caller must import the
+// matching database/sql driver package.
+func OpenDB(driver, dsn string, maxConns, maxIdle int) (*DB, error) {
+	var sqlDriver string
+	switch driver {
+	case "sqlite":
+		sqlDriver = "sqlite3"
+		dsn = sqliteDSN(dsn)
+	case "postgres":
+		sqlDriver = "postgres"
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedDriver, driver)
+	}
+
+	db, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(maxConns)
+	db.SetMaxIdleConns(maxIdle)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if driver == "sqlite" {
+		if err := checkSQLiteForeignKeys(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &DB{DB: db, driver: driver}, nil
+}
+
+// Driver returns the configured driver name.
+func (db *DB) Driver() string {
+	return db.driver
+}
+
+// Exec executes a query without returning any rows.
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.rebind(query), args...)
+}
+
+// Query executes a query that returns rows.
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.rebind(query), args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row.
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.rebind(query), args...)
+}
+
+// Begin starts a transaction.
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+// Exec executes a query without returning any rows.
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.db.rebind(query), args...)
+}
+
+// Query executes a query that returns rows.
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.db.rebind(query), args...)
+}
+
+// QueryRow executes a query that is expected to return at most one row.
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.db.rebind(query), args...)
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for PostgreSQL.
+func (db *DB) rebind(query string) string {
+	if db.driver != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(query[i])
+	}
+	return b.String()
+}
+
+// isForeignKeyViolation reports whether err is a foreign key constraint failure.
+func isForeignKeyViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23503"
+	}
+	return err != nil && strings.Contains(err.Error(), "FOREIGN KEY constraint failed")
+}
+
+// rowQuerier is implemented by *DB and *Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// conflictOrNotFound explains a conditional write on table that matched no
+// rows: ErrVersionConflict if the record exists, notFound if it does not.
+func conflictOrNotFound(q rowQuerier, table, id string, notFound error) error {
+	var exists int
+	err := q.QueryRow(`SELECT 1 FROM `+table+` WHERE id = ?`, id).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure.
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23505"
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// checkSQLiteForeignKeys returns an error unless the connection enforces
+// foreign keys, which the delete policies and reading lists rely on.
+func checkSQLiteForeignKeys(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow(`PRAGMA foreign_keys`).Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New("sqlite: foreign key enforcement is disabled in the DSN")
+	}
+	return nil
+}
+
+// sqliteDSN adds the connection parameters the repositories rely on:
+// a busy timeout so concurrent writers wait instead of failing, and
+// foreign key enforcement for book authors and reading list members.
+func sqliteDSN(dsn string) string {
+	params := []string{"_busy_timeout=5000", "_foreign_keys=on"}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	for _, p := range params {
+		key := p[:strings.IndexByte(p, '=')]
+		if strings.Contains(dsn, key+"=") {
+			continue
+		}
+		dsn += sep + p
+		sep = "&"
+	}
+	return dsn
+}
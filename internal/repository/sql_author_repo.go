@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+const authorColumns = "id, name, bio, birth_date, country, created_at, updated_at, version"
+
+// SQLAuthorRepository is an AuthorStore backed by a SQL database.
+type SQLAuthorRepository struct {
+	db *DB
+}
+
+// NewSQLAuthorRepository creates a new SQL-backed author repository.
+func NewSQLAuthorRepository(db *DB) *SQLAuthorRepository {
+	return &SQLAuthorRepository{db: db}
+}
+
+// Create adds a new author to the repository.
+func (r *SQLAuthorRepository) Create(author *model.Author) error {
+	now := time.Now().UTC()
+
+	res, err := r.db.Exec(
+		`INSERT INTO authors (`+authorColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT (id) DO NOTHING`,
+		author.ID, author.Name, author.Bio, author.BirthDate.UTC(), author.Country, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAuthorExists
+	}
+
+	author.CreatedAt = now
+	author.UpdatedAt = now
+	author.Version = 1
+	return nil
+}
+
+// Get retrieves an author by ID.
+func (r *SQLAuthorRepository) Get(id string) (*model.Author, error) {
+	row := r.db.QueryRow(`SELECT `+authorColumns+` FROM authors WHERE id = ?`, id)
+
+	author, err := scanAuthor(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAuthorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return author, nil
+}
+
+// Update modifies an existing author.
+func (r *SQLAuthorRepository) Update(author *model.Author) error {
+	now := time.Now().UTC()
+
+	query := `UPDATE authors
+		SET name = ?, bio = ?, birth_date = ?, country = ?, updated_at = ?, version = version + 1
+		WHERE id = ?`
+	args := []interface{}{author.Name, author.Bio, author.BirthDate.UTC(), author.Country, now, author.ID}
+	if author.Version != 0 {
+		query += ` AND version = ?`
+		args = append(args, author.Version)
+	}
+
+	var createdAt time.Time
+	var version int64
+	err := r.db.QueryRow(query+` RETURNING created_at, version`, args...).Scan(&createdAt, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return conflictOrNotFound(r.db, "authors", author.ID, ErrAuthorNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	author.CreatedAt = createdAt
+	author.UpdatedAt = now
+	author.Version = version
+	return nil
+}
+
+// Delete removes an author by ID.
+func (r *SQLAuthorRepository) Delete(id string) error {
+	return r.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes an author by ID if it is still at the given version.
+func (r *SQLAuthorRepository) DeleteIfVersion(id string, version int64) error {
+	query := `DELETE FROM authors WHERE id = ?`
+	args := []interface{}{id}
+	if version != 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+
+	res, err := r.db.Exec(query, args...)
+	if isForeignKeyViolation(err) {
+		return ErrStillReferenced
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return conflictOrNotFound(r.db, "authors", id, ErrAuthorNotFound)
+	}
+	return nil
+}
+
+// GetMany retrieves the authors with the given IDs that exist.
+func (r *SQLAuthorRepository) GetMany(ids []string) ([]*model.Author, error) {
+	return r.query(`SELECT `+authorColumns+` FROM authors WHERE `+inList("id", len(ids)), stringArgs(ids)...)
+}
+
+// List returns all authors.
+func (r *SQLAuthorRepository) List() []*model.Author {
+	authors, err := r.query(`SELECT ` + authorColumns + ` FROM authors ORDER BY id`)
+	if err != nil {
+		log.Printf("repository: list authors: %v", err)
+		return []*model.Author{}
+	}
+	return authors
+}
+
+// FindByCountry returns all authors from a specific country.
+func (r *SQLAuthorRepository) FindByCountry(country string) []*model.Author {
+	authors, err := r.query(`SELECT `+authorColumns+` FROM authors WHERE country = ? ORDER BY id`, country)
+	if err != nil {
+		log.Printf("repository: find authors by country: %v", err)
+		return nil
+	}
+	return authors
+}
+
+// Query returns a sorted page of the authors matching q.Filter and the
+// number of matching authors.
+func (r *SQLAuthorRepository) Query(q AuthorQuery) ([]*model.Author, int, error) {
+	if err := checkQuery(q.Sort, authorSortColumns, q.Offset, q.Limit); err != nil {
+		return nil, 0, err
+	}
+
+	var conds []string
+	var args []interface{}
+	if q.Filter.Country != "" {
+		conds, args = append(conds, "country = ?"), append(args, q.Filter.Country)
+	}
+	where := whereClause(conds)
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM authors`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	authors, err := r.query(`SELECT `+authorColumns+` FROM authors`+where+
+		orderBy(q.Sort, authorSortColumns)+limitOffset(q.Offset, q.Limit), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return authors, total, nil
+}
+
+// Count returns the total number of authors.
+func (r *SQLAuthorRepository) Count() int {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM authors`).Scan(&count); err != nil {
+		log.Printf("repository: count authors: %v", err)
+		return 0
+	}
+	return count
+}
+
+// query runs a SELECT over the author columns and scans every row.
+func (r *SQLAuthorRepository) query(query string, args ...interface{}) ([]*model.Author, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []*model.Author{}
+	for rows.Next() {
+		author, err := scanAuthor(rows)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+	return authors, rows.Err()
+}
+
+func scanAuthor(row rowScanner) (*model.Author, error) {
+	var a model.Author
+	err := row.Scan(&a.ID, &a.Name, &a.Bio, &a.BirthDate, &a.Country, &a.CreatedAt, &a.UpdatedAt, &a.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
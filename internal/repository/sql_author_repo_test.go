@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+func TestSQLAuthorRepository_CRUD(t *testing.T) {
+	repo := NewSQLAuthorRepository(newTestDB(t))
+
+	birth := time.Date(1929, 10, 21, 0, 0, 0, 0, time.UTC)
+	author := &model.Author{
+		ID:        "author-1",
+		Name:      "Ursula K. Le Guin",
+		Bio:       "American author",
+		BirthDate: birth,
+		Country:   "USA",
+	}
+
+	if err := repo.Create(author); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	retrieved, err := repo.Get("author-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if retrieved.Name != author.Name || retrieved.Country != "USA" {
+		t.Errorf("Get returned %+v", retrieved)
+	}
+	if !retrieved.BirthDate.Equal(birth) {
+		t.Errorf("BirthDate = %v, want %v", retrieved.BirthDate, birth)
+	}
+
+	retrieved.Bio = "Updated bio"
+	if err := repo.Update(retrieved); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	updated, _ := repo.Get("author-1")
+	if updated.Bio != "Updated bio" {
+		t.Errorf("Expected updated bio, got %q", updated.Bio)
+	}
+	if !updated.CreatedAt.Equal(author.CreatedAt) {
+		t.Error("CreatedAt should not change on update")
+	}
+
+	if err := repo.Delete("author-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := repo.Get("author-1"); err != ErrAuthorNotFound {
+		t.Errorf("Expected ErrAuthorNotFound after delete, got %v", err)
+	}
+}
+
+func TestSQLAuthorRepository_Errors(t *testing.T) {
+	repo := NewSQLAuthorRepository(newTestDB(t))
+
+	author := &model.Author{ID: "author-1", Name: "Jane Doe"}
+	_ = repo.Create(author)
+
+	if err := repo.Create(author); err != ErrAuthorExists {
+		t.Errorf("Create duplicate: expected ErrAuthorExists, got %v", err)
+	}
+	if err := repo.Update(&model.Author{ID: "nonexistent"}); err != ErrAuthorNotFound {
+		t.Errorf("Update: expected ErrAuthorNotFound, got %v", err)
+	}
+	if err := repo.Delete("nonexistent"); err != ErrAuthorNotFound {
+		t.Errorf("Delete: expected ErrAuthorNotFound, got %v", err)
+	}
+}
+
+func TestSQLAuthorRepository_FindByCountry(t *testing.T) {
+	repo := NewSQLAuthorRepository(newTestDB(t))
+
+	_ = repo.Create(&model.Author{ID: "1", Name: "A", Country: "USA"})
+	_ = repo.Create(&model.Author{ID: "2", Name: "B", Country: "UK"})
+	_ = repo.Create(&model.Author{ID: "3", Name: "C", Country: "USA"})
+
+	if authors := repo.FindByCountry("USA"); len(authors) != 2 {
+		t.Errorf("Expected 2 authors from USA, got %d", len(authors))
+	}
+	if authors := repo.List(); len(authors) != 3 {
+		t.Errorf("Expected 3 authors, got %d", len(authors))
+	}
+	if repo.Count() != 3 {
+		t.Errorf("Expected count 3, got %d", repo.Count())
+	}
+}
+
+func TestSQLAuthorRepository_GetMany(t *testing.T) {
+	testAuthorGetMany(t, NewSQLAuthorRepository(newTestDB(t)))
+}
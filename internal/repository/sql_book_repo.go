@@ -0,0 +1,368 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/pkg/validator"
+)
+
+const bookColumns = "id, title, isbn, author_id, published_at, pages, genre, created_at, updated_at, version"
+
+// SQLBookRepository is a BookStore backed by a SQL database.
+// ISBN uniqueness is enforced by a unique index on the normalized isbn_key column.
+type SQLBookRepository struct {
+	db *DB
+}
+
+// NewSQLBookRepository creates a new SQL-backed book repository.
+func NewSQLBookRepository(db *DB) *SQLBookRepository {
+	return &SQLBookRepository{db: db}
+}
+
+// Create adds a new book to the repository.
+func (r *SQLBookRepository) Create(book *model.Book) error {
+	now := time.Now().UTC()
+
+	res, err := r.db.Exec(
+		`INSERT INTO books (`+bookColumns+`, isbn_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT (id) DO NOTHING`,
+		book.ID, book.Title, book.ISBN, nullString(book.AuthorID), book.PublishedAt.UTC(),
+		book.Pages, book.Genre, now, now, validator.NormalizeISBN(book.ISBN),
+	)
+	if isForeignKeyViolation(err) {
+		return ErrInvalidReference
+	}
+	if isUniqueViolation(err) {
+		return ErrDuplicateISBN
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrBookExists
+	}
+
+	book.CreatedAt = now
+	book.UpdatedAt = now
+	book.Version = 1
+	return nil
+}
+
+// Get retrieves a book by ID.
+func (r *SQLBookRepository) Get(id string) (*model.Book, error) {
+	row := r.db.QueryRow(`SELECT `+bookColumns+` FROM books WHERE id = ?`, id)
+
+	book, err := scanBook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// GetMany retrieves the books with the given IDs that exist.
+func (r *SQLBookRepository) GetMany(ids []string) ([]*model.Book, error) {
+	return r.query(`SELECT `+bookColumns+` FROM books WHERE `+inList("id", len(ids)), stringArgs(ids)...)
+}
+
+// Update modifies an existing book.
+func (r *SQLBookRepository) Update(book *model.Book) error {
+	now := time.Now().UTC()
+
+	query := `UPDATE books
+		SET title = ?, isbn = ?, isbn_key = ?, author_id = ?, published_at = ?, pages = ?, genre = ?,
+			updated_at = ?, version = version + 1
+		WHERE id = ?`
+	args := []interface{}{
+		book.Title, book.ISBN, validator.NormalizeISBN(book.ISBN), nullString(book.AuthorID), book.PublishedAt.UTC(), book.Pages, book.Genre,
+		now, book.ID,
+	}
+	if book.Version != 0 {
+		query += ` AND version = ?`
+		args = append(args, book.Version)
+	}
+
+	var createdAt time.Time
+	var version int64
+	err := r.db.QueryRow(query+` RETURNING created_at, version`, args...).Scan(&createdAt, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return conflictOrNotFound(r.db, "books", book.ID, ErrBookNotFound)
+	}
+	if isForeignKeyViolation(err) {
+		return ErrInvalidReference
+	}
+	if isUniqueViolation(err) {
+		return ErrDuplicateISBN
+	}
+	if err != nil {
+		return err
+	}
+
+	book.CreatedAt = createdAt
+	book.UpdatedAt = now
+	book.Version = version
+	return nil
+}
+
+// Delete removes a book by ID.
+func (r *SQLBookRepository) Delete(id string) error {
+	return r.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes a book by ID if it is still at the given version.
+func (r *SQLBookRepository) DeleteIfVersion(id string, version int64) error {
+	query := `DELETE FROM books WHERE id = ?`
+	args := []interface{}{id}
+	if version != 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+
+	res, err := r.db.Exec(query, args...)
+	if isForeignKeyViolation(err) {
+		return ErrStillReferenced
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return conflictOrNotFound(r.db, "books", id, ErrBookNotFound)
+	}
+	return nil
+}
+
+// List returns all books.
+func (r *SQLBookRepository) List() []*model.Book {
+	books, err := r.query(`SELECT ` + bookColumns + ` FROM books ORDER BY id`)
+	if err != nil {
+		log.Printf("repository: list books: %v", err)
+		return []*model.Book{}
+	}
+	return books
+}
+
+// FindByAuthor returns all books by a specific author.
+func (r *SQLBookRepository) FindByAuthor(authorID string) []*model.Book {
+	books, err := r.query(`SELECT `+bookColumns+` FROM books WHERE author_id = ? ORDER BY id`, authorID)
+	if err != nil {
+		log.Printf("repository: find books by author: %v", err)
+		return nil
+	}
+	return books
+}
+
+// Query returns a sorted page of the books matching q.Filter and the
+// number of matching books.
+func (r *SQLBookRepository) Query(q BookQuery) ([]*model.Book, int, error) {
+	if err := checkQuery(q.Sort, bookSortColumns, q.Offset, q.Limit); err != nil {
+		return nil, 0, err
+	}
+	if err := checkBookFilter(q.Filter); err != nil {
+		return nil, 0, err
+	}
+	if err := checkExpr(q.Where); err != nil {
+		return nil, 0, err
+	}
+
+	where, args := bookWhere(q)
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM books`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	books, err := r.query(`SELECT `+bookColumns+` FROM books`+where+
+		orderBy(q.Sort, bookSortColumns)+limitOffset(q.Offset, q.Limit), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// Facets counts the values of each named facet over the books matching
+// q.Filter and q.Where, ignoring its sort and paging.
+func (r *SQLBookRepository) Facets(q BookQuery, facets []string) (map[string][]model.FacetCount, error) {
+	if err := checkFacets(facets); err != nil {
+		return nil, err
+	}
+	if err := checkBookFilter(q.Filter); err != nil {
+		return nil, err
+	}
+	if err := checkExpr(q.Where); err != nil {
+		return nil, err
+	}
+
+	where, args := bookWhere(q)
+	if where == "" {
+		where = " WHERE 1 = 1"
+	}
+
+	result := make(map[string][]model.FacetCount, len(facets))
+	for _, facet := range facets {
+		expr, cond, condArgs := r.facetSQL(facet)
+		rows, err := r.db.Query(
+			`SELECT `+expr+`, COUNT(*) FROM books`+where+` AND `+cond+` GROUP BY 1`,
+			append(append([]interface{}{}, args...), condArgs...)...,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		counts := make(map[string]int)
+		for rows.Next() {
+			var value string
+			var n int
+			if err := rows.Scan(&value, &n); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if facet == model.FacetDecade {
+				year, _ := strconv.Atoi(value)
+				value = model.Decade(year)
+			}
+			counts[value] = n
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		result[facet] = model.FacetCounts(facet, counts)
+	}
+	return result, nil
+}
+
+// facetSQL returns the grouping expression of a facet and the condition
+// that leaves out books without a value. Decades are returned as years.
+func (r *SQLBookRepository) facetSQL(facet string) (expr, cond string, args []interface{}) {
+	switch facet {
+	case model.FacetGenre:
+		return "genre", "genre <> ''", nil
+	case model.FacetAuthor:
+		return "author_id", "author_id <> ''", nil
+	case model.FacetDecade:
+		year := "CAST(substr(published_at, 1, 4) AS INTEGER)"
+		if r.db.Driver() == "postgres" {
+			year = "CAST(EXTRACT(YEAR FROM published_at) AS INTEGER)"
+		}
+		return "(" + year + " / 10) * 10", "published_at > ?", []interface{}{time.Time{}.UTC()}
+	}
+
+	// Pages
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, bucket := range model.PageBuckets {
+		if bucket.Max == math.MaxInt {
+			fmt.Fprintf(&b, " WHEN pages >= %d THEN '%s'", bucket.Min, bucket.Label)
+		} else {
+			fmt.Fprintf(&b, " WHEN pages BETWEEN %d AND %d THEN '%s'", bucket.Min, bucket.Max, bucket.Label)
+		}
+	}
+	b.WriteString(" END")
+	return b.String(), "pages > 0", nil
+}
+
+// bookWhere builds the WHERE clause selecting the books a query matches.
+func bookWhere(q BookQuery) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	f := q.Filter
+	if f.Genre != "" {
+		conds, args = append(conds, "genre = ?"), append(args, f.Genre)
+	}
+	if f.AuthorID != "" {
+		conds, args = append(conds, "author_id = ?"), append(args, f.AuthorID)
+	}
+	if f.MinPages > 0 {
+		conds, args = append(conds, "pages >= ?"), append(args, f.MinPages)
+	}
+	if f.MaxPages > 0 {
+		conds, args = append(conds, "pages <= ?"), append(args, f.MaxPages)
+	}
+	if !f.PublishedAfter.IsZero() {
+		conds, args = append(conds, "published_at >= ?"), append(args, f.PublishedAfter.UTC())
+	}
+	if !f.PublishedBefore.IsZero() {
+		conds, args = append(conds, "published_at < ?"), append(args, f.PublishedBefore.UTC())
+	}
+	if q.Where != nil {
+		cond, condArgs := exprSQL(q.Where)
+		conds, args = append(conds, cond), append(args, condArgs...)
+	}
+	return whereClause(conds), args
+}
+
+// Count returns the total number of books.
+func (r *SQLBookRepository) Count() int {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM books`).Scan(&count); err != nil {
+		log.Printf("repository: count books: %v", err)
+		return 0
+	}
+	return count
+}
+
+// query runs a SELECT over the book columns and scans every row.
+func (r *SQLBookRepository) query(query string, args ...interface{}) ([]*model.Book, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBooks(rows)
+}
+
+// scanBooks reads every row of bookColumns and closes rows.
+func scanBooks(rows *sql.Rows) ([]*model.Book, error) {
+	defer rows.Close()
+
+	books := []*model.Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBook reads a row of bookColumns. A NULL author_id, left by deleting
+// the author under the nullify policy, reads as "".
+func scanBook(row rowScanner) (*model.Book, error) {
+	var b model.Book
+	var authorID sql.NullString
+	err := row.Scan(
+		&b.ID, &b.Title, &b.ISBN, &authorID, &b.PublishedAt,
+		&b.Pages, &b.Genre, &b.CreatedAt, &b.UpdatedAt, &b.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.AuthorID = authorID.String
+	return &b, nil
+}
+
+// nullString stores "" as NULL, so that an empty reference is not checked
+// against the referenced table.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+func TestSQLBookRepository_CRUD(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "author-1")
+	repo := NewSQLBookRepository(db)
+
+	published := time.Date(2015, 10, 26, 0, 0, 0, 0, time.UTC)
+	book := &model.Book{
+		ID:          "book-1",
+		Title:       "The Go Programming Language",
+		ISBN:        "978-0134190440",
+		AuthorID:    "author-1",
+		PublishedAt: published,
+		Pages:       400,
+		Genre:       "Technology",
+	}
+
+	if err := repo.Create(book); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if book.CreatedAt.IsZero() {
+		t.Error("CreatedAt should be set")
+	}
+
+	retrieved, err := repo.Get("book-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if retrieved.Title != book.Title || retrieved.Pages != 400 || retrieved.Genre != "Technology" {
+		t.Errorf("Get returned %+v", retrieved)
+	}
+	if !retrieved.PublishedAt.Equal(published) {
+		t.Errorf("PublishedAt = %v, want %v", retrieved.PublishedAt, published)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	retrieved.Title = "Updated Title"
+	if err := repo.Update(retrieved); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	updated, _ := repo.Get("book-1")
+	if updated.Title != "Updated Title" {
+		t.Errorf("Expected updated title, got %q", updated.Title)
+	}
+	if !updated.CreatedAt.Equal(book.CreatedAt) {
+		t.Error("CreatedAt should not change on update")
+	}
+	if !updated.UpdatedAt.After(updated.CreatedAt) {
+		t.Error("UpdatedAt should be after CreatedAt")
+	}
+
+	if err := repo.Delete("book-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if repo.Count() != 0 {
+		t.Error("Book should be deleted")
+	}
+}
+
+func TestSQLBookRepository_Errors(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "author-1")
+	repo := NewSQLBookRepository(db)
+
+	book := &model.Book{ID: "book-1", Title: "Test", ISBN: "123", AuthorID: "author-1"}
+	_ = repo.Create(book)
+
+	if err := repo.Create(book); err != ErrBookExists {
+		t.Errorf("Create duplicate: expected ErrBookExists, got %v", err)
+	}
+	if _, err := repo.Get("nonexistent"); err != ErrBookNotFound {
+		t.Errorf("Get: expected ErrBookNotFound, got %v", err)
+	}
+	if err := repo.Update(&model.Book{ID: "nonexistent"}); err != ErrBookNotFound {
+		t.Errorf("Update: expected ErrBookNotFound, got %v", err)
+	}
+	if err := repo.Delete("nonexistent"); err != ErrBookNotFound {
+		t.Errorf("Delete: expected ErrBookNotFound, got %v", err)
+	}
+}
+
+func TestSQLBookRepository_DuplicateISBN(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "a")
+	repo := NewSQLBookRepository(db)
+
+	_ = repo.Create(&model.Book{ID: "book-1", Title: "First", ISBN: "0-8044-2957-x", AuthorID: "a"})
+	_ = repo.Create(&model.Book{ID: "book-2", Title: "Second", ISBN: "0306406152", AuthorID: "a"})
+
+	if err := repo.Create(&model.Book{ID: "book-3", Title: "Third", ISBN: "080442957X", AuthorID: "a"}); err != ErrDuplicateISBN {
+		t.Errorf("Create: expected ErrDuplicateISBN, got %v", err)
+	}
+	if err := repo.Update(&model.Book{ID: "book-2", Title: "Second", ISBN: "080442957X", AuthorID: "a"}); err != ErrDuplicateISBN {
+		t.Errorf("Update: expected ErrDuplicateISBN, got %v", err)
+	}
+	if err := repo.Update(&model.Book{ID: "book-1", Title: "First", ISBN: "080442957X", AuthorID: "a"}); err != nil {
+		t.Errorf("Update with own ISBN failed: %v", err)
+	}
+}
+
+func TestSQLBookRepository_Versions(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "a")
+	repo := NewSQLBookRepository(db)
+
+	book := &model.Book{ID: "book-1", Title: "First", ISBN: "1", AuthorID: "a"}
+	_ = repo.Create(book)
+	if book.Version != 1 {
+		t.Errorf("Version after create = %d, want 1", book.Version)
+	}
+
+	update := &model.Book{ID: "book-1", Title: "Second", ISBN: "1", AuthorID: "a", Version: 1}
+	if err := repo.Update(update); err != nil {
+		t.Fatalf("Update at current version failed: %v", err)
+	}
+	if update.Version != 2 {
+		t.Errorf("Version after update = %d, want 2", update.Version)
+	}
+	if err := repo.Update(&model.Book{ID: "book-1", Title: "Stale", ISBN: "1", AuthorID: "a", Version: 1}); err != ErrVersionConflict {
+		t.Errorf("Update: expected ErrVersionConflict, got %v", err)
+	}
+	if err := repo.Update(&model.Book{ID: "missing", Title: "Gone", ISBN: "9", AuthorID: "a", Version: 1}); err != ErrBookNotFound {
+		t.Errorf("Update: expected ErrBookNotFound, got %v", err)
+	}
+	if err := repo.DeleteIfVersion("book-1", 1); err != ErrVersionConflict {
+		t.Errorf("DeleteIfVersion: expected ErrVersionConflict, got %v", err)
+	}
+	if err := repo.DeleteIfVersion("book-1", 2); err != nil {
+		t.Errorf("DeleteIfVersion at current version failed: %v", err)
+	}
+}
+
+func TestSQLBookRepository_ListAndFind(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "author-1", "author-2")
+	repo := NewSQLBookRepository(db)
+
+	_ = repo.Create(&model.Book{ID: "1", Title: "Book 1", ISBN: "1", AuthorID: "author-1"})
+	_ = repo.Create(&model.Book{ID: "2", Title: "Book 2", ISBN: "2", AuthorID: "author-1"})
+	_ = repo.Create(&model.Book{ID: "3", Title: "Book 3", ISBN: "3", AuthorID: "author-2"})
+
+	if books := repo.List(); len(books) != 3 {
+		t.Errorf("Expected 3 books, got %d", len(books))
+	}
+	if books := repo.FindByAuthor("author-1"); len(books) != 2 {
+		t.Errorf("Expected 2 books by author-1, got %d", len(books))
+	}
+	if repo.Count() != 3 {
+		t.Errorf("Expected count 3, got %d", repo.Count())
+	}
+}
+
+func TestSQLBookRepository_NoAuthor(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "author-1")
+	repo := NewSQLBookRepository(db)
+
+	_ = repo.Create(&model.Book{ID: "1", Title: "Book 1", ISBN: "1", AuthorID: "author-1"})
+	book, _ := repo.Get("1")
+	book.AuthorID = ""
+	if err := repo.Update(book); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	got, err := repo.Get("1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.AuthorID != "" {
+		t.Errorf("AuthorID = %q, want empty", got.AuthorID)
+	}
+	if books := repo.FindByAuthor("author-1"); len(books) != 0 {
+		t.Errorf("Expected no books by author-1, got %d", len(books))
+	}
+	books, _, err := repo.Query(BookQuery{Sort: []SortKey{{Field: "author_id"}}, Limit: 10})
+	if err != nil || len(books) != 1 {
+		t.Errorf("Query sorted by author_id = %d books, %v", len(books), err)
+	}
+}
+
+func TestSQLBookRepository_Query(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "a1", "a2", "a3", "a4")
+	testBookQuery(t, NewSQLBookRepository(db))
+}
+
+func TestSQLBookRepository_Facets(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "a1", "a2", "a3")
+	testBookFacets(t, NewSQLBookRepository(db))
+}
+
+func TestSQLBookRepository_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "persist.db")
+
+	db, err := OpenDB("sqlite", path, 1, 1)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	migrateTestDB(t, db)
+	seedAuthors(t, db, "a")
+	_ = NewSQLBookRepository(db).Create(&model.Book{ID: "book-1", Title: "Durable", ISBN: "1", AuthorID: "a"})
+	db.Close()
+
+	db, err = OpenDB("sqlite", path, 1, 1)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer db.Close()
+
+	book, err := NewSQLBookRepository(db).Get("book-1")
+	if err != nil {
+		t.Fatalf("Get after reopen failed: %v", err)
+	}
+	if book.Title != "Durable" {
+		t.Errorf("Title = %q, want Durable", book.Title)
+	}
+}
+
+func TestSQLBookRepository_GetMany(t *testing.T) {
+	db := newTestDB(t)
+	seedAuthors(t, db, "a1")
+	testBookGetMany(t, NewSQLBookRepository(db))
+}
+
+func TestSQLBookRepository_PublishedAtOffset(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSQLBookRepository(db)
+
+	// 1999-12-31 23:00 UTC, stored as text on SQLite
+	published := time.Date(2000, 1, 1, 1, 0, 0, 0, time.FixedZone("", 2*3600))
+	if err := repo.Create(&model.Book{ID: "book-1", Title: "Offset", ISBN: "1", PublishedAt: published}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	book, err := repo.Get("book-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !book.PublishedAt.Equal(published) {
+		t.Errorf("PublishedAt = %v, want %v", book.PublishedAt, published)
+	}
+
+	check := func(t *testing.T) {
+		t.Helper()
+		millennium := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		if books, _, _ := repo.Query(BookQuery{Filter: BookFilter{PublishedBefore: millennium}, Limit: 10}); len(books) != 1 {
+			t.Errorf("Published before 2000 = %d books, want 1", len(books))
+		}
+		if books, _, _ := repo.Query(BookQuery{Filter: BookFilter{PublishedAfter: millennium}, Limit: 10}); len(books) != 0 {
+			t.Errorf("Published after 2000 = %d books, want 0", len(books))
+		}
+		facets, err := repo.Facets(BookQuery{}, []string{model.FacetDecade})
+		if err != nil {
+			t.Fatalf("Facets failed: %v", err)
+		}
+		if want := []model.FacetCount{{Value: "1990s", Count: 1}}; !reflect.DeepEqual(facets[model.FacetDecade], want) {
+			t.Errorf("Decades = %v, want %v", facets[model.FacetDecade], want)
+		}
+	}
+	check(t)
+
+	book.PublishedAt = published
+	if err := repo.Update(book); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	check(t)
+}
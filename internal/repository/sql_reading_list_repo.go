@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+const readingListColumns = "id, name, description, created_at, updated_at, version"
+
+// SQLReadingListRepository is a ReadingListStore backed by a SQL database.
+// Book membership is stored in the reading_list_books join table, ordered by position.
+type SQLReadingListRepository struct {
+	db *DB
+}
+
+// NewSQLReadingListRepository creates a new SQL-backed reading list repository.
+func NewSQLReadingListRepository(db *DB) *SQLReadingListRepository {
+	return &SQLReadingListRepository{db: db}
+}
+
+// Create adds a new reading list to the repository.
+func (r *SQLReadingListRepository) Create(list *model.ReadingList) error {
+	now := time.Now().UTC()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT INTO reading_lists (`+readingListColumns+`)
+		VALUES (?, ?, ?, ?, ?, 1)
+		ON CONFLICT (id) DO NOTHING`,
+		list.ID, list.Name, list.Description, now, now,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrReadingListExists
+	}
+
+	if err := insertListBooks(tx, list.ID, list.BookIDs); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if list.BookIDs == nil {
+		list.BookIDs = []string{}
+	}
+	list.CreatedAt = now
+	list.UpdatedAt = now
+	list.Version = 1
+	return nil
+}
+
+// Get retrieves a reading list by ID.
+func (r *SQLReadingListRepository) Get(id string) (*model.ReadingList, error) {
+	lists, err := r.query(` WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return nil, ErrReadingListNotFound
+	}
+	return lists[0], nil
+}
+
+// Update modifies an existing reading list, replacing its book membership.
+func (r *SQLReadingListRepository) Update(list *model.ReadingList) error {
+	now := time.Now().UTC()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reading_lists
+		SET name = ?, description = ?, updated_at = ?, version = version + 1
+		WHERE id = ?`
+	args := []interface{}{list.Name, list.Description, now, list.ID}
+	if list.Version != 0 {
+		query += ` AND version = ?`
+		args = append(args, list.Version)
+	}
+
+	var createdAt time.Time
+	var version int64
+	err = tx.QueryRow(query+` RETURNING created_at, version`, args...).Scan(&createdAt, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return conflictOrNotFound(tx, "reading_lists", list.ID, ErrReadingListNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reading_list_books WHERE list_id = ?`, list.ID); err != nil {
+		return err
+	}
+	if err := insertListBooks(tx, list.ID, list.BookIDs); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	list.CreatedAt = createdAt
+	list.UpdatedAt = now
+	list.Version = version
+	return nil
+}
+
+// Delete removes a reading list by ID.
+func (r *SQLReadingListRepository) Delete(id string) error {
+	return r.DeleteIfVersion(id, 0)
+}
+
+// DeleteIfVersion removes a reading list by ID if it is still at the given version.
+func (r *SQLReadingListRepository) DeleteIfVersion(id string, version int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM reading_lists WHERE id = ?`
+	args := []interface{}{id}
+	if version != 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return conflictOrNotFound(tx, "reading_lists", id, ErrReadingListNotFound)
+	}
+	if _, err := tx.Exec(`DELETE FROM reading_list_books WHERE list_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddMember appends a book to the end of a reading list.
+func (r *SQLReadingListRepository) AddMember(listID, bookID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Touching the list first takes its row lock, serializing concurrent
+	// membership changes so the next position is computed consistently.
+	if err := touchList(tx, listID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO reading_list_books (list_id, book_id, position)
+		SELECT ?, ?, COALESCE(MAX(position), -1) + 1 FROM reading_list_books WHERE list_id = ?
+		ON CONFLICT (list_id, book_id) DO NOTHING`,
+		listID, bookID, listID,
+	)
+	if isForeignKeyViolation(err) {
+		return ErrInvalidReference
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAlreadyMember
+	}
+	return tx.Commit()
+}
+
+// RemoveMember removes a book from a reading list.
+func (r *SQLReadingListRepository) RemoveMember(listID, bookID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := touchList(tx, listID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`DELETE FROM reading_list_books WHERE list_id = ? AND book_id = ?`, listID, bookID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotMember
+	}
+	return tx.Commit()
+}
+
+// List returns all reading lists.
+func (r *SQLReadingListRepository) List() []*model.ReadingList {
+	lists, err := r.query(` ORDER BY id`)
+	if err != nil {
+		log.Printf("repository: list reading lists: %v", err)
+		return []*model.ReadingList{}
+	}
+	return lists
+}
+
+// FindByBook returns all reading lists containing a specific book.
+func (r *SQLReadingListRepository) FindByBook(bookID string) []*model.ReadingList {
+	lists, err := r.query(` WHERE id IN (SELECT list_id FROM reading_list_books WHERE book_id = ?) ORDER BY id`, bookID)
+	if err != nil {
+		log.Printf("repository: find reading lists by book: %v", err)
+		return nil
+	}
+	return lists
+}
+
+// FindByBooks returns all reading lists containing any of the books.
+func (r *SQLReadingListRepository) FindByBooks(bookIDs []string) ([]*model.ReadingList, error) {
+	return r.query(` WHERE id IN (SELECT list_id FROM reading_list_books WHERE `+inList("book_id", len(bookIDs))+`) ORDER BY id`,
+		stringArgs(bookIDs)...)
+}
+
+// Query returns a sorted page of the reading lists matching q.Filter and
+// the number of matching lists.
+func (r *SQLReadingListRepository) Query(q ReadingListQuery) ([]*model.ReadingList, int, error) {
+	if err := checkQuery(q.Sort, readingListSortColumns, q.Offset, q.Limit); err != nil {
+		return nil, 0, err
+	}
+
+	var conds []string
+	var args []interface{}
+	if q.Filter.BookID != "" {
+		conds = append(conds, "id IN (SELECT list_id FROM reading_list_books WHERE book_id = ?)")
+		args = append(args, q.Filter.BookID)
+	}
+	where := whereClause(conds)
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM reading_lists`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	lists, err := r.query(where+orderBy(q.Sort, readingListSortColumns)+limitOffset(q.Offset, q.Limit), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return lists, total, nil
+}
+
+// Count returns the total number of reading lists.
+func (r *SQLReadingListRepository) Count() int {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM reading_lists`).Scan(&count); err != nil {
+		log.Printf("repository: count reading lists: %v", err)
+		return 0
+	}
+	return count
+}
+
+// query loads the reading lists selected by the given clauses, which follow
+// FROM reading_lists, together with their book IDs in list order.
+func (r *SQLReadingListRepository) query(clauses string, args ...interface{}) ([]*model.ReadingList, error) {
+	rows, err := r.db.Query(`SELECT `+readingListColumns+` FROM reading_lists`+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*model.ReadingList{}
+	byID := make(map[string]*model.ReadingList)
+	for rows.Next() {
+		list := &model.ReadingList{BookIDs: []string{}}
+		if err := rows.Scan(&list.ID, &list.Name, &list.Description, &list.CreatedAt, &list.UpdatedAt, &list.Version); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+		byID[list.ID] = list
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return lists, nil
+	}
+
+	members, err := r.db.Query(
+		`SELECT list_id, book_id FROM reading_list_books
+		WHERE list_id IN (SELECT id FROM reading_lists`+clauses+`)
+		ORDER BY list_id, position`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer members.Close()
+
+	for members.Next() {
+		var listID, bookID string
+		if err := members.Scan(&listID, &bookID); err != nil {
+			return nil, err
+		}
+		if list, ok := byID[listID]; ok {
+			list.BookIDs = append(list.BookIDs, bookID)
+		}
+	}
+	return lists, members.Err()
+}
+
+// insertListBooks stores the book membership of a list in order.
+func insertListBooks(tx *Tx, listID string, bookIDs []string) error {
+	for i, bookID := range bookIDs {
+		_, err := tx.Exec(
+			`INSERT INTO reading_list_books (list_id, book_id, position) VALUES (?, ?, ?)`,
+			listID, bookID, i,
+		)
+		if isForeignKeyViolation(err) {
+			return ErrInvalidReference
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touchList bumps the updated_at and version of a list, returning ErrReadingListNotFound
+// if it does not exist.
+func touchList(tx *Tx, listID string) error {
+	res, err := tx.Exec(`UPDATE reading_lists SET updated_at = ?, version = version + 1 WHERE id = ?`, time.Now().UTC(), listID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrReadingListNotFound
+	}
+	return nil
+}
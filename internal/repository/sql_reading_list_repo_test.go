@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+func TestSQLReadingListRepository_CRUD(t *testing.T) {
+	db := newTestDB(t)
+	seedBooks(t, db, "book-1", "book-2", "book-3", "book-4")
+	repo := NewSQLReadingListRepository(db)
+
+	list := &model.ReadingList{
+		ID:          "list-1",
+		Name:        "Summer Reading",
+		Description: "Beach books",
+		BookIDs:     []string{"book-3", "book-1", "book-2"},
+	}
+	if err := repo.Create(list); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	retrieved, err := repo.Get("list-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !reflect.DeepEqual(retrieved.BookIDs, list.BookIDs) {
+		t.Errorf("BookIDs = %v, want %v (order preserved)", retrieved.BookIDs, list.BookIDs)
+	}
+
+	retrieved.Name = "Winter Reading"
+	retrieved.RemoveBook("book-1")
+	retrieved.AddBook("book-4")
+	if err := repo.Update(retrieved); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	updated, _ := repo.Get("list-1")
+	if updated.Name != "Winter Reading" {
+		t.Errorf("Expected updated name, got %q", updated.Name)
+	}
+	want := []string{"book-3", "book-2", "book-4"}
+	if !reflect.DeepEqual(updated.BookIDs, want) {
+		t.Errorf("BookIDs = %v, want %v", updated.BookIDs, want)
+	}
+
+	if err := repo.Delete("list-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if repo.Count() != 0 {
+		t.Error("Reading list should be deleted")
+	}
+	if lists := repo.FindByBook("book-3"); len(lists) != 0 {
+		t.Errorf("Expected membership to be removed, got %d lists", len(lists))
+	}
+}
+
+func TestSQLReadingListRepository_Errors(t *testing.T) {
+	repo := NewSQLReadingListRepository(newTestDB(t))
+
+	list := &model.ReadingList{ID: "list-1", Name: "Test"}
+	_ = repo.Create(list)
+
+	if list.BookIDs == nil {
+		t.Error("BookIDs should be initialized on create")
+	}
+	if err := repo.Create(list); err != ErrReadingListExists {
+		t.Errorf("Create duplicate: expected ErrReadingListExists, got %v", err)
+	}
+	if _, err := repo.Get("nonexistent"); err != ErrReadingListNotFound {
+		t.Errorf("Get: expected ErrReadingListNotFound, got %v", err)
+	}
+	if err := repo.Update(&model.ReadingList{ID: "nonexistent"}); err != ErrReadingListNotFound {
+		t.Errorf("Update: expected ErrReadingListNotFound, got %v", err)
+	}
+	if err := repo.Delete("nonexistent"); err != ErrReadingListNotFound {
+		t.Errorf("Delete: expected ErrReadingListNotFound, got %v", err)
+	}
+}
+
+func TestSQLReadingListRepository_FindByBook(t *testing.T) {
+	db := newTestDB(t)
+	seedBooks(t, db, "book-1", "book-2")
+	repo := NewSQLReadingListRepository(db)
+
+	_ = repo.Create(&model.ReadingList{ID: "list-1", Name: "A", BookIDs: []string{"book-1", "book-2"}})
+	_ = repo.Create(&model.ReadingList{ID: "list-2", Name: "B", BookIDs: []string{"book-2"}})
+	_ = repo.Create(&model.ReadingList{ID: "list-3", Name: "C"})
+
+	lists := repo.FindByBook("book-2")
+	if len(lists) != 2 {
+		t.Fatalf("Expected 2 lists containing book-2, got %d", len(lists))
+	}
+	if !reflect.DeepEqual(lists[0].BookIDs, []string{"book-1", "book-2"}) {
+		t.Errorf("list-1 BookIDs = %v", lists[0].BookIDs)
+	}
+	if all := repo.List(); len(all) != 3 {
+		t.Errorf("Expected 3 lists, got %d", len(all))
+	}
+}
+
+func TestSQLReadingListRepository_Query(t *testing.T) {
+	db := newTestDB(t)
+	seedBooks(t, db, "book-1", "book-2", "book-3")
+	repo := NewSQLReadingListRepository(db)
+
+	_ = repo.Create(&model.ReadingList{ID: "list-1", Name: "C", BookIDs: []string{"book-1", "book-2"}})
+	_ = repo.Create(&model.ReadingList{ID: "list-2", Name: "B", BookIDs: []string{"book-2"}})
+	_ = repo.Create(&model.ReadingList{ID: "list-3", Name: "A", BookIDs: []string{"book-2", "book-3"}})
+	_ = repo.Create(&model.ReadingList{ID: "list-4", Name: "D"})
+
+	lists, total, err := repo.Query(ReadingListQuery{
+		Filter: ReadingListFilter{BookID: "book-2"},
+		Sort:   []SortKey{{Field: "name"}},
+		Offset: 1,
+		Limit:  2,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if total != 3 || len(lists) != 2 {
+		t.Fatalf("Query returned %d lists (total %d), want 2 of 3", len(lists), total)
+	}
+	if lists[0].ID != "list-2" || lists[1].ID != "list-1" {
+		t.Errorf("Query order = %s, %s; want list-2, list-1", lists[0].ID, lists[1].ID)
+	}
+	if !reflect.DeepEqual(lists[1].BookIDs, []string{"book-1", "book-2"}) {
+		t.Errorf("list-1 BookIDs = %v", lists[1].BookIDs)
+	}
+}
+
+func TestSQLReadingListRepository_Members(t *testing.T) {
+	db := newTestDB(t)
+	seedBooks(t, db, "book-1", "book-2", "book-3")
+	repo := NewSQLReadingListRepository(db)
+	_ = repo.Create(&model.ReadingList{ID: "list-1", Name: "List", BookIDs: []string{"book-1"}})
+
+	if err := repo.AddMember("list-1", "book-2"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	if err := repo.AddMember("list-1", "book-1"); err != ErrAlreadyMember {
+		t.Errorf("Expected ErrAlreadyMember, got %v", err)
+	}
+	if err := repo.AddMember("missing", "book-1"); err != ErrReadingListNotFound {
+		t.Errorf("Expected ErrReadingListNotFound, got %v", err)
+	}
+	if err := repo.RemoveMember("list-1", "book-1"); err != nil {
+		t.Fatalf("RemoveMember failed: %v", err)
+	}
+	if err := repo.RemoveMember("list-1", "book-1"); err != ErrNotMember {
+		t.Errorf("Expected ErrNotMember, got %v", err)
+	}
+	if err := repo.AddMember("list-1", "book-3"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+
+	list, _ := repo.Get("list-1")
+	if want := []string{"book-2", "book-3"}; !reflect.DeepEqual(list.BookIDs, want) {
+		t.Errorf("BookIDs = %v, want %v (appended in order)", list.BookIDs, want)
+	}
+	if list.Version != 4 {
+		t.Errorf("Version = %d, want 4 after three membership changes", list.Version)
+	}
+}
+
+func TestSQLReadingListRepository_ConcurrentMembers(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < 40; i++ {
+		seedBooks(t, db, fmt.Sprintf("book-%02d", i))
+	}
+	testConcurrentMembers(t, NewSQLReadingListRepository(db))
+}
+
+func TestSQLReadingListRepository_FindByBooks(t *testing.T) {
+	db := newTestDB(t)
+	seedBooks(t, db, "book-1", "book-2", "book-3")
+	testFindByBooks(t, NewSQLReadingListRepository(db))
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SQLRelationRepository is a RelationStore backed by a SQL database. Each
+// delete runs in one transaction that first locks the deleted row, so
+// records cannot start referencing it while the delete is under way.
+type SQLRelationRepository struct {
+	db *DB
+}
+
+// NewSQLRelationRepository creates a new SQL-backed relation store.
+func NewSQLRelationRepository(db *DB) *SQLRelationRepository {
+	return &SQLRelationRepository{db: db}
+}
+
+// DeleteAuthor deletes an author and applies action to their books.
+func (r *SQLRelationRepository) DeleteAuthor(id string, version int64, action DeleteAction) (*RelatedChanges, error) {
+	if err := checkAction(action); err != nil {
+		return nil, err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockRow(tx, "authors", id, version, ErrAuthorNotFound); err != nil {
+		return nil, err
+	}
+	bookIDs, err := queryIDs(tx, `SELECT id FROM books WHERE author_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookIDs) > 0 && action == DeleteRestrict {
+		return nil, ErrStillReferenced
+	}
+
+	changes := &RelatedChanges{}
+	now := time.Now().UTC()
+	switch {
+	case len(bookIDs) == 0:
+	case action == DeleteCascade:
+		listIDs, err := queryIDs(tx,
+			`SELECT DISTINCT m.list_id FROM reading_list_books m
+			JOIN books b ON b.id = m.book_id
+			WHERE b.author_id = ? ORDER BY m.list_id`, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, listID := range listIDs {
+			if err := touchList(tx, listID); err != nil {
+				return nil, err
+			}
+		}
+		// Memberships of the books go with them (ON DELETE CASCADE)
+		if _, err := tx.Exec(`DELETE FROM books WHERE author_id = ?`, id); err != nil {
+			return nil, err
+		}
+		changes.DeletedBooks = bookIDs
+	default:
+		rows, err := tx.Query(
+			`UPDATE books SET author_id = NULL, updated_at = ?, version = version + 1
+			WHERE author_id = ? RETURNING `+bookColumns, now, id)
+		if err != nil {
+			return nil, err
+		}
+		if changes.UpdatedBooks, err = scanBooks(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM authors WHERE id = ?`, id); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrStillReferenced
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// DeleteBook deletes a book and applies action to its reading lists.
+func (r *SQLRelationRepository) DeleteBook(id string, version int64, action DeleteAction) (*RelatedChanges, error) {
+	if err := checkAction(action); err != nil {
+		return nil, err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockRow(tx, "books", id, version, ErrBookNotFound); err != nil {
+		return nil, err
+	}
+	listIDs, err := queryIDs(tx, `SELECT list_id FROM reading_list_books WHERE book_id = ? ORDER BY list_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(listIDs) > 0 && action == DeleteRestrict {
+		return nil, ErrStillReferenced
+	}
+	for _, listID := range listIDs {
+		if err := touchList(tx, listID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Memberships of the book go with it (ON DELETE CASCADE)
+	if _, err := tx.Exec(`DELETE FROM books WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &RelatedChanges{}, nil
+}
+
+// lockRow locks the row of id in table until tx ends, and checks it is at
+// version unless version is zero. On PostgreSQL, FOR UPDATE also blocks
+// inserts of rows referencing it; SQLite takes the database write lock on
+// the first write of a transaction.
+func lockRow(tx *Tx, table, id string, version int64, notFound error) error {
+	query := `UPDATE ` + table + ` SET version = version WHERE id = ? RETURNING version`
+	if tx.db.driver == "postgres" {
+		query = `SELECT version FROM ` + table + ` WHERE id = ? FOR UPDATE`
+	}
+
+	var current int64
+	err := tx.QueryRow(query, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && version != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// queryIDs runs a query selecting a single column of IDs.
+func queryIDs(tx *Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pawelpaszki/gorts-demo/internal/migrate"
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+// newTestDB opens a fresh SQLite database with all migrations applied.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := OpenDB("sqlite", filepath.Join(t.TempDir(), "test.db"), 4, 2)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrateTestDB(t, db)
+	return db
+}
+
+// migrateTestDB applies all migrations to db.
+func migrateTestDB(t *testing.T, db *DB) {
+	t.Helper()
+
+	m, err := migrate.New(db.DB, db.Driver())
+	if err != nil {
+		t.Fatalf("migrate.New failed: %v", err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Migrating failed: %v", err)
+	}
+}
+
+// seedAuthors creates authors with the given IDs for books to refer to.
+func seedAuthors(t *testing.T, db *DB, ids ...string) {
+	t.Helper()
+
+	authors := NewSQLAuthorRepository(db)
+	for _, id := range ids {
+		if err := authors.Create(&model.Author{ID: id, Name: "Author " + id}); err != nil {
+			t.Fatalf("Seeding author %s failed: %v", id, err)
+		}
+	}
+}
+
+// seedBooks creates books with the given IDs for reading lists to refer to.
+func seedBooks(t *testing.T, db *DB, ids ...string) {
+	t.Helper()
+
+	books := NewSQLBookRepository(db)
+	for _, id := range ids {
+		if err := books.Create(&model.Book{ID: id, Title: "Book " + id, ISBN: id}); err != nil {
+			t.Fatalf("Seeding book %s failed: %v", id, err)
+		}
+	}
+}
+
+func TestOpenDB_UnsupportedDriver(t *testing.T) {
+	_, err := OpenDB("oracle", "dsn", 1, 1)
+	if !errors.Is(err, ErrUnsupportedDriver) {
+		t.Errorf("Expected ErrUnsupportedDriver, got %v", err)
+	}
+}
+
+func TestOpenDB_AppliesPoolSettings(t *testing.T) {
+	db, err := OpenDB("sqlite", filepath.Join(t.TempDir(), "pool.db"), 3, 1)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer db.Close()
+
+	if got := db.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("MaxOpenConnections = %d, want 3", got)
+	}
+	if db.Driver() != "sqlite" {
+		t.Errorf("Driver() = %q, want sqlite", db.Driver())
+	}
+}
+
+func TestSQLite_ForeignKeys(t *testing.T) {
+	testForeignKeys(t, newTestDB(t))
+}
+
+func TestOpenDB_SQLiteForeignKeysOff(t *testing.T) {
+	_, err := OpenDB("sqlite", filepath.Join(t.TempDir(), "fk.db")+"?_foreign_keys=off", 1, 1)
+	if err == nil {
+		t.Error("Expected an error when foreign keys are disabled")
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"bookshelf.db", "bookshelf.db?_busy_timeout=5000&_foreign_keys=on"},
+		{"bookshelf.db?cache=shared", "bookshelf.db?cache=shared&_busy_timeout=5000&_foreign_keys=on"},
+		{"bookshelf.db?_busy_timeout=100", "bookshelf.db?_busy_timeout=100&_foreign_keys=on"},
+	}
+
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.dsn); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+// Errors returned by stores that enforce relationships between records.
+var (
+	ErrInvalidReference = errors.New("referenced record does not exist")
+	ErrStillReferenced  = errors.New("record is still referenced")
+)
+
+// ErrVersionConflict is returned by conditional writes when the stored
+// record no longer has the version the caller expected.
+//
+// Every store sets Version to 1 on Create and increments it on each change.
+// Update is conditional when the record passed in has a non-zero Version,
+// and DeleteIfVersion when version is non-zero; a zero version means the
+// write is unconditional.
+var ErrVersionConflict = errors.New("version conflict")
+
+// BookStore is the storage contract for books.
+// Implementations must return ErrBookNotFound and ErrBookExists where applicable.
+//
+// Query returns one page of matching records together with the number of
+// records that match in total, or ErrInvalidQuery for an unknown sort field.
+// Facets counts facet values (see model.BookFacets) over all matching books.
+// GetMany returns the books with the given IDs in one lookup, in no
+// particular order, leaving out IDs that do not exist.
+type BookStore interface {
+	Create(book *model.Book) error
+	Get(id string) (*model.Book, error)
+	GetMany(ids []string) ([]*model.Book, error)
+	Update(book *model.Book) error
+	Delete(id string) error
+	DeleteIfVersion(id string, version int64) error
+	List() []*model.Book
+	FindByAuthor(authorID string) []*model.Book
+	Query(q BookQuery) ([]*model.Book, int, error)
+	Facets(q BookQuery, facets []string) (map[string][]model.FacetCount, error)
+	Count() int
+}
+
+// AuthorStore is the storage contract for authors.
+// Implementations must return ErrAuthorNotFound and ErrAuthorExists where applicable.
+// Query and GetMany behave as in BookStore.
+type AuthorStore interface {
+	Create(author *model.Author) error
+	Get(id string) (*model.Author, error)
+	GetMany(ids []string) ([]*model.Author, error)
+	Update(author *model.Author) error
+	Delete(id string) error
+	DeleteIfVersion(id string, version int64) error
+	List() []*model.Author
+	FindByCountry(country string) []*model.Author
+	Query(q AuthorQuery) ([]*model.Author, int, error)
+	Count() int
+}
+
+// ReadingListStore is the storage contract for reading lists.
+// Implementations must return ErrReadingListNotFound and ErrReadingListExists where applicable.
+//
+// AddMember and RemoveMember change a single membership atomically, so
+// concurrent changes to the same list are never lost. They return
+// ErrAlreadyMember and ErrNotMember when there is nothing to change.
+// FindByBooks returns, in one lookup, the lists containing any of the books.
+// Query behaves as in BookStore.
+type ReadingListStore interface {
+	Create(list *model.ReadingList) error
+	Get(id string) (*model.ReadingList, error)
+	Update(list *model.ReadingList) error
+	Delete(id string) error
+	DeleteIfVersion(id string, version int64) error
+	AddMember(listID, bookID string) error
+	RemoveMember(listID, bookID string) error
+	List() []*model.ReadingList
+	FindByBook(bookID string) []*model.ReadingList
+	FindByBooks(bookIDs []string) ([]*model.ReadingList, error)
+	Query(q ReadingListQuery) ([]*model.ReadingList, int, error)
+	Count() int
+}
+
+// DeleteAction is what a relational delete does to the records that
+// reference the record it deletes.
+type DeleteAction string
+
+const (
+	// DeleteRestrict fails with ErrStillReferenced while anything
+	// references the record.
+	DeleteRestrict DeleteAction = "restrict"
+	// DeleteCascade deletes the referencing records too.
+	DeleteCascade DeleteAction = "cascade"
+	// DeleteNullify keeps the referencing records but clears the reference.
+	DeleteNullify DeleteAction = "nullify"
+)
+
+// RelationStore deletes authors and books together with what references
+// them. Each delete is a single atomic write: if the version check, the
+// action or the delete fails, nothing changes.
+//
+// DeleteAuthor applies the action to the author's books; cascading deletes
+// them and removes them from their reading lists. DeleteBook applies it to
+// the reading lists containing the book; cascade and nullify both remove
+// the book from the lists. Both return the not-found and version errors of
+// DeleteIfVersion, and the other records they changed.
+type RelationStore interface {
+	DeleteAuthor(id string, version int64, action DeleteAction) (*RelatedChanges, error)
+	DeleteBook(id string, version int64, action DeleteAction) (*RelatedChanges, error)
+}
+
+// RelatedChanges are the books a relational delete changed besides the
+// record it deleted.
+type RelatedChanges struct {
+	// DeletedBooks are the IDs of books deleted with their author.
+	DeletedBooks []string
+	// UpdatedBooks are the books whose author was cleared, as stored.
+	UpdatedBooks []*model.Book
+}
+
+// Compile-time checks that the repositories satisfy the store interfaces.
+var (
+	_ BookStore        = (*BookRepository)(nil)
+	_ AuthorStore      = (*AuthorRepository)(nil)
+	_ ReadingListStore = (*ReadingListRepository)(nil)
+
+	_ BookStore        = (*SQLBookRepository)(nil)
+	_ AuthorStore      = (*SQLAuthorRepository)(nil)
+	_ ReadingListStore = (*SQLReadingListRepository)(nil)
+
+	_ BookStore        = (*fileBookStore)(nil)
+	_ AuthorStore      = (*fileAuthorStore)(nil)
+	_ ReadingListStore = (*fileReadingListStore)(nil)
+
+	_ RelationStore = (*RelationRepository)(nil)
+	_ RelationStore = (*SQLRelationRepository)(nil)
+	_ RelationStore = (*fileRelationStore)(nil)
+)
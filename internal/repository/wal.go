@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Log records are framed as a 4-byte big-endian payload length, a 4-byte
+// CRC-32C checksum of the payload, and the payload itself.
+const recordHeaderSize = 8
+
+var ErrCorruptLog = errors.New("corrupt log record")
+
+// logFile is the log of a FileStore, an *os.File outside tests.
+type logFile interface {
+	io.WriteCloser
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// writeRecord frames payload and writes it with a single Write call.
+func writeRecord(w io.Writer, payload []byte) error {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// readRecords decodes the framed records in data.
+//
+// It returns the payloads and the length of the valid prefix of data. A final
+// record that is incomplete or fails its checksum is treated as torn by an
+// interrupted write: it is excluded and valid is less than len(data). A bad
+// record followed by further data cannot be explained by a torn write and
+// returns ErrCorruptLog; so does a length running past the end of data when
+// a valid record follows its header, as after a damaged length field.
+func readRecords(data []byte) (payloads [][]byte, valid int, err error) {
+	offset := 0
+	for offset < len(data) {
+		remaining := len(data) - offset
+		if remaining < recordHeaderSize {
+			return payloads, offset, nil
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		checksum := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		if length > remaining-recordHeaderSize {
+			if recordAfter(data, offset+recordHeaderSize) {
+				return nil, offset, ErrCorruptLog
+			}
+			return payloads, offset, nil
+		}
+
+		end := offset + recordHeaderSize + length
+		payload := data[offset+recordHeaderSize : end]
+		if crc32.Checksum(payload, crcTable) != checksum {
+			if end == len(data) {
+				return payloads, offset, nil
+			}
+			return nil, offset, ErrCorruptLog
+		}
+
+		payloads = append(payloads, payload)
+		offset = end
+	}
+	return payloads, offset, nil
+}
+
+// recordAfter reports whether a complete record with a valid checksum starts
+// anywhere in data from offset on.
+func recordAfter(data []byte, offset int) bool {
+	for ; len(data)-offset >= recordHeaderSize; offset++ {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		if length > len(data)-offset-recordHeaderSize {
+			continue
+		}
+		payload := data[offset+recordHeaderSize : offset+recordHeaderSize+length]
+		if crc32.Checksum(payload, crcTable) == binary.BigEndian.Uint32(data[offset+4:offset+8]) {
+			return true
+		}
+	}
+	return false
+}
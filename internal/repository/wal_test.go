@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+)
+
+func framed(t *testing.T, payloads ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, p := range payloads {
+		if err := writeRecord(&buf, []byte(p)); err != nil {
+			t.Fatalf("writeRecord failed: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadRecords_RoundTrip(t *testing.T) {
+	data := framed(t, "first", "", "third")
+
+	payloads, valid, err := readRecords(data)
+	if err != nil {
+		t.Fatalf("readRecords failed: %v", err)
+	}
+	if valid != len(data) {
+		t.Errorf("valid = %d, want %d", valid, len(data))
+	}
+	if len(payloads) != 3 || string(payloads[0]) != "first" || string(payloads[2]) != "third" {
+		t.Errorf("payloads = %q", payloads)
+	}
+}
+
+func TestReadRecords_TornTail(t *testing.T) {
+	good := framed(t, "first", "second")
+	full := framed(t, "first", "second", "third")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"partial header", full[:len(good)+3]},
+		{"partial payload", full[:len(full)-2]},
+		{"bad checksum on last record", func() []byte {
+			d := append([]byte(nil), full...)
+			d[len(d)-1] ^= 0xff
+			return d
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads, valid, err := readRecords(tt.data)
+			if err != nil {
+				t.Fatalf("readRecords failed: %v", err)
+			}
+			if valid != len(good) {
+				t.Errorf("valid = %d, want %d", valid, len(good))
+			}
+			if len(payloads) != 2 {
+				t.Errorf("Expected 2 intact records, got %d", len(payloads))
+			}
+		})
+	}
+}
+
+func TestReadRecords_CorruptMiddle(t *testing.T) {
+	data := framed(t, "first", "second", "third")
+	data[recordHeaderSize] ^= 0xff // flip a byte in the first payload
+
+	if _, _, err := readRecords(data); err != ErrCorruptLog {
+		t.Errorf("Expected ErrCorruptLog, got %v", err)
+	}
+
+	// A damaged length must not pass for a torn tail and drop later records
+	data = framed(t, "first", "second", "third")
+	data[0] = 0x7f
+	if _, _, err := readRecords(data); err != ErrCorruptLog {
+		t.Errorf("Expected ErrCorruptLog for a damaged length, got %v", err)
+	}
+}
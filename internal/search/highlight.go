@@ -0,0 +1,84 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// Snippet sizes, in bytes of source text.
+const (
+	snippetLen    = 160
+	snippetBefore = 40
+)
+
+// highlights returns a highlighted snippet of every field of doc that
+// matches one of the query terms.
+func highlights(doc Document, terms []string) map[string]string {
+	out := make(map[string]string)
+	for _, f := range doc.Fields {
+		if s, ok := highlight(f.Text, terms); ok {
+			out[f.Name] = s
+		}
+	}
+	return out
+}
+
+// highlight wraps the tokens of text that match a query term, exactly or
+// by prefix, in <mark> tags. Long text is cut to a window around the first
+// match. It reports false if nothing matched.
+func highlight(text string, terms []string) (string, bool) {
+	var marks []Token
+	for _, tok := range Tokenize(text) {
+		for _, term := range terms {
+			if tok.Term == term || (len(term) >= minPrefixLen && strings.HasPrefix(tok.Term, term)) {
+				marks = append(marks, tok)
+				break
+			}
+		}
+	}
+	if len(marks) == 0 {
+		return "", false
+	}
+
+	start, end := 0, len(text)
+	if len(text) > snippetLen {
+		start = max(marks[0].Start-snippetBefore, 0)
+		end = min(start+snippetLen, len(text))
+		start, end = wordBoundary(text, start, -1), wordBoundary(text, end, +1)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range marks {
+		if m.Start < start || m.End > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:m.Start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[m.Start:m.End]))
+		b.WriteString("</mark>")
+		pos = m.End
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// wordBoundary moves i in direction dir to the nearest space so snippets
+// do not start or end mid-word, giving up after a few bytes. The result is
+// always on a rune boundary.
+func wordBoundary(text string, i, dir int) int {
+	for n := 0; n < 15 && i > 0 && i < len(text) && text[i-1] != ' ' && text[i] != ' '; n++ {
+		i += dir
+	}
+	for i > 0 && i < len(text) && !utf8.RuneStart(text[i]) {
+		i += dir
+	}
+	return i
+}
@@ -0,0 +1,353 @@
+// Package search provides an in-process full-text index over the catalogue.
+//
+// Documents are tokenized with Tokenize, so matching ignores case and
+// diacritics. Query terms also match longer terms they are a prefix of, and
+// results are ranked with BM25.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+// Document kinds.
+const (
+	KindBook        = "book"
+	KindAuthor      = "author"
+	KindReadingList = "list"
+)
+
+// BM25 parameters.
+const (
+	k1 = 1.2
+	b  = 0.75
+
+	// prefixWeight scales the score of a term matched by prefix only, so
+	// exact matches rank first.
+	prefixWeight = 0.5
+	// minPrefixLen is the shortest query term that is expanded by prefix.
+	minPrefixLen = 2
+)
+
+// Field is a named piece of document text. Boost scales how much a match
+// in the field counts; zero means 1.
+type Field struct {
+	Name  string
+	Text  string
+	Boost float64
+}
+
+// Document is a record as seen by the index.
+type Document struct {
+	Kind string
+	ID   string
+	// Title is the display name returned with hits.
+	Title  string
+	Fields []Field
+	// Facets holds the document's facet values, e.g. a book's genre.
+	Facets map[string]string
+}
+
+// Query is a search request. Every term of Text must match. An empty Kind
+// searches all kinds; a zero Limit returns every hit from Offset on.
+type Query struct {
+	Text   string
+	Kind   string
+	Offset int
+	Limit  int
+}
+
+// Hit is a ranked search result. Highlights holds a snippet of each
+// matching field with the matched terms wrapped in <mark> tags; the rest of
+// the snippet is HTML-escaped.
+type Hit struct {
+	Kind       string            `json:"type"`
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type docKey struct {
+	kind string
+	id   string
+}
+
+type entry struct {
+	doc    Document
+	length float64
+	terms  []string
+}
+
+// Index is an inverted index safe for concurrent use.
+type Index struct {
+	// writes serializes the writes of the stores wrapped around the index
+	// (see IndexBooks) with their updates of it.
+	writes sync.Mutex
+
+	mu       sync.RWMutex
+	docs     map[docKey]*entry
+	postings map[string]map[docKey]float64
+	total    float64
+	// vocab is the sorted list of terms for prefix lookups, rebuilt on
+	// demand after new terms are added.
+	vocab []string
+}
+
+// NewIndex creates an empty index.
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[docKey]*entry),
+		postings: make(map[string]map[docKey]float64),
+	}
+}
+
+// Put adds a document, replacing any previous document of the same kind and ID.
+func (x *Index) Put(doc Document) {
+	freqs := make(map[string]float64)
+	var length float64
+	for _, f := range doc.Fields {
+		boost := f.Boost
+		if boost == 0 {
+			boost = 1
+		}
+		for _, tok := range Tokenize(f.Text) {
+			freqs[tok.Term] += boost
+			length += boost
+		}
+	}
+
+	key := docKey{doc.Kind, doc.ID}
+	e := &entry{doc: doc, length: length, terms: make([]string, 0, len(freqs))}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(key)
+	for term, tf := range freqs {
+		p, ok := x.postings[term]
+		if !ok {
+			p = make(map[docKey]float64)
+			x.postings[term] = p
+			x.vocab = nil
+		}
+		p[key] = tf
+		e.terms = append(e.terms, term)
+	}
+	x.docs[key] = e
+	x.total += length
+}
+
+// Remove deletes a document from the index.
+func (x *Index) Remove(kind, id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(docKey{kind, id})
+}
+
+// remove deletes a document. The caller must hold the write lock.
+func (x *Index) remove(key docKey) {
+	e, ok := x.docs[key]
+	if !ok {
+		return
+	}
+	for _, term := range e.terms {
+		p := x.postings[term]
+		delete(p, key)
+		if len(p) == 0 {
+			delete(x.postings, term)
+			x.vocab = nil
+		}
+	}
+	delete(x.docs, key)
+	x.total -= e.length
+}
+
+// Len returns the number of indexed documents.
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.docs)
+}
+
+// Search returns a page of hits ordered by descending score and the total
+// number of matching documents.
+func (x *Index) Search(q Query) ([]Hit, int) {
+	var terms []string
+	for _, tok := range Tokenize(q.Text) {
+		terms = append(terms, tok.Term)
+	}
+	if len(terms) == 0 {
+		return []Hit{}, 0
+	}
+
+	x.rlock()
+	defer x.mu.RUnlock()
+
+	scores := x.score(terms, q.Kind)
+
+	keys := make([]docKey, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if si, sj := scores[keys[i]], scores[keys[j]]; si != sj {
+			return si > sj
+		}
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	total := len(keys)
+	if q.Offset >= len(keys) {
+		return []Hit{}, total
+	}
+	keys = keys[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(keys) {
+		keys = keys[:q.Limit]
+	}
+
+	hits := make([]Hit, len(keys))
+	for i, key := range keys {
+		doc := x.docs[key].doc
+		hits[i] = Hit{
+			Kind:       doc.Kind,
+			ID:         doc.ID,
+			Title:      doc.Title,
+			Score:      math.Round(scores[key]*1000) / 1000,
+			Highlights: highlights(doc, terms),
+		}
+	}
+	return hits, total
+}
+
+// Facets counts the values of each named facet over all documents matching
+// q, ignoring its paging. Documents without a value for a facet are skipped.
+func (x *Index) Facets(q Query, facets []string) map[string][]model.FacetCount {
+	var terms []string
+	for _, tok := range Tokenize(q.Text) {
+		terms = append(terms, tok.Term)
+	}
+
+	x.rlock()
+	defer x.mu.RUnlock()
+
+	var scores map[docKey]float64
+	if len(terms) > 0 {
+		scores = x.score(terms, q.Kind)
+	}
+
+	result := make(map[string][]model.FacetCount, len(facets))
+	for _, facet := range facets {
+		counts := make(map[string]int)
+		for key := range scores {
+			if v := x.docs[key].doc.Facets[facet]; v != "" {
+				counts[v]++
+			}
+		}
+		result[facet] = model.FacetCounts(facet, counts)
+	}
+	return result
+}
+
+// rlock read-locks the index with an up-to-date vocabulary.
+func (x *Index) rlock() {
+	x.mu.RLock()
+	for x.vocab == nil {
+		// A write added or dropped terms; rebuild the vocabulary, then
+		// check again under the read lock in case another write raced us.
+		x.mu.RUnlock()
+		x.mu.Lock()
+		x.buildVocab()
+		x.mu.Unlock()
+		x.mu.RLock()
+	}
+}
+
+// buildVocab rebuilds the sorted term list. The caller must hold the write lock.
+func (x *Index) buildVocab() {
+	if x.vocab != nil {
+		return
+	}
+	x.vocab = make([]string, 0, len(x.postings))
+	for term := range x.postings {
+		x.vocab = append(x.vocab, term)
+	}
+	sort.Strings(x.vocab)
+}
+
+// score returns the BM25 score of every document of the given kind that
+// matches all terms. The caller must hold the read lock.
+func (x *Index) score(terms []string, kind string) map[docKey]float64 {
+	n := float64(len(x.docs))
+	if n == 0 {
+		return nil
+	}
+	avg := x.total / n
+
+	var scores map[docKey]float64
+	for _, term := range terms {
+		// A document's score for a query term is its best-scoring expansion.
+		best := make(map[docKey]float64)
+		for _, t := range x.expand(term) {
+			weight := 1.0
+			if t != term {
+				weight = prefixWeight
+			}
+			p := x.postings[t]
+			idf := math.Log(1 + (n-float64(len(p))+0.5)/(float64(len(p))+0.5))
+			for key, tf := range p {
+				if kind != "" && key.kind != kind {
+					continue
+				}
+				if scores != nil {
+					if _, ok := scores[key]; !ok {
+						continue
+					}
+				}
+				dl := x.docs[key].length
+				s := weight * idf * tf * (k1 + 1) / (tf + k1*(1-b+b*dl/avg))
+				if s > best[key] {
+					best[key] = s
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = best
+			continue
+		}
+		for key, s := range scores {
+			if add, ok := best[key]; ok {
+				scores[key] = s + add
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+	return scores
+}
+
+// expand returns the indexed terms a query term matches: the term itself
+// and, for terms of at least minPrefixLen bytes, every term it prefixes.
+// The caller must hold the read lock and vocab must be current.
+func (x *Index) expand(term string) []string {
+	if len(term) < minPrefixLen {
+		if _, ok := x.postings[term]; ok {
+			return []string{term}
+		}
+		return nil
+	}
+
+	var terms []string
+	for i := sort.SearchStrings(x.vocab, term); i < len(x.vocab) && strings.HasPrefix(x.vocab[i], term); i++ {
+		terms = append(terms, x.vocab[i])
+	}
+	return terms
+}
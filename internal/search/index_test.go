@@ -0,0 +1,170 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestIndex() *Index {
+	idx := NewIndex()
+	idx.Put(Document{Kind: KindBook, ID: "b1", Title: "The Hobbit", Fields: []Field{
+		{Name: "title", Text: "The Hobbit", Boost: 2},
+		{Name: "genre", Text: "Fantasy"},
+	}})
+	idx.Put(Document{Kind: KindBook, ID: "b2", Title: "The Lord of the Rings", Fields: []Field{
+		{Name: "title", Text: "The Lord of the Rings", Boost: 2},
+		{Name: "genre", Text: "Fantasy"},
+	}})
+	idx.Put(Document{Kind: KindBook, ID: "b3", Title: "Lords and Ladies", Fields: []Field{
+		{Name: "title", Text: "Lords and Ladies", Boost: 2},
+		{Name: "genre", Text: "Comedy"},
+	}})
+	idx.Put(Document{Kind: KindAuthor, ID: "a1", Title: "J. R. R. Tolkien", Fields: []Field{
+		{Name: "name", Text: "J. R. R. Tolkien", Boost: 2},
+		{Name: "bio", Text: "Author of The Hobbit and other fantasy novels, born in Bloemfontein."},
+	}})
+	idx.Put(Document{Kind: KindAuthor, ID: "a2", Title: "Stanisław Lem", Fields: []Field{
+		{Name: "name", Text: "Stanisław Lem", Boost: 2},
+		{Name: "bio", Text: "Science fiction writer from Lwów."},
+	}})
+	return idx
+}
+
+func hitIDs(hits []Hit) string {
+	var ids []string
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestIndex_Search(t *testing.T) {
+	idx := newTestIndex()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"boosted field ranks first", Query{Text: "hobbit"}, "b1,a1"},
+		{"all terms must match", Query{Text: "hobbit fantasy"}, "b1,a1"},
+		{"no match", Query{Text: "hobbit lem"}, ""},
+		{"diacritics folded", Query{Text: "STANISLAW lwow"}, "a2"},
+		{"prefix", Query{Text: "tolk"}, "a1"},
+		{"exact before prefix", Query{Text: "lord"}, "b2,b3"},
+		{"single letters are not prefixes", Query{Text: "l"}, ""},
+		{"kind", Query{Text: "fantasy", Kind: KindAuthor}, "a1"},
+		{"page", Query{Text: "fantasy", Offset: 1, Limit: 1}, "b2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, _ := idx.Search(tt.query)
+			if got := hitIDs(hits); got != tt.want {
+				t.Errorf("Search(%q) = %s, want %s", tt.query.Text, got, tt.want)
+			}
+		})
+	}
+
+	if _, total := idx.Search(Query{Text: "fantasy", Limit: 1}); total != 3 {
+		t.Errorf("total = %d, want 3", total)
+	}
+}
+
+func TestIndex_PutReplacesAndRemove(t *testing.T) {
+	idx := newTestIndex()
+
+	idx.Put(Document{Kind: KindBook, ID: "b1", Title: "Solaris", Fields: []Field{{Name: "title", Text: "Solaris"}}})
+	if hits, _ := idx.Search(Query{Text: "hobbit", Kind: KindBook}); len(hits) != 0 {
+		t.Errorf("Old text still matches: %s", hitIDs(hits))
+	}
+	if hits, _ := idx.Search(Query{Text: "solaris"}); hitIDs(hits) != "b1" {
+		t.Errorf("New text does not match: %s", hitIDs(hits))
+	}
+
+	idx.Remove(KindBook, "b1")
+	if hits, _ := idx.Search(Query{Text: "sol"}); len(hits) != 0 {
+		t.Errorf("Removed document still matches: %s", hitIDs(hits))
+	}
+	if idx.Len() != 4 {
+		t.Errorf("Len = %d, want 4", idx.Len())
+	}
+}
+
+func TestIndex_Highlights(t *testing.T) {
+	idx := NewIndex()
+	bio := strings.Repeat("Filler words here. ", 10) + "Wrote <Solaris> & Solaristics. " + strings.Repeat("More filler. ", 10)
+	idx.Put(Document{Kind: KindBook, ID: "b3", Title: "Lords and Ladies", Fields: []Field{
+		{Name: "title", Text: "Lords and Ladies", Boost: 2},
+		{Name: "genre", Text: "Comedy"},
+	}})
+	idx.Put(Document{Kind: KindAuthor, ID: "a1", Title: "Lem", Fields: []Field{
+		{Name: "name", Text: "Stanisław Lem"},
+		{Name: "bio", Text: bio},
+	}})
+
+	hits, _ := idx.Search(Query{Text: "solaris"})
+	if len(hits) != 1 {
+		t.Fatalf("Expected 1 hit, got %d", len(hits))
+	}
+	h := hits[0].Highlights
+	if _, ok := h["name"]; ok {
+		t.Errorf("Non-matching field highlighted: %q", h["name"])
+	}
+	snippet := h["bio"]
+	if !strings.Contains(snippet, "Wrote &lt;<mark>Solaris</mark>&gt; &amp; <mark>Solaristics</mark>.") {
+		t.Errorf("Snippet does not mark and escape matches: %q", snippet)
+	}
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") || len(snippet) > snippetLen+60 {
+		t.Errorf("Snippet is not a window of the text: %q", snippet)
+	}
+}
+
+func TestIndex_Concurrent(t *testing.T) {
+	idx := newTestIndex()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id := fmt.Sprintf("c%d-%d", i, j)
+				idx.Put(Document{Kind: KindBook, ID: id, Fields: []Field{{Name: "title", Text: "Concurrent " + id}}})
+				idx.Search(Query{Text: "conc"})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, total := idx.Search(Query{Text: "concurrent"}); total != 400 {
+		t.Errorf("total = %d, want 400", total)
+	}
+}
+
+func TestIndex_Facets(t *testing.T) {
+	idx := NewIndex()
+	for id, genre := range map[string]string{"b1": "Fantasy", "b2": "Fantasy", "b3": "Comedy", "b4": ""} {
+		idx.Put(Document{Kind: KindBook, ID: id, Title: "Discworld " + id, Fields: []Field{
+			{Name: "title", Text: "Discworld " + id},
+		}, Facets: map[string]string{"genre": genre}})
+	}
+	idx.Put(Document{Kind: KindAuthor, ID: "a1", Title: "Discworld fan", Fields: []Field{
+		{Name: "name", Text: "Discworld fan"},
+	}})
+
+	counts := idx.Facets(Query{Text: "discworld", Limit: 1}, []string{"genre"})
+	genres := counts["genre"]
+	if len(genres) != 2 || genres[0].Value != "Fantasy" || genres[0].Count != 2 || genres[1].Value != "Comedy" {
+		t.Errorf("Genre counts = %+v", genres)
+	}
+
+	if counts := idx.Facets(Query{Text: "b3"}, []string{"genre"}); len(counts["genre"]) != 1 || counts["genre"][0].Value != "Comedy" {
+		t.Errorf("Genre counts for b3 = %+v", counts["genre"])
+	}
+	if counts := idx.Facets(Query{Text: "nothing"}, []string{"genre"}); len(counts["genre"]) != 0 {
+		t.Errorf("Expected no counts, got %+v", counts["genre"])
+	}
+}
@@ -0,0 +1,242 @@
+package search
+
+import (
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+// BookDocument indexes a book's title and genre, with its facet values.
+func BookDocument(book *model.Book) Document {
+	facets := make(map[string]string, len(model.BookFacets))
+	for _, f := range model.BookFacets {
+		facets[f] = book.FacetValue(f)
+	}
+	return Document{
+		Kind:  KindBook,
+		ID:    book.ID,
+		Title: book.Title,
+		Fields: []Field{
+			{Name: "title", Text: book.Title, Boost: 2},
+			{Name: "genre", Text: book.Genre},
+		},
+		Facets: facets,
+	}
+}
+
+// AuthorDocument indexes an author's name and bio.
+func AuthorDocument(author *model.Author) Document {
+	return Document{
+		Kind:  KindAuthor,
+		ID:    author.ID,
+		Title: author.Name,
+		Fields: []Field{
+			{Name: "name", Text: author.Name, Boost: 2},
+			{Name: "bio", Text: author.Bio},
+		},
+	}
+}
+
+// ReadingListDocument indexes a reading list's name and description.
+func ReadingListDocument(list *model.ReadingList) Document {
+	return Document{
+		Kind:  KindReadingList,
+		ID:    list.ID,
+		Title: list.Name,
+		Fields: []Field{
+			{Name: "name", Text: list.Name, Boost: 2},
+			{Name: "description", Text: list.Description},
+		},
+	}
+}
+
+// IndexBooks adds every book in store to idx and returns a store that keeps
+// idx up to date on every successful write.
+//
+// Writes through the returned store, and through every other store wrapped
+// around idx, are serialized so that the index sees them in the order the
+// underlying stores applied them.
+func IndexBooks(store repository.BookStore, idx *Index) repository.BookStore {
+	for _, book := range store.List() {
+		idx.Put(BookDocument(book))
+	}
+	return &bookStore{BookStore: store, idx: idx}
+}
+
+type bookStore struct {
+	repository.BookStore
+	idx *Index
+}
+
+func (s *bookStore) Create(book *model.Book) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.BookStore.Create(book); err != nil {
+		return err
+	}
+	s.idx.Put(BookDocument(book))
+	return nil
+}
+
+func (s *bookStore) Update(book *model.Book) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.BookStore.Update(book); err != nil {
+		return err
+	}
+	s.idx.Put(BookDocument(book))
+	return nil
+}
+
+func (s *bookStore) Delete(id string) error {
+	return s.DeleteIfVersion(id, 0)
+}
+
+func (s *bookStore) DeleteIfVersion(id string, version int64) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.BookStore.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	s.idx.Remove(KindBook, id)
+	return nil
+}
+
+// IndexAuthors is IndexBooks for authors.
+func IndexAuthors(store repository.AuthorStore, idx *Index) repository.AuthorStore {
+	for _, author := range store.List() {
+		idx.Put(AuthorDocument(author))
+	}
+	return &authorStore{AuthorStore: store, idx: idx}
+}
+
+type authorStore struct {
+	repository.AuthorStore
+	idx *Index
+}
+
+func (s *authorStore) Create(author *model.Author) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.AuthorStore.Create(author); err != nil {
+		return err
+	}
+	s.idx.Put(AuthorDocument(author))
+	return nil
+}
+
+func (s *authorStore) Update(author *model.Author) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.AuthorStore.Update(author); err != nil {
+		return err
+	}
+	s.idx.Put(AuthorDocument(author))
+	return nil
+}
+
+func (s *authorStore) Delete(id string) error {
+	return s.DeleteIfVersion(id, 0)
+}
+
+func (s *authorStore) DeleteIfVersion(id string, version int64) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.AuthorStore.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	s.idx.Remove(KindAuthor, id)
+	return nil
+}
+
+// IndexReadingLists is IndexBooks for reading lists. Membership changes
+// do not touch indexed text, so AddMember and RemoveMember pass through.
+func IndexReadingLists(store repository.ReadingListStore, idx *Index) repository.ReadingListStore {
+	for _, list := range store.List() {
+		idx.Put(ReadingListDocument(list))
+	}
+	return &readingListStore{ReadingListStore: store, idx: idx}
+}
+
+type readingListStore struct {
+	repository.ReadingListStore
+	idx *Index
+}
+
+func (s *readingListStore) Create(list *model.ReadingList) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.ReadingListStore.Create(list); err != nil {
+		return err
+	}
+	s.idx.Put(ReadingListDocument(list))
+	return nil
+}
+
+func (s *readingListStore) Update(list *model.ReadingList) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.ReadingListStore.Update(list); err != nil {
+		return err
+	}
+	s.idx.Put(ReadingListDocument(list))
+	return nil
+}
+
+func (s *readingListStore) Delete(id string) error {
+	return s.DeleteIfVersion(id, 0)
+}
+
+func (s *readingListStore) DeleteIfVersion(id string, version int64) error {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	if err := s.ReadingListStore.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	s.idx.Remove(KindReadingList, id)
+	return nil
+}
+
+// IndexRelations returns a relation store that keeps idx up to date with
+// the records a successful delete removed or changed.
+func IndexRelations(store repository.RelationStore, idx *Index) repository.RelationStore {
+	return &relationStore{RelationStore: store, idx: idx}
+}
+
+type relationStore struct {
+	repository.RelationStore
+	idx *Index
+}
+
+func (s *relationStore) DeleteAuthor(id string, version int64, action repository.DeleteAction) (*repository.RelatedChanges, error) {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	changes, err := s.RelationStore.DeleteAuthor(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	s.idx.Remove(KindAuthor, id)
+	s.apply(changes)
+	return changes, nil
+}
+
+func (s *relationStore) DeleteBook(id string, version int64, action repository.DeleteAction) (*repository.RelatedChanges, error) {
+	s.idx.writes.Lock()
+	defer s.idx.writes.Unlock()
+	changes, err := s.RelationStore.DeleteBook(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	s.idx.Remove(KindBook, id)
+	s.apply(changes)
+	return changes, nil
+}
+
+// apply updates the index with the books a delete changed.
+func (s *relationStore) apply(changes *repository.RelatedChanges) {
+	for _, id := range changes.DeletedBooks {
+		s.idx.Remove(KindBook, id)
+	}
+	for _, book := range changes.UpdatedBooks {
+		s.idx.Put(BookDocument(book))
+	}
+}
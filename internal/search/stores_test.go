@@ -0,0 +1,159 @@
+package search
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+func TestIndexBooks(t *testing.T) {
+	repo := repository.NewBookRepository()
+	_ = repo.Create(&model.Book{ID: "b1", Title: "Solaris", ISBN: "1", AuthorID: "a1", Genre: "SF"})
+
+	idx := NewIndex()
+	books := IndexBooks(repo, idx)
+	if hits, _ := idx.Search(Query{Text: "solaris"}); hitIDs(hits) != "b1" {
+		t.Fatalf("Existing book not indexed: %s", hitIDs(hits))
+	}
+
+	book := &model.Book{ID: "b2", Title: "Fiasco", ISBN: "2", AuthorID: "a1", Genre: "SF"}
+	if err := books.Create(book); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	book.Title = "The Invincible"
+	if err := books.Update(book); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if hits, _ := idx.Search(Query{Text: "fiasco"}); len(hits) != 0 {
+		t.Errorf("Old title still indexed")
+	}
+	if hits, _ := idx.Search(Query{Text: "invincible"}); hitIDs(hits) != "b2" {
+		t.Errorf("Updated title not indexed: %s", hitIDs(hits))
+	}
+
+	// Failed writes leave the index alone.
+	if err := books.Create(&model.Book{ID: "b3", Title: "Eden", ISBN: "1"}); err == nil {
+		t.Fatal("Expected duplicate ISBN error")
+	}
+	if hits, _ := idx.Search(Query{Text: "eden"}); len(hits) != 0 {
+		t.Errorf("Rejected book was indexed")
+	}
+
+	if err := books.Delete("b1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if hits, _ := idx.Search(Query{Text: "solaris"}); len(hits) != 0 {
+		t.Errorf("Deleted book still indexed")
+	}
+}
+
+func TestIndexReadingLists(t *testing.T) {
+	idx := NewIndex()
+	lists := IndexReadingLists(repository.NewReadingListRepository(), idx)
+
+	_ = lists.Create(&model.ReadingList{ID: "l1", Name: "Summer", Description: "Beach reads"})
+	if err := lists.AddMember("l1", "b1"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	if hits, _ := idx.Search(Query{Text: "beach", Kind: KindReadingList}); hitIDs(hits) != "l1" {
+		t.Errorf("List not indexed: %s", hitIDs(hits))
+	}
+
+	if err := lists.DeleteIfVersion("l1", 2); err != nil {
+		t.Fatalf("DeleteIfVersion failed: %v", err)
+	}
+	if idx.Len() != 0 {
+		t.Errorf("Len = %d after delete, want 0", idx.Len())
+	}
+}
+
+func TestIndexRelations(t *testing.T) {
+	bookRepo, authorRepo := repository.NewBookRepository(), repository.NewAuthorRepository()
+	_ = authorRepo.Create(&model.Author{ID: "a1", Name: "Stanislaw Lem"})
+	_ = authorRepo.Create(&model.Author{ID: "a2", Name: "Ursula Le Guin"})
+	_ = bookRepo.Create(&model.Book{ID: "b1", Title: "Solaris", ISBN: "1", AuthorID: "a1"})
+	_ = bookRepo.Create(&model.Book{ID: "b2", Title: "Earthsea", ISBN: "2", AuthorID: "a2"})
+
+	idx := NewIndex()
+	IndexBooks(bookRepo, idx)
+	IndexAuthors(authorRepo, idx)
+	relations := IndexRelations(repository.NewRelationRepository(bookRepo, authorRepo, repository.NewReadingListRepository()), idx)
+
+	// Failed deletes leave the index alone.
+	if _, err := relations.DeleteAuthor("a1", 0, repository.DeleteRestrict); err == nil {
+		t.Fatal("Expected restrict error")
+	}
+	if idx.Len() != 4 {
+		t.Errorf("Len = %d after failed delete, want 4", idx.Len())
+	}
+
+	if _, err := relations.DeleteAuthor("a1", 0, repository.DeleteCascade); err != nil {
+		t.Fatalf("DeleteAuthor failed: %v", err)
+	}
+	if hits, _ := idx.Search(Query{Text: "solaris lem"}); len(hits) != 0 {
+		t.Errorf("Deleted author and book still indexed: %s", hitIDs(hits))
+	}
+
+	if _, err := relations.DeleteAuthor("a2", 0, repository.DeleteNullify); err != nil {
+		t.Fatalf("DeleteAuthor failed: %v", err)
+	}
+	if hits, _ := idx.Search(Query{Text: "earthsea"}); hitIDs(hits) != "b2" {
+		t.Errorf("Book of a nullified author not indexed: %s", hitIDs(hits))
+	}
+	if idx.Len() != 1 {
+		t.Errorf("Len = %d, want only b2", idx.Len())
+	}
+}
+
+// slowUpdates pauses after each update it applies, before the wrappers
+// around it update their index.
+type slowUpdates struct {
+	repository.BookStore
+}
+
+func (s slowUpdates) Update(book *model.Book) error {
+	err := s.BookStore.Update(book)
+	time.Sleep(2 * time.Millisecond)
+	return err
+}
+
+func TestIndexRelations_ConcurrentUpdate(t *testing.T) {
+	bookRepo := repository.NewBookRepository()
+	idx, suggester := NewIndex(), NewSuggester()
+	books := SuggestBooks(IndexBooks(slowUpdates{bookRepo}, idx), suggester)
+	relations := repository.NewRelationRepository(bookRepo, repository.NewAuthorRepository(), repository.NewReadingListRepository())
+	deletes := SuggestRelations(IndexRelations(relations, idx), suggester)
+
+	// A delete racing an update must not be undone by the update
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("b%d", i)
+		if err := books.Create(&model.Book{ID: id, Title: "Solaris", ISBN: id}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = books.Update(&model.Book{ID: id, Title: "Fiasco", ISBN: id})
+		}()
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			_, _ = deletes.DeleteBook(id, 0, repository.DeleteCascade)
+		}()
+		wg.Wait()
+	}
+
+	if idx.Len() != bookRepo.Count() {
+		t.Errorf("Index has %d documents for %d books", idx.Len(), bookRepo.Count())
+	}
+	suggester.mu.RLock()
+	defer suggester.mu.RUnlock()
+	if len(suggester.entries) != bookRepo.Count() {
+		t.Errorf("Suggester has %d entries for %d books", len(suggester.entries), bookRepo.Count())
+	}
+}
@@ -0,0 +1,480 @@
+package search
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+)
+
+// SuggestQuery is an autocomplete request. Text is what the user has typed
+// so far; an empty Kind suggests books and authors.
+type SuggestQuery struct {
+	Text  string
+	Kind  string
+	Limit int
+}
+
+// Suggestion is a completion of a suggest query. Popularity is the number
+// of reading lists containing the book, or for an author, their books.
+type Suggestion struct {
+	Kind       string `json:"type"`
+	ID         string `json:"id"`
+	Text       string `json:"text"`
+	Popularity int    `json:"popularity"`
+}
+
+// MaxTypos returns how many typos a suggest query of n letters tolerates:
+// none for one or two letters, one up to five and two beyond that.
+func MaxTypos(n int) int {
+	switch {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+type suggestEntry struct {
+	// slot is the entry's index in Suggester.slots.
+	slot     int
+	kind     string
+	id       string
+	text     string
+	authorID string
+	// folded is the text's terms joined by single spaces; starts holds the
+	// offset of each term in it and words the term itself.
+	folded []rune
+	starts []int
+	words  []*suggestWord
+}
+
+// suggestWord is a distinct term of the indexed names, with the names it
+// occurs in.
+type suggestWord struct {
+	term     string
+	runes    []rune
+	postings []posting
+}
+
+// Suggester completes partial book titles and author names. Completions
+// start at any word of the name, tolerate typos (see MaxTypos), and are
+// ranked by fewest typos, then popularity. It is safe for concurrent use.
+//
+// Names are indexed by word. A query is matched once against each distinct
+// word, and names continuing with the same words share the work of
+// matching them, so common words and titles are cheap.
+type Suggester struct {
+	// writes serializes the writes of the stores wrapped around the
+	// suggester (see SuggestBooks) with their updates of it.
+	writes sync.Mutex
+
+	mu      sync.RWMutex
+	entries map[docKey]*suggestEntry
+	words   map[string]*suggestWord
+	// slots numbers the entries so that queries can track matches in a
+	// slice; free holds the numbers of removed entries for reuse.
+	slots []*suggestEntry
+	free  []int
+	// lists counts the reading lists containing each book.
+	lists map[string]int
+	// books holds the IDs of each author's books.
+	books map[string]map[string]bool
+}
+
+// NewSuggester creates an empty suggester.
+func NewSuggester() *Suggester {
+	return &Suggester{
+		entries: make(map[docKey]*suggestEntry),
+		words:   make(map[string]*suggestWord),
+		lists:   make(map[string]int),
+		books:   make(map[string]map[string]bool),
+	}
+}
+
+// PutBook adds a book or replaces its previous title and author.
+func (s *Suggester) PutBook(book *model.Book) {
+	e := newSuggestEntry(KindBook, book.ID, book.Title)
+	e.authorID = book.AuthorID
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(e)
+	if s.books[book.AuthorID] == nil {
+		s.books[book.AuthorID] = make(map[string]bool)
+	}
+	s.books[book.AuthorID][book.ID] = true
+}
+
+// PutAuthor adds an author or replaces their previous name.
+func (s *Suggester) PutAuthor(author *model.Author) {
+	e := newSuggestEntry(KindAuthor, author.ID, author.Name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(e)
+}
+
+// Remove drops a book or author. Removing an unknown record is a no-op.
+func (s *Suggester) Remove(kind, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(docKey{kind, id})
+	if kind == KindBook {
+		delete(s.lists, id)
+	}
+}
+
+func (s *Suggester) put(e *suggestEntry) {
+	key := docKey{e.kind, e.id}
+	s.remove(key)
+	s.entries[key] = e
+	if n := len(s.free); n > 0 {
+		e.slot, s.free = s.free[n-1], s.free[:n-1]
+		s.slots[e.slot] = e
+	} else {
+		e.slot = len(s.slots)
+		s.slots = append(s.slots, e)
+	}
+
+	for i, w := range e.words {
+		if shared := s.words[w.term]; shared != nil {
+			w = shared
+		} else {
+			s.words[w.term] = w
+		}
+		e.words[i] = w
+		w.postings = append(w.postings, posting{slot: int32(e.slot), word: int32(i)})
+	}
+}
+
+func (s *Suggester) remove(key docKey) {
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	for _, w := range e.words {
+		w.postings = slices.DeleteFunc(w.postings, func(p posting) bool { return int(p.slot) == e.slot })
+		if len(w.postings) == 0 {
+			delete(s.words, w.term)
+		}
+	}
+	if e.kind == KindBook {
+		delete(s.books[e.authorID], e.id)
+		if len(s.books[e.authorID]) == 0 {
+			delete(s.books, e.authorID)
+		}
+	}
+	delete(s.entries, key)
+	s.slots[e.slot] = nil
+	s.free = append(s.free, e.slot)
+}
+
+// SetListCount records how many reading lists contain a book.
+func (s *Suggester) SetListCount(bookID string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n == 0 {
+		delete(s.lists, bookID)
+		return
+	}
+	s.lists[bookID] = n
+}
+
+// Suggest returns up to q.Limit completions of q.Text; a zero Limit
+// returns all of them.
+func (s *Suggester) Suggest(q SuggestQuery) []Suggestion {
+	query := []rune(strings.Join(terms(q.Text), " "))
+	if len(query) == 0 {
+		return []Suggestion{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// typos[slot] is one more than the fewest typos of each name so far,
+	// and word[slot] the word it starts at; matched lists the slots with a
+	// match.
+	typos := make([]int8, len(s.slots))
+	word := make([]int32, len(s.slots))
+	var matched []int32
+	emit := func(p posting, n int) {
+		if q.Kind != "" && s.slots[p.slot].kind != q.Kind {
+			return
+		}
+		switch t := typos[p.slot]; {
+		case t == 0:
+			matched = append(matched, p.slot)
+		case n+1 > int(t) || (n+1 == int(t) && p.word >= word[p.slot]):
+			return
+		}
+		typos[p.slot], word[p.slot] = int8(n+1), p.word
+	}
+
+	m := newPrefixMatcher(query, MaxTypos(len(query)), s.slots)
+	for _, w := range s.words {
+		st := m.start()
+		m.advance(st, w.runes, len(w.runes))
+		if st.done && st.best < 0 {
+			continue
+		}
+		m.extend(0, 1, w.postings, emit)
+	}
+
+	// Keep the best q.Limit matches in order.
+	var top []suggestMatch
+	for _, slot := range matched {
+		match := suggestMatch{entry: s.slots[slot], typos: int(typos[slot]) - 1, word: int(word[slot])}
+		match.popularity = s.popularity(match.entry)
+		i := sort.Search(len(top), func(i int) bool { return match.before(top[i]) })
+		if q.Limit > 0 && i >= q.Limit {
+			continue
+		}
+		top = append(top, suggestMatch{})
+		copy(top[i+1:], top[i:])
+		top[i] = match
+		if q.Limit > 0 && len(top) > q.Limit {
+			top = top[:q.Limit]
+		}
+	}
+
+	out := make([]Suggestion, len(top))
+	for i, match := range top {
+		e := match.entry
+		out[i] = Suggestion{Kind: e.kind, ID: e.id, Text: e.text, Popularity: match.popularity}
+	}
+	return out
+}
+
+func (s *Suggester) popularity(e *suggestEntry) int {
+	if e.kind == KindBook {
+		return s.lists[e.id]
+	}
+	n := 0
+	for id := range s.books[e.id] {
+		n += s.lists[id]
+	}
+	return n
+}
+
+// suggestMatch is a name completing a suggest query.
+type suggestMatch struct {
+	entry      *suggestEntry
+	typos      int
+	popularity int
+	// word is the position of the word the completion starts at.
+	word int
+}
+
+// before reports whether a ranks above b: fewer typos first, then more
+// popular, then completions of the first word, then by name.
+func (a suggestMatch) before(b suggestMatch) bool {
+	switch {
+	case a.typos != b.typos:
+		return a.typos < b.typos
+	case a.popularity != b.popularity:
+		return a.popularity > b.popularity
+	case (a.word == 0) != (b.word == 0):
+		return a.word == 0
+	case a.entry.text != b.entry.text:
+		return a.entry.text < b.entry.text
+	}
+	return a.entry.id < b.entry.id
+}
+
+func newSuggestEntry(kind, id, text string) *suggestEntry {
+	e := &suggestEntry{kind: kind, id: id, text: text}
+	for _, term := range terms(text) {
+		if len(e.folded) > 0 {
+			e.folded = append(e.folded, ' ')
+		}
+		runes := []rune(term)
+		e.starts = append(e.starts, len(e.folded))
+		e.words = append(e.words, &suggestWord{term: term, runes: runes})
+		e.folded = append(e.folded, runes...)
+	}
+	return e
+}
+
+func terms(text string) []string {
+	tokens := Tokenize(text)
+	out := make([]string, len(tokens))
+	for i, tok := range tokens {
+		out[i] = tok.Term
+	}
+	return out
+}
+
+// posting is a completion candidate: the slot of a name and the word it
+// starts at. It holds no pointers, so the long lists of common words cost
+// the garbage collector nothing to scan.
+type posting struct {
+	slot int32
+	word int32
+}
+
+// prefixMatcher finds the smallest edit distance between a query and a
+// prefix of a name, counting an insertion, deletion, substitution or
+// transposition of adjacent letters as one typo. It reuses its buffers, so
+// it must not be shared between goroutines.
+//
+// Distances above maxTypos are capped at maxTypos+1, and only the band of
+// the distance table within maxTypos of the diagonal is computed: cells
+// outside it are always over the limit.
+type prefixMatcher struct {
+	query    []rune
+	maxTypos int
+	slots    []*suggestEntry
+	cur      []int
+	// stack holds the state after each further word of the names being
+	// extended.
+	stack []*prefixState
+}
+
+// prefixState is a position in the distance table: prev2 and prev hold the
+// distances from each query prefix to the name prefixes of length col-1
+// and col.
+type prefixState struct {
+	prev2, prev []int
+	col         int
+	// best is the distance to the closest name prefix so far, or -1 if
+	// none is within maxTypos.
+	best int
+	// done is set once no longer name prefix can be closer.
+	done bool
+}
+
+func newPrefixMatcher(query []rune, maxTypos int, slots []*suggestEntry) *prefixMatcher {
+	return &prefixMatcher{
+		query:    query,
+		maxTypos: maxTypos,
+		slots:    slots,
+		cur:      make([]int, len(query)+1),
+	}
+}
+
+// state returns the reusable state for the given depth.
+func (m *prefixMatcher) state(depth int) *prefixState {
+	for len(m.stack) <= depth {
+		n := len(m.query) + 1
+		m.stack = append(m.stack, &prefixState{prev2: make([]int, n), prev: make([]int, n)})
+	}
+	return m.stack[depth]
+}
+
+// start returns the state at the start of a name, at depth 0.
+func (m *prefixMatcher) start() *prefixState {
+	st := m.state(0)
+	for i := range st.prev {
+		st.prev[i] = min(i, m.maxTypos+1)
+	}
+	st.col, st.best, st.done = 0, -1, false
+	return st
+}
+
+// fork copies the state at depth to depth+1 and returns the copy.
+func (m *prefixMatcher) fork(depth int) *prefixState {
+	from, to := m.state(depth), m.state(depth+1)
+	copy(to.prev2, from.prev2)
+	copy(to.prev, from.prev)
+	to.col, to.best, to.done = from.col, from.best, from.done
+	return to
+}
+
+// extend finishes matching postings whose first next words are matched by
+// the state at depth, and emits each one that is within maxTypos. Postings
+// continuing with the same word are extended together.
+func (m *prefixMatcher) extend(depth, next int, postings []posting, emit func(posting, int)) {
+	st := m.state(depth)
+	switch {
+	case st.done:
+		if st.best >= 0 {
+			for _, p := range postings {
+				emit(p, st.best)
+			}
+		}
+		return
+	case len(postings) == 1:
+		p := postings[0]
+		name := m.name(p)
+		st = m.fork(depth)
+		m.advance(st, name, len(name))
+		if st.best >= 0 {
+			emit(p, st.best)
+		}
+		return
+	}
+
+	groups := make(map[*suggestWord][]posting)
+	for _, p := range postings {
+		e := m.slots[p.slot]
+		if int(p.word)+next >= len(e.words) {
+			if st.best >= 0 {
+				emit(p, st.best)
+			}
+			continue
+		}
+		w := e.words[int(p.word)+next]
+		groups[w] = append(groups[w], p)
+	}
+	for w, group := range groups {
+		// The names in a group share their text up to the end of w.
+		p := group[0]
+		e := m.slots[p.slot]
+		end := e.starts[int(p.word)+next] - e.starts[p.word] + len(w.runes)
+		m.advance(m.fork(depth), m.name(p), end)
+		m.extend(depth+1, next+1, group, emit)
+	}
+}
+
+// name returns the text of p's name from its first word on.
+func (m *prefixMatcher) name(p posting) []rune {
+	e := m.slots[p.slot]
+	return e.folded[e.starts[p.word]:]
+}
+
+// advance extends st over name up to column to.
+func (m *prefixMatcher) advance(st *prefixState, name []rune, to int) {
+	q, k := m.query, m.maxTypos
+	over := k + 1
+	// A prefix longer than the query by more than k letters cannot be
+	// closer than a shorter one.
+	limit := min(to, len(q)+k)
+	for j := st.col + 1; j <= limit && !st.done; j++ {
+		prev2, prev, cur := st.prev2, st.prev, m.cur
+		lo, hi := max(j-k, 1), min(j+k, len(q))
+		cur[lo-1] = over
+		if lo == 1 {
+			cur[0] = min(j, over)
+		}
+		lowest := over
+		for i := lo; i <= hi; i++ {
+			cost := 1
+			if q[i-1] == name[j-1] {
+				cost = 0
+			}
+			d := min(prev[i]+1, cur[i-1]+1, prev[i-1]+cost, over)
+			if i > 1 && j > 1 && q[i-1] == name[j-2] && q[i-2] == name[j-1] {
+				d = min(d, prev2[i-2]+1)
+			}
+			cur[i] = d
+			lowest = min(lowest, d)
+		}
+		if hi < len(q) {
+			// The next column reads this cell as being above it.
+			cur[hi+1] = over
+		} else if d := cur[len(q)]; d <= k && (st.best < 0 || d < st.best) {
+			st.best = d
+		}
+		// Every later column is at least lowest away.
+		st.done = lowest > k || st.best == 0
+		st.prev2, st.prev, m.cur = prev, cur, prev2
+		st.col = j
+	}
+	if st.col >= len(q)+k {
+		st.done = true
+	}
+}
@@ -0,0 +1,240 @@
+package search
+
+import (
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+// SuggestBooks adds every book in store to s and returns a store that keeps
+// s up to date on every successful write.
+func SuggestBooks(store repository.BookStore, s *Suggester) repository.BookStore {
+	for _, book := range store.List() {
+		s.PutBook(book)
+	}
+	return &suggestBookStore{BookStore: store, s: s}
+}
+
+type suggestBookStore struct {
+	repository.BookStore
+	s *Suggester
+}
+
+func (st *suggestBookStore) Create(book *model.Book) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.BookStore.Create(book); err != nil {
+		return err
+	}
+	st.s.PutBook(book)
+	return nil
+}
+
+func (st *suggestBookStore) Update(book *model.Book) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.BookStore.Update(book); err != nil {
+		return err
+	}
+	st.s.PutBook(book)
+	return nil
+}
+
+func (st *suggestBookStore) Delete(id string) error {
+	return st.DeleteIfVersion(id, 0)
+}
+
+func (st *suggestBookStore) DeleteIfVersion(id string, version int64) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.BookStore.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	st.s.Remove(KindBook, id)
+	return nil
+}
+
+// SuggestAuthors is SuggestBooks for authors.
+func SuggestAuthors(store repository.AuthorStore, s *Suggester) repository.AuthorStore {
+	for _, author := range store.List() {
+		s.PutAuthor(author)
+	}
+	return &suggestAuthorStore{AuthorStore: store, s: s}
+}
+
+type suggestAuthorStore struct {
+	repository.AuthorStore
+	s *Suggester
+}
+
+func (st *suggestAuthorStore) Create(author *model.Author) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.AuthorStore.Create(author); err != nil {
+		return err
+	}
+	st.s.PutAuthor(author)
+	return nil
+}
+
+func (st *suggestAuthorStore) Update(author *model.Author) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.AuthorStore.Update(author); err != nil {
+		return err
+	}
+	st.s.PutAuthor(author)
+	return nil
+}
+
+func (st *suggestAuthorStore) Delete(id string) error {
+	return st.DeleteIfVersion(id, 0)
+}
+
+func (st *suggestAuthorStore) DeleteIfVersion(id string, version int64) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.AuthorStore.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	st.s.Remove(KindAuthor, id)
+	return nil
+}
+
+// SuggestReadingLists records in s how many lists in store contain each
+// book, and returns a store that recounts, with FindByBook, the books
+// whose membership a successful write may have changed.
+func SuggestReadingLists(store repository.ReadingListStore, s *Suggester) repository.ReadingListStore {
+	counts := make(map[string]int)
+	for _, list := range store.List() {
+		for _, id := range list.BookIDs {
+			counts[id]++
+		}
+	}
+	for id, n := range counts {
+		s.SetListCount(id, n)
+	}
+	return &suggestReadingListStore{ReadingListStore: store, s: s}
+}
+
+type suggestReadingListStore struct {
+	repository.ReadingListStore
+	s *Suggester
+}
+
+// recount refreshes the list counts of the given books.
+func (st *suggestReadingListStore) recount(bookIDs ...string) {
+	for _, id := range bookIDs {
+		st.s.SetListCount(id, len(st.ReadingListStore.FindByBook(id)))
+	}
+}
+
+// members returns the books of a list before a write, or none if it does
+// not exist.
+func (st *suggestReadingListStore) members(id string) []string {
+	if list, err := st.ReadingListStore.Get(id); err == nil {
+		return list.BookIDs
+	}
+	return nil
+}
+
+func (st *suggestReadingListStore) Create(list *model.ReadingList) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.ReadingListStore.Create(list); err != nil {
+		return err
+	}
+	st.recount(list.BookIDs...)
+	return nil
+}
+
+func (st *suggestReadingListStore) Update(list *model.ReadingList) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	before := st.members(list.ID)
+	if err := st.ReadingListStore.Update(list); err != nil {
+		return err
+	}
+	st.recount(before...)
+	st.recount(list.BookIDs...)
+	return nil
+}
+
+func (st *suggestReadingListStore) Delete(id string) error {
+	return st.DeleteIfVersion(id, 0)
+}
+
+func (st *suggestReadingListStore) DeleteIfVersion(id string, version int64) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	before := st.members(id)
+	if err := st.ReadingListStore.DeleteIfVersion(id, version); err != nil {
+		return err
+	}
+	st.recount(before...)
+	return nil
+}
+
+func (st *suggestReadingListStore) AddMember(listID, bookID string) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.ReadingListStore.AddMember(listID, bookID); err != nil {
+		return err
+	}
+	st.recount(bookID)
+	return nil
+}
+
+func (st *suggestReadingListStore) RemoveMember(listID, bookID string) error {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	if err := st.ReadingListStore.RemoveMember(listID, bookID); err != nil {
+		return err
+	}
+	st.recount(bookID)
+	return nil
+}
+
+// SuggestRelations is IndexRelations for a suggester.
+func SuggestRelations(store repository.RelationStore, s *Suggester) repository.RelationStore {
+	return &suggestRelationStore{RelationStore: store, s: s}
+}
+
+type suggestRelationStore struct {
+	repository.RelationStore
+	s *Suggester
+}
+
+func (st *suggestRelationStore) DeleteAuthor(id string, version int64, action repository.DeleteAction) (*repository.RelatedChanges, error) {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	changes, err := st.RelationStore.DeleteAuthor(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	st.s.Remove(KindAuthor, id)
+	st.apply(changes)
+	return changes, nil
+}
+
+func (st *suggestRelationStore) DeleteBook(id string, version int64, action repository.DeleteAction) (*repository.RelatedChanges, error) {
+	st.s.writes.Lock()
+	defer st.s.writes.Unlock()
+	changes, err := st.RelationStore.DeleteBook(id, version, action)
+	if err != nil {
+		return nil, err
+	}
+	st.s.Remove(KindBook, id)
+	st.apply(changes)
+	return changes, nil
+}
+
+// apply updates the suggester with the books a delete changed. Removing a
+// book also drops its list count.
+func (st *suggestRelationStore) apply(changes *repository.RelatedChanges) {
+	for _, id := range changes.DeletedBooks {
+		st.s.Remove(KindBook, id)
+	}
+	for _, book := range changes.UpdatedBooks {
+		st.s.PutBook(book)
+	}
+}
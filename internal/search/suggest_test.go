@@ -0,0 +1,179 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+func newTestSuggester() *Suggester {
+	s := NewSuggester()
+	s.PutBook(&model.Book{ID: "b1", Title: "The Hobbit", AuthorID: "a1"})
+	s.PutBook(&model.Book{ID: "b2", Title: "The Lord of the Rings", AuthorID: "a1"})
+	s.PutBook(&model.Book{ID: "b3", Title: "Lords and Ladies", AuthorID: "a3"})
+	s.PutBook(&model.Book{ID: "b4", Title: "Solaris", AuthorID: "a2"})
+	s.PutAuthor(&model.Author{ID: "a1", Name: "J. R. R. Tolkien"})
+	s.PutAuthor(&model.Author{ID: "a2", Name: "Stanisław Lem"})
+	s.PutAuthor(&model.Author{ID: "a3", Name: "Terry Pratchett"})
+	return s
+}
+
+func suggestionIDs(suggestions []Suggestion) string {
+	var ids []string
+	for _, s := range suggestions {
+		ids = append(ids, s.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestSuggester_Suggest(t *testing.T) {
+	s := newTestSuggester()
+
+	tests := []struct {
+		name  string
+		query SuggestQuery
+		want  string
+	}{
+		{"prefix", SuggestQuery{Text: "hob"}, "b1"},
+		{"later word", SuggestQuery{Text: "rings"}, "b2"},
+		{"across words", SuggestQuery{Text: "lord of th"}, "b2"},
+		{"one typo", SuggestQuery{Text: "hobbti"}, "b1"},
+		{"two typos", SuggestQuery{Text: "lrod of teh"}, "b2"},
+		{"two typos in a long word", SuggestQuery{Text: "pratchet"}, "a3"},
+		{"diacritics", SuggestQuery{Text: "stanislaw"}, "a2"},
+		{"too many typos", SuggestQuery{Text: "hxbxix"}, ""},
+		{"short queries must match exactly", SuggestQuery{Text: "lx"}, ""},
+		{"kind", SuggestQuery{Text: "lem", Kind: KindBook}, ""},
+		{"limit", SuggestQuery{Text: "lord", Limit: 1}, "b3"},
+		{"no letters", SuggestQuery{Text: " - "}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suggestionIDs(s.Suggest(tt.query)); got != tt.want {
+				t.Errorf("Suggest(%q) = %q, want %q", tt.query.Text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggester_Ranking(t *testing.T) {
+	s := newTestSuggester()
+
+	// Without popularity, title order breaks the tie.
+	if got := suggestionIDs(s.Suggest(SuggestQuery{Text: "lord"})); got != "b3,b2" {
+		t.Errorf("Suggest(lord) = %q, want b3,b2", got)
+	}
+
+	s.SetListCount("b2", 2)
+	got := s.Suggest(SuggestQuery{Text: "lord"})
+	if suggestionIDs(got) != "b2,b3" || got[0].Popularity != 2 {
+		t.Errorf("Suggest(lord) = %+v, want b2 first", got)
+	}
+
+	// Exact completions rank above typos regardless of popularity.
+	s.SetListCount("b1", 5)
+	if got := suggestionIDs(s.Suggest(SuggestQuery{Text: "lords"})); got != "b3,b2" {
+		t.Errorf("Suggest(lords) = %q, want b3,b2", got)
+	}
+
+	// An author is as popular as their books together.
+	authors := s.Suggest(SuggestQuery{Text: "tolkien", Kind: KindAuthor})
+	if len(authors) != 1 || authors[0].Popularity != 7 {
+		t.Errorf("Author popularity = %+v, want 7", authors)
+	}
+
+	// Moving a book to another author moves its popularity with it.
+	s.PutBook(&model.Book{ID: "b1", Title: "The Hobbit", AuthorID: "a2"})
+	if authors := s.Suggest(SuggestQuery{Text: "lem"}); len(authors) != 1 || authors[0].Popularity != 5 {
+		t.Errorf("Author popularity after update = %+v, want 5", authors)
+	}
+
+	s.Remove(KindBook, "b1")
+	if got := s.Suggest(SuggestQuery{Text: "hobbit"}); len(got) != 0 {
+		t.Errorf("Removed book suggested: %+v", got)
+	}
+}
+
+func TestSuggester_SharedWords(t *testing.T) {
+	s := NewSuggester()
+	for i, title := range []string{"The Lord of the Rings", "The Lord of the Flies", "Lord of Light", "The Lady of the Lake"} {
+		s.PutBook(&model.Book{ID: fmt.Sprintf("b%d", i+1), Title: title})
+	}
+
+	tests := map[string]string{
+		"lord of teh r": "b1,b2",
+		"the lord of":   "b2,b1",
+		"lord of l":     "b3,b2,b1",
+		"lady":          "b4",
+		"of the":        "b4,b2,b1",
+	}
+	for text, want := range tests {
+		if got := suggestionIDs(s.Suggest(SuggestQuery{Text: text})); got != want {
+			t.Errorf("Suggest(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	s.Remove(KindBook, "b1")
+	s.PutBook(&model.Book{ID: "b5", Title: "Lords of the Sith"})
+	if got := suggestionIDs(s.Suggest(SuggestQuery{Text: "lord of the"})); got != "b2,b5" {
+		t.Errorf("After remove: Suggest(lord of the) = %q, want b2,b5", got)
+	}
+}
+
+func TestSuggestReadingLists(t *testing.T) {
+	repo := repository.NewReadingListRepository()
+	_ = repo.Create(&model.ReadingList{ID: "l1", Name: "Classics", BookIDs: []string{"b1"}})
+
+	s := newTestSuggester()
+	lists := SuggestReadingLists(repo, s)
+	popularity := func(bookID string) int {
+		for _, sg := range s.Suggest(SuggestQuery{Kind: KindBook, Text: "the"}) {
+			if sg.ID == bookID {
+				return sg.Popularity
+			}
+		}
+		return -1
+	}
+	if got := popularity("b1"); got != 1 {
+		t.Errorf("Existing list not counted: popularity %d", got)
+	}
+
+	_ = lists.Create(&model.ReadingList{ID: "l2", Name: "Fantasy", BookIDs: []string{"b1", "b2"}})
+	if popularity("b1") != 2 || popularity("b2") != 1 {
+		t.Errorf("After Create: b1 %d, b2 %d", popularity("b1"), popularity("b2"))
+	}
+	if err := lists.AddMember("l1", "b2"); err != nil {
+		t.Fatalf("AddMember failed: %v", err)
+	}
+	if err := lists.RemoveMember("l2", "b1"); err != nil {
+		t.Fatalf("RemoveMember failed: %v", err)
+	}
+	if popularity("b1") != 1 || popularity("b2") != 2 {
+		t.Errorf("After membership changes: b1 %d, b2 %d", popularity("b1"), popularity("b2"))
+	}
+	if err := lists.Delete("l1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if popularity("b1") != 0 || popularity("b2") != 1 {
+		t.Errorf("After Delete: b1 %d, b2 %d", popularity("b1"), popularity("b2"))
+	}
+}
+
+func BenchmarkSuggester_Suggest(b *testing.B) {
+	s := NewSuggester()
+	words := []string{"shadow", "river", "garden", "winter", "empire", "stone", "night", "glass", "silver", "harbour"}
+	for i := 0; i < 10000; i++ {
+		title := fmt.Sprintf("The %s of the %s %d", words[i%len(words)], words[(i/len(words))%len(words)], i)
+		s.PutBook(&model.Book{ID: fmt.Sprint(i), Title: title, AuthorID: fmt.Sprint(i % 500)})
+	}
+	for _, text := range []string{"th", "sliver", "sliver harb", "the silver of the harbour"} {
+		b.Run(text, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.Suggest(SuggestQuery{Text: text, Limit: 10})
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	text := "Łódź, Straße & the Café-Noir (2nd ed.)"
+
+	var terms []string
+	for _, tok := range Tokenize(text) {
+		terms = append(terms, tok.Term)
+	}
+	want := []string{"lodz", "strasse", "the", "cafe", "noir", "2nd", "ed"}
+	if !reflect.DeepEqual(terms, want) {
+		t.Errorf("Tokenize terms = %q, want %q", terms, want)
+	}
+
+	first := Tokenize(text)[0]
+	if got := text[first.Start:first.End]; got != "Łódź" {
+		t.Errorf("First token covers %q, want %q", got, "Łódź")
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Go", "go"},
+		{"ŻÓŁW", "zolw"},
+		{"Ærøskøbing", "aeroskobing"},
+		{"Café", "cafe"},  // decomposed é
+		{"ΣΟΦΊΑ", "σοφία"}, // only Latin letters are folded
+	}
+
+	for _, tt := range tests {
+		if got := Fold(tt.in); got != tt.want {
+			t.Errorf("Fold(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
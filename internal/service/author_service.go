@@ -11,16 +11,35 @@ import (
 var (
 	ErrInvalidAuthor  = errors.New("invalid author data")
 	ErrAuthorNotFound = errors.New("author not found")
+	ErrAuthorHasBooks = errors.New("author still has books")
 )
 
 // AuthorService handles business logic for authors.
 type AuthorService struct {
-	repo *repository.AuthorRepository
+	repo       repository.AuthorStore
+	books      *BookService
+	onDelete   DeletePolicy
+	importMode bool
 }
 
 // NewAuthorService creates a new author service.
-func NewAuthorService(repo *repository.AuthorRepository) *AuthorService {
-	return &AuthorService{repo: repo}
+//
+// books are what author deletes apply the delete policy to, through the
+// book service's relation store, and what QueryAuthorBooks reads. Pass nil
+// only where there are no books: deleting an author then leaves books
+// untouched.
+//
+// opts.OnDelete is what deleting an author does to its books when the
+// caller does not choose: DeleteRestrict, the default, rejects the delete
+// with ErrAuthorHasBooks, DeleteCascade deletes the books, removing them
+// from their reading lists, and DeleteNullify clears their author_id.
+func NewAuthorService(repo repository.AuthorStore, books *BookService, opts Options) *AuthorService {
+	return &AuthorService{
+		repo:       repo,
+		books:      books,
+		onDelete:   opts.OnDelete.or(DeleteRestrict),
+		importMode: opts.ImportMode,
+	}
 }
 
 // CreateAuthor validates and creates a new author.
@@ -29,8 +48,17 @@ func (s *AuthorService) CreateAuthor(author *model.Author) error {
 	if err := author.Validate(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidAuthor, err)
 	}
+	if err := assignID(&author.ID, s.importMode); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAuthor, err)
+	}
 
-	return s.repo.Create(author)
+	if err := s.repo.Create(author); err != nil {
+		if errors.Is(err, repository.ErrAuthorExists) {
+			return ErrDuplicateID
+		}
+		return err
+	}
+	return nil
 }
 
 // GetAuthor retrieves an author by ID.
@@ -46,6 +74,8 @@ func (s *AuthorService) GetAuthor(id string) (*model.Author, error) {
 }
 
 // UpdateAuthor validates and updates an existing author.
+// If author.Version is non-zero the update only succeeds while the stored
+// author is at that version; otherwise ErrVersionConflict is returned.
 func (s *AuthorService) UpdateAuthor(author *model.Author) error {
 	if err := author.Validate(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidAuthor, err)
@@ -55,20 +85,48 @@ func (s *AuthorService) UpdateAuthor(author *model.Author) error {
 		if errors.Is(err, repository.ErrAuthorNotFound) {
 			return ErrAuthorNotFound
 		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return ErrVersionConflict
+		}
 		return err
 	}
 	return nil
 }
 
-// DeleteAuthor removes an author by ID.
+// DeleteAuthor removes an author by ID under the configured delete policy.
 func (s *AuthorService) DeleteAuthor(id string) error {
-	if err := s.repo.Delete(id); err != nil {
-		if errors.Is(err, repository.ErrAuthorNotFound) {
-			return ErrAuthorNotFound
-		}
-		return err
+	return s.DeleteAuthorIfVersion(id, 0, "")
+}
+
+// DeleteAuthorIfVersion removes an author by ID if it is still at the given
+// version. A zero version deletes unconditionally. policy overrides the
+// configured delete policy unless it is empty.
+//
+// The version check, the policy and the delete are one write, so a stale
+// or rejected delete changes nothing.
+func (s *AuthorService) DeleteAuthorIfVersion(id string, version int64, policy DeletePolicy) error {
+	if s.books == nil || s.books.relations == nil {
+		return authorDeleteError(s.repo.DeleteIfVersion(id, version))
 	}
-	return nil
+	_, err := s.books.relations.DeleteAuthor(id, version, repository.DeleteAction(policy.or(s.onDelete)))
+	return authorDeleteError(err)
+}
+
+// authorDeleteError maps repository delete errors to service errors.
+func authorDeleteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, repository.ErrAuthorNotFound) {
+		return ErrAuthorNotFound
+	}
+	if errors.Is(err, repository.ErrStillReferenced) {
+		return ErrAuthorHasBooks
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return ErrVersionConflict
+	}
+	return err
 }
 
 // ListAuthors returns all authors.
@@ -76,6 +134,31 @@ func (s *AuthorService) ListAuthors() []*model.Author {
 	return s.repo.List()
 }
 
+// QueryAuthors returns a sorted page of the authors matching q.Filter and
+// the number of matching authors.
+func (s *AuthorService) QueryAuthors(q repository.AuthorQuery) ([]*model.Author, int, error) {
+	authors, total, err := s.repo.Query(q)
+	if err != nil {
+		return nil, 0, queryError(err)
+	}
+	return authors, total, nil
+}
+
+// QueryAuthorBooks returns a sorted page of an author's books and the number
+// of books they wrote, or ErrAuthorNotFound if the author does not exist.
+// Without a book service it finds no books.
+func (s *AuthorService) QueryAuthorBooks(id string, q repository.BookQuery) ([]*model.Book, int, error) {
+	if _, err := s.GetAuthor(id); err != nil {
+		return nil, 0, err
+	}
+	if s.books == nil {
+		return []*model.Book{}, 0, nil
+	}
+
+	q.Filter.AuthorID = id
+	return s.books.QueryBooks(q)
+}
+
 // GetAuthorsByCountry returns all authors from a specific country.
 func (s *AuthorService) GetAuthorsByCountry(country string) []*model.Author {
 	return s.repo.FindByCountry(country)
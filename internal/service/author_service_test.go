@@ -1,15 +1,17 @@
 package service
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
 	"github.com/pawelpaszki/gorts-demo/internal/repository"
+	"github.com/pawelpaszki/gorts-demo/pkg/ulid"
 )
 
 func newTestAuthorService() *AuthorService {
 	repo := repository.NewAuthorRepository()
-	return NewAuthorService(repo)
+	return NewAuthorService(repo, nil, Options{ImportMode: true}) // tests use fixed IDs
 }
 
 func validAuthor(id string) *model.Author {
@@ -138,3 +140,140 @@ func TestAuthorService_GetAuthorsByCountry(t *testing.T) {
 		t.Errorf("Expected 2 authors, got %d", len(authors))
 	}
 }
+
+// referencedAuthorStore is an AuthorStore test double whose deletes fail
+// because the author is still referenced.
+type referencedAuthorStore struct {
+	repository.AuthorStore
+}
+
+func (s *referencedAuthorStore) DeleteIfVersion(id string, version int64) error {
+	return repository.ErrStillReferenced
+}
+
+func TestAuthorService_DeleteAuthor_HasBooks(t *testing.T) {
+	svc := NewAuthorService(&referencedAuthorStore{AuthorStore: repository.NewAuthorRepository()}, nil, Options{})
+
+	if err := svc.DeleteAuthor("author-1"); err != ErrAuthorHasBooks {
+		t.Errorf("Expected ErrAuthorHasBooks, got %v", err)
+	}
+}
+
+func TestAuthorService_CreateAuthor_GeneratesID(t *testing.T) {
+	svc := NewAuthorService(repository.NewAuthorRepository(), nil, Options{})
+
+	author := &model.Author{Name: "Jane Doe"}
+	if err := svc.CreateAuthor(author); err != nil {
+		t.Fatalf("CreateAuthor failed: %v", err)
+	}
+	if len(author.ID) != ulid.Length {
+		t.Errorf("Expected a generated ULID, got %q", author.ID)
+	}
+
+	err := svc.CreateAuthor(&model.Author{ID: "author-1", Name: "John Doe"})
+	if !errors.Is(err, ErrInvalidAuthor) {
+		t.Errorf("Expected ErrInvalidAuthor for client-supplied ID, got %v", err)
+	}
+}
+
+// newTestLibrary returns an author service whose deletes reach books and
+// reading lists under onDelete, with author-1 writing book-1 and book-2,
+// and book-1 in list-1.
+func newTestLibrary(t *testing.T, onDelete DeletePolicy) (*AuthorService, *BookService, repository.ReadingListStore) {
+	t.Helper()
+	authorRepo := repository.NewAuthorRepository()
+	bookRepo := repository.NewBookRepository()
+	lists := repository.NewReadingListRepository()
+	relations := repository.NewRelationRepository(bookRepo, authorRepo, lists)
+	books := NewBookService(bookRepo, authorRepo, lists, relations, Options{ImportMode: true})
+	authors := NewAuthorService(authorRepo, books, Options{ImportMode: true, OnDelete: onDelete})
+
+	if err := authors.CreateAuthor(validAuthor("author-1")); err != nil {
+		t.Fatalf("CreateAuthor failed: %v", err)
+	}
+	for _, id := range []string{"book-1", "book-2"} {
+		if err := books.CreateBook(validBook(id)); err != nil {
+			t.Fatalf("CreateBook failed: %v", err)
+		}
+	}
+	_ = lists.Create(&model.ReadingList{ID: "list-1", Name: "Favourites", BookIDs: []string{"book-1"}})
+	return authors, books, lists
+}
+
+func TestAuthorService_DeleteAuthor_Restrict(t *testing.T) {
+	authors, books, _ := newTestLibrary(t, "")
+
+	if err := authors.DeleteAuthor("author-1"); err != ErrAuthorHasBooks {
+		t.Errorf("Expected ErrAuthorHasBooks, got %v", err)
+	}
+	if books.GetBookCount() != 2 {
+		t.Errorf("Expected 2 books, got %d", books.GetBookCount())
+	}
+}
+
+func TestAuthorService_DeleteAuthor_Cascade(t *testing.T) {
+	authors, books, lists := newTestLibrary(t, "")
+
+	if err := authors.DeleteAuthorIfVersion("author-1", 0, DeleteCascade); err != nil {
+		t.Fatalf("DeleteAuthorIfVersion failed: %v", err)
+	}
+	if books.GetBookCount() != 0 {
+		t.Errorf("Expected books to be deleted, got %d", books.GetBookCount())
+	}
+	if list, _ := lists.Get("list-1"); len(list.BookIDs) != 0 {
+		t.Errorf("Expected deleted books to leave list-1, got %v", list.BookIDs)
+	}
+	if _, err := authors.GetAuthor("author-1"); err != ErrAuthorNotFound {
+		t.Errorf("Expected ErrAuthorNotFound, got %v", err)
+	}
+}
+
+func TestAuthorService_DeleteAuthor_Nullify(t *testing.T) {
+	authors, books, _ := newTestLibrary(t, DeleteNullify)
+
+	if err := authors.DeleteAuthor("author-1"); err != nil {
+		t.Fatalf("DeleteAuthor failed: %v", err)
+	}
+	book, err := books.GetBook("book-1")
+	if err != nil {
+		t.Fatalf("GetBook failed: %v", err)
+	}
+	if book.AuthorID != "" {
+		t.Errorf("AuthorID = %q, want empty", book.AuthorID)
+	}
+}
+
+func TestAuthorService_DeleteAuthor_StaleVersion(t *testing.T) {
+	authors, books, _ := newTestLibrary(t, "")
+
+	for _, policy := range []DeletePolicy{DeleteCascade, DeleteNullify} {
+		if err := authors.DeleteAuthorIfVersion("author-1", 99, policy); err != ErrVersionConflict {
+			t.Errorf("%s: expected ErrVersionConflict, got %v", policy, err)
+		}
+	}
+	if books.GetBookCount() != 2 {
+		t.Errorf("Stale delete removed books: %d left", books.GetBookCount())
+	}
+	if book, _ := books.GetBook("book-1"); book.AuthorID != "author-1" {
+		t.Errorf("Stale delete cleared the author of book-1: %q", book.AuthorID)
+	}
+}
+
+func TestAuthorService_QueryAuthorBooks(t *testing.T) {
+	authors, _, _ := newTestLibrary(t, "")
+
+	books, total, err := authors.QueryAuthorBooks("author-1", repository.BookQuery{
+		Sort:  []repository.SortKey{{Field: "id", Desc: true}},
+		Limit: 1,
+	})
+	if err != nil {
+		t.Fatalf("QueryAuthorBooks failed: %v", err)
+	}
+	if total != 2 || len(books) != 1 || books[0].ID != "book-2" {
+		t.Errorf("QueryAuthorBooks = %d books of %d, want [book-2] of 2", len(books), total)
+	}
+
+	if _, _, err := authors.QueryAuthorBooks("missing", repository.BookQuery{}); err != ErrAuthorNotFound {
+		t.Errorf("Expected ErrAuthorNotFound, got %v", err)
+	}
+}
@@ -3,8 +3,10 @@ package service
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/querylang"
 	"github.com/pawelpaszki/gorts-demo/internal/repository"
 )
 
@@ -12,16 +14,43 @@ var (
 	ErrInvalidBook   = errors.New("invalid book data")
 	ErrBookNotFound  = errors.New("book not found")
 	ErrDuplicateISBN = errors.New("book with this ISBN already exists")
+	ErrBookInLists   = errors.New("book is still in reading lists")
 )
 
 // BookService handles business logic for books.
 type BookService struct {
-	repo *repository.BookRepository
+	repo       repository.BookStore
+	authors    repository.AuthorStore
+	lists      repository.ReadingListStore
+	relations  repository.RelationStore
+	onDelete   DeletePolicy
+	importMode bool
 }
 
 // NewBookService creates a new book service.
-func NewBookService(repo *repository.BookRepository) *BookService {
-	return &BookService{repo: repo}
+//
+// authors are what QueryBooks resolves author: terms against and BookFacets
+// labels author facets with; repo itself checks author_id, in the same
+// write as the book. lists are what QueryBookLists and BookViews read.
+// relations are what book and author deletes go through, so that the
+// delete policy is applied in the same write as the delete. Pass nil only
+// where a store does not exist: without authors, author: queries fail
+// with ErrInvalidQuery; without lists, books are in no lists; without
+// relations, deletes touch nothing else.
+//
+// opts.OnDelete is what deleting a book does to the reading lists that
+// contain it when the caller does not choose: DeleteRestrict rejects the
+// delete with ErrBookInLists, while DeleteCascade, the default, and
+// DeleteNullify both remove the book from the lists.
+func NewBookService(repo repository.BookStore, authors repository.AuthorStore, lists repository.ReadingListStore, relations repository.RelationStore, opts Options) *BookService {
+	return &BookService{
+		repo:       repo,
+		authors:    authors,
+		lists:      lists,
+		relations:  relations,
+		onDelete:   opts.OnDelete.or(DeleteCascade),
+		importMode: opts.ImportMode,
+	}
 }
 
 // CreateBook validates and creates a new book.
@@ -29,16 +58,20 @@ func (s *BookService) CreateBook(book *model.Book) error {
 	if err := book.Validate(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidBook, err)
 	}
-
-	// Check for duplicate ISBN
-	existingBooks := s.repo.List()
-	for _, existing := range existingBooks {
-		if existing.ISBN == book.ISBN {
-			return ErrDuplicateISBN
-		}
+	if err := assignID(&book.ID, s.importMode); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBook, err)
 	}
 
 	if err := s.repo.Create(book); err != nil {
+		if errors.Is(err, repository.ErrBookExists) {
+			return ErrDuplicateID
+		}
+		if errors.Is(err, repository.ErrDuplicateISBN) {
+			return ErrDuplicateISBN
+		}
+		if errors.Is(err, repository.ErrInvalidReference) {
+			return fmt.Errorf("%w: author does not exist", ErrInvalidBook)
+		}
 		return err
 	}
 	return nil
@@ -57,37 +90,62 @@ func (s *BookService) GetBook(id string) (*model.Book, error) {
 }
 
 // UpdateBook validates and updates an existing book.
+// If book.Version is non-zero the update only succeeds while the stored book
+// is at that version; otherwise ErrVersionConflict is returned.
 func (s *BookService) UpdateBook(book *model.Book) error {
 	if err := book.Validate(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidBook, err)
 	}
 
-	// Check ISBN uniqueness (excluding current book)
-	existingBooks := s.repo.List()
-	for _, existing := range existingBooks {
-		if existing.ISBN == book.ISBN && existing.ID != book.ID {
-			return ErrDuplicateISBN
-		}
-	}
-
 	if err := s.repo.Update(book); err != nil {
 		if errors.Is(err, repository.ErrBookNotFound) {
 			return ErrBookNotFound
 		}
+		if errors.Is(err, repository.ErrDuplicateISBN) {
+			return ErrDuplicateISBN
+		}
+		if errors.Is(err, repository.ErrInvalidReference) {
+			return fmt.Errorf("%w: author does not exist", ErrInvalidBook)
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return ErrVersionConflict
+		}
 		return err
 	}
 	return nil
 }
 
-// DeleteBook removes a book by ID.
+// DeleteBook removes a book by ID under the configured delete policy.
 func (s *BookService) DeleteBook(id string) error {
-	if err := s.repo.Delete(id); err != nil {
-		if errors.Is(err, repository.ErrBookNotFound) {
-			return ErrBookNotFound
-		}
-		return err
+	return s.DeleteBookIfVersion(id, 0, "")
+}
+
+// DeleteBookIfVersion removes a book by ID if it is still at the given
+// version. A zero version deletes unconditionally. policy overrides the
+// configured delete policy unless it is empty.
+func (s *BookService) DeleteBookIfVersion(id string, version int64, policy DeletePolicy) error {
+	if s.relations == nil {
+		return bookDeleteError(s.repo.DeleteIfVersion(id, version))
 	}
-	return nil
+	_, err := s.relations.DeleteBook(id, version, repository.DeleteAction(policy.or(s.onDelete)))
+	return bookDeleteError(err)
+}
+
+// bookDeleteError maps repository delete errors to service errors.
+func bookDeleteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, repository.ErrBookNotFound) {
+		return ErrBookNotFound
+	}
+	if errors.Is(err, repository.ErrStillReferenced) {
+		return ErrBookInLists
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return ErrVersionConflict
+	}
+	return err
 }
 
 // ListBooks returns all books.
@@ -95,6 +153,95 @@ func (s *BookService) ListBooks() []*model.Book {
 	return s.repo.List()
 }
 
+// QueryBooks returns a sorted page of the books matching q.Filter and the
+// number of matching books.
+//
+// author: terms in q.Where match authors whose name contains the value,
+// ignoring case.
+func (s *BookService) QueryBooks(q repository.BookQuery) ([]*model.Book, int, error) {
+	q, err := s.resolveAuthors(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	books, total, err := s.repo.Query(q)
+	if err != nil {
+		return nil, 0, queryError(err)
+	}
+	return books, total, nil
+}
+
+// BookFacets counts the values of each named facet over all books matching
+// q, ignoring its sort and paging. Author facets are labelled with the
+// author's name when an author store is set.
+func (s *BookService) BookFacets(q repository.BookQuery, facets []string) (map[string][]model.FacetCount, error) {
+	q, err := s.resolveAuthors(q)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.repo.Facets(q, facets)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	labelAuthors(s.authors, counts)
+	return counts, nil
+}
+
+// resolveAuthors replaces author: terms in q.Where with matching author IDs.
+func (s *BookService) resolveAuthors(q repository.BookQuery) (repository.BookQuery, error) {
+	if q.Where != nil {
+		where, err := querylang.ResolveAuthors(q.Where, s.findAuthorIDs)
+		if err != nil {
+			return q, err
+		}
+		q.Where = where
+	}
+	return q, nil
+}
+
+// findAuthorIDs returns the IDs of the authors whose name contains name.
+func (s *BookService) findAuthorIDs(name string) ([]string, error) {
+	if s.authors == nil {
+		return nil, fmt.Errorf("%w: author: terms are not supported", ErrInvalidQuery)
+	}
+
+	name = strings.ToLower(name)
+	ids := []string{}
+	for _, author := range s.authors.List() {
+		if strings.Contains(strings.ToLower(author.Name), name) {
+			ids = append(ids, author.ID)
+		}
+	}
+	return ids, nil
+}
+
+// QueryBookLists returns a sorted page of the reading lists containing a
+// book and the number of such lists, or ErrBookNotFound if the book does
+// not exist. Without a reading list store it finds no lists.
+func (s *BookService) QueryBookLists(id string, q repository.ReadingListQuery) ([]*model.ReadingList, int, error) {
+	if _, err := s.GetBook(id); err != nil {
+		return nil, 0, err
+	}
+	if s.lists == nil {
+		return []*model.ReadingList{}, 0, nil
+	}
+
+	q.Filter.BookID = id
+	lists, total, err := s.lists.Query(q)
+	if err != nil {
+		return nil, 0, queryError(err)
+	}
+	return lists, total, nil
+}
+
+// BookViews embeds the relations named by inc in books: their author and
+// the reading lists containing them, ordered by ID. Each relation is loaded
+// with one store lookup.
+func (s *BookService) BookViews(books []*model.Book, inc Include) ([]BookView, error) {
+	return bookViews(books, inc, s.authors, s.lists)
+}
+
 // GetBooksByAuthor returns all books by a specific author.
 func (s *BookService) GetBooksByAuthor(authorID string) []*model.Book {
 	return s.repo.FindByAuthor(authorID)
@@ -104,3 +251,16 @@ func (s *BookService) GetBooksByAuthor(authorID string) []*model.Book {
 func (s *BookService) GetBookCount() int {
 	return s.repo.Count()
 }
+
+// labelAuthors sets the label of each author facet count to the author's
+// name. Authors that no longer exist keep an empty label.
+func labelAuthors(authors repository.AuthorStore, counts map[string][]model.FacetCount) {
+	if authors == nil {
+		return
+	}
+	for i, c := range counts[model.FacetAuthor] {
+		if author, err := authors.Get(c.Value); err == nil {
+			counts[model.FacetAuthor][i].Label = author.Name
+		}
+	}
+}
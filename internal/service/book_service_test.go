@@ -1,15 +1,21 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/querylang"
 	"github.com/pawelpaszki/gorts-demo/internal/repository"
+	"github.com/pawelpaszki/gorts-demo/pkg/ulid"
 )
 
 func newTestBookService() *BookService {
 	repo := repository.NewBookRepository()
-	return NewBookService(repo)
+	return NewBookService(repo, nil, nil, nil, Options{ImportMode: true}) // tests use fixed IDs
 }
 
 func validBook(id string) *model.Book {
@@ -65,6 +71,69 @@ func TestBookService_CreateBook_DuplicateISBN(t *testing.T) {
 	}
 }
 
+func TestBookService_CreateBook_ConcurrentDuplicateISBN(t *testing.T) {
+	svc := newTestBookService()
+
+	// Alternate between hyphenated and plain forms of the same ISBN.
+	isbns := []string{"978-0-306-40615-7", "9780306406157"}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	var created, duplicates atomic.Int32
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			book := validBook(fmt.Sprintf("book-%d", i))
+			book.ISBN = isbns[i%len(isbns)]
+			switch err := svc.CreateBook(book); err {
+			case nil:
+				created.Add(1)
+			case ErrDuplicateISBN:
+				duplicates.Add(1)
+			default:
+				t.Errorf("CreateBook failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created.Load() != 1 || duplicates.Load() != writers-1 {
+		t.Errorf("Expected 1 create and %d duplicates, got %d and %d", writers-1, created.Load(), duplicates.Load())
+	}
+}
+
+func TestBookService_CreateBook_GeneratesID(t *testing.T) {
+	svc := NewBookService(repository.NewBookRepository(), nil, nil, nil, Options{})
+
+	first, second := validBook(""), validBook("")
+	second.ISBN = "978-other"
+	if err := svc.CreateBook(first); err != nil {
+		t.Fatalf("CreateBook failed: %v", err)
+	}
+	if err := svc.CreateBook(second); err != nil {
+		t.Fatalf("CreateBook failed: %v", err)
+	}
+	if len(first.ID) != ulid.Length || first.ID >= second.ID {
+		t.Errorf("Expected increasing ULIDs, got %q then %q", first.ID, second.ID)
+	}
+
+	if err := svc.CreateBook(validBook("book-1")); !errors.Is(err, ErrInvalidBook) {
+		t.Errorf("Expected ErrInvalidBook for client-supplied ID, got %v", err)
+	}
+}
+
+func TestBookService_CreateBook_ImportDuplicateID(t *testing.T) {
+	svc := newTestBookService()
+	_ = svc.CreateBook(validBook("book-1"))
+
+	dup := validBook("book-1")
+	dup.ISBN = "978-other"
+	if err := svc.CreateBook(dup); err != ErrDuplicateID {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+}
+
 func TestBookService_GetBook(t *testing.T) {
 	svc := newTestBookService()
 	original := validBook("book-1")
@@ -164,6 +233,101 @@ func TestBookService_ListBooks(t *testing.T) {
 	}
 }
 
+func TestBookService_QueryBooks(t *testing.T) {
+	svc := newTestBookService()
+	for _, id := range []string{"book-1", "book-2", "book-3"} {
+		_ = svc.CreateBook(validBook(id))
+	}
+
+	books, total, err := svc.QueryBooks(repository.BookQuery{
+		Sort:  []repository.SortKey{{Field: "isbn", Desc: true}},
+		Limit: 2,
+	})
+	if err != nil {
+		t.Fatalf("QueryBooks failed: %v", err)
+	}
+	if total != 3 || len(books) != 2 || books[0].ID != "book-3" {
+		t.Errorf("QueryBooks returned %d books (total %d)", len(books), total)
+	}
+
+	_, _, err = svc.QueryBooks(repository.BookQuery{Sort: []repository.SortKey{{Field: "nope"}}})
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+	if want := `invalid query: cannot sort by "nope"`; err == nil || err.Error() != want {
+		t.Errorf("Error = %v, want %q", err, want)
+	}
+}
+
+func TestBookService_QueryBooks_Author(t *testing.T) {
+	authors := repository.NewAuthorRepository()
+	_ = authors.Create(&model.Author{ID: "author-1", Name: "Ursula K. Le Guin"})
+	_ = authors.Create(&model.Author{ID: "author-2", Name: "Stanisław Lem"})
+
+	repo := repository.NewBookRepository()
+	svc := NewBookService(repo, authors, nil, nil, Options{ImportMode: true})
+	for i, authorID := range []string{"author-1", "author-2", "author-1"} {
+		book := validBook(fmt.Sprintf("book-%d", i+1))
+		book.AuthorID = authorID
+		_ = svc.CreateBook(book)
+	}
+
+	where, _ := querylang.Parse(`author:"le guin"`)
+	without := NewBookService(repo, nil, nil, nil, Options{})
+	if _, _, err := without.QueryBooks(repository.BookQuery{Where: where}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Without an author store: expected ErrInvalidQuery, got %v", err)
+	}
+
+	books, total, err := svc.QueryBooks(repository.BookQuery{Where: where})
+	if err != nil {
+		t.Fatalf("QueryBooks failed: %v", err)
+	}
+	if total != 2 || books[0].ID != "book-1" || books[1].ID != "book-3" {
+		t.Errorf("QueryBooks returned %d books (total %d)", len(books), total)
+	}
+
+	where, _ = querylang.Parse(`author:tolkien`)
+	if _, total, _ := svc.QueryBooks(repository.BookQuery{Where: where}); total != 0 {
+		t.Errorf("Unknown author matched %d books", total)
+	}
+}
+
+func TestBookService_BookFacets(t *testing.T) {
+	authors := repository.NewAuthorRepository()
+	_ = authors.Create(&model.Author{ID: "author-1", Name: "Ursula K. Le Guin"})
+
+	svc := NewBookService(repository.NewBookRepository(), authors, nil, nil, Options{ImportMode: true})
+	for i, authorID := range []string{"author-1", "author-2", "author-1"} {
+		book := validBook(fmt.Sprintf("book-%d", i+1))
+		book.AuthorID = authorID
+		// author-2 does not exist, which the facets must cope with
+		_ = svc.repo.Create(book)
+	}
+
+	counts, err := svc.BookFacets(repository.BookQuery{Limit: 1}, []string{model.FacetAuthor})
+	if err != nil {
+		t.Fatalf("BookFacets failed: %v", err)
+	}
+	want := []model.FacetCount{
+		{Value: "author-1", Label: "Ursula K. Le Guin", Count: 2},
+		{Value: "author-2", Count: 1},
+	}
+	got := counts[model.FacetAuthor]
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Author facet = %+v, want %+v", got, want)
+	}
+
+	where, _ := querylang.Parse(`author:"le guin"`)
+	counts, _ = svc.BookFacets(repository.BookQuery{Where: where}, []string{model.FacetAuthor})
+	if got := counts[model.FacetAuthor]; len(got) != 1 || got[0].Count != 2 {
+		t.Errorf("Author facet for author: query = %+v", got)
+	}
+
+	if _, err := svc.BookFacets(repository.BookQuery{}, []string{"colour"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for an unknown facet, got %v", err)
+	}
+}
+
 func TestBookService_GetBooksByAuthor(t *testing.T) {
 	svc := newTestBookService()
 
@@ -184,3 +348,114 @@ func TestBookService_GetBooksByAuthor(t *testing.T) {
 		t.Errorf("Expected 2 books, got %d", len(books))
 	}
 }
+
+// failingBookStore is a BookStore test double whose writes always fail.
+type failingBookStore struct {
+	repository.BookStore
+	err error
+}
+
+func (s *failingBookStore) Create(book *model.Book) error { return s.err }
+
+func (s *failingBookStore) Get(id string) (*model.Book, error) { return nil, s.err }
+
+func TestBookService_CustomStore(t *testing.T) {
+	storeErr := errors.New("store unavailable")
+	svc := NewBookService(&failingBookStore{
+		BookStore: repository.NewBookRepository(),
+		err:       storeErr,
+	}, nil, nil, nil, Options{ImportMode: true})
+
+	if err := svc.CreateBook(validBook("book-1")); !errors.Is(err, storeErr) {
+		t.Errorf("CreateBook error = %v, want %v", err, storeErr)
+	}
+
+	if _, err := svc.GetBook("book-1"); !errors.Is(err, storeErr) {
+		t.Errorf("GetBook error = %v, want %v", err, storeErr)
+	}
+}
+
+func TestBookService_CreateBook_UnknownAuthor(t *testing.T) {
+	svc := NewBookService(&failingBookStore{
+		BookStore: repository.NewBookRepository(),
+		err:       repository.ErrInvalidReference,
+	}, nil, nil, nil, Options{ImportMode: true})
+
+	err := svc.CreateBook(validBook("book-1"))
+	if !errors.Is(err, ErrInvalidBook) {
+		t.Errorf("Expected ErrInvalidBook, got %v", err)
+	}
+}
+
+func TestBookService_CheckAuthor(t *testing.T) {
+	books, authors, _ := repository.NewRepositories()
+	svc := NewBookService(books, authors, nil, nil, Options{ImportMode: true})
+
+	if err := svc.CreateBook(validBook("book-1")); !errors.Is(err, ErrInvalidBook) {
+		t.Errorf("Expected ErrInvalidBook for unknown author, got %v", err)
+	}
+
+	_ = authors.Create(&model.Author{ID: "author-1", Name: "Jane Doe"})
+	book := validBook("book-1")
+	if err := svc.CreateBook(book); err != nil {
+		t.Fatalf("CreateBook failed: %v", err)
+	}
+
+	book.AuthorID = "author-2"
+	if err := svc.UpdateBook(book); !errors.Is(err, ErrInvalidBook) {
+		t.Errorf("Expected ErrInvalidBook for unknown author on update, got %v", err)
+	}
+}
+
+func TestBookService_DeleteBook_Policy(t *testing.T) {
+	repo := repository.NewBookRepository()
+	lists := repository.NewReadingListRepository()
+	relations := repository.NewRelationRepository(repo, repository.NewAuthorRepository(), lists)
+	svc := NewBookService(repo, nil, lists, relations, Options{ImportMode: true})
+	_ = svc.CreateBook(validBook("book-1"))
+	_ = svc.CreateBook(validBook("book-2"))
+	_ = lists.Create(&model.ReadingList{ID: "list-1", Name: "One", BookIDs: []string{"book-1", "book-2"}})
+	_ = lists.Create(&model.ReadingList{ID: "list-2", Name: "Two", BookIDs: []string{"book-1"}})
+
+	if err := svc.DeleteBookIfVersion("book-1", 0, DeleteRestrict); err != ErrBookInLists {
+		t.Errorf("Expected ErrBookInLists, got %v", err)
+	}
+	if _, err := svc.GetBook("book-1"); err != nil {
+		t.Errorf("Restricted delete removed the book: %v", err)
+	}
+
+	if err := svc.DeleteBook("book-1"); err != nil {
+		t.Fatalf("DeleteBook failed: %v", err)
+	}
+	if got := lists.FindByBook("book-1"); len(got) != 0 {
+		t.Errorf("Deleted book is still in %d lists", len(got))
+	}
+	if list, _ := lists.Get("list-1"); len(list.BookIDs) != 1 || list.BookIDs[0] != "book-2" {
+		t.Errorf("list-1 books = %v, want [book-2]", list.BookIDs)
+	}
+
+	svc = NewBookService(repo, nil, lists, relations, Options{OnDelete: DeleteRestrict})
+	if err := svc.DeleteBook("book-2"); err != ErrBookInLists {
+		t.Errorf("Expected ErrBookInLists under the restrict default, got %v", err)
+	}
+}
+
+func TestBookService_QueryBookLists(t *testing.T) {
+	lists := repository.NewReadingListRepository()
+	svc := NewBookService(repository.NewBookRepository(), nil, lists, nil, Options{ImportMode: true})
+	_ = svc.CreateBook(validBook("book-1"))
+	_ = lists.Create(&model.ReadingList{ID: "list-1", Name: "One", BookIDs: []string{"book-1"}})
+	_ = lists.Create(&model.ReadingList{ID: "list-2", Name: "Two"})
+
+	got, total, err := svc.QueryBookLists("book-1", repository.ReadingListQuery{})
+	if err != nil {
+		t.Fatalf("QueryBookLists failed: %v", err)
+	}
+	if total != 1 || len(got) != 1 || got[0].ID != "list-1" {
+		t.Errorf("QueryBookLists = %+v (total %d), want [list-1]", got, total)
+	}
+
+	if _, _, err := svc.QueryBookLists("missing", repository.ReadingListQuery{}); err != ErrBookNotFound {
+		t.Errorf("Expected ErrBookNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidDeletePolicy is returned for an unknown delete policy name.
+var ErrInvalidDeletePolicy = errors.New("invalid delete policy")
+
+// DeletePolicy says what happens to the records that reference a record
+// being deleted. Each policy is the repository.DeleteAction of the same
+// name.
+type DeletePolicy string
+
+const (
+	// DeleteRestrict rejects the delete while anything references the record.
+	DeleteRestrict DeletePolicy = "restrict"
+	// DeleteCascade deletes the referencing records too.
+	DeleteCascade DeletePolicy = "cascade"
+	// DeleteNullify keeps the referencing records but clears the reference.
+	DeleteNullify DeletePolicy = "nullify"
+)
+
+// ParseDeletePolicy parses a policy name. An empty name returns the zero
+// policy, which services read as "use the configured default".
+func ParseDeletePolicy(name string) (DeletePolicy, error) {
+	switch p := DeletePolicy(name); p {
+	case "", DeleteRestrict, DeleteCascade, DeleteNullify:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w %q: want restrict, cascade or nullify", ErrInvalidDeletePolicy, name)
+}
+
+// or returns p, or def if p is the zero policy.
+func (p DeletePolicy) or(def DeletePolicy) DeletePolicy {
+	if p == "" {
+		return def
+	}
+	return p
+}
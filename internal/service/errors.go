@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+var (
+	// ErrVersionConflict is returned by conditional updates and deletes when the
+	// record was changed since the caller read the version it passed in.
+	ErrVersionConflict = errors.New("record was modified by another request")
+
+	// ErrDuplicateID is returned when an imported record reuses an existing ID.
+	ErrDuplicateID = errors.New("a record with this id already exists")
+
+	// ErrInvalidQuery is returned for list queries with unknown sort fields
+	// or invalid filter ranges.
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// queryError maps a repository query error to ErrInvalidQuery, keeping the
+// repository's description of what was wrong.
+func queryError(err error) error {
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		detail := strings.TrimPrefix(err.Error(), repository.ErrInvalidQuery.Error())
+		return fmt.Errorf("%w%s", ErrInvalidQuery, detail)
+	}
+	return err
+}
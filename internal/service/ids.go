@@ -0,0 +1,22 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/pawelpaszki/gorts-demo/pkg/ulid"
+)
+
+var errClientID = errors.New("id is assigned by the server")
+
+// assignID gives a new record a generated ULID. A caller-supplied ID is only
+// accepted in import mode, so that existing data can be loaded with its IDs.
+func assignID(id *string, importMode bool) error {
+	if *id == "" {
+		*id = ulid.New()
+		return nil
+	}
+	if !importMode {
+		return errClientID
+	}
+	return nil
+}
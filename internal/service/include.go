@@ -0,0 +1,179 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+// ErrInvalidInclude is returned for an unknown ?include= relation.
+var ErrInvalidInclude = errors.New("invalid include")
+
+// Relations that can be embedded with ?include=.
+const (
+	IncludeAuthor      = "author"
+	IncludeLists       = "lists"
+	IncludeBooks       = "books"
+	IncludeBooksAuthor = "books.author"
+)
+
+// Include is the set of relations to embed in a response.
+type Include map[string]bool
+
+// ParseBookInclude parses the ?include= value of a book request: a
+// comma-separated list of author and lists.
+func ParseBookInclude(s string) (Include, error) {
+	return parseInclude(s, IncludeAuthor, IncludeLists)
+}
+
+// ParseReadingListInclude parses the ?include= value of a reading list
+// request: books, or books.author, which implies books.
+func ParseReadingListInclude(s string) (Include, error) {
+	inc, err := parseInclude(s, IncludeBooks, IncludeBooksAuthor)
+	if inc[IncludeBooksAuthor] {
+		inc[IncludeBooks] = true
+	}
+	return inc, err
+}
+
+func parseInclude(s string, allowed ...string) (Include, error) {
+	inc := Include{}
+	if s == "" {
+		return inc, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if !contains(allowed, name) {
+			return nil, fmt.Errorf("%w %q: want one of %s", ErrInvalidInclude, name, strings.Join(allowed, ", "))
+		}
+		inc[name] = true
+	}
+	return inc, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// BookView is a book with its included relations. Author is nil if the
+// book has no author; Lists is the reading lists containing the book.
+type BookView struct {
+	*model.Book
+	Author  *model.Author
+	Lists   []*model.ReadingList
+	include Include
+}
+
+// MarshalJSON writes the book's fields followed by "author" and "lists"
+// when they were included.
+func (v BookView) MarshalJSON() ([]byte, error) {
+	out := struct {
+		*model.Book
+		Author **model.Author        `json:"author,omitempty"`
+		Lists  *[]*model.ReadingList `json:"lists,omitempty"`
+	}{Book: v.Book}
+	if v.include[IncludeAuthor] {
+		out.Author = &v.Author
+	}
+	if v.include[IncludeLists] {
+		lists := append([]*model.ReadingList{}, v.Lists...)
+		out.Lists = &lists
+	}
+	return json.Marshal(out)
+}
+
+// ReadingListView is a reading list with its included books, in list
+// order. Books deleted since they were added are left out.
+type ReadingListView struct {
+	*model.ReadingList
+	Books   []BookView
+	include Include
+}
+
+// MarshalJSON writes the list's fields followed by "books" when it was
+// included.
+func (v ReadingListView) MarshalJSON() ([]byte, error) {
+	out := struct {
+		*model.ReadingList
+		Books *[]BookView `json:"books,omitempty"`
+	}{ReadingList: v.ReadingList}
+	if v.include[IncludeBooks] {
+		books := append([]BookView{}, v.Books...)
+		out.Books = &books
+	}
+	return json.Marshal(out)
+}
+
+// bookViews embeds the included relations of books, looking each relation
+// up in one batch.
+func bookViews(books []*model.Book, inc Include, authors repository.AuthorStore, lists repository.ReadingListStore) ([]BookView, error) {
+	views := make([]BookView, len(books))
+	for i, book := range books {
+		views[i] = BookView{Book: book, include: inc}
+	}
+
+	if inc[IncludeAuthor] && authors != nil {
+		ids := make([]string, 0, len(books))
+		for _, book := range books {
+			if book.AuthorID != "" {
+				ids = append(ids, book.AuthorID)
+			}
+		}
+		found, err := authors.GetMany(dedupe(ids))
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[string]*model.Author, len(found))
+		for _, author := range found {
+			byID[author.ID] = author
+		}
+		for i := range views {
+			views[i].Author = byID[views[i].AuthorID]
+		}
+	}
+
+	if inc[IncludeLists] && lists != nil {
+		ids := make([]string, len(books))
+		for i, book := range books {
+			ids[i] = book.ID
+		}
+		found, err := lists.FindByBooks(dedupe(ids))
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+		byBook := make(map[string][]*model.ReadingList)
+		for _, list := range found {
+			for _, id := range list.BookIDs {
+				byBook[id] = append(byBook[id], list)
+			}
+		}
+		for i := range views {
+			views[i].Lists = byBook[views[i].ID]
+		}
+	}
+	return views, nil
+}
+
+// dedupe returns ids without repeats, in first-seen order.
+func dedupe(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+)
+
+func TestParseInclude(t *testing.T) {
+	inc, err := ParseReadingListInclude("books.author")
+	if err != nil {
+		t.Fatalf("ParseReadingListInclude failed: %v", err)
+	}
+	if !inc[IncludeBooks] || !inc[IncludeBooksAuthor] {
+		t.Errorf("books.author should imply books, got %v", inc)
+	}
+
+	if inc, err := ParseBookInclude(""); err != nil || len(inc) != 0 {
+		t.Errorf("ParseBookInclude(\"\") = %v, %v", inc, err)
+	}
+	for _, s := range []string{"books", "author,", "lists.books"} {
+		if _, err := ParseBookInclude(s); !errors.Is(err, ErrInvalidInclude) {
+			t.Errorf("ParseBookInclude(%q): expected ErrInvalidInclude, got %v", s, err)
+		}
+	}
+}
+
+// countingAuthorStore counts single and batch author lookups.
+type countingAuthorStore struct {
+	repository.AuthorStore
+	gets, batches int
+}
+
+func (s *countingAuthorStore) Get(id string) (*model.Author, error) {
+	s.gets++
+	return s.AuthorStore.Get(id)
+}
+
+func (s *countingAuthorStore) GetMany(ids []string) ([]*model.Author, error) {
+	s.batches++
+	return s.AuthorStore.GetMany(ids)
+}
+
+func TestReadingListService_ReadingListViews(t *testing.T) {
+	bookRepo := repository.NewBookRepository()
+	authors := &countingAuthorStore{AuthorStore: repository.NewAuthorRepository()}
+	svc := NewReadingListService(repository.NewReadingListRepository(), bookRepo, authors, Options{})
+
+	_ = authors.Create(&model.Author{ID: "a1", Name: "Frank Herbert"})
+	_ = authors.Create(&model.Author{ID: "a2", Name: "Ursula K. Le Guin"})
+	_ = bookRepo.Create(&model.Book{ID: "b1", Title: "Dune", ISBN: "1", AuthorID: "a1"})
+	_ = bookRepo.Create(&model.Book{ID: "b2", Title: "The Dispossessed", ISBN: "2", AuthorID: "a2"})
+	_ = bookRepo.Create(&model.Book{ID: "b3", Title: "Dune Messiah", ISBN: "3", AuthorID: "a1"})
+	one := &model.ReadingList{ID: "l1", Name: "One", BookIDs: []string{"b3", "b1"}}
+	two := &model.ReadingList{ID: "l2", Name: "Two", BookIDs: []string{"b2", "b1"}}
+
+	views, err := svc.ReadingListViews([]*model.ReadingList{one, two}, Include{IncludeBooks: true, IncludeBooksAuthor: true})
+	if err != nil {
+		t.Fatalf("ReadingListViews failed: %v", err)
+	}
+	if authors.gets != 0 || authors.batches != 1 {
+		t.Errorf("Author lookups: %d single, %d batched; want one batch", authors.gets, authors.batches)
+	}
+
+	var got []struct {
+		ID    string `json:"id"`
+		Books []struct {
+			ID     string `json:"id"`
+			Author struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"books"`
+	}
+	data, _ := json.Marshal(views)
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(got) != 2 || len(got[0].Books) != 2 || got[0].Books[0].ID != "b3" || got[0].Books[1].ID != "b1" {
+		t.Fatalf("Views = %s, want l1 books in list order", data)
+	}
+	if got[1].Books[0].Author.Name != "Ursula K. Le Guin" {
+		t.Errorf("l2 first book author = %q", got[1].Books[0].Author.Name)
+	}
+}
+
+func TestBookService_BookViews(t *testing.T) {
+	authors := repository.NewAuthorRepository()
+	lists := repository.NewReadingListRepository()
+	svc := NewBookService(repository.NewBookRepository(), authors, lists, nil, Options{ImportMode: true})
+
+	_ = authors.Create(&model.Author{ID: "author-1", Name: "Frank Herbert"})
+	_ = svc.CreateBook(validBook("book-1"))
+	_ = svc.CreateBook(validBook("book-2"))
+	_ = lists.Create(&model.ReadingList{ID: "list-2", Name: "Two", BookIDs: []string{"book-1"}})
+	_ = lists.Create(&model.ReadingList{ID: "list-1", Name: "One", BookIDs: []string{"book-1"}})
+	book1, _ := svc.GetBook("book-1")
+	book2, _ := svc.GetBook("book-2")
+
+	views, err := svc.BookViews([]*model.Book{book1, book2}, Include{IncludeAuthor: true, IncludeLists: true})
+	if err != nil {
+		t.Fatalf("BookViews failed: %v", err)
+	}
+	if views[0].Author == nil || views[0].Author.Name != "Frank Herbert" {
+		t.Errorf("book-1 author = %+v", views[0].Author)
+	}
+	var listIDs []string
+	for _, list := range views[0].Lists {
+		listIDs = append(listIDs, list.ID)
+	}
+	if !reflect.DeepEqual(listIDs, []string{"list-1", "list-2"}) {
+		t.Errorf("book-1 lists = %v, want [list-1 list-2]", listIDs)
+	}
+
+	// Included relations are always present, even when empty.
+	var got map[string]json.RawMessage
+	data, _ := json.Marshal(views[1])
+	_ = json.Unmarshal(data, &got)
+	if string(got["lists"]) != "[]" || got["title"] == nil {
+		t.Errorf("book-2 view = %s, want its fields and empty lists", data)
+	}
+
+	var plain map[string]json.RawMessage
+	data, _ = json.Marshal(BookView{Book: book2})
+	if err := json.Unmarshal(data, &plain); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if _, ok := plain["author"]; ok {
+		t.Errorf("Author should be left out when not included: %s", data)
+	}
+}
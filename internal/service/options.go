@@ -0,0 +1,13 @@
+package service
+
+// Options holds the settings the services are created with.
+type Options struct {
+	// ImportMode makes creates accept client-supplied IDs, so that existing
+	// data can be loaded with its IDs. Without it every new record gets a
+	// generated ULID.
+	ImportMode bool
+	// OnDelete is what deleting a record does to the records that reference
+	// it when the caller does not choose. Empty selects the service's
+	// default; reading lists are never referenced and ignore it.
+	OnDelete DeletePolicy
+}
@@ -17,15 +17,21 @@ var (
 
 // ReadingListService handles business logic for reading lists.
 type ReadingListService struct {
-	repo     *repository.ReadingListRepository
-	bookRepo *repository.BookRepository
+	repo       repository.ReadingListStore
+	bookRepo   repository.BookStore
+	authors    repository.AuthorStore
+	importMode bool
 }
 
-// NewReadingListService creates a new reading list service.
-func NewReadingListService(repo *repository.ReadingListRepository, bookRepo *repository.BookRepository) *ReadingListService {
+// NewReadingListService creates a new reading list service. bookRepo holds
+// the books lists refer to, and authors the authors ReadingListViews embeds
+// for books.author; with nil authors books are embedded without them.
+func NewReadingListService(repo repository.ReadingListStore, bookRepo repository.BookStore, authors repository.AuthorStore, opts Options) *ReadingListService {
 	return &ReadingListService{
-		repo:     repo,
-		bookRepo: bookRepo,
+		repo:       repo,
+		bookRepo:   bookRepo,
+		authors:    authors,
+		importMode: opts.ImportMode,
 	}
 }
 
@@ -34,8 +40,17 @@ func (s *ReadingListService) CreateReadingList(list *model.ReadingList) error {
 	if err := list.Validate(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidReadingList, err)
 	}
+	if err := assignID(&list.ID, s.importMode); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReadingList, err)
+	}
 
 	if err := s.repo.Create(list); err != nil {
+		if errors.Is(err, repository.ErrReadingListExists) {
+			return ErrDuplicateID
+		}
+		if errors.Is(err, repository.ErrInvalidReference) {
+			return fmt.Errorf("%w: book does not exist", ErrInvalidReadingList)
+		}
 		return err
 	}
 	return nil
@@ -54,6 +69,8 @@ func (s *ReadingListService) GetReadingList(id string) (*model.ReadingList, erro
 }
 
 // UpdateReadingList validates and updates an existing reading list.
+// If list.Version is non-zero the update only succeeds while the stored list
+// is at that version; otherwise ErrVersionConflict is returned.
 func (s *ReadingListService) UpdateReadingList(list *model.ReadingList) error {
 	if err := list.Validate(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidReadingList, err)
@@ -63,6 +80,12 @@ func (s *ReadingListService) UpdateReadingList(list *model.ReadingList) error {
 		if errors.Is(err, repository.ErrReadingListNotFound) {
 			return ErrReadingListNotFound
 		}
+		if errors.Is(err, repository.ErrInvalidReference) {
+			return fmt.Errorf("%w: book does not exist", ErrInvalidReadingList)
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return ErrVersionConflict
+		}
 		return err
 	}
 	return nil
@@ -70,13 +93,27 @@ func (s *ReadingListService) UpdateReadingList(list *model.ReadingList) error {
 
 // DeleteReadingList removes a reading list by ID.
 func (s *ReadingListService) DeleteReadingList(id string) error {
-	if err := s.repo.Delete(id); err != nil {
-		if errors.Is(err, repository.ErrReadingListNotFound) {
-			return ErrReadingListNotFound
-		}
-		return err
+	return readingListDeleteError(s.repo.Delete(id))
+}
+
+// DeleteReadingListIfVersion removes a reading list by ID if it is still at the given
+// version. A zero version deletes unconditionally.
+func (s *ReadingListService) DeleteReadingListIfVersion(id string, version int64) error {
+	return readingListDeleteError(s.repo.DeleteIfVersion(id, version))
+}
+
+// readingListDeleteError maps repository delete errors to service errors.
+func readingListDeleteError(err error) error {
+	if err == nil {
+		return nil
 	}
-	return nil
+	if errors.Is(err, repository.ErrReadingListNotFound) {
+		return ErrReadingListNotFound
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return ErrVersionConflict
+	}
+	return err
 }
 
 // ListReadingLists returns all reading lists.
@@ -84,46 +121,119 @@ func (s *ReadingListService) ListReadingLists() []*model.ReadingList {
 	return s.repo.List()
 }
 
+// QueryReadingLists returns a sorted page of the reading lists matching
+// q.Filter and the number of matching lists.
+func (s *ReadingListService) QueryReadingLists(q repository.ReadingListQuery) ([]*model.ReadingList, int, error) {
+	lists, total, err := s.repo.Query(q)
+	if err != nil {
+		return nil, 0, queryError(err)
+	}
+	return lists, total, nil
+}
+
 // AddBookToList adds a book to a reading list.
 func (s *ReadingListService) AddBookToList(listID, bookID string) error {
-	// Verify book exists
-	if _, err := s.bookRepo.Get(bookID); err != nil {
-		if errors.Is(err, repository.ErrBookNotFound) {
+	if err := s.repo.AddMember(listID, bookID); err != nil {
+		if errors.Is(err, repository.ErrReadingListNotFound) {
+			return ErrReadingListNotFound
+		}
+		if errors.Is(err, repository.ErrAlreadyMember) {
+			return ErrBookAlreadyInList
+		}
+		if errors.Is(err, repository.ErrInvalidReference) {
 			return ErrBookNotFound
 		}
 		return err
 	}
+	return nil
+}
 
-	list, err := s.repo.Get(listID)
-	if err != nil {
+// RemoveBookFromList removes a book from a reading list.
+func (s *ReadingListService) RemoveBookFromList(listID, bookID string) error {
+	if err := s.repo.RemoveMember(listID, bookID); err != nil {
 		if errors.Is(err, repository.ErrReadingListNotFound) {
 			return ErrReadingListNotFound
 		}
+		if errors.Is(err, repository.ErrNotMember) {
+			return ErrBookNotInList
+		}
 		return err
 	}
+	return nil
+}
 
-	if !list.AddBook(bookID) {
-		return ErrBookAlreadyInList
+// ListBooks returns limit of a reading list's books in list order, starting
+// at offset, and the number of books in the list, or ErrReadingListNotFound
+// if the list does not exist. A zero limit returns every book from offset
+// on. Books deleted since they were added are neither returned nor counted.
+func (s *ReadingListService) ListBooks(listID string, offset, limit int) ([]*model.Book, int, error) {
+	list, err := s.GetReadingList(listID)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return s.repo.Update(list)
-}
-
-// RemoveBookFromList removes a book from a reading list.
-func (s *ReadingListService) RemoveBookFromList(listID, bookID string) error {
-	list, err := s.repo.Get(listID)
+	found, err := s.bookRepo.GetMany(dedupe(list.BookIDs))
 	if err != nil {
-		if errors.Is(err, repository.ErrReadingListNotFound) {
-			return ErrReadingListNotFound
+		return nil, 0, err
+	}
+	byID := make(map[string]*model.Book, len(found))
+	for _, book := range found {
+		byID[book.ID] = book
+	}
+	books := make([]*model.Book, 0, len(found))
+	for _, id := range list.BookIDs {
+		if book, ok := byID[id]; ok {
+			books = append(books, book)
 		}
-		return err
 	}
 
-	if !list.RemoveBook(bookID) {
-		return ErrBookNotInList
+	total := len(books)
+	books = books[min(offset, total):]
+	if limit > 0 && limit < len(books) {
+		books = books[:limit]
 	}
+	return books, total, nil
+}
 
-	return s.repo.Update(list)
+// ReadingListViews embeds the relations named by inc in lists: their books
+// and, for books.author, each book's author. Each relation is loaded with
+// one store lookup however many lists there are.
+func (s *ReadingListService) ReadingListViews(lists []*model.ReadingList, inc Include) ([]ReadingListView, error) {
+	views := make([]ReadingListView, len(lists))
+	for i, list := range lists {
+		views[i] = ReadingListView{ReadingList: list, include: inc}
+	}
+	if !inc[IncludeBooks] {
+		return views, nil
+	}
+
+	var ids []string
+	for _, list := range lists {
+		ids = append(ids, list.BookIDs...)
+	}
+	books, err := s.bookRepo.GetMany(dedupe(ids))
+	if err != nil {
+		return nil, err
+	}
+	bookInclude := Include{IncludeAuthor: inc[IncludeBooksAuthor]}
+	bookViews, err := bookViews(books, bookInclude, s.authors, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]BookView, len(bookViews))
+	for _, view := range bookViews {
+		byID[view.ID] = view
+	}
+	for i, list := range lists {
+		views[i].Books = make([]BookView, 0, len(list.BookIDs))
+		for _, id := range list.BookIDs {
+			if view, ok := byID[id]; ok {
+				views[i].Books = append(views[i].Books, view)
+			}
+		}
+	}
+	return views, nil
 }
 
 // GetListsContainingBook returns all lists that contain a specific book.
@@ -1,6 +1,9 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/pawelpaszki/gorts-demo/internal/model"
@@ -8,9 +11,12 @@ import (
 )
 
 func newTestReadingListService() (*ReadingListService, *repository.BookRepository) {
-	listRepo := repository.NewReadingListRepository()
-	bookRepo := repository.NewBookRepository()
-	return NewReadingListService(listRepo, bookRepo), bookRepo
+	bookRepo, authors, listRepo := repository.NewRepositories()
+	// the authors the test books are written by
+	_ = authors.Create(&model.Author{ID: "a", Name: "A"})
+	_ = authors.Create(&model.Author{ID: "author-1", Name: "Jane Doe"})
+	svc := NewReadingListService(listRepo, bookRepo, nil, Options{ImportMode: true}) // tests use fixed IDs
+	return svc, bookRepo
 }
 
 func validReadingList(id string) *model.ReadingList {
@@ -201,3 +207,105 @@ func TestReadingListService_GetListsContainingBook(t *testing.T) {
 		t.Errorf("Expected 2 lists containing book-1, got %d", len(lists))
 	}
 }
+
+func TestReadingListService_ConcurrentAddBookToList(t *testing.T) {
+	svc, bookRepo := newTestReadingListService()
+	_ = svc.CreateReadingList(validReadingList("list-1"))
+
+	const books = 50
+	for i := 0; i < books; i++ {
+		_ = bookRepo.Create(validBook(fmt.Sprintf("book-%d", i)))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < books; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := svc.AddBookToList("list-1", fmt.Sprintf("book-%d", i)); err != nil {
+				t.Errorf("AddBookToList failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	list, _ := svc.GetReadingList("list-1")
+	if len(list.BookIDs) != books {
+		t.Errorf("Expected %d books in list, got %d", books, len(list.BookIDs))
+	}
+}
+
+func TestReadingListService_CreateReadingList_UnknownBook(t *testing.T) {
+	svc, bookRepo := newTestReadingListService()
+	_ = bookRepo.Create(&model.Book{ID: "book-1", Title: "Book 1", ISBN: "1", AuthorID: "a"})
+
+	list := validReadingList("list-1")
+	list.BookIDs = []string{"book-1", "book-2"}
+	if err := svc.CreateReadingList(list); !errors.Is(err, ErrInvalidReadingList) {
+		t.Errorf("Expected ErrInvalidReadingList, got %v", err)
+	}
+
+	list.BookIDs = []string{"book-1"}
+	if err := svc.CreateReadingList(list); err != nil {
+		t.Fatalf("CreateReadingList failed: %v", err)
+	}
+	list.BookIDs = append(list.BookIDs, "book-3")
+	if err := svc.UpdateReadingList(list); !errors.Is(err, ErrInvalidReadingList) {
+		t.Errorf("Expected ErrInvalidReadingList on update, got %v", err)
+	}
+}
+
+func TestReadingListService_ListBooks(t *testing.T) {
+	svc, bookRepo := newTestReadingListService()
+	for _, id := range []string{"book-1", "book-2", "book-3"} {
+		_ = bookRepo.Create(&model.Book{ID: id, Title: id, ISBN: id, AuthorID: "a"})
+	}
+	list := validReadingList("list-1")
+	list.BookIDs = []string{"book-3", "book-1", "book-2"}
+	_ = svc.CreateReadingList(list)
+
+	books, total, err := svc.ListBooks("list-1", 1, 1)
+	if err != nil {
+		t.Fatalf("ListBooks failed: %v", err)
+	}
+	if total != 3 || len(books) != 1 || books[0].ID != "book-1" {
+		t.Errorf("ListBooks(1, 1) = %d books of %d, want [book-1] of 3", len(books), total)
+	}
+
+	if books, _, _ := svc.ListBooks("list-1", 5, 0); len(books) != 0 {
+		t.Errorf("Expected no books past the end, got %d", len(books))
+	}
+	if _, _, err := svc.ListBooks("missing", 0, 0); err != ErrReadingListNotFound {
+		t.Errorf("Expected ErrReadingListNotFound, got %v", err)
+	}
+
+	// A deleted book is neither returned nor counted, and does not shift pages
+	_ = bookRepo.Delete("book-3")
+	books, total, err = svc.ListBooks("list-1", 0, 1)
+	if err != nil {
+		t.Fatalf("ListBooks failed: %v", err)
+	}
+	if total != 2 || len(books) != 1 || books[0].ID != "book-1" {
+		t.Errorf("ListBooks(0, 1) after delete = %d books of %d, want [book-1] of 2", len(books), total)
+	}
+}
+
+func TestReadingListService_DuplicateBooks(t *testing.T) {
+	svc, bookRepo := newTestReadingListService()
+	_ = bookRepo.Create(&model.Book{ID: "book-1", Title: "Book 1", ISBN: "1", AuthorID: "a"})
+
+	list := validReadingList("list-1")
+	list.BookIDs = []string{"book-1", "book-1"}
+	if err := svc.CreateReadingList(list); !errors.Is(err, ErrInvalidReadingList) {
+		t.Errorf("Expected ErrInvalidReadingList, got %v", err)
+	}
+
+	list.BookIDs = []string{"book-1"}
+	if err := svc.CreateReadingList(list); err != nil {
+		t.Fatalf("CreateReadingList failed: %v", err)
+	}
+	list.BookIDs = []string{"book-1", "book-1"}
+	if err := svc.UpdateReadingList(list); !errors.Is(err, ErrInvalidReadingList) {
+		t.Errorf("Expected ErrInvalidReadingList on update, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/model"
+	"github.com/pawelpaszki/gorts-demo/internal/repository"
+	"github.com/pawelpaszki/gorts-demo/internal/search"
+)
+
+// SearchService runs full-text queries against the search index.
+type SearchService struct {
+	index   *search.Index
+	authors repository.AuthorStore
+}
+
+// NewSearchService creates a new search service. authors are the names
+// Facets labels author facets with; with nil authors facets keep their IDs.
+func NewSearchService(index *search.Index, authors repository.AuthorStore) *SearchService {
+	return &SearchService{index: index, authors: authors}
+}
+
+// Search returns a page of hits for q and the total number of hits.
+// It returns ErrInvalidQuery if q has no search terms or an unknown kind.
+func (s *SearchService) Search(q search.Query) ([]search.Hit, int, error) {
+	if err := checkSearch(q); err != nil {
+		return nil, 0, err
+	}
+
+	hits, total := s.index.Search(q)
+	return hits, total, nil
+}
+
+// Facets counts book facet values over all hits for q, ignoring its
+// paging. Only books have facets; other hits are not counted.
+func (s *SearchService) Facets(q search.Query, facets []string) (map[string][]model.FacetCount, error) {
+	if err := checkSearch(q); err != nil {
+		return nil, err
+	}
+	for _, f := range facets {
+		if !model.IsBookFacet(f) {
+			return nil, fmt.Errorf("%w: unknown facet %q", ErrInvalidQuery, f)
+		}
+	}
+
+	counts := s.index.Facets(q, facets)
+	labelAuthors(s.authors, counts)
+	return counts, nil
+}
+
+func checkSearch(q search.Query) error {
+	if len(search.Tokenize(q.Text)) == 0 {
+		return fmt.Errorf("%w: q must contain a word to search for", ErrInvalidQuery)
+	}
+	switch q.Kind {
+	case "", search.KindBook, search.KindAuthor, search.KindReadingList:
+	default:
+		return fmt.Errorf("%w: type must be one of %s", ErrInvalidQuery,
+			strings.Join([]string{search.KindBook, search.KindAuthor, search.KindReadingList}, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pawelpaszki/gorts-demo/internal/search"
+)
+
+// SuggestService completes partial book titles and author names.
+type SuggestService struct {
+	suggester *search.Suggester
+}
+
+// NewSuggestService creates a new suggest service.
+func NewSuggestService(suggester *search.Suggester) *SuggestService {
+	return &SuggestService{suggester: suggester}
+}
+
+// Suggest returns the top completions of q.Text. It returns ErrInvalidQuery
+// if q.Text has no letters or digits or q.Kind is not a book or author.
+func (s *SuggestService) Suggest(q search.SuggestQuery) ([]search.Suggestion, error) {
+	if len(search.Tokenize(q.Text)) == 0 {
+		return nil, fmt.Errorf("%w: q must contain a word to complete", ErrInvalidQuery)
+	}
+	switch q.Kind {
+	case "", search.KindBook, search.KindAuthor:
+	default:
+		return nil, fmt.Errorf("%w: type must be one of %s", ErrInvalidQuery,
+			strings.Join([]string{search.KindBook, search.KindAuthor}, ", "))
+	}
+	return s.suggester.Suggest(q), nil
+}
@@ -0,0 +1,139 @@
+// Package ulid generates ULIDs: 128-bit identifiers made of a 48-bit
+// millisecond timestamp followed by 80 random bits, encoded as 26 characters
+// of Crockford base32 so that their string order is their creation order.
+package ulid
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Length is the number of characters in an encoded ULID.
+const Length = 26
+
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ErrInvalid = errors.New("invalid ULID")
+
+// decoding maps an upper-case alphabet character to its value, or 0xFF.
+var decoding = func() [256]byte {
+	var d [256]byte
+	for i := range d {
+		d[i] = 0xFF
+	}
+	for i := 0; i < len(alphabet); i++ {
+		d[alphabet[i]] = byte(i)
+	}
+	return d
+}()
+
+// Generator produces monotonically increasing ULIDs. IDs generated within
+// the same millisecond, or while the clock runs backwards, reuse the last
+// timestamp and increment the random part, so they still sort in order.
+type Generator struct {
+	mu      sync.Mutex
+	entropy io.Reader
+	lastMs  uint64
+	last    [10]byte
+}
+
+// NewGenerator creates a generator that draws randomness from entropy.
+func NewGenerator(entropy io.Reader) *Generator {
+	return &Generator{entropy: entropy}
+}
+
+// Make returns a new ULID for time t.
+func (g *Generator) Make(t time.Time) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(t.UnixMilli())
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		if !increment(&g.last) {
+			// The random part overflowed; move on to the next millisecond.
+			ms++
+			if _, err := io.ReadFull(g.entropy, g.last[:]); err != nil {
+				return "", err
+			}
+		}
+	} else if _, err := io.ReadFull(g.entropy, g.last[:]); err != nil {
+		return "", err
+	}
+	g.lastMs = ms
+
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(id[6:], g.last[:])
+	return encode(id), nil
+}
+
+var defaultGenerator = NewGenerator(rand.Reader)
+
+// New returns a new ULID for the current time.
+// It panics if the system random source fails.
+func New() string {
+	id, err := defaultGenerator.Make(time.Now())
+	if err != nil {
+		panic("ulid: reading random source: " + err.Error())
+	}
+	return id
+}
+
+// Time returns the timestamp encoded in a ULID.
+func Time(id string) (time.Time, error) {
+	if len(id) != Length || decoding[id[0]] > 7 {
+		return time.Time{}, ErrInvalid
+	}
+
+	var ms uint64
+	for i := 0; i < 10; i++ {
+		v := decoding[id[i]]
+		if v == 0xFF {
+			return time.Time{}, ErrInvalid
+		}
+		ms = ms<<5 | uint64(v)
+	}
+	for i := 10; i < Length; i++ {
+		if decoding[id[i]] == 0xFF {
+			return time.Time{}, ErrInvalid
+		}
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// increment adds one to b as a big-endian integer and reports false if it
+// wrapped around to zero.
+func increment(b *[10]byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes the 128 bits of id as 26 base32 characters, most
+// significant first; the leading character carries only 3 bits.
+func encode(id [16]byte) string {
+	var out [Length]byte
+	var acc uint32
+	bits := 2 // 26*5 = 130 bits, so the value is padded with two leading zero bits
+	i := 0
+	for _, b := range id {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[i] = alphabet[(acc>>uint(bits))&0x1F]
+			i++
+		}
+	}
+	return string(out[:])
+}
@@ -0,0 +1,103 @@
+package ulid
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	id := New()
+	if len(id) != Length {
+		t.Fatalf("len(%q) = %d, want %d", id, len(id), Length)
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(alphabet, c) {
+			t.Errorf("ID %q contains %q, which is not in the Crockford alphabet", id, c)
+		}
+	}
+}
+
+func TestGenerator_Make_KnownValue(t *testing.T) {
+	g := NewGenerator(bytes.NewReader(make([]byte, 10)))
+
+	id, err := g.Make(time.UnixMilli(1))
+	if err != nil {
+		t.Fatalf("Make failed: %v", err)
+	}
+	if want := "00000000010000000000000000"; id != want {
+		t.Errorf("Make = %q, want %q", id, want)
+	}
+}
+
+func TestGenerator_Make_Monotonic(t *testing.T) {
+	g := NewGenerator(rand.Reader)
+	now := time.Now()
+
+	ids := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		// Repeat timestamps and step the clock backwards now and then.
+		ts := now.Add(time.Duration(i/10-i%3) * time.Millisecond)
+		id, err := g.Make(ts)
+		if err != nil {
+			t.Fatalf("Make failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if !sort.StringsAreSorted(ids) {
+		t.Error("IDs should sort in generation order")
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("Duplicate ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestGenerator_Make_EntropyError(t *testing.T) {
+	g := NewGenerator(bytes.NewReader(nil))
+	if _, err := g.Make(time.Now()); err == nil {
+		t.Error("Expected error when entropy is exhausted")
+	}
+}
+
+func TestTime(t *testing.T) {
+	want := time.UnixMilli(1700000000123)
+	id, _ := NewGenerator(rand.Reader).Make(want)
+
+	got, err := Time(id)
+	if err != nil {
+		t.Fatalf("Time failed: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("Time = %v, want %v", got, want)
+	}
+}
+
+func TestTime_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"empty", ""},
+		{"too short", "0000000001"},
+		{"invalid character", "0000000001000000000000000U"},
+		{"timestamp overflow", "80000000000000000000000000"},
+		{"lowercase", "0000000001000000000000000a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Time(tt.id); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Time(%q) error = %v, want ErrInvalid", tt.id, err)
+			}
+		})
+	}
+}
@@ -99,6 +99,28 @@ func TestISBN_WithHyphens(t *testing.T) {
 	}
 }
 
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		name string
+		isbn string
+		want string
+	}{
+		{"already normalized", "9780306406157", "9780306406157"},
+		{"hyphenated ISBN-13", "978-0-306-40615-7", "9780306406157"},
+		{"spaces", "978 0 306 40615 7", "9780306406157"},
+		{"lowercase x", "0-8044-2957-x", "080442957X"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeISBN(tt.isbn); got != tt.want {
+				t.Errorf("NormalizeISBN(%q) = %q, want %q", tt.isbn, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsValidISBN10(t *testing.T) {
 	tests := []struct {
 		isbn string
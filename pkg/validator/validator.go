@@ -4,6 +4,7 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -82,6 +83,18 @@ func ISBN(value string) error {
 	return ErrInvalidISBN
 }
 
+// NormalizeISBN returns the canonical form of an ISBN used for comparison:
+// hyphens and whitespace are removed and a trailing x is upper-cased, so
+// "0-8044-2957-x" and "080442957X" normalize to the same key.
+func NormalizeISBN(value string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, value))
+}
+
 // isValidISBN10 checks ISBN-10 checksum.
 func isValidISBN10(isbn string) bool {
 	if len(isbn) != 10 {
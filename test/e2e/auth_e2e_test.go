@@ -26,7 +26,7 @@ func NewTestServerWithAuth() *TestServerWithAuth {
 	bookRepo := repository.NewBookRepository()
 
 	// Create services
-	bookService := service.NewBookService(bookRepo)
+	bookService := service.NewBookService(bookRepo, nil, nil, nil, service.Options{ImportMode: true})
 
 	// Create handlers
 	bookHandler := handler.NewBookHandler(bookService)
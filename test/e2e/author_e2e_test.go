@@ -27,7 +27,7 @@ func NewTestServerWithAuthors() *TestServerWithAuthors {
 	authorRepo := repository.NewAuthorRepository()
 
 	// Create services
-	authorService := service.NewAuthorService(authorRepo)
+	authorService := service.NewAuthorService(authorRepo, nil, service.Options{ImportMode: true})
 
 	// Create handlers
 	authorHandler := handler.NewAuthorHandler(authorService)
@@ -24,13 +24,11 @@ type TestServerWithReadingLists struct {
 // NewTestServerWithReadingLists creates a test server with reading list support.
 func NewTestServerWithReadingLists() *TestServerWithReadingLists {
 	// Create repositories
-	bookRepo := repository.NewBookRepository()
-	authorRepo := repository.NewAuthorRepository()
-	readingListRepo := repository.NewReadingListRepository()
+	bookRepo, authorRepo, readingListRepo := repository.NewRepositories()
 
 	// Create services
-	bookService := service.NewBookService(bookRepo)
-	readingListService := service.NewReadingListService(readingListRepo, bookRepo)
+	bookService := service.NewBookService(bookRepo, nil, nil, nil, service.Options{ImportMode: true})
+	readingListService := service.NewReadingListService(readingListRepo, bookRepo, nil, service.Options{ImportMode: true})
 
 	// Create handlers
 	bookHandler := handler.NewBookHandler(bookService)
@@ -144,6 +142,8 @@ func TestE2E_ReadingList_AddRemoveBooks(t *testing.T) {
 	baseURL := ts.URL()
 
 	// Create books first
+	_ = ts.AuthorRepo.Create(&model.Author{ID: "author-1", Name: "Author One"})
+	_ = ts.AuthorRepo.Create(&model.Author{ID: "author-2", Name: "Author Two"})
 	books := []map[string]interface{}{
 		{"id": "book-1", "title": "Book One", "isbn": "isbn-1", "author_id": "author-1"},
 		{"id": "book-2", "title": "Book Two", "isbn": "isbn-2", "author_id": "author-1"},
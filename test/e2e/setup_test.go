@@ -26,7 +26,7 @@ func NewTestServer() *TestServer {
 	authorRepo := repository.NewAuthorRepository()
 
 	// Create services
-	bookService := service.NewBookService(bookRepo)
+	bookService := service.NewBookService(bookRepo, nil, nil, nil, service.Options{ImportMode: true})
 
 	// Create handlers
 	bookHandler := handler.NewBookHandler(bookService)
@@ -12,7 +12,7 @@ import (
 // TestAuthorServiceIntegration tests the author service with a real repository.
 func TestAuthorServiceIntegration(t *testing.T) {
 	repo := repository.NewAuthorRepository()
-	svc := service.NewAuthorService(repo)
+	svc := service.NewAuthorService(repo, nil, service.Options{ImportMode: true})
 
 	t.Run("full CRUD lifecycle", func(t *testing.T) {
 		// Create
@@ -79,7 +79,7 @@ func TestAuthorServiceIntegration(t *testing.T) {
 
 func TestAuthorServiceIntegration_MultipleAuthors(t *testing.T) {
 	repo := repository.NewAuthorRepository()
-	svc := service.NewAuthorService(repo)
+	svc := service.NewAuthorService(repo, nil, service.Options{ImportMode: true})
 
 	// Create multiple authors from different countries
 	authors := []*model.Author{
@@ -146,7 +146,7 @@ func TestAuthorServiceIntegration_MultipleAuthors(t *testing.T) {
 
 func TestAuthorServiceIntegration_ValidationErrors(t *testing.T) {
 	repo := repository.NewAuthorRepository()
-	svc := service.NewAuthorService(repo)
+	svc := service.NewAuthorService(repo, nil, service.Options{ImportMode: true})
 
 	tests := []struct {
 		name   string
@@ -182,7 +182,7 @@ func TestAuthorServiceIntegration_ValidationErrors(t *testing.T) {
 
 func TestAuthorServiceIntegration_UpdateNonExistent(t *testing.T) {
 	repo := repository.NewAuthorRepository()
-	svc := service.NewAuthorService(repo)
+	svc := service.NewAuthorService(repo, nil, service.Options{ImportMode: true})
 
 	author := &model.Author{
 		ID:   "non-existent",
@@ -197,7 +197,7 @@ func TestAuthorServiceIntegration_UpdateNonExistent(t *testing.T) {
 
 func TestAuthorServiceIntegration_DeleteNonExistent(t *testing.T) {
 	repo := repository.NewAuthorRepository()
-	svc := service.NewAuthorService(repo)
+	svc := service.NewAuthorService(repo, nil, service.Options{ImportMode: true})
 
 	err := svc.DeleteAuthor("non-existent")
 	if err != service.ErrAuthorNotFound {
@@ -207,7 +207,7 @@ func TestAuthorServiceIntegration_DeleteNonExistent(t *testing.T) {
 
 func TestAuthorServiceIntegration_ConcurrentAccess(t *testing.T) {
 	repo := repository.NewAuthorRepository()
-	svc := service.NewAuthorService(repo)
+	svc := service.NewAuthorService(repo, nil, service.Options{ImportMode: true})
 
 	// Create initial author
 	author := &model.Author{
@@ -247,7 +247,7 @@ func TestAuthorServiceIntegration_ConcurrentAccess(t *testing.T) {
 
 func TestAuthorServiceIntegration_TimestampBehavior(t *testing.T) {
 	repo := repository.NewAuthorRepository()
-	svc := service.NewAuthorService(repo)
+	svc := service.NewAuthorService(repo, nil, service.Options{ImportMode: true})
 
 	// Create author
 	author := &model.Author{
@@ -12,7 +12,7 @@ import (
 // TestBookServiceIntegration tests the book service with a real repository.
 func TestBookServiceIntegration(t *testing.T) {
 	repo := repository.NewBookRepository()
-	svc := service.NewBookService(repo)
+	svc := service.NewBookService(repo, nil, nil, nil, service.Options{ImportMode: true})
 
 	t.Run("full CRUD lifecycle", func(t *testing.T) {
 		// Create
@@ -74,7 +74,7 @@ func TestBookServiceIntegration(t *testing.T) {
 
 func TestBookServiceIntegration_MultipleBooks(t *testing.T) {
 	repo := repository.NewBookRepository()
-	svc := service.NewBookService(repo)
+	svc := service.NewBookService(repo, nil, nil, nil, service.Options{ImportMode: true})
 
 	// Create multiple books
 	books := []*model.Book{
@@ -129,7 +129,7 @@ func TestBookServiceIntegration_MultipleBooks(t *testing.T) {
 
 func TestBookServiceIntegration_ISBNUniqueness(t *testing.T) {
 	repo := repository.NewBookRepository()
-	svc := service.NewBookService(repo)
+	svc := service.NewBookService(repo, nil, nil, nil, service.Options{ImportMode: true})
 
 	// Create first book
 	book1 := &model.Book{
@@ -170,7 +170,7 @@ func TestBookServiceIntegration_ISBNUniqueness(t *testing.T) {
 
 func TestBookServiceIntegration_ValidationErrors(t *testing.T) {
 	repo := repository.NewBookRepository()
-	svc := service.NewBookService(repo)
+	svc := service.NewBookService(repo, nil, nil, nil, service.Options{ImportMode: true})
 
 	tests := []struct {
 		name string
@@ -206,7 +206,7 @@ func TestBookServiceIntegration_ValidationErrors(t *testing.T) {
 
 func TestBookServiceIntegration_ConcurrentAccess(t *testing.T) {
 	repo := repository.NewBookRepository()
-	svc := service.NewBookService(repo)
+	svc := service.NewBookService(repo, nil, nil, nil, service.Options{ImportMode: true})
 
 	// Create initial book
 	book := &model.Book{